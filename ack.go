@@ -0,0 +1,414 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AckEvent is an event delivered by an AckConsumer, which is delivered
+// again until it is acknowledged.
+type AckEvent struct {
+	Event
+	// ID identifies the event, it increases with every event received.
+	// The Seq of the event is not set.
+	ID uint64
+	// Attempt is 1 the first time the event is delivered, and
+	// is incremented every time it is delivered again.
+	Attempt int
+
+	c *AckConsumer
+}
+
+// Ack acknowledges the event, so that it is not delivered again. It returns
+// the error saving the checkpoint, if any. Acknowledging an event more than
+// once does nothing.
+func (e AckEvent) Ack() error {
+	return e.c.ack(e.ID)
+}
+
+// AckConsumer delivers the changes to the data at a reference at least
+// once, for consumers that must not lose any of them:
+//
+//    c := firego.NewAckConsumer(fb.Child("orders"))
+//    c.Store = store
+//    if err := c.Start(); err != nil {
+//        log.Fatal(err)
+//    }
+//    for event := range c.Events() {
+//        if err := process(event); err == nil {
+//            event.Ack()
+//        }
+//    }
+//
+// Events not acknowledged within VisibilityTimeout of being delivered are
+// delivered again, so that they may be delivered out of order. Rather than
+// the initial data, the consumer receives put events for the locations
+// changed since the last data it received, whether before the connection
+// was lost or, when Store is set, before a restart: the data received
+// and the events not acknowledged yet are checkpointed into Store after
+// every change, the whole of the data being saved, which suits nodes of
+// moderate size.
+type AckConsumer struct {
+	// VisibilityTimeout is how long a delivered event can go without
+	// being acknowledged before it is delivered again. It defaults
+	// to 30 seconds.
+	VisibilityTimeout time.Duration
+	// Store, if set, is where the checkpoints are saved, for the
+	// events to survive restarts.
+	Store Store
+	// OnError is called when a checkpoint can not be saved or the
+	// connection is lost. Errors are logged if it is nil.
+	OnError func(err error)
+
+	fb     *Firebase
+	events chan AckEvent
+	wake   chan struct{}
+
+	mtx     sync.Mutex
+	state   ackState
+	cancel  context.CancelFunc
+	stopped bool
+	running sync.WaitGroup
+}
+
+// ackState is the checkpoint of an AckConsumer.
+type ackState struct {
+	// Tree is the data received last
+	Tree interface{} `json:"tree"`
+	// Next is the ID of the next event received
+	Next    uint64        `json:"next"`
+	Pending []*ackPending `json:"pending"`
+}
+
+// ackPending is an event not acknowledged yet.
+type ackPending struct {
+	ID      uint64      `json:"id"`
+	Type    EventType   `json:"type"`
+	Path    string      `json:"path"`
+	Data    interface{} `json:"data"`
+	Attempt int         `json:"attempt"`
+
+	// visibleAt is when the event is to be delivered again
+	visibleAt time.Time
+}
+
+// NewAckConsumer creates an AckConsumer for the data at fb.
+func NewAckConsumer(fb *Firebase) *AckConsumer {
+	return &AckConsumer{
+		VisibilityTimeout: 30 * time.Second,
+		fb:                fb,
+		events:            make(chan AckEvent),
+		wake:              make(chan struct{}, 1),
+		state:             ackState{Next: 1},
+	}
+}
+
+// Events returns the channel the events are delivered to, which is
+// closed by Stop.
+func (c *AckConsumer) Events() <-chan AckEvent {
+	return c.events
+}
+
+// Start restores the checkpoint from Store, if any, and starts watching
+// the reference. The events that were not acknowledged before a restart
+// are delivered right away.
+func (c *AckConsumer) Start() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.cancel != nil {
+		// already running
+		return nil
+	}
+	if c.stopped {
+		return errors.New("ack consumer: stopped")
+	}
+
+	if c.Store != nil {
+		data, ok, err := c.Store.Get(c.storeKey())
+		if err != nil {
+			return fmt.Errorf("failed to load checkpoint %w", err)
+		}
+		if ok {
+			var state ackState
+			if err := json.Unmarshal(data, &state); err != nil {
+				return fmt.Errorf("failed to decode checkpoint %w", err)
+			}
+			c.state = state
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	stream := WatchMulti(ctx, c.fb)
+	c.running.Add(1)
+	go func() {
+		defer c.running.Done()
+		c.run(ctx, stream)
+	}()
+	return nil
+}
+
+// Stop stops watching and closes the channel of events. The events that
+// were not acknowledged remain in the checkpoint. The consumer can not be
+// started again.
+func (c *AckConsumer) Stop() {
+	c.mtx.Lock()
+	cancel := c.cancel
+	c.cancel = nil
+	c.stopped = true
+	c.mtx.Unlock()
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	c.running.Wait()
+	close(c.events)
+}
+
+// run receives the events of the stream and delivers
+// the pending events as they become visible.
+func (c *AckConsumer) run(ctx context.Context, stream <-chan RefEvent) {
+	for {
+		next, wait := c.nextVisible()
+		var out chan AckEvent
+		var ready AckEvent
+		if next != nil {
+			out = c.events
+			ready = c.ackEvent(next)
+		}
+		var timer <-chan time.Time
+		if next == nil && wait > 0 {
+			timer = time.After(wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			for range stream {
+				// drain so the watch can shut down
+			}
+			return
+		case out <- ready:
+			c.delivered(next)
+		case event, ok := <-stream:
+			if ok {
+				c.receive(event.Event)
+			}
+		case <-timer:
+		case <-c.wake:
+		}
+	}
+}
+
+// nextVisible returns the pending event to deliver next, if any, or
+// else how long until one becomes visible, 0 meaning none will.
+func (c *AckConsumer) nextVisible() (*ackPending, time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	for _, p := range c.state.Pending {
+		if !p.visibleAt.After(now) {
+			return p, 0
+		}
+		if d := p.visibleAt.Sub(now); wait == 0 || d < wait {
+			wait = d
+		}
+	}
+	return nil, wait
+}
+
+func (c *AckConsumer) ackEvent(p *ackPending) AckEvent {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	raw, _ := marshal(map[string]interface{}{"path": p.Path, "data": p.Data})
+	return AckEvent{
+		Event:   Event{Type: p.Type, Path: p.Path, Data: p.Data, rawData: raw},
+		ID:      p.ID,
+		Attempt: p.Attempt + 1,
+		c:       c,
+	}
+}
+
+// delivered hides the event until its visibility timeout.
+func (c *AckConsumer) delivered(p *ackPending) {
+	c.mtx.Lock()
+	p.Attempt++
+	p.visibleAt = time.Now().Add(c.VisibilityTimeout)
+	err := c.save()
+	c.mtx.Unlock()
+	if err != nil {
+		c.handleError(err)
+	}
+}
+
+// receive makes the event pending, the initial data of a stream
+// being turned into put events for the locations that changed.
+func (c *AckConsumer) receive(event Event) {
+	var changes []Event
+	switch event.Type {
+	case EventTypePut, EventTypePatch:
+		if event.Seq == 1 {
+			diffTrees(nil, c.state.Tree, event.Data, &changes)
+		} else {
+			changes = append(changes, event)
+		}
+	default:
+		if err := eventError(event); err != nil {
+			c.handleError(err)
+		}
+		return
+	}
+
+	c.mtx.Lock()
+	c.state.Tree = applyEvent(c.state.Tree, event)
+	for _, change := range changes {
+		c.state.Pending = append(c.state.Pending, &ackPending{
+			ID:   c.state.Next,
+			Type: change.Type,
+			Path: change.Path,
+			Data: change.Data,
+		})
+		c.state.Next++
+	}
+	err := c.save()
+	c.mtx.Unlock()
+	if err != nil {
+		c.handleError(err)
+	}
+}
+
+func (c *AckConsumer) ack(id uint64) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	i := sort.Search(len(c.state.Pending), func(i int) bool {
+		return c.state.Pending[i].ID >= id
+	})
+	if i == len(c.state.Pending) || c.state.Pending[i].ID != id {
+		return nil
+	}
+	c.state.Pending = append(c.state.Pending[:i], c.state.Pending[i+1:]...)
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return c.save()
+}
+
+// save checkpoints the state into Store. It must be
+// called with the consumer's mutex held.
+func (c *AckConsumer) save() error {
+	if c.Store == nil {
+		return nil
+	}
+	data, err := json.Marshal(c.state)
+	if err == nil {
+		err = c.Store.Set(c.storeKey(), data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint %w", err)
+	}
+	return nil
+}
+
+// storeKey is the key the checkpoint is saved under.
+func (c *AckConsumer) storeKey() string {
+	return "ackconsumer:" + c.fb.url
+}
+
+func (c *AckConsumer) handleError(err error) {
+	if c.OnError != nil {
+		c.OnError(err)
+		return
+	}
+	log.Printf("AckConsumer: %s", err)
+}
+
+// diffTrees appends to changes a put event for every location, as high
+// as possible, where the data after differs from the data before.
+func diffTrees(path []string, before, after interface{}, changes *[]Event) {
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+	b, bok := before.(map[string]interface{})
+	a, aok := after.(map[string]interface{})
+	if !bok || !aok {
+		*changes = append(*changes, Event{Type: EventTypePut, Path: "/" + strings.Join(path, "/"), Data: after})
+		return
+	}
+	for _, k := range unionKeys(b, a) {
+		diffTrees(append(path[:len(path):len(path)], k), b[k], a[k], changes)
+	}
+}
+
+// ProcessFunc processes an event delivered by an AckConsumer.
+type ProcessFunc func(event AckEvent) error
+
+// ProcessOnce calls fn with the events delivered by the consumer, until
+// Stop is called, acknowledging those it processes successfully. Events
+// are not processed again once fn succeeded, even when the process dies
+// before acknowledging them: a record keyed by the ID and a hash of the
+// path and data of the event is saved into Store before acknowledging it
+// and removed once it is acknowledged, the event being acknowledged
+// without calling fn if it is delivered again in the meantime. Events for
+// which fn fails are delivered again after VisibilityTimeout.
+//
+// Side effects of fn are only repeated if the process dies between fn
+// returning and the record being saved. It requires Store to be set.
+func (c *AckConsumer) ProcessOnce(fn ProcessFunc) error {
+	if c.Store == nil {
+		return errors.New("ack consumer: no store")
+	}
+
+	for event := range c.Events() {
+		key, err := c.dedupKey(event)
+		if err != nil {
+			c.handleError(err)
+			continue
+		}
+		_, done, err := c.Store.Get(key)
+		if err != nil {
+			c.handleError(fmt.Errorf("failed to read dedup record %w", err))
+			continue
+		}
+
+		if !done {
+			if err := fn(event); err != nil {
+				continue
+			}
+			if err := c.Store.Set(key, []byte("1")); err != nil {
+				c.handleError(fmt.Errorf("failed to save dedup record %w", err))
+				continue
+			}
+		}
+		if err := event.Ack(); err != nil {
+			c.handleError(err)
+			continue
+		}
+		if err := c.Store.Delete(key); err != nil {
+			c.handleError(fmt.Errorf("failed to delete dedup record %w", err))
+		}
+	}
+	return nil
+}
+
+// dedupKey returns the key of the record telling that event was processed.
+func (c *AckConsumer) dedupKey(event AckEvent) (string, error) {
+	hash, err := ContentHash(event.rawData)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("dedup:%s:%d:%s", c.fb.url, event.ID, hash), nil
+}
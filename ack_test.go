@@ -0,0 +1,170 @@
+package firego
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func nextAckEvent(t *testing.T, c *AckConsumer) AckEvent {
+	select {
+	case event, ok := <-c.Events():
+		require.True(t, ok, "channel closed")
+		return event
+	case <-time.After(2 * time.Second):
+		require.FailNow(t, "no event received")
+	}
+	return AckEvent{}
+}
+
+func TestAckConsumer(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("orders/1", "new")
+
+	c := NewAckConsumer(New(server.URL, nil).Child("orders"))
+	c.VisibilityTimeout = 100 * time.Millisecond
+	require.NoError(t, c.Start())
+	defer c.Stop()
+
+	event := nextAckEvent(t, c)
+	assert.Equal(t, uint64(1), event.ID)
+	assert.Equal(t, 1, event.Attempt)
+	assert.Equal(t, "/", event.Path)
+	assert.Equal(t, map[string]interface{}{"1": "new"}, event.Data)
+	require.NoError(t, event.Ack())
+
+	server.Set("orders/2", "new")
+	event = nextAckEvent(t, c)
+	assert.Equal(t, uint64(2), event.ID)
+	assert.Equal(t, "/2", event.Path)
+	var v string
+	require.NoError(t, event.Value(&v))
+	assert.Equal(t, "new", v)
+
+	// not acknowledged, delivered again
+	start := time.Now()
+	event = nextAckEvent(t, c)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	assert.Equal(t, uint64(2), event.ID)
+	assert.Equal(t, 2, event.Attempt)
+	require.NoError(t, event.Ack())
+	require.NoError(t, event.Ack())
+
+	select {
+	case event := <-c.Events():
+		t.Fatalf("unexpected event %v", event)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestAckConsumerCheckpoint(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("orders", map[string]interface{}{"1": "new", "2": "new"})
+
+	store := NewMemoryStore()
+	fb := New(server.URL, nil).Child("orders")
+	c := NewAckConsumer(fb)
+	c.Store = store
+	require.NoError(t, c.Start())
+	require.NoError(t, nextAckEvent(t, c).Ack())
+	server.Set("orders/3", "new")
+	unacked := nextAckEvent(t, c)
+	assert.Equal(t, "/3", unacked.Path)
+	c.Stop()
+	_, ok := <-c.Events()
+	assert.False(t, ok)
+	assert.Error(t, c.Start())
+
+	// changes made while stopped are not lost
+	server.Set("orders/1", "shipped")
+	server.Delete("orders/2")
+
+	c = NewAckConsumer(fb)
+	c.Store = store
+	require.NoError(t, c.Start())
+	defer c.Stop()
+
+	event := nextAckEvent(t, c)
+	assert.Equal(t, unacked.ID, event.ID)
+	assert.Equal(t, 2, event.Attempt)
+	require.NoError(t, event.Ack())
+
+	got := map[string]interface{}{}
+	for len(got) < 2 {
+		event = nextAckEvent(t, c)
+		assert.Equal(t, EventTypePut, event.Type)
+		got[event.Path] = event.Data
+		require.NoError(t, event.Ack())
+	}
+	assert.Equal(t, map[string]interface{}{"/1": "shipped", "/2": nil}, got)
+}
+
+func TestAckConsumerProcessOnce(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("orders/1", "new")
+
+	store := NewMemoryStore()
+	fb := New(server.URL, nil).Child("orders")
+	c := NewAckConsumer(fb)
+	assert.Error(t, c.ProcessOnce(nil))
+	c.Store = store
+	require.NoError(t, c.Start())
+
+	// the process dies after processing the event, before acknowledging it
+	event := nextAckEvent(t, c)
+	key, err := c.dedupKey(event)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(key, []byte("1")))
+	c.Stop()
+
+	c = NewAckConsumer(fb)
+	c.Store = store
+	c.VisibilityTimeout = 50 * time.Millisecond
+	require.NoError(t, c.Start())
+
+	processed := make(chan AckEvent, 10)
+	failures := 1
+	done := make(chan error)
+	go func() {
+		done <- c.ProcessOnce(func(event AckEvent) error {
+			if failures > 0 {
+				failures--
+				return assert.AnError
+			}
+			processed <- event
+			return nil
+		})
+	}()
+
+	server.Set("orders/2", "new")
+	select {
+	case event := <-processed:
+		assert.Equal(t, "/2", event.Path)
+		assert.Equal(t, 2, event.Attempt)
+	case <-time.After(2 * time.Second):
+		t.Fatal("event was not processed")
+	}
+
+	c.Stop()
+	require.NoError(t, <-done)
+	assert.Empty(t, processed)
+
+	// nothing is left to deliver nor dedup records
+	var keys []string
+	store.Iterate(func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	assert.Equal(t, []string{"ackconsumer:" + fb.url}, keys)
+	data, _, _ := store.Get("ackconsumer:" + fb.url)
+	assert.Contains(t, string(data), `"pending":[]`)
+}
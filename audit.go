@@ -0,0 +1,223 @@
+package firego
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditEntry describes a mutation applied by Firebase.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Method is the HTTP method of the mutation: PUT, PATCH, POST or DELETE.
+	Method string `json:"method"`
+	// Path is the location mutated, e.g. "/users/alice".
+	Path string `json:"path"`
+	// PayloadHash is the SHA-256 hash, hex encoded, of the request body.
+	// It is empty for requests without one.
+	PayloadHash string `json:"payloadHash,omitempty"`
+	// Identity is the uid, or subject, of the token the request was
+	// authenticated with. It is empty for unauthenticated requests and
+	// tokens that are not JWTs, such as database secrets.
+	Identity string `json:"identity,omitempty"`
+}
+
+// AuditSink receives the mutations applied through the references it is
+// set on. Audit is called synchronously, once the mutation succeeded, and
+// must be safe for concurrent use.
+type AuditSink interface {
+	Audit(entry AuditEntry)
+}
+
+// AuditSinkFunc is an adapter to allow the use of ordinary
+// functions as an AuditSink.
+type AuditSinkFunc func(entry AuditEntry)
+
+// Audit calls f(entry).
+func (f AuditSinkFunc) Audit(entry AuditEntry) {
+	f(entry)
+}
+
+// AuditTo sends every successful mutation made through the reference, and
+// the references derived from it afterwards, to sink. Mutations that fail
+// are not recorded, nor are those applied by Firebase although the request
+// timed out.
+func (fb *Firebase) AuditTo(sink AuditSink) {
+	fb.audit = sink
+}
+
+// auditEntry returns the entry recording the given successful request.
+func auditEntry(req *http.Request, body []byte) AuditEntry {
+	entry := AuditEntry{
+		Time:     time.Now(),
+		Method:   req.Method,
+		Path:     "/" + strings.Trim(strings.TrimSuffix(req.URL.Path, ".json"), "/"),
+		Identity: tokenIdentity(requestToken(req)),
+	}
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		entry.PayloadHash = hex.EncodeToString(sum[:])
+	}
+	return entry
+}
+
+// requestToken returns the token a request is authenticated with,
+// whatever the AuthStyle.
+func requestToken(req *http.Request) string {
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	query := req.URL.Query()
+	if token := query.Get(authParam); token != "" {
+		return token
+	}
+	return query.Get(accessTokenParam)
+}
+
+// tokenIdentity returns the uid carried by the claims of a token, be it
+// a Firebase custom token, legacy token or ID token.
+func tokenIdentity(token string) string {
+	var claims struct {
+		UID    string `json:"uid"`
+		UserID string `json:"user_id"`
+		Sub    string `json:"sub"`
+		D      struct {
+			UID string `json:"uid"`
+		} `json:"d"`
+	}
+	if token == "" || decodeClaims(token, &claims) != nil {
+		return ""
+	}
+	for _, id := range []string{claims.UID, claims.UserID, claims.D.UID, claims.Sub} {
+		if id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// AuditLog is an AuditSink writing entries to w as lines of JSON. Every
+// line carries the hash of the previous one, so that VerifyAuditLog
+// detects lines that were modified, removed or reordered.
+type AuditLog struct {
+	// OnError is called when an entry cannot be written.
+	// Errors are logged if it is nil.
+	OnError func(err error)
+
+	mtx  sync.Mutex
+	w    io.Writer
+	prev string
+}
+
+// auditLine is a line of an AuditLog.
+type auditLine struct {
+	AuditEntry
+	Prev string `json:"prev"`
+	Hash string `json:"hash"`
+}
+
+// NewAuditLog creates an AuditLog writing to w, starting a new chain.
+// Use ResumeAuditLog to add entries to an existing log.
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{w: w}
+}
+
+// ResumeAuditLog creates an AuditLog continuing the chain of the log read
+// from r, e.g. after a restart, which is verified first, writing the new
+// entries to w:
+//
+//    f, err := os.OpenFile("audit.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+//    if err != nil {
+//        log.Fatal(err)
+//    }
+//    l, err := firego.ResumeAuditLog(f, f)
+//    if err != nil {
+//        log.Fatal(err)
+//    }
+//    fb.AuditTo(l)
+func ResumeAuditLog(r io.Reader, w io.Writer) (*AuditLog, error) {
+	_, prev, err := verifyAuditLog(r)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{w: w, prev: prev}, nil
+}
+
+// Audit implements AuditSink.
+func (l *AuditLog) Audit(entry AuditEntry) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	line := auditLine{AuditEntry: entry, Prev: l.prev}
+	hash, err := line.hash()
+	if err == nil {
+		line.Hash = hash
+		var data []byte
+		if data, err = json.Marshal(line); err == nil {
+			_, err = l.w.Write(append(data, '\n'))
+		}
+	}
+	if err != nil {
+		if l.OnError != nil {
+			l.OnError(err)
+		} else {
+			log.Printf("AuditLog: failed to write entry %s", err)
+		}
+		return
+	}
+	l.prev = hash
+}
+
+// hash returns the hash of the line, which covers its entry
+// and the hash of the previous line.
+func (l auditLine) hash() (string, error) {
+	data, err := json.Marshal(l.AuditEntry)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(l.Prev), data...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// VerifyAuditLog checks the chain of hashes of the lines written by an
+// AuditLog and returns the entries read. The error names the first line
+// that does not follow from the previous one.
+func VerifyAuditLog(r io.Reader) ([]AuditEntry, error) {
+	entries, _, err := verifyAuditLog(r)
+	return entries, err
+}
+
+// verifyAuditLog is VerifyAuditLog, also returning
+// the hash of the last line.
+func verifyAuditLog(r io.Reader) ([]AuditEntry, string, error) {
+	var (
+		entries []AuditEntry
+		prev    string
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		var line auditLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return entries, "", fmt.Errorf("failed to unmarshal audit line %d %w", n, err)
+		}
+		hash, err := line.hash()
+		if err != nil {
+			return entries, "", err
+		}
+		if line.Prev != prev || line.Hash != hash {
+			return entries, "", fmt.Errorf("audit line %d was tampered with", n)
+		}
+		entries = append(entries, line.AuditEntry)
+		prev = hash
+	}
+	return entries, prev, scanner.Err()
+}
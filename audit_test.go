@@ -0,0 +1,136 @@
+package firego
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestAuditTo(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	var (
+		mtx     sync.Mutex
+		entries []AuditEntry
+	)
+	fb := New(server.URL, nil)
+	fb.Auth(testJWT(`{"uid":"alice"}`))
+	fb.AuditTo(AuditSinkFunc(func(entry AuditEntry) {
+		mtx.Lock()
+		entries = append(entries, entry)
+		mtx.Unlock()
+	}))
+
+	users := fb.Child("users")
+	require.NoError(t, users.Child("bob").Set("hi"))
+	require.NoError(t, users.Update(map[string]string{"carol": "hey"}))
+	require.NoError(t, users.Child("bob").Remove())
+	var v interface{}
+	require.NoError(t, users.Value(&v))
+
+	require.Len(t, entries, 3)
+	sum := sha256.Sum256([]byte(`"hi"`))
+	assert.Equal(t, "PUT", entries[0].Method)
+	assert.Equal(t, "/users/bob", entries[0].Path)
+	assert.Equal(t, hex.EncodeToString(sum[:]), entries[0].PayloadHash)
+	assert.Equal(t, "alice", entries[0].Identity)
+	assert.False(t, entries[0].Time.IsZero())
+	assert.Equal(t, "PATCH", entries[1].Method)
+	assert.Equal(t, "/users", entries[1].Path)
+	assert.Equal(t, "DELETE", entries[2].Method)
+	assert.Empty(t, entries[2].PayloadHash)
+
+	// failed mutations are not recorded
+	server.RequireAuth(true)
+	fb.Unauth()
+	assert.Error(t, users.Set("nope"))
+	assert.Len(t, entries, 3)
+}
+
+func TestTokenIdentity(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "1", tokenIdentity(testJWT(`{"uid":"1"}`)))
+	assert.Equal(t, "2", tokenIdentity(testJWT(`{"d":{"uid":"2"}}`)))
+	assert.Equal(t, "3", tokenIdentity(testJWT(`{"sub":"3","user_id":"3"}`)))
+	assert.Equal(t, "", tokenIdentity("database-secret"))
+	assert.Equal(t, "", tokenIdentity(""))
+}
+
+func TestAuditLog(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	l := NewAuditLog(&buf)
+	l.Audit(AuditEntry{Method: "PUT", Path: "/a", Identity: "alice"})
+	l.Audit(AuditEntry{Method: "DELETE", Path: "/b"})
+	l.Audit(AuditEntry{Method: "PATCH", Path: "/c"})
+
+	entries, err := VerifyAuditLog(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "/a", entries[0].Path)
+	assert.Equal(t, "alice", entries[0].Identity)
+
+	lines := strings.SplitAfter(buf.String(), "\n")
+
+	// modified
+	modified := strings.Replace(buf.String(), `"/b"`, `"/x"`, 1)
+	entries, err = VerifyAuditLog(strings.NewReader(modified))
+	assert.EqualError(t, err, "audit line 2 was tampered with")
+	assert.Len(t, entries, 1)
+
+	// removed
+	_, err = VerifyAuditLog(strings.NewReader(lines[0] + lines[2]))
+	assert.EqualError(t, err, "audit line 2 was tampered with")
+
+	// reordered
+	_, err = VerifyAuditLog(strings.NewReader(lines[1] + lines[0]))
+	assert.EqualError(t, err, "audit line 1 was tampered with")
+}
+
+func TestResumeAuditLog(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	open := func() (*os.File, *AuditLog) {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+		require.NoError(t, err)
+		l, err := ResumeAuditLog(f, f)
+		require.NoError(t, err)
+		return f, l
+	}
+
+	// the log is reopened after every entry, as if the process restarted
+	for _, p := range []string{"/a", "/b", "/c"} {
+		f, l := open()
+		l.Audit(AuditEntry{Method: "PUT", Path: p})
+		require.NoError(t, f.Close())
+	}
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	entries, err := VerifyAuditLog(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "/c", entries[2].Path)
+
+	// a log that was tampered with is not resumed
+	modified := strings.Replace(string(data), `"/b"`, `"/x"`, 1)
+	_, err = ResumeAuditLog(strings.NewReader(modified), ioutil.Discard)
+	assert.EqualError(t, err, "audit line 2 was tampered with")
+}
@@ -0,0 +1,151 @@
+package benchmarks
+
+import (
+	"context"
+	"flag"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/zabawaba99/firego"
+	"github.com/zabawaba99/firego/firetest"
+	"github.com/zabawaba99/firego/loadtest"
+)
+
+var target = flag.String("target", "", "URL of the database to run against instead of firetest")
+
+type user struct {
+	Name    string          `firebase:"name"`
+	Email   string          `firebase:"email"`
+	Age     int             `firebase:"age"`
+	Tags    []string        `firebase:"tags"`
+	Friends map[string]bool `firebase:"friends"`
+}
+
+var testUser = user{
+	Name:    "Alice",
+	Email:   "alice@example.com",
+	Age:     30,
+	Tags:    []string{"admin", "beta"},
+	Friends: map[string]bool{"bob": true, "carol": true},
+}
+
+// reference returns a reference to /benchmarks/name on the target,
+// along with a function releasing it.
+func reference(name string) (*firego.Firebase, func()) {
+	if *target != "" {
+		return firego.New(*target, nil).Child("benchmarks/" + name), func() {}
+	}
+	server := firetest.New()
+	server.Start()
+	return firego.New(server.URL, nil).Child("benchmarks/" + name), server.Close
+}
+
+func BenchmarkSet(b *testing.B) {
+	fb, done := reference("set")
+	defer done()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := fb.Set(testUser); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	fb, done := reference("update")
+	defer done()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := fb.Update(map[string]interface{}{"age": i, "name": "Alice"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPush(b *testing.B) {
+	fb, done := reference("push")
+	defer done()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := fb.Push(testUser); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkValue(b *testing.B) {
+	for _, n := range []int{1, 100} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			fb, done := reference("value" + strconv.Itoa(n))
+			defer done()
+			users := map[string]user{}
+			for i := 0; i < n; i++ {
+				users[strconv.Itoa(i)] = testUser
+			}
+			if err := fb.Set(users); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var v map[string]user
+				if err := fb.Value(&v); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkWatch measures the time it takes for a write to be received
+// by a stream watching it.
+func BenchmarkWatch(b *testing.B) {
+	fb, done := reference("watch")
+	defer done()
+	if err := fb.Set(0); err != nil {
+		b.Fatal(err)
+	}
+	events := make(chan firego.Event)
+	if err := fb.Watch(events); err != nil {
+		b.Fatal(err)
+	}
+	defer fb.StopWatching()
+	<-events
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := fb.Set(i + 1); err != nil {
+			b.Fatal(err)
+		}
+		select {
+		case <-events:
+		case <-time.After(5 * time.Second):
+			b.Fatal("no event received")
+		}
+	}
+}
+
+// BenchmarkMix runs b.N operations of a read heavy mix with loadtest
+// and reports their latency percentiles.
+func BenchmarkMix(b *testing.B) {
+	fb, done := reference("mix")
+	defer done()
+	b.ResetTimer()
+	report, err := loadtest.Run(context.Background(), fb, loadtest.Config{
+		Mix:        loadtest.Mix{Reads: 8, Writes: 2, Streams: 1},
+		Workers:    10,
+		Operations: b.N,
+		Keys:       50,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(report.Reads.P99.Microseconds()), "read-p99-µs")
+	b.ReportMetric(float64(report.Writes.P99.Microseconds()), "write-p99-µs")
+}
@@ -0,0 +1,15 @@
+/*
+Package benchmarks holds the benchmarks of the firego client, run against
+the fake server of firetest by default:
+
+    go test -bench . ./benchmarks
+
+Set -target to the URL of a database, such as the emulator, to run them
+against it instead; the data under /benchmarks is overwritten:
+
+    go test -bench . ./benchmarks -target http://localhost:9000
+
+The benchmarks run the client end to end, over HTTP, so that regressions
+of the encoding, decoding and transport layers show up alike.
+*/
+package benchmarks
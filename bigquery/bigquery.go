@@ -0,0 +1,321 @@
+/*
+Package bigquery exports the children of a Firebase node as the rows of a
+BigQuery table through the insertAll streaming API, for scheduled
+analytics dumps.
+
+The client authenticates with the same firego.TokenSource used for the
+database, which must provide OAuth2 access tokens with the
+https://www.googleapis.com/auth/bigquery scope:
+
+    bq := bigquery.New("my-project", tr, nil)
+    n, err := bq.Export(ctx, fb.Child("orders"), "analytics", "orders", bigquery.ExportOptions{
+        CreateTable: true,
+    })
+
+Every child is a row holding its key, in the "key" column by default, and
+its fields converted to the schema of the table, which is inferred from
+the first children read unless one is given.
+*/
+package bigquery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/zabawaba99/firego"
+)
+
+// DefaultEndpoint is the base URL of the BigQuery API.
+const DefaultEndpoint = "https://bigquery.googleapis.com"
+
+// Error is returned when BigQuery rejects a request.
+type Error struct {
+	// Code is the HTTP status code of the response.
+	Code    int    `json:"code"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("bigquery: %s (%d): %s", e.Status, e.Code, e.Message)
+}
+
+// RowError describes why a row was not inserted.
+type RowError struct {
+	// Key is the key of the child the row was made from.
+	Key    string
+	Reason string
+	// Location is the field the error is about, if any.
+	Location string
+	Message  string
+}
+
+// InsertError is returned when BigQuery rejects some of the rows inserted.
+type InsertError struct {
+	Rows []RowError
+}
+
+func (e *InsertError) Error() string {
+	first := e.Rows[0]
+	return fmt.Sprintf("bigquery: %d rows not inserted, %s: %s", len(e.Rows), first.Key, first.Message)
+}
+
+// Client exports data to the tables of a Google Cloud project.
+type Client struct {
+	// Endpoint is the base URL of the BigQuery API, DefaultEndpoint by default.
+	Endpoint string
+
+	projectID string
+	tokens    firego.TokenSource
+	client    *http.Client
+}
+
+// New creates a Client for the given project authenticated with tokens.
+// If client is nil, http.DefaultClient is used.
+func New(projectID string, tokens firego.TokenSource, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{
+		Endpoint:  DefaultEndpoint,
+		projectID: projectID,
+		tokens:    tokens,
+		client:    client,
+	}
+}
+
+// ExportOptions configures Export.
+type ExportOptions struct {
+	// Schema is the schema of the table, without the key column. It is
+	// inferred from the first chunk of children if nil.
+	Schema Schema
+	// KeyColumn is the name of the column holding the keys of the
+	// children. It defaults to "key".
+	KeyColumn string
+	// ChunkSize is the number of children read, and rows inserted, at a
+	// time. It defaults to 500, the batch size BigQuery recommends.
+	ChunkSize int
+	// CreateTable creates the table with the schema if it does not exist.
+	CreateTable bool
+	// SkipInvalidRows inserts the valid rows of a chunk even if some
+	// of them are rejected, which are reported by the error returned.
+	SkipInvalidRows bool
+}
+
+// Export inserts a row in the table for every child of fb, reading the
+// children ChunkSize at a time in key order, and returns the number of
+// rows inserted. The keys of the children are used as the insert IDs of
+// the rows, which lets BigQuery drop the rows inserted again when an
+// export is retried shortly after failing.
+func (c *Client) Export(ctx context.Context, fb *firego.Firebase, dataset, table string, opts ExportOptions) (int, error) {
+	if opts.KeyColumn == "" {
+		opts.KeyColumn = "key"
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = 500
+	}
+
+	ref := fb.WithContext(ctx).OrderBy("$key")
+	schema := opts.Schema
+	var (
+		rows  int
+		after string
+	)
+	for {
+		limit := opts.ChunkSize
+		if after != "" {
+			// startAt includes the last child inserted, skipped below
+			limit++
+		}
+		var v interface{}
+		if err := ref.StartAtValue(after).LimitToFirst(int64(limit)).Value(&v); err != nil {
+			return rows, err
+		}
+		children := childrenOf(v)
+		delete(children, after)
+		if len(children) == 0 {
+			return rows, nil
+		}
+
+		if schema == nil {
+			schema = InferSchema(children)
+			if opts.CreateTable {
+				full := append(Schema{{Name: opts.KeyColumn, Type: TypeString, Mode: ModeRequired}}, schema...)
+				if err := c.createTable(ctx, dataset, table, full); err != nil {
+					return rows, err
+				}
+			}
+		}
+
+		keys := make([]string, 0, len(children))
+		for k := range children {
+			keys = append(keys, k)
+		}
+		firego.SortKeys(keys)
+
+		n, err := c.insert(ctx, dataset, table, keys, children, schema, opts)
+		rows += n
+		if err != nil {
+			return rows, err
+		}
+		if len(keys) < opts.ChunkSize {
+			return rows, nil
+		}
+		after = keys[len(keys)-1]
+	}
+}
+
+// childrenOf returns the children of v, a node read from Firebase, which
+// sends the nodes whose keys are mostly sequential integers as arrays,
+// the missing keys being null.
+func childrenOf(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return v
+	case []interface{}:
+		children := make(map[string]interface{}, len(v))
+		for i, child := range v {
+			if child != nil {
+				children[strconv.Itoa(i)] = child
+			}
+		}
+		return children
+	}
+	return nil
+}
+
+// insert inserts the rows of the children with the given keys and
+// returns the number of rows inserted.
+func (c *Client) insert(ctx context.Context, dataset, table string, keys []string, children map[string]interface{}, schema Schema, opts ExportOptions) (int, error) {
+	type insertRow struct {
+		InsertID string                 `json:"insertId"`
+		JSON     map[string]interface{} `json:"json"`
+	}
+	req := struct {
+		Kind            string      `json:"kind"`
+		SkipInvalidRows bool        `json:"skipInvalidRows,omitempty"`
+		Rows            []insertRow `json:"rows"`
+	}{Kind: "bigquery#tableDataInsertAllRequest", SkipInvalidRows: opts.SkipInvalidRows}
+
+	for _, key := range keys {
+		row, err := schema.row(children[key])
+		if err != nil {
+			return 0, fmt.Errorf("bigquery: failed to convert %s. %w", key, err)
+		}
+		row[opts.KeyColumn] = key
+		req.Rows = append(req.Rows, insertRow{InsertID: key, JSON: row})
+	}
+
+	var resp struct {
+		InsertErrors []struct {
+			Index  int `json:"index"`
+			Errors []struct {
+				Reason   string `json:"reason"`
+				Location string `json:"location"`
+				Message  string `json:"message"`
+			} `json:"errors"`
+		} `json:"insertErrors"`
+	}
+	path := fmt.Sprintf("datasets/%s/tables/%s/insertAll", dataset, table)
+	if err := c.do(ctx, path, req, &resp); err != nil {
+		return 0, err
+	}
+	if len(resp.InsertErrors) == 0 {
+		return len(keys), nil
+	}
+
+	e := &InsertError{}
+	rejected := map[int]bool{}
+	for _, ie := range resp.InsertErrors {
+		if ie.Index < 0 || ie.Index >= len(keys) {
+			continue
+		}
+		for _, re := range ie.Errors {
+			// without skipInvalidRows, valid rows are reported as stopped
+			if re.Reason == "stopped" {
+				continue
+			}
+			rejected[ie.Index] = true
+			e.Rows = append(e.Rows, RowError{Key: keys[ie.Index], Reason: re.Reason, Location: re.Location, Message: re.Message})
+		}
+	}
+	if len(e.Rows) == 0 {
+		e.Rows = append(e.Rows, RowError{Key: keys[0], Reason: "stopped", Message: "rows were not inserted"})
+	}
+	if !opts.SkipInvalidRows {
+		return 0, e
+	}
+	return len(keys) - len(rejected), e
+}
+
+// createTable creates a table with the given schema,
+// unless it already exists.
+func (c *Client) createTable(ctx context.Context, dataset, table string, schema Schema) error {
+	req := map[string]interface{}{
+		"tableReference": map[string]string{
+			"projectId": c.projectID,
+			"datasetId": dataset,
+			"tableId":   table,
+		},
+		"schema": map[string]interface{}{"fields": schema},
+	}
+	err := c.do(ctx, fmt.Sprintf("datasets/%s/tables", dataset), req, nil)
+	if e, ok := err.(*Error); ok && e.Code == http.StatusConflict {
+		return nil
+	}
+	return err
+}
+
+// do posts body to the given path of the project and
+// decodes the response into out, unless it is nil.
+func (c *Client) do(ctx context.Context, path string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	token, err := c.tokens.Token()
+	if err != nil {
+		return fmt.Errorf("failed to get token %w", err)
+	}
+
+	url := fmt.Sprintf("%s/bigquery/v2/projects/%s/%s", strings.TrimSuffix(c.Endpoint, "/"), c.projectID, path)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Error *Error `json:"error"`
+		}
+		if err := json.Unmarshal(respBody, &e); err != nil || e.Error == nil {
+			return &Error{Code: resp.StatusCode, Status: resp.Status, Message: string(respBody)}
+		}
+		return e.Error
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
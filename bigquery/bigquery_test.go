@@ -0,0 +1,193 @@
+package bigquery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+var tokens = firego.TokenSourceFunc(func() (string, error) {
+	return "access-token", nil
+})
+
+// fakeBigQuery records the tables created and the rows inserted.
+type fakeBigQuery struct {
+	mtx     sync.Mutex
+	tables  []map[string]interface{}
+	inserts [][]map[string]interface{}
+	reject  string
+}
+
+func (f *fakeBigQuery) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if req.Header.Get("Authorization") != "Bearer access-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var body map[string]interface{}
+	json.NewDecoder(req.Body).Decode(&body)
+	switch {
+	case req.URL.Path == "/bigquery/v2/projects/my-project/datasets/analytics/tables":
+		if len(f.tables) > 0 {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"error":{"code":409,"status":"ALREADY_EXISTS","message":"Already Exists"}}`)
+			return
+		}
+		f.tables = append(f.tables, body)
+		fmt.Fprint(w, `{}`)
+	case strings.HasSuffix(req.URL.Path, "/datasets/analytics/tables/users/insertAll"):
+		var rows []map[string]interface{}
+		var errs []string
+		for i, r := range body["rows"].([]interface{}) {
+			row := r.(map[string]interface{})
+			rows = append(rows, row)
+			if row["insertId"] == f.reject {
+				errs = append(errs, fmt.Sprintf(`{"index":%d,"errors":[{"reason":"invalid","location":"age","message":"bad age"}]}`, i))
+			}
+		}
+		f.inserts = append(f.inserts, rows)
+		fmt.Fprintf(w, `{"insertErrors":[%s]}`, strings.Join(errs, ","))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// exportServer starts a server holding the given number of users.
+func exportServer(users int) *firetest.Firetest {
+	server := firetest.New()
+	server.Start()
+	for i := 1; i <= users; i++ {
+		server.Set(fmt.Sprintf("users/u%02d", i), map[string]interface{}{
+			"name": fmt.Sprintf("user %d", i),
+			"age":  float64(20 + i),
+		})
+	}
+	return server
+}
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+	fbServer := exportServer(5)
+	defer fbServer.Close()
+	fb := firego.New(fbServer.URL, nil).Child("users")
+	bq := &fakeBigQuery{}
+	server := httptest.NewServer(bq)
+	defer server.Close()
+
+	c := New("my-project", tokens, nil)
+	c.Endpoint = server.URL
+	n, err := c.Export(context.Background(), fb, "analytics", "users", ExportOptions{
+		ChunkSize:   2,
+		CreateTable: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	require.Len(t, bq.tables, 1)
+	assert.Equal(t, map[string]interface{}{
+		"tableReference": map[string]interface{}{"projectId": "my-project", "datasetId": "analytics", "tableId": "users"},
+		"schema": map[string]interface{}{"fields": []interface{}{
+			map[string]interface{}{"name": "key", "type": "STRING", "mode": "REQUIRED"},
+			map[string]interface{}{"name": "age", "type": "INTEGER"},
+			map[string]interface{}{"name": "name", "type": "STRING"},
+		}},
+	}, bq.tables[0])
+
+	require.Len(t, bq.inserts, 3)
+	assert.Equal(t, map[string]interface{}{
+		"insertId": "u01",
+		"json":     map[string]interface{}{"key": "u01", "name": "user 1", "age": "21"},
+	}, bq.inserts[0][0])
+	var keys []string
+	for _, rows := range bq.inserts {
+		for _, row := range rows {
+			keys = append(keys, row["insertId"].(string))
+		}
+	}
+	assert.Equal(t, []string{"u01", "u02", "u03", "u04", "u05"}, keys)
+}
+
+func TestExportArray(t *testing.T) {
+	t.Parallel()
+	// Firebase sends nodes with sequential integer keys as arrays,
+	// starting at index 0 whatever the first key read
+	fbServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start, _ := strconv.Atoi(strings.Trim(req.URL.Query().Get("startAt"), `"`))
+		limit, _ := strconv.Atoi(req.URL.Query().Get("limitToFirst"))
+		users := make([]interface{}, start)
+		for i := start; i < 3 && i < start+limit; i++ {
+			users = append(users, map[string]interface{}{"name": fmt.Sprintf("user %d", i)})
+		}
+		json.NewEncoder(w).Encode(users)
+	}))
+	defer fbServer.Close()
+	bq := &fakeBigQuery{}
+	server := httptest.NewServer(bq)
+	defer server.Close()
+
+	c := New("my-project", tokens, nil)
+	c.Endpoint = server.URL
+	n, err := c.Export(context.Background(), firego.New(fbServer.URL, nil).Child("users"), "analytics", "users", ExportOptions{ChunkSize: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	var rows []interface{}
+	for _, inserted := range bq.inserts {
+		for _, row := range inserted {
+			rows = append(rows, row["json"])
+		}
+	}
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "0", "name": "user 0"},
+		map[string]interface{}{"key": "1", "name": "user 1"},
+		map[string]interface{}{"key": "2", "name": "user 2"},
+	}, rows)
+}
+
+func TestExportInsertErrors(t *testing.T) {
+	t.Parallel()
+	fbServer := exportServer(3)
+	defer fbServer.Close()
+	fb := firego.New(fbServer.URL, nil).Child("users")
+	bq := &fakeBigQuery{reject: "u02"}
+	server := httptest.NewServer(bq)
+	defer server.Close()
+
+	c := New("my-project", tokens, nil)
+	c.Endpoint = server.URL
+	schema := Schema{{Name: "name", Type: TypeString}}
+	n, err := c.Export(context.Background(), fb, "analytics", "users", ExportOptions{Schema: schema, SkipInvalidRows: true})
+	assert.Equal(t, 2, n)
+	var insertErr *InsertError
+	require.True(t, errors.As(err, &insertErr), "%v", err)
+	assert.Equal(t, []RowError{{Key: "u02", Reason: "invalid", Location: "age", Message: "bad age"}}, insertErr.Rows)
+	assert.Empty(t, bq.tables)
+	assert.Equal(t, map[string]interface{}{"key": "u01", "name": "user 1"}, bq.inserts[0][0]["json"])
+
+	n, err = c.Export(context.Background(), fb, "analytics", "users", ExportOptions{Schema: schema})
+	assert.Equal(t, 0, n)
+	assert.Error(t, err)
+
+	c = New("my-project", firego.TokenSourceFunc(func() (string, error) {
+		return "expired", nil
+	}), nil)
+	c.Endpoint = server.URL
+	_, err = c.Export(context.Background(), fb, "analytics", "users", ExportOptions{})
+	var apiErr *Error
+	require.True(t, errors.As(err, &apiErr), "%v", err)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.Code)
+}
@@ -0,0 +1,238 @@
+package bigquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Types of the fields of a schema.
+const (
+	TypeString  = "STRING"
+	TypeInteger = "INTEGER"
+	TypeFloat   = "FLOAT"
+	TypeBoolean = "BOOLEAN"
+	TypeRecord  = "RECORD"
+)
+
+// Modes of the fields of a schema.
+const (
+	ModeNullable = "NULLABLE"
+	ModeRequired = "REQUIRED"
+	ModeRepeated = "REPEATED"
+)
+
+// Field is a column of a table.
+//
+// Reference https://cloud.google.com/bigquery/docs/reference/rest/v2/tables#TableFieldSchema
+type Field struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Mode is ModeNullable if empty.
+	Mode string `json:"mode,omitempty"`
+	// Fields are the fields of a TypeRecord field.
+	Fields Schema `json:"fields,omitempty"`
+}
+
+// Schema is the list of the columns of a table.
+type Schema []Field
+
+// InferSchema returns the schema fitting the values of children, which
+// are the children of a node as read with Value. Numbers are integers if
+// they all are, objects are records, arrays are repeated fields and the
+// fields whose values have conflicting types are strings holding their
+// JSON. Fields that are always null are left out. Fields are sorted by
+// name.
+func InferSchema(children map[string]interface{}) Schema {
+	var rows []interface{}
+	for _, child := range children {
+		rows = append(rows, child)
+	}
+	return recordSchema(rows)
+}
+
+// recordSchema infers the fields of the given objects,
+// other values being ignored.
+func recordSchema(objects []interface{}) Schema {
+	values := map[string][]interface{}{}
+	for _, o := range objects {
+		m, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for k, v := range m {
+			if v != nil {
+				values[k] = append(values[k], v)
+			}
+		}
+	}
+
+	var schema Schema
+	for name, vs := range values {
+		f := Field{Name: name}
+		// arrays are repeated fields of the type of their elements
+		var elems []interface{}
+		repeated := true
+		for _, v := range vs {
+			a, ok := v.([]interface{})
+			if !ok {
+				repeated = false
+				break
+			}
+			for _, e := range a {
+				if e != nil {
+					elems = append(elems, e)
+				}
+			}
+		}
+		if repeated {
+			f.Mode = ModeRepeated
+			vs = elems
+		}
+		f.Type = inferType(vs)
+		if f.Type == TypeRecord {
+			f.Fields = recordSchema(vs)
+			if len(f.Fields) == 0 {
+				continue
+			}
+		}
+		schema = append(schema, f)
+	}
+	sort.Slice(schema, func(i, j int) bool {
+		return schema[i].Name < schema[j].Name
+	})
+	return schema
+}
+
+// inferType returns the type fitting every value.
+func inferType(values []interface{}) string {
+	t := ""
+	for _, v := range values {
+		vt := valueType(v)
+		switch {
+		case t == "" || t == vt:
+			t = vt
+		case (t == TypeInteger && vt == TypeFloat) || (t == TypeFloat && vt == TypeInteger):
+			t = TypeFloat
+		default:
+			return TypeString
+		}
+	}
+	if t == "" {
+		return TypeString
+	}
+	return t
+}
+
+func valueType(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return TypeBoolean
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return TypeInteger
+		}
+		return TypeFloat
+	case map[string]interface{}:
+		return TypeRecord
+	}
+	// strings, and nested arrays which BigQuery does not support
+	return TypeString
+}
+
+// row converts an object to a row of the schema. Fields missing from the
+// schema are left out and values are converted to the type of their field.
+func (s Schema) row(v interface{}) (map[string]interface{}, error) {
+	m, _ := v.(map[string]interface{})
+	row := map[string]interface{}{}
+	for _, f := range s {
+		value, ok := m[f.Name]
+		if !ok || value == nil {
+			continue
+		}
+		if f.Mode != ModeRepeated {
+			converted, err := f.convert(value)
+			if err != nil {
+				return nil, err
+			}
+			row[f.Name] = converted
+			continue
+		}
+
+		var converted []interface{}
+		for _, e := range elements(value) {
+			c, err := f.convert(e)
+			if err != nil {
+				return nil, err
+			}
+			converted = append(converted, c)
+		}
+		row[f.Name] = converted
+	}
+	return row, nil
+}
+
+// elements returns the elements of an array, arrays being possibly read
+// as objects keyed by index, or the value as a single element.
+func elements(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		var elems []interface{}
+		for _, e := range v {
+			if e != nil {
+				elems = append(elems, e)
+			}
+		}
+		return elems
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, aErr := strconv.Atoi(keys[i])
+			b, bErr := strconv.Atoi(keys[j])
+			if aErr == nil && bErr == nil {
+				return a < b
+			}
+			return keys[i] < keys[j]
+		})
+		elems := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			elems = append(elems, v[k])
+		}
+		return elems
+	}
+	return []interface{}{v}
+}
+
+// convert converts a value to the type of the field.
+func (f Field) convert(v interface{}) (interface{}, error) {
+	switch f.Type {
+	case TypeRecord:
+		return f.Fields.row(v)
+	case TypeInteger:
+		if n, ok := v.(float64); ok && n == math.Trunc(n) {
+			return strconv.FormatInt(int64(n), 10), nil
+		}
+	case TypeFloat:
+		if n, ok := v.(float64); ok {
+			return n, nil
+		}
+	case TypeBoolean:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case TypeString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		data, err := json.Marshal(v)
+		return string(data), err
+	default:
+		return v, nil
+	}
+	return nil, fmt.Errorf("bigquery: %v does not fit the %s field %q", v, f.Type, f.Name)
+}
@@ -0,0 +1,70 @@
+package bigquery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInferSchema(t *testing.T) {
+	t.Parallel()
+	schema := InferSchema(map[string]interface{}{
+		"a": map[string]interface{}{
+			"name":    "Alice",
+			"age":     float64(30),
+			"score":   float64(1),
+			"admin":   true,
+			"tags":    []interface{}{"x", "y"},
+			"address": map[string]interface{}{"city": "Paris", "zip": float64(75001)},
+			"mixed":   "text",
+			"gone":    nil,
+		},
+		"b": map[string]interface{}{
+			"name":  "Bob",
+			"score": 2.5,
+			"mixed": float64(3),
+			"empty": map[string]interface{}{"nothing": nil},
+		},
+		"c": "not an object",
+	})
+	assert.Equal(t, Schema{
+		{Name: "address", Type: TypeRecord, Fields: Schema{
+			{Name: "city", Type: TypeString},
+			{Name: "zip", Type: TypeInteger},
+		}},
+		{Name: "admin", Type: TypeBoolean},
+		{Name: "age", Type: TypeInteger},
+		{Name: "mixed", Type: TypeString},
+		{Name: "name", Type: TypeString},
+		{Name: "score", Type: TypeFloat},
+		{Name: "tags", Type: TypeString, Mode: ModeRepeated},
+	}, schema)
+}
+
+func TestSchemaRow(t *testing.T) {
+	t.Parallel()
+	schema := Schema{
+		{Name: "address", Type: TypeRecord, Fields: Schema{{Name: "city", Type: TypeString}}},
+		{Name: "age", Type: TypeInteger},
+		{Name: "mixed", Type: TypeString},
+		{Name: "tags", Type: TypeString, Mode: ModeRepeated},
+	}
+	row, err := schema.row(map[string]interface{}{
+		"address": map[string]interface{}{"city": "Paris", "zip": float64(75001)},
+		"age":     float64(30),
+		"mixed":   map[string]interface{}{"a": true},
+		"tags":    map[string]interface{}{"1": "y", "0": "x"},
+		"unknown": "dropped",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"address": map[string]interface{}{"city": "Paris"},
+		"age":     "30",
+		"mixed":   `{"a":true}`,
+		"tags":    []interface{}{"x", "y"},
+	}, row)
+
+	_, err = schema.row(map[string]interface{}{"age": "thirty"})
+	assert.EqualError(t, err, `bigquery: thirty does not fit the INTEGER field "age"`)
+}
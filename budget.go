@@ -0,0 +1,178 @@
+package firego
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExceeded is returned for the reads rejected by a
+// BandwidthBudget whose budget is exceeded.
+var ErrBudgetExceeded = errors.New("firego: bandwidth budget exceeded")
+
+// BudgetAction is what a BandwidthBudget does once its budget is exceeded.
+type BudgetAction int
+
+const (
+	// BudgetWarn only reports that the budget is exceeded.
+	BudgetWarn BudgetAction = iota
+	// BudgetThrottle holds requests back until the next interval.
+	BudgetThrottle
+	// BudgetReject fails the reads whose response is larger than
+	// MaxReadSize with ErrBudgetExceeded until the next interval.
+	BudgetReject
+)
+
+// BandwidthBudget limits the number of bytes references send and receive
+// per interval, guarding against a faulty deploy reading the database in
+// a loop and running up the bill:
+//
+//    budget := firego.NewBandwidthBudget(1<<30, time.Hour, firego.BudgetReject)
+//    budget.MaxReadSize = 1 << 20
+//    fb = budget.Guard(fb)
+//
+// The bytes counted are those of the request and response bodies,
+// including the events received while watching.
+type BandwidthBudget struct {
+	// MaxReadSize is the size of the largest response still read once
+	// the budget is exceeded with BudgetReject. Zero rejects every read.
+	MaxReadSize int64
+	// OnExceeded is called, once per interval, with the number of bytes
+	// used when the budget is exceeded. It is logged if it is nil.
+	OnExceeded func(used int64)
+
+	bytes    int64
+	interval time.Duration
+	action   BudgetAction
+	now      func() time.Time
+
+	mtx      sync.Mutex
+	start    time.Time
+	used     int64
+	exceeded bool
+}
+
+// NewBandwidthBudget creates a budget of the given number of bytes per
+// interval, applying action once it is exceeded.
+func NewBandwidthBudget(bytes int64, interval time.Duration, action BudgetAction) *BandwidthBudget {
+	return &BandwidthBudget{bytes: bytes, interval: interval, action: action, now: time.Now}
+}
+
+// Guard returns a copy of the reference whose traffic, and the traffic
+// of the references derived from it, is subject to the budget.
+func (b *BandwidthBudget) Guard(fb *Firebase) *Firebase {
+	ref := fb.copy()
+	client := *ref.client
+	client.Transport = &budgetTransport{base: client.Transport, b: b}
+	ref.client = &client
+	return ref
+}
+
+// Used returns the number of bytes used during the current interval.
+func (b *BandwidthBudget) Used() int64 {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.rollover()
+	return b.used
+}
+
+// use adds n bytes to the interval. It returns whether the budget is
+// exceeded and when the interval ends.
+func (b *BandwidthBudget) use(n int64) (bool, time.Time) {
+	b.mtx.Lock()
+	b.rollover()
+	b.used += n
+	exceeded := b.used > b.bytes
+	notify := exceeded && !b.exceeded
+	b.exceeded = exceeded
+	used, end := b.used, b.start.Add(b.interval)
+	b.mtx.Unlock()
+
+	if notify {
+		if b.OnExceeded != nil {
+			b.OnExceeded(used)
+		} else {
+			log.Printf("BandwidthBudget: %d bytes used out of %d per %s", used, b.bytes, b.interval)
+		}
+	}
+	return exceeded, end
+}
+
+// rollover starts a new interval if the current one is over.
+func (b *BandwidthBudget) rollover() {
+	now := b.now()
+	if now.Sub(b.start) < b.interval {
+		return
+	}
+	b.start = now
+	b.used = 0
+	b.exceeded = false
+}
+
+// budgetTransport applies a budget to requests.
+type budgetTransport struct {
+	base http.RoundTripper
+	b    *BandwidthBudget
+}
+
+func (tr *budgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := tr.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	var written int64
+	if req.ContentLength > 0 {
+		written = req.ContentLength
+	}
+	exceeded, end := tr.b.use(written)
+	if exceeded && tr.b.action == BudgetThrottle {
+		select {
+		case <-time.After(time.Until(end)):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	reject := exceeded && tr.b.action == BudgetReject && req.Method == "GET"
+	if reject && resp.ContentLength > tr.b.MaxReadSize {
+		resp.Body.Close()
+		return nil, ErrBudgetExceeded
+	}
+	body := &countingBody{ReadCloser: resp.Body, fn: func(n int) {
+		tr.b.use(int64(n))
+	}}
+	resp.Body = body
+	if reject {
+		resp.Body = &limitedBody{ReadCloser: body, left: tr.b.MaxReadSize, err: ErrBudgetExceeded}
+	}
+	return resp, nil
+}
+
+// limitedBody fails with err once more than the given
+// number of bytes are read from a response body.
+type limitedBody struct {
+	io.ReadCloser
+	left int64
+	err  error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.left+1 {
+		p = p[:b.left+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	if b.left < 0 {
+		return 0, b.err
+	}
+	return n, err
+}
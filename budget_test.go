@@ -0,0 +1,98 @@
+package firego
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sizedServer responds to GET requests with a string of the length
+// given in the path, streamed without a Content-Length for "/stream".
+func sizedServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body := `"` + strings.Repeat("x", 98) + `"`
+		if strings.HasPrefix(req.URL.Path, "/small") {
+			body = `"x"`
+		}
+		if strings.HasPrefix(req.URL.Path, "/stream") {
+			w.Write([]byte(body[:50]))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(body[50:]))
+			return
+		}
+		w.Write([]byte(body))
+	}))
+}
+
+func TestBandwidthBudgetWarn(t *testing.T) {
+	t.Parallel()
+	server := sizedServer()
+	defer server.Close()
+
+	var warnings []int64
+	budget := NewBandwidthBudget(150, time.Hour, BudgetWarn)
+	budget.OnExceeded = func(used int64) {
+		warnings = append(warnings, used)
+	}
+	fb := budget.Guard(New(server.URL, nil))
+
+	var v string
+	for i := 0; i < 3; i++ {
+		require.NoError(t, fb.Child("large").Value(&v))
+	}
+	assert.Equal(t, int64(300), budget.Used())
+	assert.Equal(t, []int64{200}, warnings)
+}
+
+func TestBandwidthBudgetReject(t *testing.T) {
+	t.Parallel()
+	server := sizedServer()
+	defer server.Close()
+
+	now := time.Now()
+	budget := NewBandwidthBudget(150, time.Hour, BudgetReject)
+	budget.now = func() time.Time { return now }
+	budget.MaxReadSize = 10
+	budget.OnExceeded = func(int64) {}
+	fb := budget.Guard(New(server.URL, nil))
+
+	var v string
+	require.NoError(t, fb.Child("large").Value(&v))
+	require.NoError(t, fb.Child("large").Value(&v))
+
+	// only the small reads are let through
+	err := fb.Child("large").Value(&v)
+	assert.True(t, errors.Is(err, ErrBudgetExceeded), "%v", err)
+	err = fb.Child("stream").Value(&v)
+	assert.True(t, errors.Is(err, ErrBudgetExceeded), "%v", err)
+	require.NoError(t, fb.Child("small").Value(&v))
+	assert.Equal(t, "x", v)
+	// writes are not
+	require.NoError(t, fb.Child("large").Set("y"))
+
+	// until the next interval
+	now = now.Add(time.Hour)
+	require.NoError(t, fb.Child("large").Value(&v))
+}
+
+func TestBandwidthBudgetThrottle(t *testing.T) {
+	t.Parallel()
+	server := sizedServer()
+	defer server.Close()
+
+	budget := NewBandwidthBudget(50, 300*time.Millisecond, BudgetThrottle)
+	budget.OnExceeded = func(int64) {}
+	fb := budget.Guard(New(server.URL, nil))
+
+	var v string
+	start := time.Now()
+	require.NoError(t, fb.Child("large").Value(&v))
+	require.NoError(t, fb.Child("large").Value(&v))
+	assert.True(t, time.Since(start) >= 250*time.Millisecond, "request was not throttled")
+}
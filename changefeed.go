@@ -0,0 +1,90 @@
+package firego
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// EventRecord is the newline-delimited JSON representation of an Event
+// written by an EventWriter.
+type EventRecord struct {
+	// Timestamp is the time the event was received
+	Timestamp time.Time `json:"timestamp"`
+	// Path to the data that changed
+	Path string `json:"path"`
+	// Type of event that was received
+	Type EventType `json:"type"`
+	// Data that changed
+	Data json.RawMessage `json:"data"`
+	// Seq is the sequence number of the event in its stream
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// EventWriter serializes events as newline-delimited JSON records, one per
+// line, so that a change feed can be piped into files, queues or loaders.
+type EventWriter struct {
+	enc *json.Encoder
+	now func() time.Time
+}
+
+// NewEventWriter creates an EventWriter that writes to w.
+func NewEventWriter(w io.Writer) *EventWriter {
+	return &EventWriter{
+		enc: json.NewEncoder(w),
+		now: time.Now,
+	}
+}
+
+// Write encodes a single event as a line of JSON.
+func (ew *EventWriter) Write(event Event) error {
+	data := event.Data
+	if err, ok := data.(error); ok {
+		data = err.Error()
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event data. %w", err)
+	}
+
+	return ew.enc.Encode(EventRecord{
+		Timestamp: ew.now(),
+		Path:      event.Path,
+		Type:      event.Type,
+		Data:      raw,
+		Seq:       event.Seq,
+	})
+}
+
+// WatchTo watches the Firebase reference and writes every event it receives
+// to w as newline-delimited JSON. It blocks until StopWatching is called,
+// in which case nil is returned, or until the stream fails or w returns
+// an error.
+func (fb *Firebase) WatchTo(w io.Writer) error {
+	notifications := make(chan Event)
+	if err := fb.Watch(notifications); err != nil {
+		return err
+	}
+
+	ew := NewEventWriter(w)
+	for event := range notifications {
+		err := ew.Write(event)
+		if err == nil && event.Type == EventTypeError {
+			var ok bool
+			if err, ok = event.Data.(error); !ok {
+				err = fmt.Errorf("Got error from event %#v", event)
+			}
+		}
+
+		if err != nil {
+			fb.StopWatching()
+			// drain so the watcher can shut down
+			for range notifications {
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package firego
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestEventWriter(t *testing.T) {
+	t.Parallel()
+	var (
+		buf bytes.Buffer
+		now = time.Date(2019, 3, 31, 12, 0, 0, 0, time.UTC)
+		ew  = NewEventWriter(&buf)
+	)
+	ew.now = func() time.Time { return now }
+
+	require.NoError(t, ew.Write(Event{
+		Type: EventTypePut,
+		Path: "/foo",
+		Data: map[string]interface{}{"bar": true},
+	}))
+	require.NoError(t, ew.Write(Event{
+		Type: EventTypeError,
+		Data: errors.New("boom"),
+	}))
+
+	expected := `{"timestamp":"2019-03-31T12:00:00Z","path":"/foo","type":"put","data":{"bar":true}}` + "\n" +
+		`{"timestamp":"2019-03-31T12:00:00Z","path":"","type":"event_error","data":"boom"}` + "\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestWatchTo(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	pr, pw := io.Pipe()
+
+	done := make(chan error)
+	go func() {
+		done <- fb.WatchTo(pw)
+	}()
+
+	scanner := bufio.NewScanner(pr)
+	readRecord := func() EventRecord {
+		require.True(t, scanner.Scan(), "no record written")
+		var record EventRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		return record
+	}
+
+	record := readRecord()
+	assert.Equal(t, EventTypePut, record.Type)
+	assert.Equal(t, "/", record.Path)
+	assert.Equal(t, "null", string(record.Data))
+
+	server.Set("foo", "bar")
+	record = readRecord()
+	assert.Equal(t, EventTypePut, record.Type)
+	assert.Equal(t, "/foo", record.Path)
+	assert.Equal(t, `"bar"`, string(record.Data))
+
+	fb.StopWatching()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "WatchTo did not return")
+	}
+	pr.Close()
+}
@@ -0,0 +1,263 @@
+package firego
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestNewClientTLS(t *testing.T) {
+	t.Parallel()
+	var clientCerts int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		clientCerts = len(req.TLS.PeerCertificates)
+		fmt.Fprint(w, `"ok"`)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	var v string
+	err := New(server.URL, NewClient(ClientOptions{})).Value(&v)
+	assert.Error(t, err, "server certificate is not trusted")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	err = New(server.URL, NewClient(ClientOptions{RootCAs: roots})).Value(&v)
+	assert.Error(t, err, "no client certificate")
+
+	client := NewClient(ClientOptions{
+		RootCAs:       roots,
+		Certificates:  server.TLS.Certificates,
+		MinTLSVersion: tls.VersionTLS12,
+	})
+	require.NoError(t, New(server.URL, client).Value(&v))
+	assert.Equal(t, "ok", v)
+	assert.Equal(t, 1, clientCerts)
+}
+
+func TestNewClientOptions(t *testing.T) {
+	t.Parallel()
+	base := &tls.Config{ServerName: "example.com"}
+	client := NewClient(ClientOptions{
+		Timeout:       time.Second,
+		TLSConfig:     base,
+		MinTLSVersion: tls.VersionTLS12,
+	})
+
+	tr := client.Transport.(*http.Transport)
+	assert.Equal(t, "example.com", tr.TLSClientConfig.ServerName)
+	assert.Equal(t, uint16(tls.VersionTLS12), tr.TLSClientConfig.MinVersion)
+	assert.Equal(t, uint16(0), base.MinVersion, "base config is not modified")
+
+	tr = NewClient(ClientOptions{}).Transport.(*http.Transport)
+	assert.Nil(t, tr.TLSClientConfig)
+}
+
+func TestNewClientProxy(t *testing.T) {
+	t.Parallel()
+	var hosts []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		hosts = append(hosts, req.URL.Host)
+		fmt.Fprint(w, `"proxied"`)
+	}))
+	defer proxy.Close()
+
+	var v string
+	fb := New("http://firebase.invalid", NewClient(ClientOptions{Proxy: proxy.URL}))
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, "proxied", v)
+
+	fb = New("http://other.invalid", NewClient(ClientOptions{
+		Proxy: "http://ignored.invalid",
+		ProxyFunc: func(req *http.Request) (*url.URL, error) {
+			return url.Parse(proxy.URL)
+		},
+	}))
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, []string{"firebase.invalid", "other.invalid"}, hosts)
+
+	fb = New("http://firebase.invalid", NewClient(ClientOptions{Proxy: "://"}))
+	assert.Error(t, fb.Value(&v))
+}
+
+func TestNewClientSOCKS5Proxy(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `"ok"`)
+	}))
+	defer server.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	connects := make(chan string, 1)
+	go serveSOCKS5(l, connects)
+
+	var v string
+	fb := New(server.URL, NewClient(ClientOptions{Proxy: "socks5://" + l.Addr().String()}))
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, "ok", v)
+	assert.Equal(t, server.Listener.Addr().String(), <-connects)
+}
+
+// serveSOCKS5 is a minimal SOCKS5 server supporting
+// CONNECT to IPv4 addresses without authentication.
+func serveSOCKS5(l net.Listener, connects chan string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+			buf := make([]byte, 10)
+			// greeting: version, number of methods, methods
+			if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+				return
+			}
+			if _, err := io.ReadFull(conn, make([]byte, buf[1])); err != nil {
+				return
+			}
+			conn.Write([]byte{5, 0})
+
+			// request: version, CONNECT, reserved, IPv4, address, port
+			if _, err := io.ReadFull(conn, buf); err != nil || buf[3] != 1 {
+				return
+			}
+			addr := net.JoinHostPort(net.IP(buf[4:8]).String(), strconv.Itoa(int(buf[8])<<8|int(buf[9])))
+			target, err := net.Dial("tcp", addr)
+			if err != nil {
+				return
+			}
+			defer target.Close()
+			connects <- addr
+			conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+			go io.Copy(target, conn)
+			io.Copy(conn, target)
+		}()
+	}
+}
+
+type testResolver struct {
+	mtx     sync.Mutex
+	lookups int
+	addrs   map[string][]string
+}
+
+func (r *testResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.lookups++
+	if addrs, ok := r.addrs[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host}
+}
+
+func TestNewClientResolver(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `"ok"`)
+	}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+
+	resolver := &testResolver{addrs: map[string][]string{
+		// addresses that can not be dialed are skipped
+		"firebase.test": {"127.0.0.1:bad", "127.0.0.1"},
+	}}
+	client := NewClient(ClientOptions{Resolver: resolver, DNSCacheTTL: time.Minute})
+	// new connections for every request
+	client.Transport.(*http.Transport).DisableKeepAlives = true
+	fb := New("http://firebase.test:"+port, client)
+
+	var v string
+	for i := 0; i < 3; i++ {
+		require.NoError(t, fb.Value(&v))
+		assert.Equal(t, "ok", v)
+	}
+	assert.Equal(t, 1, resolver.lookups, "lookups are cached")
+
+	fb = New("http://missing.test:"+port, client)
+	assert.Error(t, fb.Value(&v))
+	assert.Error(t, fb.Value(&v))
+	assert.Equal(t, 3, resolver.lookups, "failed lookups are not cached")
+}
+
+func TestNewClientIPv4Only(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `"ok"`)
+	}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+
+	var v string
+	fb := New("http://localhost:"+port, NewClient(ClientOptions{IPv4Only: true, FallbackDelay: -1}))
+	require.NoError(t, fb.Value(&v))
+
+	resolver := &testResolver{addrs: map[string][]string{
+		"dual.test": {"::1", "127.0.0.1"},
+		"ipv6.test": {"::1"},
+	}}
+	client := NewClient(ClientOptions{Resolver: resolver, IPv4Only: true})
+	require.NoError(t, New("http://dual.test:"+port, client).Value(&v))
+	assert.Equal(t, "ok", v)
+
+	err = New("http://ipv6.test:"+port, client).Value(&v)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no suitable address found")
+}
+
+func TestNewClientMaxResponseBytes(t *testing.T) {
+	t.Parallel()
+	server := sizedServer()
+	defer server.Close()
+
+	fb := New(server.URL, NewClient(ClientOptions{MaxResponseBytes: 60}))
+	var v string
+	err := fb.Child("large").Value(&v)
+	assert.True(t, errors.Is(err, ErrResponseTooLarge), "%v", err)
+	err = fb.Child("stream").Value(&v)
+	assert.True(t, errors.Is(err, ErrResponseTooLarge), "%v", err)
+	require.NoError(t, fb.Child("small").Value(&v))
+	assert.Equal(t, "x", v)
+
+	// event streams are not limited
+	fs := firetest.New()
+	fs.Start()
+	defer fs.Close()
+	fs.Set("large", strings.Repeat("x", 100))
+
+	fb = New(fs.URL, NewClient(ClientOptions{MaxResponseBytes: 60}))
+	notifications := make(chan Event)
+	require.NoError(t, fb.Child("large").Watch(notifications))
+	defer fb.Child("large").StopWatching()
+	select {
+	case event := <-notifications:
+		assert.Equal(t, strings.Repeat("x", 100), event.Data)
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+}
@@ -0,0 +1,144 @@
+package firego
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// CoalesceEvents makes Watch merge the put and patch events on the same
+// path received within window of each other into a single event holding
+// the latest data, which protects consumers from keys being written many
+// times a second. Events are held for up to window before being delivered,
+// in the order they were received. Zero, the default, delivers every event
+// as soon as it is received. Like SkipInitialSnapshot, it is not inherited
+// by references derived from fb.
+func (fb *Firebase) CoalesceEvents(window time.Duration) {
+	fb.coalesce = window
+}
+
+// coalesceEvents delivers the events of a stream in batches collected over
+// window, merging the events of a batch that apply to the same path.
+func coalesceEvents(events chan Event, window time.Duration, stop chan struct{}) chan Event {
+	out := make(chan Event)
+
+	go func() {
+		defer close(out)
+
+		var pending []Event
+		var flush <-chan time.Time
+		deliver := func() bool {
+			for _, event := range pending {
+				select {
+				case out <- event:
+				case <-stop:
+					return false
+				}
+			}
+			pending, flush = nil, nil
+			return true
+		}
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					deliver()
+					return
+				}
+				if event.Type != EventTypePut && event.Type != EventTypePatch {
+					// errors and the like end the stream,
+					// everything before them is delivered first
+					pending = append(pending, event)
+					if !deliver() {
+						return
+					}
+					continue
+				}
+				pending = mergeEvent(pending, event)
+				if flush == nil {
+					flush = time.After(window)
+				}
+			case <-flush:
+				if !deliver() {
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// mergeEvent merges event into the latest pending event on the same path,
+// unless an event in between touches an overlapping path, in which case
+// event is appended so that the data is still changed in the same order.
+func mergeEvent(pending []Event, event Event) []Event {
+	for i := len(pending) - 1; i >= 0; i-- {
+		p := pending[i]
+		if p.Path != event.Path {
+			if pathsOverlap(p.Path, event.Path) {
+				break
+			}
+			continue
+		}
+
+		switch {
+		case event.Type == EventTypePut:
+			// a put replaces whatever was there before
+			pending[i] = event
+			return pending
+		case p.Type == EventTypePatch:
+			if merged, ok := mergePatches(p, event); ok {
+				pending[i] = merged
+				return pending
+			}
+		}
+		break
+	}
+	return append(pending, event)
+}
+
+// mergePatches combines two patch events on the same path, provided that
+// the children they update are either the same or unrelated.
+func mergePatches(a, b Event) (Event, bool) {
+	am, _ := a.Data.(map[string]interface{})
+	bm, _ := b.Data.(map[string]interface{})
+	if am == nil || bm == nil {
+		return Event{}, false
+	}
+
+	data := make(map[string]interface{}, len(am)+len(bm))
+	for k, v := range am {
+		data[k] = v
+	}
+	for k, v := range bm {
+		for ak := range am {
+			if ak != k && pathsOverlap(ak, k) {
+				return Event{}, false
+			}
+		}
+		data[k] = v
+	}
+
+	raw, err := json.Marshal(map[string]interface{}{
+		"path": b.Path,
+		"data": data,
+	})
+	if err != nil {
+		return Event{}, false
+	}
+	return Event{Type: EventTypePatch, Path: b.Path, Data: data, ID: b.ID, rawData: raw}, true
+}
+
+// pathsOverlap reports whether one of the paths is the same as or
+// a descendant of the other.
+func pathsOverlap(a, b string) bool {
+	a, b = strings.Trim(a, "/"), strings.Trim(b, "/")
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return a == "" || a == b || strings.HasPrefix(b, a+"/")
+}
@@ -0,0 +1,118 @@
+package firego
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalesceEvents(t *testing.T) {
+	t.Parallel()
+	stop := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Connection", "close")
+		for _, e := range []string{
+			`{"path":"/","data":null}`,
+			`{"path":"/foo","data":"1"}`,
+			`{"path":"/foo","data":"2"}`,
+			`{"path":"/bar","data":"x"}`,
+			`{"path":"/foo","data":"3"}`,
+		} {
+			fmt.Fprintf(w, "event: put\ndata: %s\n\n", e)
+		}
+		w.(http.Flusher).Flush()
+		<-stop
+	}))
+	defer server.Close()
+	defer close(stop)
+
+	fb := New(server.URL, nil)
+	fb.CoalesceEvents(100 * time.Millisecond)
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+
+	event := receiveEvent(t, notifications)
+	assert.Equal(t, "/", event.Path)
+	assert.Equal(t, uint64(1), event.Seq)
+
+	event = receiveEvent(t, notifications)
+	assert.Equal(t, "/foo", event.Path)
+	assert.Equal(t, "3", event.Data)
+	assert.Equal(t, uint64(2), event.Seq)
+	var v string
+	require.NoError(t, event.Value(&v))
+	assert.Equal(t, "3", v)
+
+	event = receiveEvent(t, notifications)
+	assert.Equal(t, "/bar", event.Path)
+	assert.Equal(t, "x", event.Data)
+	assert.Equal(t, uint64(3), event.Seq)
+
+	fb.StopWatching()
+	for range notifications {
+	}
+}
+
+func TestMergeEvent(t *testing.T) {
+	put := func(path string, data interface{}) Event {
+		return Event{Type: EventTypePut, Path: path, Data: data}
+	}
+	patch := func(path string, data map[string]interface{}) Event {
+		return Event{Type: EventTypePatch, Path: path, Data: data}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		pending  []Event
+		event    Event
+		expected []Event
+	}{
+		{
+			name:     "put replaces put",
+			pending:  []Event{put("/a", 1), put("/b", 1)},
+			event:    put("/a", 2),
+			expected: []Event{put("/a", 2), put("/b", 1)},
+		},
+		{
+			name:     "put replaces patch",
+			pending:  []Event{patch("/a", map[string]interface{}{"x": 1})},
+			event:    put("/a", 2),
+			expected: []Event{put("/a", 2)},
+		},
+		{
+			name:     "overlapping path in between",
+			pending:  []Event{put("/a", 1), put("/a/b", 1)},
+			event:    put("/a", 2),
+			expected: []Event{put("/a", 1), put("/a/b", 1), put("/a", 2)},
+		},
+		{
+			name:     "patch after put",
+			pending:  []Event{put("/a", 1)},
+			event:    patch("/a", map[string]interface{}{"x": 1}),
+			expected: []Event{put("/a", 1), patch("/a", map[string]interface{}{"x": 1})},
+		},
+		{
+			name:     "overlapping patches",
+			pending:  []Event{patch("/a", map[string]interface{}{"x": 1})},
+			event:    patch("/a", map[string]interface{}{"x/y": 2}),
+			expected: []Event{patch("/a", map[string]interface{}{"x": 1}), patch("/a", map[string]interface{}{"x/y": 2})},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, mergeEvent(tt.pending, tt.event))
+		})
+	}
+
+	merged := mergeEvent([]Event{patch("/a", map[string]interface{}{"x": 1, "y": 1})}, patch("/a", map[string]interface{}{"y": 2, "z": 2}))
+	require.Len(t, merged, 1)
+	assert.Equal(t, map[string]interface{}{"x": 1, "y": 2, "z": 2}, merged[0].Data)
+	var v map[string]int
+	require.NoError(t, merged[0].Value(&v))
+	assert.Equal(t, map[string]int{"x": 1, "y": 2, "z": 2}, v)
+}
@@ -0,0 +1,720 @@
+package firego
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// codecTag is the struct tag documented in the package overview.
+const codecTag = "firebase"
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	marshalerT   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	unmarshalerT = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// encode validates v and marshals it for a write. Multi-location
+// paths are only allowed as keys of update payloads.
+func (fb *Firebase) encode(v interface{}, update bool) ([]byte, error) {
+	buf, err := fb.encodeBuffer(v, update)
+	if err != nil {
+		return nil, err
+	}
+	defer putBuffer(buf)
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+// encodeBuffer is encode marshaling into a pooled buffer, which the
+// caller puts back once done with its bytes.
+func (fb *Firebase) encodeBuffer(v interface{}, update bool) (*bytes.Buffer, error) {
+	vd := validator{multiPath: update, escapeKeys: fb.encodeKeys}
+	if fb.enforceLimits {
+		vd.limits = true
+		vd.depth = fb.depth()
+	}
+	if err := vd.value(reflect.ValueOf(v), ""); err != nil {
+		return nil, err
+	}
+
+	buf := getBuffer()
+	err := marshalTo(buf, v)
+	if err == nil && fb.encodeKeys {
+		var tree interface{}
+		if tree, err = decodeTree(buf.Bytes()); err == nil {
+			buf.Reset()
+			err = marshalTo(buf, encodeTreeKeys(tree, update))
+		}
+	}
+	if err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// decode unmarshals the JSON data read through fb into v.
+func (fb *Firebase) decode(data []byte, v interface{}) error {
+	fb.paramsMtx.RLock()
+	export := fb.params.Get(formatParam) == formatVal
+	fb.paramsMtx.RUnlock()
+	if !fb.encodeKeys && !export {
+		return unmarshal(data, v)
+	}
+
+	tree, err := decodeTree(data)
+	if err != nil {
+		return err
+	}
+	if fb.encodeKeys {
+		tree = decodeTreeKeys(tree)
+	}
+	if export {
+		return unmarshalExport(tree, v)
+	}
+	b, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	return unmarshal(b, v)
+}
+
+// unmarshalExport decodes a tree read in the export format, where values
+// with a priority are wrapped in objects holding ".value" and ".priority",
+// into v. Priorities are stored into the fields tagged "$priority".
+func unmarshalExport(tree interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || !needsCodec(rv.Type()) {
+		b, err := json.Marshal(stripExport(tree))
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(b, v)
+	}
+	return fromTree(tree, rv.Elem())
+}
+
+// stripExport returns the tree without the priorities of the export format.
+func stripExport(tree interface{}) interface{} {
+	switch t := tree.(type) {
+	case map[string]interface{}:
+		if v, ok := t[".value"]; ok {
+			return v
+		}
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			if k != ".priority" {
+				m[k] = stripExport(v)
+			}
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, v := range t {
+			s[i] = stripExport(v)
+		}
+		return s
+	}
+	return tree
+}
+
+// marshal encodes v as JSON honoring firebase struct tags.
+func marshal(v interface{}) ([]byte, error) {
+	if v == nil || !needsCodec(reflect.TypeOf(v)) {
+		return json.Marshal(v)
+	}
+
+	tree, err := toTree(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
+
+// unmarshal decodes the JSON data into v honoring firebase struct tags.
+func unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || !needsCodec(rv.Type()) {
+		return json.Unmarshal(data, v)
+	}
+
+	tree, err := decodeTree(data)
+	if err != nil {
+		return err
+	}
+	return fromTree(tree, rv.Elem())
+}
+
+var codecTypes = struct {
+	sync.RWMutex
+	m map[reflect.Type]bool
+}{m: map[reflect.Type]bool{}}
+
+// needsCodec reports whether t, or any type it is made of,
+// has fields with a firebase tag.
+func needsCodec(t reflect.Type) bool {
+	codecTypes.RLock()
+	need, ok := codecTypes.m[t]
+	codecTypes.RUnlock()
+	if ok {
+		return need
+	}
+
+	need = typeNeedsCodec(t, map[reflect.Type]bool{})
+	codecTypes.Lock()
+	codecTypes.m[t] = need
+	codecTypes.Unlock()
+	return need
+}
+
+func typeNeedsCodec(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return typeNeedsCodec(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if _, ok := f.Tag.Lookup(codecTag); ok {
+				return true
+			}
+			if typeNeedsCodec(f.Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type codecField struct {
+	name            string
+	index           []int
+	tagged          bool
+	omitEmpty       bool
+	serverTimestamp bool
+	// key is set for the field tagged "$key", which holds the key of
+	// the struct's location rather than one of its children
+	key bool
+	// priority is set for the field tagged "$priority", which holds
+	// the priority of the struct's location
+	priority bool
+	// ref is the path template of the locations referenced by the
+	// field, whose keys only are stored, see ResolveRefs
+	ref string
+}
+
+const (
+	// keyTag is the name given in a firebase tag to the field holding
+	// the key of the struct's location.
+	keyTag = "$key"
+	// priorityTag is the name given in a firebase tag to the field
+	// holding the priority of the struct's location.
+	priorityTag = "$priority"
+	// refOption prefixes the path template given in a firebase
+	// tag to a field referencing other locations.
+	refOption = "ref:"
+)
+
+var codecFields = struct {
+	sync.RWMutex
+	m map[reflect.Type][]codecField
+}{m: map[reflect.Type][]codecField{}}
+
+func fieldsOf(t reflect.Type) []codecField {
+	codecFields.RLock()
+	fields, ok := codecFields.m[t]
+	codecFields.RUnlock()
+	if ok {
+		return fields
+	}
+
+	fields = collectFields(t, nil)
+	codecFields.Lock()
+	codecFields.m[t] = fields
+	codecFields.Unlock()
+	return fields
+}
+
+func collectFields(t reflect.Type, index []int) []codecField {
+	var fields []codecField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		idx := append(append([]int{}, index...), i)
+
+		tag, tagged := f.Tag.Lookup(codecTag)
+		if !tagged {
+			tag = f.Tag.Get("json")
+		}
+		if tag == "-" {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		if tagged && strings.HasPrefix(name, refOption) {
+			// a reference named after the field
+			name, parts = "", append([]string{""}, parts...)
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			// promote the fields of embedded structs
+			fields = append(fields, collectFields(ft, idx)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		field := codecField{
+			name:     name,
+			index:    idx,
+			tagged:   tagged,
+			key:      tagged && name == keyTag,
+			priority: tagged && name == priorityTag,
+		}
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "omitempty":
+				field.omitEmpty = true
+			case "serverTimestamp":
+				field.serverTimestamp = tagged
+			default:
+				if tagged && strings.HasPrefix(opt, refOption) {
+					field.ref = strings.TrimPrefix(opt, refOption)
+				}
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// toTree converts v into a value that encoding/json can marshal
+// without any knowledge of firebase tags.
+func toTree(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if !needsCodec(v.Type()) || v.Type().Implements(marshalerT) {
+		return v.Interface(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return toTree(v.Elem())
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			elem, err := toTree(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			s[i] = elem
+		}
+		return s, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		m := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			elem, err := toTree(v.MapIndex(k))
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k.Interface())] = elem
+		}
+		return m, nil
+
+	case reflect.Struct:
+		m := map[string]interface{}{}
+		for _, f := range fieldsOf(v.Type()) {
+			if f.key {
+				// the key is the name of the location, not a child
+				continue
+			}
+			fv, ok := fieldByIndex(v, f.index, false)
+			if !ok {
+				continue
+			}
+			if f.priority {
+				if !isEmptyValue(fv) {
+					m[".priority"] = fv.Interface()
+				}
+				continue
+			}
+
+			if f.ref != "" {
+				if keys := refKeys(fv); keys != nil || !f.omitEmpty {
+					m[f.name] = keys
+				}
+				continue
+			}
+
+			zero := isEmptyValue(fv)
+			if f.serverTimestamp && zero {
+				m[f.name] = ServerTimestamp
+				continue
+			}
+			if f.omitEmpty && zero {
+				continue
+			}
+
+			if f.tagged && isTime(fv.Type()) {
+				m[f.name] = timeToMillis(fv)
+				continue
+			}
+
+			elem, err := toTree(fv)
+			if err != nil {
+				return nil, err
+			}
+			m[f.name] = elem
+		}
+		return m, nil
+	}
+	return v.Interface(), nil
+}
+
+// fromTree stores the decoded JSON tree into v. Trees read in
+// the export format are supported as well.
+func fromTree(tree interface{}, v reflect.Value) error {
+	if !needsCodec(v.Type()) || reflect.PtrTo(v.Type()).Implements(unmarshalerT) {
+		return roundTrip(stripExport(tree), v)
+	}
+	if m, ok := tree.(map[string]interface{}); ok {
+		if value, ok := m[".value"]; ok {
+			// a primitive with a priority
+			tree = value
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if tree == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return fromTree(tree, v.Elem())
+
+	case reflect.Slice:
+		if tree == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if m, ok := tree.(map[string]interface{}); ok {
+			return objectToSlice(m, v)
+		}
+		s, ok := tree.([]interface{})
+		if !ok {
+			return typeError(tree, v.Type())
+		}
+		slice := reflect.MakeSlice(v.Type(), len(s), len(s))
+		for i, elem := range s {
+			if err := fromTree(elem, slice.Index(i)); err != nil {
+				return err
+			}
+			if elem != nil {
+				setKey(slice.Index(i), strconv.Itoa(i))
+			}
+		}
+		v.Set(slice)
+		return nil
+
+	case reflect.Array:
+		s, ok := tree.([]interface{})
+		if !ok {
+			return typeError(tree, v.Type())
+		}
+		for i := 0; i < v.Len() && i < len(s); i++ {
+			if err := fromTree(s[i], v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		if tree == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		m, ok := tree.(map[string]interface{})
+		if !ok {
+			return typeError(tree, v.Type())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for k, elem := range m {
+			if k == ".priority" {
+				continue
+			}
+			key, err := mapKey(k, v.Type().Key())
+			if err != nil {
+				return err
+			}
+			val := reflect.New(v.Type().Elem()).Elem()
+			if err := fromTree(elem, val); err != nil {
+				return err
+			}
+			setKey(val, k)
+			v.SetMapIndex(key, val)
+		}
+		return nil
+
+	case reflect.Struct:
+		if tree == nil {
+			return nil
+		}
+		m, ok := tree.(map[string]interface{})
+		if !ok {
+			return typeError(tree, v.Type())
+		}
+		for _, f := range fieldsOf(v.Type()) {
+			if f.priority {
+				if priority, ok := m[".priority"]; ok {
+					fv, _ := fieldByIndex(v, f.index, true)
+					if err := roundTrip(priority, fv); err != nil {
+						return fmt.Errorf("firego: cannot decode priority: %w", err)
+					}
+				}
+				continue
+			}
+			elem, ok := m[f.name]
+			if !ok || f.key {
+				continue
+			}
+			fv, _ := fieldByIndex(v, f.index, true)
+			if f.ref != "" {
+				if err := refsFromTree(elem, fv); err != nil {
+					return fmt.Errorf("firego: cannot decode %q: %w", f.name, err)
+				}
+				continue
+			}
+			if f.tagged && isTime(fv.Type()) {
+				if err := millisToTimeValue(elem, fv); err != nil {
+					return fmt.Errorf("firego: cannot decode %q: %w", f.name, err)
+				}
+				continue
+			}
+			if err := fromTree(elem, fv); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return roundTrip(tree, v)
+}
+
+// objectToSlice stores the children of an object into the slice v,
+// ordered by key, such as a list of pushed children.
+func objectToSlice(m map[string]interface{}, v reflect.Value) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if k != ".priority" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return compareKeys(keys[i], keys[j]) < 0
+	})
+
+	slice := reflect.MakeSlice(v.Type(), len(keys), len(keys))
+	for i, k := range keys {
+		if err := fromTree(m[k], slice.Index(i)); err != nil {
+			return err
+		}
+		setKey(slice.Index(i), k)
+	}
+	v.Set(slice)
+	return nil
+}
+
+// setKey stores key into the "$key" field of the struct v, if any.
+func setKey(v reflect.Value, key string) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	for _, f := range fieldsOf(v.Type()) {
+		if !f.key {
+			continue
+		}
+		if fv, _ := fieldByIndex(v, f.index, true); fv.Kind() == reflect.String {
+			fv.SetString(key)
+		}
+	}
+}
+
+// keyOf returns the "$key" field of the struct v, if any.
+func keyOf(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	for _, f := range fieldsOf(v.Type()) {
+		if !f.key {
+			continue
+		}
+		if fv, ok := fieldByIndex(v, f.index, false); ok && fv.Kind() == reflect.String {
+			return fv.String()
+		}
+	}
+	return ""
+}
+
+// roundTrip lets encoding/json decode the tree into v.
+func roundTrip(tree interface{}, v reflect.Value) error {
+	b, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v.Addr().Interface())
+}
+
+func typeError(tree interface{}, t reflect.Type) error {
+	return fmt.Errorf("firego: cannot decode %T into %s", tree, t)
+}
+
+func mapKey(k string, t reflect.Type) (reflect.Value, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(k).Convert(t), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(k, 10, 64)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(n).Convert(t), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(k, 10, 64)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(n).Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("firego: unsupported map key type %s", t)
+}
+
+// fieldByIndex walks the index path of a promoted field. Nil embedded
+// pointers are allocated when alloc is set, otherwise ok is false.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func isTime(t reflect.Type) bool {
+	return t == timeType || (t.Kind() == reflect.Ptr && t.Elem() == timeType)
+}
+
+func timeToMillis(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	t := v.Interface().(time.Time)
+	if t.IsZero() {
+		// like Time, which would otherwise be stored as a date in 1754
+		return nil
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func millisToTimeValue(tree interface{}, v reflect.Value) error {
+	if tree == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	n, ok := tree.(json.Number)
+	if !ok {
+		return fmt.Errorf("expected milliseconds, got %T", tree)
+	}
+	ms, err := n.Float64()
+	if err != nil {
+		return err
+	}
+
+	t := millisToTime(ms)
+	if v.Kind() == reflect.Ptr {
+		v.Set(reflect.ValueOf(&t))
+		return nil
+	}
+	v.Set(reflect.ValueOf(t))
+	return nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface().(time.Time).IsZero()
+		}
+	}
+	return false
+}
@@ -0,0 +1,272 @@
+package firego
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+type codecAddress struct {
+	City string `firebase:"city"`
+}
+
+type codecBase struct {
+	ID string `json:"id"`
+}
+
+type codecUser struct {
+	codecBase
+	Name     string            `firebase:"name"`
+	Nick     string            `firebase:"nick,omitempty"`
+	Email    string            `json:"email"`
+	Secret   string            `firebase:"-"`
+	Created  time.Time         `firebase:"created,serverTimestamp"`
+	Updated  *time.Time        `firebase:"updated,omitempty"`
+	Birthday time.Time         `json:"birthday"`
+	Address  *codecAddress     `firebase:"address"`
+	Tags     map[string]bool   `firebase:"tags,omitempty"`
+	Homes    []codecAddress    `firebase:"homes,omitempty"`
+	Meta     map[int]codecBase `firebase:"meta,omitempty"`
+}
+
+func TestMarshalPlainTypes(t *testing.T) {
+	t.Parallel()
+	type plain struct {
+		Foo string `json:"foo"`
+	}
+
+	for _, v := range []interface{}{
+		nil, "foo", 1, map[string]interface{}{"a": 1}, plain{Foo: "bar"}, &plain{},
+	} {
+		expected, err := json.Marshal(v)
+		require.NoError(t, err)
+
+		actual, err := marshal(v)
+		require.NoError(t, err)
+		assert.Equal(t, string(expected), string(actual))
+	}
+}
+
+func TestMarshalFirebaseTags(t *testing.T) {
+	t.Parallel()
+	updated := time.Unix(1500000000, 123000000)
+	u := codecUser{
+		codecBase: codecBase{ID: "1"},
+		Name:      "alice",
+		Email:     "alice@example.com",
+		Secret:    "shh",
+		Updated:   &updated,
+		Birthday:  time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+		Address:   &codecAddress{City: "Berlin"},
+		Meta:      map[int]codecBase{7: {ID: "x"}},
+	}
+
+	b, err := marshal(u)
+	require.NoError(t, err)
+
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &m))
+	assert.Equal(t, map[string]interface{}{
+		"id":       "1",
+		"name":     "alice",
+		"email":    "alice@example.com",
+		"created":  map[string]interface{}{".sv": "timestamp"},
+		"updated":  1500000000123.0,
+		"birthday": "1990-01-01T00:00:00Z",
+		"address":  map[string]interface{}{"city": "Berlin"},
+		"meta":     map[string]interface{}{"7": map[string]interface{}{"id": "x"}},
+	}, m)
+}
+
+func TestUnmarshalFirebaseTags(t *testing.T) {
+	t.Parallel()
+	data := `{
+		"id": "1",
+		"name": "alice",
+		"nick": "al",
+		"secret": "shh",
+		"created": 1500000000123,
+		"updated": 1500000000456,
+		"birthday": "1990-01-01T00:00:00Z",
+		"address": {"city": "Berlin"},
+		"tags": {"admin": true},
+		"homes": [{"city": "Paris"}],
+		"meta": {"7": {"id": "x"}}
+	}`
+
+	var u codecUser
+	require.NoError(t, unmarshal([]byte(data), &u))
+
+	assert.Equal(t, "1", u.ID)
+	assert.Equal(t, "alice", u.Name)
+	assert.Equal(t, "al", u.Nick)
+	assert.Empty(t, u.Secret)
+	assert.Equal(t, int64(1500000000123), u.Created.UnixNano()/int64(time.Millisecond))
+	require.NotNil(t, u.Updated)
+	assert.Equal(t, int64(1500000000456), u.Updated.UnixNano()/int64(time.Millisecond))
+	assert.True(t, u.Birthday.Equal(time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, &codecAddress{City: "Berlin"}, u.Address)
+	assert.Equal(t, map[string]bool{"admin": true}, u.Tags)
+	assert.Equal(t, []codecAddress{{City: "Paris"}}, u.Homes)
+	assert.Equal(t, map[int]codecBase{7: {ID: "x"}}, u.Meta)
+}
+
+func TestFirebaseTagsZeroTime(t *testing.T) {
+	t.Parallel()
+	type event struct {
+		At  time.Time  `firebase:"at"`
+		Ptr *time.Time `firebase:"ptr"`
+	}
+
+	b, err := marshal(event{Ptr: &time.Time{}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"at":null,"ptr":null}`, string(b))
+
+	e := event{At: time.Now()}
+	require.NoError(t, unmarshal(b, &e))
+	assert.True(t, e.At.IsZero())
+	assert.Nil(t, e.Ptr)
+}
+
+func TestUnmarshalFirebaseTagsInvalidTime(t *testing.T) {
+	t.Parallel()
+	var u codecUser
+	assert.Error(t, unmarshal([]byte(`{"created":"yesterday"}`), &u))
+}
+
+func TestSetValueFirebaseTags(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	before := time.Now().Add(-time.Second)
+	fb := New(server.URL, nil)
+	require.NoError(t, fb.Set(codecUser{Name: "alice"}))
+
+	var u codecUser
+	require.NoError(t, fb.Value(&u))
+	assert.Equal(t, "alice", u.Name)
+	assert.True(t, u.Created.After(before), "server timestamp was not resolved")
+}
+
+type codecItem struct {
+	Key  string `firebase:"$key"`
+	Name string `firebase:"name"`
+}
+
+func TestMarshalKeyField(t *testing.T) {
+	t.Parallel()
+	b, err := marshal(codecItem{Key: "-Kabc", Name: "a"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"a"}`, string(b))
+	_, err = New(URL, nil).encode(codecItem{Key: "-Kabc"}, false)
+	assert.NoError(t, err)
+}
+
+func TestUnmarshalObjectToSlice(t *testing.T) {
+	t.Parallel()
+	data := `{"-Kdef": {"name": "b"}, "-Kabc": {"name": "a"}, "10": {"name": "d"}, "9": {"name": "c"}}`
+
+	var items []codecItem
+	require.NoError(t, unmarshal([]byte(data), &items))
+	assert.Equal(t, []codecItem{
+		{Key: "9", Name: "c"},
+		{Key: "10", Name: "d"},
+		{Key: "-Kabc", Name: "a"},
+		{Key: "-Kdef", Name: "b"},
+	}, items)
+
+	var ptrs []*codecItem
+	require.NoError(t, unmarshal([]byte(data), &ptrs))
+	require.Len(t, ptrs, 4)
+	assert.Equal(t, &codecItem{Key: "-Kabc", Name: "a"}, ptrs[2])
+
+	var m map[string]codecItem
+	require.NoError(t, unmarshal([]byte(data), &m))
+	assert.Equal(t, codecItem{Key: "-Kdef", Name: "b"}, m["-Kdef"])
+
+	require.NoError(t, unmarshal([]byte(`[{"name": "a"}, null, {"name": "c"}]`), &items))
+	assert.Equal(t, []codecItem{{Key: "0", Name: "a"}, {}, {Key: "2", Name: "c"}}, items)
+}
+
+func TestValueObjectToSlice(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil).Child("items")
+	first, err := fb.Push(codecItem{Name: "a"})
+	require.NoError(t, err)
+	_, err = fb.Push(codecItem{Key: "ignored", Name: "b"})
+	require.NoError(t, err)
+
+	var items []codecItem
+	require.NoError(t, fb.Value(&items))
+	require.Len(t, items, 2)
+	assert.Equal(t, strings.TrimPrefix(first.URL(), fb.URL()+"/"), items[0].Key)
+	assert.Equal(t, "a", items[0].Name)
+	assert.Equal(t, "b", items[1].Name)
+}
+
+type codecPlayer struct {
+	Key      string      `firebase:"$key"`
+	Name     string      `firebase:"name"`
+	Priority interface{} `firebase:"$priority"`
+}
+
+func TestMarshalPriorityField(t *testing.T) {
+	t.Parallel()
+	b, err := marshal(codecPlayer{Name: "a", Priority: 10})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"a",".priority":10}`, string(b))
+
+	b, err = marshal(codecPlayer{Name: "a"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"a"}`, string(b))
+	_, err = New(URL, nil).encode(codecPlayer{Priority: "x"}, false)
+	assert.NoError(t, err)
+}
+
+func TestDecodeExportFormat(t *testing.T) {
+	t.Parallel()
+	response := `{
+		".priority": 1,
+		"-Kabc": {".priority": 20, "name": {".value": "alice", ".priority": "x"}},
+		"-Kdef": {"name": "bob"}
+	}`
+	server := newTestServer(response)
+	defer server.Close()
+	fb := New(server.URL, nil)
+	fb.IncludePriority(true)
+
+	var players []codecPlayer
+	require.NoError(t, fb.Value(&players))
+	assert.Equal(t, []codecPlayer{
+		{Key: "-Kabc", Name: "alice", Priority: float64(20)},
+		{Key: "-Kdef", Name: "bob"},
+	}, players)
+
+	var m map[string]codecPlayer
+	require.NoError(t, fb.Value(&m))
+	assert.Len(t, m, 2)
+
+	var plain map[string]map[string]string
+	require.NoError(t, fb.Value(&plain))
+	assert.Equal(t, map[string]map[string]string{
+		"-Kabc": {"name": "alice"},
+		"-Kdef": {"name": "bob"},
+	}, plain)
+
+	// without the export format, the data is left as is
+	fb.IncludePriority(false)
+	var raw map[string]interface{}
+	require.NoError(t, fb.Value(&raw))
+	assert.Contains(t, raw, ".priority")
+}
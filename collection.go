@@ -0,0 +1,204 @@
+package firego
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// The types in this file mimic the document API of Cloud Firestore on top
+// of Firebase paths so that code prototyped with firego can later be moved
+// to Firestore with few call site changes. A collection is stored as a node
+// whose children are its documents, and the subcollections of a document
+// are stored as children of the document's node, which means that they are
+// replaced when the document is set.
+
+// CollectionRef is a reference to a collection of documents.
+type CollectionRef struct {
+	// Parent is the document this collection belongs
+	// to, nil for top level collections.
+	Parent *DocumentRef
+	// ID of the collection
+	ID string
+	// Path of the collection relative to the root reference.
+	Path string
+
+	fb *Firebase
+}
+
+// DocumentRef is a reference to a document.
+type DocumentRef struct {
+	// Parent is the collection holding the document.
+	Parent *CollectionRef
+	// ID of the document
+	ID string
+	// Path of the document relative to the root reference.
+	Path string
+
+	fb *Firebase
+}
+
+// DocumentSnapshot is the contents of a document at the time it was read.
+type DocumentSnapshot struct {
+	// Ref is the reference of the document
+	Ref *DocumentRef
+
+	data json.RawMessage
+}
+
+// WriteResult is returned by writes to documents.
+type WriteResult struct {
+	// UpdateTime is the local time at which the write was acknowledged.
+	UpdateTime time.Time
+}
+
+// DocumentIterator lists the documents of a collection.
+type DocumentIterator struct {
+	ctx context.Context
+	c   *CollectionRef
+}
+
+// Collection returns a reference to the collection at path, made of
+// alternating collection and document IDs. It returns nil if path
+// points to a document.
+func (fb *Firebase) Collection(path string) *CollectionRef {
+	segments := splitPath(path)
+	if len(segments)%2 != 1 {
+		return nil
+	}
+
+	c := &CollectionRef{ID: segments[0], Path: segments[0], fb: fb}
+	for i := 1; i < len(segments); i += 2 {
+		c = c.Doc(segments[i]).Collection(segments[i+1])
+	}
+	return c
+}
+
+// Doc returns a reference to the document at path, made of alternating
+// collection and document IDs. It returns nil if path points to a
+// collection.
+func (fb *Firebase) Doc(path string) *DocumentRef {
+	segments := splitPath(path)
+	if len(segments) == 0 || len(segments)%2 != 0 {
+		return nil
+	}
+
+	last := len(segments) - 1
+	return fb.Collection(strings.Join(segments[:last], "/")).Doc(segments[last])
+}
+
+// Doc returns a reference to the document with the given ID.
+func (c *CollectionRef) Doc(id string) *DocumentRef {
+	return &DocumentRef{Parent: c, ID: id, Path: c.Path + "/" + id, fb: c.fb}
+}
+
+// NewDoc returns a reference to a document with a random ID.
+func (c *CollectionRef) NewDoc() *DocumentRef {
+	return c.Doc(randomDocID())
+}
+
+// Documents returns an iterator over the documents of the collection.
+func (c *CollectionRef) Documents(ctx context.Context) *DocumentIterator {
+	return &DocumentIterator{ctx: ctx, c: c}
+}
+
+// GetAll reads every document of the collection, ordered by ID.
+func (it *DocumentIterator) GetAll() ([]*DocumentSnapshot, error) {
+	_, body, err := it.c.fb.Child(it.c.Path).WithContext(it.ctx).doRequest("GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs map[string]json.RawMessage
+	if err := json.Unmarshal(body, &docs); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]interface{}, len(docs))
+	for id := range docs {
+		ids[id] = nil
+	}
+
+	snapshots := make([]*DocumentSnapshot, 0, len(docs))
+	for _, id := range sortedKeysByFirebase(ids) {
+		snapshots = append(snapshots, &DocumentSnapshot{Ref: it.c.Doc(id), data: docs[id]})
+	}
+	return snapshots, nil
+}
+
+// Collection returns a reference to a subcollection of the document.
+func (d *DocumentRef) Collection(id string) *CollectionRef {
+	return &CollectionRef{Parent: d, ID: id, Path: d.Path + "/" + id, fb: d.fb}
+}
+
+// Get reads the document. The snapshot of a document
+// that does not exist reports false from Exists.
+func (d *DocumentRef) Get(ctx context.Context) (*DocumentSnapshot, error) {
+	_, body, err := d.ref().WithContext(ctx).doRequest("GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	return &DocumentSnapshot{Ref: d, data: body}, nil
+}
+
+// Set replaces the contents of the document with data.
+func (d *DocumentRef) Set(ctx context.Context, data interface{}) (*WriteResult, error) {
+	ref := d.ref()
+	body, err := ref.encode(data, false)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := ref.WithContext(ctx).doRequest("PUT", body); err != nil {
+		return nil, err
+	}
+	return &WriteResult{UpdateTime: time.Now()}, nil
+}
+
+// Delete removes the document.
+func (d *DocumentRef) Delete(ctx context.Context) (*WriteResult, error) {
+	if _, _, err := d.ref().WithContext(ctx).doRequest("DELETE", nil); err != nil {
+		return nil, err
+	}
+	return &WriteResult{UpdateTime: time.Now()}, nil
+}
+
+func (d *DocumentRef) ref() *Firebase {
+	return d.fb.Child(d.Path)
+}
+
+// Exists reports whether the document existed when it was read.
+func (s *DocumentSnapshot) Exists() bool {
+	data := strings.TrimSpace(string(s.data))
+	return data != "" && data != "null"
+}
+
+// Data returns the fields of the document, or nil
+// if the document does not exist.
+func (s *DocumentSnapshot) Data() map[string]interface{} {
+	var m map[string]interface{}
+	if err := json.Unmarshal(s.data, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// DataTo decodes the document into v, honoring firebase struct tags.
+func (s *DocumentSnapshot) DataTo(v interface{}) error {
+	return s.Ref.fb.decode(s.data, v)
+}
+
+const docIDChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// randomDocID generates a 20 character ID like the ones used by Firestore.
+func randomDocID() string {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = docIDChars[int(b[i])%len(docIDChars)]
+	}
+	return string(b)
+}
@@ -0,0 +1,96 @@
+package firego
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestCollectionPaths(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil)
+
+	c := fb.Collection("/users/alice/posts/")
+	require.NotNil(t, c)
+	assert.Equal(t, "posts", c.ID)
+	assert.Equal(t, "users/alice/posts", c.Path)
+	assert.Equal(t, "alice", c.Parent.ID)
+	assert.Equal(t, "users", c.Parent.Parent.ID)
+	assert.Nil(t, c.Parent.Parent.Parent)
+
+	d := fb.Doc("users/alice")
+	require.NotNil(t, d)
+	assert.Equal(t, "alice", d.ID)
+	assert.Equal(t, "users/alice", d.Path)
+
+	assert.Nil(t, fb.Collection("users/alice"))
+	assert.Nil(t, fb.Collection(""))
+	assert.Nil(t, fb.Doc("users"))
+	assert.Nil(t, fb.Doc(""))
+
+	doc := fb.Collection("users").NewDoc()
+	assert.Len(t, doc.ID, 20)
+	assert.NotEqual(t, doc.ID, fb.Collection("users").NewDoc().ID)
+}
+
+func TestDocuments(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	ctx := context.Background()
+	fb := New(server.URL, nil)
+	users := fb.Collection("users")
+
+	type user struct {
+		Name string `firebase:"name"`
+	}
+	_, err := users.Doc("alice").Set(ctx, user{Name: "Alice"})
+	require.NoError(t, err)
+	_, err = users.Doc("bob").Set(ctx, map[string]interface{}{"name": "Bob"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "Alice"}, server.Get("users/alice"))
+
+	snap, err := users.Doc("alice").Get(ctx)
+	require.NoError(t, err)
+	assert.True(t, snap.Exists())
+	assert.Equal(t, map[string]interface{}{"name": "Alice"}, snap.Data())
+	var u user
+	require.NoError(t, snap.DataTo(&u))
+	assert.Equal(t, "Alice", u.Name)
+
+	snaps, err := users.Documents(ctx).GetAll()
+	require.NoError(t, err)
+	require.Len(t, snaps, 2)
+	assert.Equal(t, "alice", snaps[0].Ref.ID)
+	assert.Equal(t, "bob", snaps[1].Ref.ID)
+	assert.Equal(t, "Bob", snaps[1].Data()["name"])
+
+	_, err = users.Doc("alice").Delete(ctx)
+	require.NoError(t, err)
+	snap, err = users.Doc("alice").Get(ctx)
+	require.NoError(t, err)
+	assert.False(t, snap.Exists())
+	assert.Nil(t, snap.Data())
+
+	snaps, err = fb.Collection("empty").Documents(ctx).GetAll()
+	require.NoError(t, err)
+	assert.Empty(t, snaps)
+}
+
+func TestDocumentContext(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := New(server.URL, nil).Doc("users/alice").Get(ctx)
+	assert.Error(t, err)
+}
@@ -0,0 +1,320 @@
+package firego
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DiffKind describes how a location differs between two databases.
+type DiffKind int
+
+const (
+	// DiffMissing means the location exists in the source but
+	// not in the target.
+	DiffMissing DiffKind = iota + 1
+	// DiffExtra means the location exists in the target but
+	// not in the source.
+	DiffExtra
+	// DiffChanged means the location exists in both databases
+	// with different values.
+	DiffChanged
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffMissing:
+		return "missing"
+	case DiffExtra:
+		return "extra"
+	case DiffChanged:
+		return "changed"
+	}
+	return "unknown"
+}
+
+// Difference is a location whose value does not match between two databases.
+type Difference struct {
+	// Path of the location, relative to the compared references
+	Path string
+	// Kind of difference
+	Kind DiffKind
+}
+
+// CompareOptions configures how Compare walks the databases.
+type CompareOptions struct {
+	// MaxDepth is the number of levels that are walked using shallow reads
+	// before the children of a location are compared by value.
+	MaxDepth int
+	// PageSize is the number of children that are read at once when
+	// comparing by value. Defaults to 100.
+	PageSize int
+	// Repair makes the target match the source for every difference
+	// that is found.
+	Repair bool
+}
+
+const defaultComparePageSize = 100
+
+// Compare walks the data under src and dst and reports every location where
+// dst does not match src. The structure of the databases is discovered with
+// shallow reads and the values are fetched in pages ordered by key, so that
+// large databases never have to be loaded at once.
+//
+// When opts.Repair is set, dst is modified to match src as differences are
+// found.
+func Compare(src, dst *Firebase, opts CompareOptions) ([]Difference, error) {
+	if opts.PageSize < 1 {
+		opts.PageSize = defaultComparePageSize
+	}
+
+	c := &comparer{src: src, dst: dst, opts: opts}
+	if err := c.walk("", 0); err != nil {
+		return c.diffs, err
+	}
+	return c.diffs, nil
+}
+
+type comparer struct {
+	src, dst *Firebase
+	opts     CompareOptions
+	diffs    []Difference
+}
+
+func (c *comparer) walk(path string, depth int) error {
+	a, err := shallowValue(c.src.at(path))
+	if err != nil {
+		return err
+	}
+	b, err := shallowValue(c.dst.at(path))
+	if err != nil {
+		return err
+	}
+
+	aMap, aOK := a.(map[string]interface{})
+	bMap, bOK := b.(map[string]interface{})
+	if !aOK || !bOK {
+		if aOK || bOK || !reflect.DeepEqual(a, b) {
+			return c.report(path, a, b)
+		}
+		return nil
+	}
+
+	if depth >= c.opts.MaxDepth {
+		return c.compareChildren(path)
+	}
+
+	for _, k := range sortedKeys(aMap) {
+		if _, ok := bMap[k]; !ok {
+			if err := c.report(joinPath(path, k), aMap[k], nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.walk(joinPath(path, k), depth+1); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range sortedKeys(bMap) {
+		if _, ok := aMap[k]; !ok {
+			if err := c.report(joinPath(path, k), nil, bMap[k]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compareChildren pages through the children of path in both databases
+// in key order and compares them by value.
+func (c *comparer) compareChildren(path string) error {
+	var start string
+	for {
+		limit := c.opts.PageSize
+		if start != "" {
+			// startAt is inclusive, so we will get the
+			// last key of the previous page back
+			limit++
+		}
+
+		a, err := keyPage(c.src.at(path), start, "", int64(limit))
+		if err != nil {
+			return err
+		}
+
+		keys := sortedKeysByFirebase(a)
+		full := len(keys) == limit
+		if len(keys) == 0 {
+			return c.compareExtra(path, start)
+		}
+
+		// the destination is read up to the last key of the page so
+		// that both hold the same range of keys
+		end := keys[len(keys)-1]
+		b, err := keyPage(c.dst.at(path), start, end, 0)
+		if err != nil {
+			return err
+		}
+
+		if start != "" {
+			delete(a, start)
+			delete(b, start)
+		}
+
+		for _, k := range sortedKeys(a) {
+			bv, ok := b[k]
+			if ok && reflect.DeepEqual(a[k], bv) {
+				continue
+			}
+			if err := c.report(joinPath(path, k), a[k], bv); err != nil {
+				return err
+			}
+		}
+		for _, k := range sortedKeys(b) {
+			if _, ok := a[k]; !ok {
+				if err := c.report(joinPath(path, k), nil, b[k]); err != nil {
+					return err
+				}
+			}
+		}
+
+		if !full {
+			return c.compareExtra(path, end)
+		}
+		start = end
+	}
+}
+
+// compareExtra pages through the children of path in the destination
+// whose keys sort after the given one, which are not in the source.
+func (c *comparer) compareExtra(path, after string) error {
+	for {
+		limit := c.opts.PageSize
+		if after != "" {
+			limit++
+		}
+
+		b, err := keyPage(c.dst.at(path), after, "", int64(limit))
+		if err != nil {
+			return err
+		}
+
+		keys := sortedKeysByFirebase(b)
+		for _, k := range keys {
+			if k == after {
+				continue
+			}
+			if err := c.report(joinPath(path, k), nil, b[k]); err != nil {
+				return err
+			}
+		}
+
+		if len(keys) < limit {
+			return nil
+		}
+		after = keys[len(keys)-1]
+	}
+}
+
+func (c *comparer) report(path string, a, b interface{}) error {
+	kind := DiffChanged
+	switch {
+	case b == nil:
+		kind = DiffMissing
+	case a == nil:
+		kind = DiffExtra
+	}
+	c.diffs = append(c.diffs, Difference{Path: "/" + path, Kind: kind})
+
+	if !c.opts.Repair {
+		return nil
+	}
+
+	if kind == DiffExtra {
+		return c.dst.at(path).Remove()
+	}
+
+	// the value we have might be shallow, fetch all of it
+	var v interface{}
+	if err := c.src.at(path).Value(&v); err != nil {
+		return err
+	}
+	return c.dst.at(path).Set(v)
+}
+
+func shallowValue(fb *Firebase) (interface{}, error) {
+	fb.Shallow(true)
+	var v interface{}
+	err := fb.Value(&v)
+	return v, err
+}
+
+// keyPage reads the children of fb ordered by key, starting at start
+// and ending at end. Empty bounds and non positive limits are ignored.
+func keyPage(fb *Firebase, start, end string, limit int64) (map[string]interface{}, error) {
+	fb = fb.OrderBy("$key").StartAtValue(start).EndAtValue(end).LimitToFirst(limit)
+
+	var v interface{}
+	if err := fb.Value(&v); err != nil {
+		return nil, err
+	}
+
+	m, _ := v.(map[string]interface{})
+	if m == nil {
+		m = map[string]interface{}{}
+	}
+	return m, nil
+}
+
+func joinPath(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	return parent + "/" + child
+}
+
+// sortedKeysByFirebase returns the keys of m in the order that Firebase
+// sorts them by key.
+func sortedKeysByFirebase(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return compareKeys(keys[i], keys[j]) < 0
+	})
+	return keys
+}
+
+// SortKeys sorts keys in the order Firebase sorts children by key, as
+// needed to page through children with OrderBy("$key") and StartAtValue.
+func SortKeys(keys []string) {
+	sort.Slice(keys, func(i, j int) bool {
+		return compareKeys(keys[i], keys[j]) < 0
+	})
+}
+
+// compareKeys orders keys the same way Firebase does, keys that can be
+// parsed as 32-bit integers come first in numeric order followed by
+// the remaining keys in lexicographic order.
+func compareKeys(a, b string) int {
+	ai, aErr := strconv.ParseInt(a, 10, 32)
+	bi, bErr := strconv.ParseInt(b, 10, 32)
+	switch {
+	case aErr == nil && bErr == nil:
+		switch {
+		case ai < bi:
+			return -1
+		case ai > bi:
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
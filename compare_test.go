@@ -0,0 +1,155 @@
+package firego
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func setupCompare(t *testing.T) (*firetest.Firetest, *firetest.Firetest) {
+	src := firetest.New()
+	src.Start()
+	dst := firetest.New()
+	dst.Start()
+
+	users := map[string]interface{}{
+		"1": map[string]interface{}{"name": "alice"},
+		"2": map[string]interface{}{"name": "bob"},
+		"3": map[string]interface{}{"name": "carol"},
+		"4": map[string]interface{}{"name": "dave"},
+		"5": map[string]interface{}{"name": "erin"},
+	}
+	src.Set("users", users)
+	src.Set("version", 2.0)
+	dst.Set("users", users)
+	dst.Set("version", 1.0)
+
+	dst.Delete("users/2")
+	dst.Set("users/4/name", "dan")
+	dst.Set("users/6", map[string]interface{}{"name": "frank"})
+	dst.Set("legacy", true)
+	return src, dst
+}
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+	for _, opts := range []CompareOptions{
+		{MaxDepth: 0, PageSize: 2},
+		{MaxDepth: 1, PageSize: 2},
+		{MaxDepth: 5, PageSize: 2},
+		{MaxDepth: 1},
+	} {
+		src, dst := setupCompare(t)
+
+		diffs, err := Compare(New(src.URL, nil), New(dst.URL, nil), opts)
+		require.NoError(t, err)
+
+		var expected []Difference
+		switch opts.MaxDepth {
+		case 0:
+			expected = []Difference{
+				{Path: "/legacy", Kind: DiffExtra},
+				{Path: "/users", Kind: DiffChanged},
+				{Path: "/version", Kind: DiffChanged},
+			}
+		case 1:
+			expected = []Difference{
+				{Path: "/legacy", Kind: DiffExtra},
+				{Path: "/users/2", Kind: DiffMissing},
+				{Path: "/users/4", Kind: DiffChanged},
+				{Path: "/users/6", Kind: DiffExtra},
+				{Path: "/version", Kind: DiffChanged},
+			}
+		default:
+			expected = []Difference{
+				{Path: "/legacy", Kind: DiffExtra},
+				{Path: "/users/2", Kind: DiffMissing},
+				{Path: "/users/4/name", Kind: DiffChanged},
+				{Path: "/users/6", Kind: DiffExtra},
+				{Path: "/version", Kind: DiffChanged},
+			}
+		}
+		assert.ElementsMatch(t, expected, diffs, "%#v", opts)
+
+		src.Close()
+		dst.Close()
+	}
+}
+
+func TestCompareRepair(t *testing.T) {
+	t.Parallel()
+	src, dst := setupCompare(t)
+	defer src.Close()
+	defer dst.Close()
+
+	diffs, err := Compare(New(src.URL, nil), New(dst.URL, nil), CompareOptions{MaxDepth: 1, PageSize: 2, Repair: true})
+	require.NoError(t, err)
+	assert.Len(t, diffs, 5)
+
+	assert.Equal(t, src.Get(""), dst.Get(""))
+
+	diffs, err = Compare(New(src.URL, nil), New(dst.URL, nil), CompareOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+}
+
+func TestCompareBoundsPages(t *testing.T) {
+	t.Parallel()
+	src := firetest.New()
+	src.Start()
+	defer src.Close()
+	dst := firetest.New()
+	dst.Start()
+	defer dst.Close()
+
+	for i := 1; i <= 12; i++ {
+		if i <= 3 {
+			src.Set(fmt.Sprintf("users/%d", i), "user")
+		}
+		dst.Set(fmt.Sprintf("users/%d", i), "user")
+	}
+
+	var mtx sync.Mutex
+	var unbounded []string
+	dstRef := New(dst.URL, nil)
+	dstRef.BeforeSend(func(req *http.Request, body []byte) error {
+		q := req.URL.Query()
+		if q.Get("orderBy") != "" && q.Get("limitToFirst") == "" && q.Get("endAt") == "" {
+			mtx.Lock()
+			unbounded = append(unbounded, req.URL.String())
+			mtx.Unlock()
+		}
+		return nil
+	})
+
+	diffs, err := Compare(New(src.URL, nil), dstRef, CompareOptions{MaxDepth: 1, PageSize: 2})
+	require.NoError(t, err)
+	var expected []Difference
+	for i := 4; i <= 12; i++ {
+		expected = append(expected, Difference{Path: fmt.Sprintf("/users/%d", i), Kind: DiffExtra})
+	}
+	assert.ElementsMatch(t, expected, diffs)
+	assert.Empty(t, unbounded)
+}
+
+func TestCompareKeys(t *testing.T) {
+	t.Parallel()
+	ordered := []string{"-1", "2", "10", "100", "a", "b", "ba"}
+	for i := 0; i < len(ordered)-1; i++ {
+		assert.True(t, compareKeys(ordered[i], ordered[i+1]) < 0, "%s < %s", ordered[i], ordered[i+1])
+		assert.True(t, compareKeys(ordered[i+1], ordered[i]) > 0, "%s > %s", ordered[i+1], ordered[i])
+	}
+	assert.Equal(t, 0, compareKeys("a", "a"))
+}
+
+func TestSortKeys(t *testing.T) {
+	t.Parallel()
+	keys := []string{"b", "10", "a", "2", "-1"}
+	SortKeys(keys)
+	assert.Equal(t, []string{"-1", "2", "10", "a", "b"}, keys)
+}
@@ -0,0 +1,334 @@
+package firego
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// defaultCompoundSeparator separates the fields of compound keys unless
+// set otherwise. It is the ASCII unit separator, which sorts before the
+// characters allowed in keys for the keys to sort by their first field.
+const defaultCompoundSeparator = "\x1f"
+
+// CompoundIndex maintains, in every child of a location, a denormalized
+// child concatenating several of its fields, such as "status_timestamp",
+// for the children to be queried by more than one field at once, which
+// Firebase can not do on its own:
+//
+//    index := firego.NewCompoundIndex("status", "timestamp")
+//    err := index.Set(fb.Child("orders/1"), order)
+//    ...
+//    pending, err := index.Query(fb.Child("orders"), "pending")
+//    ...
+//    recent, err := index.Range(fb.Child("orders"), []interface{}{"pending"}, since, nil)
+//
+// The child is only kept up to date by writes made through the index, and
+// it is left out of the children missing any of the fields. It should be
+// indexed with an ".indexOn" rule for the queries to be efficient.
+//
+// Compound keys sort by their fields in order: strings as is, numbers by
+// value and false before true. Strings holding control characters and
+// other types of values can not be part of a compound key.
+type CompoundIndex struct {
+	// Child is the name of the child holding the compound key. It
+	// defaults to the fields joined by underscores.
+	Child string
+	// Fields are the children the key is made of, in order. A field may
+	// be the path of a nested child, e.g. "meta/created".
+	Fields []string
+	// Separator is put between the fields of the key. It defaults to
+	// the ASCII unit separator. Other separators are more readable but
+	// make the strings sort before their extensions that continue with
+	// lower characters, e.g. with "_" the key of "ab" sorts before "a".
+	Separator string
+}
+
+// NewCompoundIndex creates an index of the given fields, held by the
+// child named after the fields joined by underscores.
+func NewCompoundIndex(fields ...string) *CompoundIndex {
+	return &CompoundIndex{
+		Child:  strings.Replace(strings.Join(fields, "_"), "/", "_", -1),
+		Fields: fields,
+	}
+}
+
+// Key returns the compound key of the given values of the fields. Fewer
+// values than fields give the prefix shared by the keys starting with
+// them.
+func (ci *CompoundIndex) Key(values ...interface{}) (string, error) {
+	if len(values) > len(ci.Fields) {
+		return "", fmt.Errorf("%d values given for %d fields", len(values), len(ci.Fields))
+	}
+	components := make([]string, len(values))
+	for i, value := range values {
+		v, err := jsonValue(value)
+		if err != nil {
+			return "", err
+		}
+		if components[i], err = ci.component(ci.Fields[i], v); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(components, ci.separator()), nil
+}
+
+// Set writes v at ref along with its compound key.
+func (ci *CompoundIndex) Set(ref *Firebase, v interface{}) error {
+	tree, err := ci.withKey(v)
+	if err != nil {
+		return err
+	}
+	return ref.Set(tree)
+}
+
+// Push creates a child of ref holding v along with its compound key.
+func (ci *CompoundIndex) Push(ref *Firebase, v interface{}) (*Firebase, error) {
+	tree, err := ci.withKey(v)
+	if err != nil {
+		return nil, err
+	}
+	return ref.Push(tree)
+}
+
+// Update updates the children of ref with v and, if v changes any of the
+// fields, its compound key. The fields left unchanged are read from ref
+// first, which means that the key may be stale if they are concurrently
+// changed by writes not made through the index.
+func (ci *CompoundIndex) Update(ref *Firebase, v interface{}) error {
+	tree, err := jsonValue(v)
+	if err != nil {
+		return err
+	}
+	update, ok := tree.(map[string]interface{})
+	if !ok {
+		return ref.Update(v)
+	}
+
+	values := make([]interface{}, len(ci.Fields))
+	var changed bool
+	for i, field := range ci.Fields {
+		value, ok := fieldUpdate(update, field)
+		if !ok {
+			continue
+		}
+		values[i] = value
+		changed = true
+	}
+	if !changed {
+		return ref.Update(v)
+	}
+
+	for i, field := range ci.Fields {
+		if _, ok := fieldUpdate(update, field); ok {
+			continue
+		}
+		if err := ref.Child(field).Value(&values[i]); err != nil {
+			return err
+		}
+	}
+
+	key, err := ci.keyOf(values)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		update[ci.Child] = nil
+	} else {
+		update[ci.Child] = *key
+	}
+	return ref.Update(update)
+}
+
+// Query returns a query of the children of fb whose leading fields are
+// equal to values, ordered by their compound key. All of the fields may
+// be given to find the children matching them exactly.
+func (ci *CompoundIndex) Query(fb *Firebase, values ...interface{}) (*Firebase, error) {
+	prefix, err := ci.Key(values...)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == len(ci.Fields) {
+		c := fb.OrderBy(ci.Child)
+		c.params.Set(equalToParam, jsonString(prefix))
+		c.params.Del(startAtParam)
+		c.params.Del(endAtParam)
+		return c, nil
+	}
+	if len(values) > 0 {
+		prefix += ci.separator()
+	}
+	return fb.SearchPrefix(ci.Child, prefix, 0), nil
+}
+
+// Range returns a query of the children of fb whose leading fields are
+// equal to values and whose next field is between start and end,
+// inclusive, ordered by their compound key. A nil start or end leaves
+// the range open on that side.
+func (ci *CompoundIndex) Range(fb *Firebase, values []interface{}, start, end interface{}) (*Firebase, error) {
+	if len(values) >= len(ci.Fields) {
+		return nil, fmt.Errorf("%d values given for %d fields, leaving none to query a range of", len(values), len(ci.Fields))
+	}
+	prefix, err := ci.Key(values...)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) > 0 {
+		prefix += ci.separator()
+	}
+
+	field := ci.Fields[len(values)]
+	from, to := prefix, prefix+prefixSentinel
+	if start != nil {
+		s, err := ci.bound(field, start)
+		if err != nil {
+			return nil, err
+		}
+		from = prefix + s
+	}
+	if end != nil {
+		e, err := ci.bound(field, end)
+		if err != nil {
+			return nil, err
+		}
+		// the keys with further fields sort after the value alone
+		to = prefix + e
+		if len(values)+1 < len(ci.Fields) {
+			to += ci.separator() + prefixSentinel
+		}
+	}
+
+	c := fb.OrderBy(ci.Child)
+	c.params.Set(startAtParam, jsonString(from))
+	c.params.Set(endAtParam, jsonString(to))
+	c.params.Del(equalToParam)
+	return c, nil
+}
+
+// withKey returns v as a JSON tree holding its compound key.
+func (ci *CompoundIndex) withKey(v interface{}) (interface{}, error) {
+	tree, err := jsonValue(v)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := tree.(map[string]interface{})
+	if !ok {
+		return tree, nil
+	}
+
+	values := make([]interface{}, len(ci.Fields))
+	for i, field := range ci.Fields {
+		values[i] = valueAt(m, splitPath(field))
+	}
+	key, err := ci.keyOf(values)
+	if err != nil {
+		return nil, err
+	}
+	delete(m, ci.Child)
+	if key != nil {
+		m[ci.Child] = *key
+	}
+	return m, nil
+}
+
+// keyOf returns the compound key of the given JSON values of all of the
+// fields, nil if any of them is missing.
+func (ci *CompoundIndex) keyOf(values []interface{}) (*string, error) {
+	components := make([]string, len(values))
+	for i, value := range values {
+		if value == nil {
+			return nil, nil
+		}
+		var err error
+		if components[i], err = ci.component(ci.Fields[i], value); err != nil {
+			return nil, err
+		}
+	}
+	key := strings.Join(components, ci.separator())
+	return &key, nil
+}
+
+// bound returns the component of the key for a bound of a range.
+func (ci *CompoundIndex) bound(field string, value interface{}) (string, error) {
+	v, err := jsonValue(value)
+	if err != nil {
+		return "", err
+	}
+	return ci.component(field, v)
+}
+
+// component returns the part of a compound key holding the JSON value of
+// field, encoded for keys to sort by their fields.
+func (ci *CompoundIndex) component(field string, v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		if strings.Contains(v, ci.separator()) || strings.IndexFunc(v, unicode.IsControl) >= 0 {
+			return "", fmt.Errorf("value %q of %q holds control characters or the separator of compound keys", v, field)
+		}
+		return v, nil
+	case float64:
+		return sortableFloat(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("value of %q can not be part of a compound key, got %T", field, v)
+}
+
+func (ci *CompoundIndex) separator() string {
+	if ci.Separator == "" {
+		return defaultCompoundSeparator
+	}
+	return ci.Separator
+}
+
+// sortableFloat encodes f as 16 hexadecimal digits sorting
+// lexicographically like the numbers they encode.
+func sortableFloat(f float64) string {
+	if f == 0 {
+		// -0 and 0 are equal
+		f = 0
+	}
+	bits := math.Float64bits(f)
+	if f < 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return fmt.Sprintf("%016x", bits)
+}
+
+// fieldUpdate returns the value update gives to field, if any, update
+// being the children given to Update, which may be slash separated paths.
+func fieldUpdate(update map[string]interface{}, field string) (interface{}, bool) {
+	path := splitPath(field)
+	for k, v := range update {
+		segments := splitPath(k)
+		if len(segments) > len(path) {
+			if strings.Join(segments[:len(path)], "/") == strings.Join(path, "/") {
+				// a part of the field is changed, which makes it an object
+				return map[string]interface{}{}, true
+			}
+			continue
+		}
+		if strings.Join(segments, "/") == strings.Join(path[:len(segments)], "/") {
+			return valueAt(v, path[len(segments):]), true
+		}
+	}
+	return nil, false
+}
+
+// jsonValue returns v as decoded from its JSON encoding.
+func jsonValue(v interface{}) (interface{}, error) {
+	b, err := marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var tree interface{}
+	if err := json.Unmarshal(b, &tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
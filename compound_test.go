@@ -0,0 +1,99 @@
+package firego
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestCompoundIndexKey(t *testing.T) {
+	t.Parallel()
+	index := NewCompoundIndex("status", "meta/timestamp")
+	assert.Equal(t, "status_meta_timestamp", index.Child)
+
+	key, err := index.Key("pending", 12)
+	require.NoError(t, err)
+	assert.Equal(t, "pending\x1f"+sortableFloat(12), key)
+
+	key, err = index.Key("pending")
+	require.NoError(t, err)
+	assert.Equal(t, "pending", key)
+
+	_, err = index.Key("pending\nreview")
+	assert.Error(t, err)
+	_, err = index.Key("pending", map[string]interface{}{})
+	assert.Error(t, err)
+	_, err = index.Key("pending", 1, 2)
+	assert.Error(t, err)
+}
+
+func TestSortableFloat(t *testing.T) {
+	t.Parallel()
+	numbers := []float64{-1e10, -2.5, -1, 0, 0.5, 1, 2, 10, 1e10, 1483228800000}
+	encoded := make([]string, len(numbers))
+	for i, n := range numbers {
+		encoded[i] = sortableFloat(n)
+	}
+	assert.True(t, sort.StringsAreSorted(encoded), "%v", encoded)
+}
+
+func TestCompoundIndex(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	fb := New(server.URL, nil)
+	orders := fb.Child("orders")
+
+	index := NewCompoundIndex("status", "timestamp")
+	for id, order := range map[string]map[string]interface{}{
+		"a": {"status": "pending", "timestamp": 3},
+		"b": {"status": "pending", "timestamp": 20},
+		"c": {"status": "shipped", "timestamp": 1},
+		"d": {"status": "pending"},
+	} {
+		require.NoError(t, index.Set(orders.Child(id), order))
+	}
+	_, err := index.Push(orders, map[string]interface{}{"status": "pendingX", "timestamp": 2})
+	require.NoError(t, err)
+
+	var v map[string]interface{}
+	require.NoError(t, orders.Child("d").Value(&v))
+	assert.NotContains(t, v, index.Child, "children missing fields are left out")
+
+	keys := func(query *Firebase, err error) []string {
+		require.NoError(t, err)
+		var v map[string]interface{}
+		require.NoError(t, query.Value(&v))
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	assert.Equal(t, []string{"a", "b"}, keys(index.Query(orders, "pending")))
+	assert.Equal(t, []string{"b"}, keys(index.Query(orders, "pending", 20)))
+	assert.Equal(t, []string{"b"}, keys(index.Range(orders, []interface{}{"pending"}, 10, nil)))
+	assert.Equal(t, []string{"a"}, keys(index.Range(orders, []interface{}{"pending"}, nil, 3)))
+	assert.Equal(t, []string{"a", "b"}, keys(index.Range(orders, nil, "pending", "pending")))
+	assert.Len(t, keys(index.Range(orders, nil, "pendingX", "shipped")), 2)
+
+	// the key follows the fields changed, even partially
+	require.NoError(t, index.Update(orders.Child("a"), map[string]interface{}{"status": "shipped"}))
+	assert.Equal(t, []string{"a", "c"}, keys(index.Query(orders, "shipped")))
+	require.NoError(t, index.Update(orders.Child("d"), map[string]interface{}{"timestamp": 5}))
+	assert.Equal(t, []string{"b", "d"}, keys(index.Query(orders, "pending")))
+
+	// and is removed along with them
+	require.NoError(t, index.Update(orders.Child("b"), map[string]interface{}{"timestamp": nil}))
+	v = nil
+	require.NoError(t, orders.Child("b").Value(&v))
+	assert.Equal(t, map[string]interface{}{"status": "pending"}, v)
+
+	_, err = index.Range(orders, []interface{}{"pending", 1}, nil, nil)
+	assert.Error(t, err)
+}
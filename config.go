@@ -0,0 +1,217 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// ConfigFunc validates the configuration about to be applied, next being
+// a pointer to a new copy of the configuration struct. Returning an error
+// rejects it, the current configuration being kept.
+type ConfigFunc func(next interface{}) error
+
+// LiveConfig is a configuration struct bound to a node by Config.
+type LiveConfig struct {
+	typ      reflect.Type
+	defaults []byte
+	validate ConfigFunc
+
+	current atomic.Value
+	tree    interface{}
+
+	mtx     sync.Mutex
+	err     error
+	changed chan struct{}
+}
+
+// Config binds the configuration struct cfg points to to the node at fb,
+// keeping it up to date as the node changes until ctx is done:
+//
+//    type Limits struct {
+//        MaxUsers int    `firebase:"maxUsers"`
+//        Banner   string `firebase:"banner"`
+//    }
+//    live, err := firego.Config(ctx, fb.Child("config/limits"), &Limits{MaxUsers: 10}, nil)
+//    if err != nil {
+//        log.Fatal(err)
+//    }
+//    limits := live.Load().(*Limits)
+//
+// The value of cfg holds the defaults of the fields missing from the node,
+// and is not modified. Every change to the node is decoded into a new copy
+// of the struct, passed to onChange, if set, to be validated, and then made
+// the current configuration by atomically swapping the pointer Load
+// returns, so that readers always see a whole configuration without
+// locking. A struct is never modified once it was returned by Load.
+//
+// Config returns once the initial configuration was applied, and fails if
+// the node can not be watched or its data is rejected. Later changes that
+// are rejected, as well as lost connections, are logged and reported by
+// Err, the node being watched again after a second.
+func Config(ctx context.Context, fb *Firebase, cfg interface{}, onChange ConfigFunc) (*LiveConfig, error) {
+	rv := reflect.ValueOf(cfg)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil, errors.New("firego: config must be a non-nil pointer")
+	}
+	defaults, err := marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the default config %w", err)
+	}
+
+	c := &LiveConfig{
+		typ:      rv.Type().Elem(),
+		defaults: defaults,
+		validate: onChange,
+		changed:  make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	events := WatchMulti(ctx, fb)
+
+	// apply the initial configuration before returning
+	for event := range events {
+		if event.Type == EventTypePut || event.Type == EventTypePatch {
+			if err := c.apply(event.Event); err != nil {
+				cancel()
+				return nil, err
+			}
+			break
+		}
+		if err := eventError(event.Event); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	if ctx.Err() != nil {
+		cancel()
+		return nil, ctx.Err()
+	}
+
+	go func() {
+		defer cancel()
+		for event := range events {
+			switch event.Type {
+			case EventTypePut, EventTypePatch:
+				if err := c.apply(event.Event); err != nil {
+					log.Printf("Config: %s", err)
+				}
+			default:
+				if err := eventError(event.Event); err != nil {
+					c.setErr(err)
+					log.Printf("Config: %s", err)
+				}
+			}
+		}
+	}()
+	return c, nil
+}
+
+// Load returns a pointer to the current configuration, of the type of
+// the pointer given to Config.
+func (c *LiveConfig) Load() interface{} {
+	return c.current.Load()
+}
+
+// Err returns the reason the last change to the node was not applied,
+// or why the connection was lost since, or nil.
+func (c *LiveConfig) Err() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.err
+}
+
+// Changed returns a channel closed when the configuration is next
+// replaced, for waiting on changes:
+//
+//    for {
+//        changed := live.Changed()
+//        reconfigure(live.Load().(*Limits))
+//        <-changed
+//    }
+func (c *LiveConfig) Changed() <-chan struct{} {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.changed
+}
+
+// apply updates the copy of the node with the event and
+// swaps the configuration if it changed and is valid.
+func (c *LiveConfig) apply(event Event) error {
+	c.tree = applyEvent(c.tree, event)
+
+	next := reflect.New(c.typ)
+	err := unmarshal(c.defaults, next.Interface())
+	if err == nil && c.tree != nil {
+		var data []byte
+		if data, err = marshal(c.tree); err == nil {
+			err = unmarshal(data, next.Interface())
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to decode the config %w", err)
+	}
+	if current := c.Load(); err == nil && current != nil && reflect.DeepEqual(current, next.Interface()) {
+		return c.setErr(nil)
+	}
+	if err == nil && c.validate != nil {
+		if err = c.validate(next.Interface()); err != nil {
+			err = fmt.Errorf("config rejected. %w", err)
+		}
+	}
+	if err != nil {
+		return c.setErr(err)
+	}
+
+	c.current.Store(next.Interface())
+	c.mtx.Lock()
+	c.err = nil
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.mtx.Unlock()
+	return nil
+}
+
+func (c *LiveConfig) setErr(err error) error {
+	c.mtx.Lock()
+	c.err = err
+	c.mtx.Unlock()
+	return err
+}
+
+// eventError returns the error ending a stream with the
+// given event, or nil if it is not the last of its stream.
+func eventError(event Event) error {
+	switch event.Type {
+	case EventTypeError:
+		if err, ok := event.Data.(error); ok {
+			return err
+		}
+		return fmt.Errorf("watch failed: %v", event.Data)
+	case EventTypeCancel, EventTypeAuthRevoked:
+		return fmt.Errorf("watch ended by %s event", event.Type)
+	}
+	return nil
+}
+
+// applyEvent returns tree, the data at a watched location, updated with
+// the put or patch event received for it.
+func applyEvent(tree interface{}, event Event) interface{} {
+	if event.Seq == 1 {
+		// the first event holds the whole of the location
+		return event.Data
+	}
+	path := splitPath(event.Path)
+	if event.Type == EventTypePatch {
+		children, _ := event.Data.(map[string]interface{})
+		for k, v := range children {
+			tree = setValueAt(tree, append(path[:len(path):len(path)], k), v)
+		}
+		return tree
+	}
+	return setValueAt(tree, path, event.Data)
+}
@@ -0,0 +1,84 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+type testConfig struct {
+	MaxUsers int             `firebase:"maxUsers"`
+	Banner   string          `firebase:"banner"`
+	Flags    map[string]bool `firebase:"flags"`
+}
+
+func waitChanged(t *testing.T, changed <-chan struct{}) {
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		require.FailNow(t, "config did not change")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("config", map[string]interface{}{"banner": "hello"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	defaults := &testConfig{MaxUsers: 10, Flags: map[string]bool{"beta": false}}
+	validate := func(next interface{}) error {
+		if next.(*testConfig).MaxUsers < 0 {
+			return errors.New("negative maxUsers")
+		}
+		return nil
+	}
+	live, err := Config(ctx, New(server.URL, nil).Child("config"), defaults, validate)
+	require.NoError(t, err)
+
+	initial := live.Load().(*testConfig)
+	assert.Equal(t, &testConfig{MaxUsers: 10, Banner: "hello", Flags: map[string]bool{"beta": false}}, initial)
+
+	changed := live.Changed()
+	server.Set("config/flags/beta", true)
+	waitChanged(t, changed)
+	current := live.Load().(*testConfig)
+	assert.True(t, current.Flags["beta"])
+	assert.NoError(t, live.Err())
+
+	// neither the defaults nor the previous configuration are modified
+	assert.False(t, defaults.Flags["beta"])
+	assert.False(t, initial.Flags["beta"])
+
+	// invalid changes are rejected
+	server.Set("config/maxUsers", -1)
+	eventually(t, func() bool { return live.Err() != nil }, "change was not rejected")
+	assert.Same(t, current, live.Load())
+
+	changed = live.Changed()
+	server.Set("config/maxUsers", 20)
+	waitChanged(t, changed)
+	assert.Equal(t, 20, live.Load().(*testConfig).MaxUsers)
+	assert.NoError(t, live.Err())
+}
+
+func TestConfigInvalid(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("config/maxUsers", "many")
+
+	_, err := Config(context.Background(), New(server.URL, nil).Child("config"), &testConfig{}, nil)
+	assert.Error(t, err)
+
+	_, err = Config(context.Background(), New(server.URL, nil), testConfig{}, nil)
+	assert.Error(t, err)
+}
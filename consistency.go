@@ -0,0 +1,71 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ConsistencyToken identifies the data written to a location by
+// SetWithToken, so that it can be read back with ValueAfter.
+type ConsistencyToken struct {
+	// ETag is the ETag of the data written, as returned by Firebase.
+	ETag string
+
+	url string
+}
+
+// SetWithToken behaves like Set and returns a token identifying the data
+// written, for reads that need to see it even when going through caches.
+func (fb *Firebase) SetWithToken(v interface{}) (ConsistencyToken, error) {
+	bytes, err := fb.encode(v, false)
+	if err != nil {
+		return ConsistencyToken{}, err
+	}
+	headers, _, err := fb.doRequest("PUT", bytes, withHeader("X-Firebase-ETag", "true"))
+	if err != nil {
+		return ConsistencyToken{}, err
+	}
+
+	etag := headers.Get("ETag")
+	if etag == "" {
+		return ConsistencyToken{}, errors.New("no etag returned by Firebase")
+	}
+	return ConsistencyToken{ETag: etag, url: fb.url}, nil
+}
+
+// ValueAfter gets the value of the Firebase reference once it reflects the
+// write token was returned for, reading it again, with the delays of the
+// reference's RetryPolicy, until it does or ctx is done:
+//
+//    token, err := fb.SetWithToken(order)
+//    ...
+//    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+//    defer cancel()
+//    err = fb.ValueAfter(ctx, token, &order)
+//
+// The data is compared by ETag, so a write made by someone else in the
+// meantime means the version is never seen, use a context with a deadline.
+func (fb *Firebase) ValueAfter(ctx context.Context, token ConsistencyToken, v interface{}) error {
+	if token.url != fb.url {
+		return fmt.Errorf("consistency token of %s used to read %s", token.url, fb.url)
+	}
+
+	ref := fb.WithContext(ctx)
+	for attempt := 1; ; attempt++ {
+		headers, body, err := ref.doRequest("GET", nil, withHeader("X-Firebase-ETag", "true"))
+		if err != nil {
+			return err
+		}
+		if headers.Get("ETag") == token.ETag {
+			return fb.decode(body, v)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("written data not seen after %d reads: %w", attempt, ctx.Err())
+		case <-time.After(fb.retry.backoff(attempt)):
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueAfter(t *testing.T) {
+	t.Parallel()
+	var reads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "true", req.Header.Get("X-Firebase-ETag"))
+		switch req.Method {
+		case "PUT":
+			w.Header().Set("ETag", "new")
+			fmt.Fprint(w, `"bar"`)
+		case "GET":
+			// the first reads go through a stale cache
+			if atomic.AddInt32(&reads, 1) < 3 {
+				w.Header().Set("ETag", "old")
+				fmt.Fprint(w, `"foo"`)
+				return
+			}
+			w.Header().Set("ETag", "new")
+			fmt.Fprint(w, `"bar"`)
+		}
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.SetRetryPolicy(RetryPolicy{BaseDelay: time.Millisecond})
+	token, err := fb.SetWithToken("bar")
+	require.NoError(t, err)
+	assert.Equal(t, "new", token.ETag)
+
+	var v string
+	require.NoError(t, fb.ValueAfter(context.Background(), token, &v))
+	assert.Equal(t, "bar", v)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&reads))
+}
+
+func TestValueAfterTimeout(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("ETag", "old")
+		fmt.Fprint(w, `"foo"`)
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.SetRetryPolicy(RetryPolicy{BaseDelay: time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var v string
+	err := fb.ValueAfter(ctx, ConsistencyToken{ETag: "new", url: fb.url}, &v)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error %v", err)
+	assert.Empty(t, v)
+
+	err = fb.Child("other").ValueAfter(ctx, ConsistencyToken{ETag: "new", url: fb.url}, &v)
+	assert.Error(t, err)
+}
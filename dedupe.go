@@ -0,0 +1,117 @@
+package firego
+
+import (
+	"fmt"
+	"net/http"
+	_url "net/url"
+	"sync"
+)
+
+// readGroup coalesces the identical GET requests made concurrently.
+type readGroup struct {
+	mtx   sync.Mutex
+	calls map[string]*readCall
+}
+
+// readCall is a request in flight and, once done, its result.
+type readCall struct {
+	done    chan struct{}
+	headers http.Header
+	body    []byte
+	err     error
+}
+
+// DedupeReads determines whether calls to Value made while an identical
+// one is in flight wait for its response rather than sending their own
+// request, which cuts down the load of reading the same locations from
+// many goroutines at once. Requests are identical when they are for the
+// same location with the same query parameters and the same auth token,
+// including the one obtained from the TokenSource, if any.
+//
+// Enabling it starts a new group of references sharing their requests,
+// joined by the references derived from fb afterwards. The response is
+// shared as is: the calls waiting for it fail along with the one that
+// sent it, e.g. when its context is canceled.
+func (fb *Firebase) DedupeReads(v bool) {
+	if !v {
+		fb.reads = nil
+		return
+	}
+	fb.reads = &readGroup{calls: map[string]*readCall{}}
+}
+
+// getValue sends a GET request for the reference, unless an identical
+// one is in flight, in which case its response is returned instead, or
+// the location is a cached miss.
+func (fb *Firebase) getValue() (http.Header, []byte, error) {
+	key, err := fb.readKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	if fb.misses != nil {
+		if miss, ok := fb.misses.get(key); ok {
+			if miss.err != nil {
+				return nil, nil, miss.err
+			}
+			return nil, []byte("null"), nil
+		}
+	}
+
+	var headers http.Header
+	var body []byte
+	if fb.reads == nil {
+		headers, body, err = fb.doRequest("GET", nil)
+	} else {
+		headers, body, err = fb.reads.do(key, func() (http.Header, []byte, error) {
+			return fb.doRequest("GET", nil)
+		})
+	}
+	if fb.misses != nil {
+		fb.misses.record(key, fb.url, body, err)
+	}
+	return headers, body, err
+}
+
+// readKey identifies the reads of the reference by the URL they would be
+// sent to with their token in the auth parameter, so that the responses
+// read with a token are never given to the reads made with another.
+func (fb *Firebase) readKey() (string, error) {
+	if fb.tokens == nil {
+		return fb.String(), nil
+	}
+
+	token, err := fb.tokens.Token()
+	if err != nil {
+		return "", fmt.Errorf("failed to get token %w", err)
+	}
+	fb.paramsMtx.RLock()
+	params := _url.Values{}
+	for k, v := range fb.params {
+		params[k] = v
+	}
+	fb.paramsMtx.RUnlock()
+	params.Set(authParam, token)
+	return fb.url + "/.json?" + params.Encode(), nil
+}
+
+// do calls fn, unless a call with the same key is in
+// flight, in which case it waits for its result.
+func (g *readGroup) do(key string, fn func() (http.Header, []byte, error)) (http.Header, []byte, error) {
+	g.mtx.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mtx.Unlock()
+		<-c.done
+		return c.headers, c.body, c.err
+	}
+	c := &readCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mtx.Unlock()
+
+	c.headers, c.body, c.err = fn()
+
+	g.mtx.Lock()
+	delete(g.calls, key)
+	g.mtx.Unlock()
+	close(c.done)
+	return c.headers, c.body, c.err
+}
@@ -0,0 +1,121 @@
+package firego
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupeReads(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	arrived := make(chan struct{}, 10)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		arrived <- struct{}{}
+		<-release
+		fmt.Fprintf(w, `{"n":%d,"path":%q}`, n, req.URL.Path)
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.DedupeReads(true)
+
+	var wg sync.WaitGroup
+	values := make([]map[string]interface{}, 10)
+	errs := make([]error, 10)
+	for i := range values {
+		// derived references share the requests of fb
+		ref := fb.Child("users")
+		if i == 9 {
+			ref = fb.Child("orders")
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = ref.Value(&values[i])
+		}(i)
+	}
+
+	<-arrived
+	<-arrived
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	for i, v := range values {
+		require.NoError(t, errs[i])
+		if i == 9 {
+			assert.Equal(t, "/orders/.json", v["path"])
+			continue
+		}
+		assert.Equal(t, values[0], v)
+		assert.Equal(t, "/users/.json", v["path"])
+	}
+
+	// requests are only shared while in flight
+	require.NoError(t, fb.Child("users").Value(new(interface{})))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestDedupeReadsPerToken(t *testing.T) {
+	t.Parallel()
+	arrived := make(chan struct{}, 2)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		arrived <- struct{}{}
+		<-release
+		if req.URL.Query().Get("auth") != "alice" {
+			w.Write([]byte("null"))
+			return
+		}
+		w.Write([]byte(`"secret of alice"`))
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.DedupeReads(true)
+	fb.CacheMisses(time.Minute)
+	alice, bob := fb.Child("secret"), fb.Child("secret")
+	alice.AuthTokenSource(TokenSourceFunc(func() (string, error) { return "alice", nil }))
+	bob.AuthTokenSource(TokenSourceFunc(func() (string, error) { return "bob", nil }))
+
+	var wg sync.WaitGroup
+	var aliceValue, bobValue interface{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, alice.Value(&aliceValue))
+	}()
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, bob.Value(&bobValue))
+	}()
+
+	// both requests are sent rather than shared
+	for i := 0; i < 2; i++ {
+		select {
+		case <-arrived:
+		case <-time.After(time.Second):
+			close(release)
+			require.FailNow(t, "the reads of alice and bob were coalesced")
+		}
+	}
+	close(release)
+	wg.Wait()
+	assert.Equal(t, "secret of alice", aliceValue)
+	assert.Nil(t, bobValue)
+
+	// the miss of bob is not used for alice
+	require.NoError(t, alice.Value(&aliceValue))
+	assert.Equal(t, "secret of alice", aliceValue)
+}
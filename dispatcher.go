@@ -0,0 +1,284 @@
+package firego
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDispatcherClosed is returned when registering a handler
+// with a closed Dispatcher.
+var ErrDispatcherClosed = errors.New("firego: dispatcher closed")
+
+// EventHandler handles an event routed by a Dispatcher, params holding
+// the values captured by the wildcards of the handler's pattern.
+type EventHandler func(event Event, params map[string]string) error
+
+// HandlerStats holds the metrics collected for a handler.
+type HandlerStats struct {
+	// Handled is the number of events handled, successfully or not.
+	Handled int64
+	// Errors is the number of events the handler returned an error for.
+	Errors int64
+	// Panics is the number of events the handler panicked on.
+	Panics int64
+	// Latency is the total time spent handling events.
+	Latency time.Duration
+}
+
+// Dispatcher routes the events of a Watch to the handlers registered for
+// the path patterns they match, in place of a switch on their paths:
+//
+//    d := firego.NewDispatcher()
+//    d.Handle("/orders/{id}", 4, func(event firego.Event, params map[string]string) error {
+//        return ship(params["id"], event.Data)
+//    })
+//    d.Handle("/users/{uid}/email", 1, sendConfirmation)
+//    d.Run(notifications)
+//
+// Patterns follow the syntax of PathPattern. An event is routed to the
+// handlers of the patterns matching its path or one of its ancestors, the
+// latter receiving the event as is, e.g. a change to "/orders/42/status"
+// for "/orders/{id}". Writes above the locations of a pattern, such as the
+// initial data of the stream, are split into put events at the locations
+// they hold, keeping the Seq of the write. The locations they remove are
+// not reported, unless named by a patch, use Triggers to be notified of
+// them.
+//
+// Every handler runs in its own pool of workers, the events of a location
+// always being handled by the same worker so that they are handled in the
+// order they were received. Handlers panicking are recovered, their
+// errors and panics being counted and reported to OnError.
+type Dispatcher struct {
+	// OnError is called when a handler fails or panics.
+	// Errors are logged if it is nil.
+	OnError func(pattern, path string, err error)
+
+	mtx    sync.RWMutex
+	routes []*route
+	closed bool
+	// dispatching counts the calls to Dispatch enqueuing
+	// events, which Close waits for before closing the queues
+	dispatching sync.WaitGroup
+	running     sync.WaitGroup
+}
+
+// route is a handler and the pool of workers running it.
+type route struct {
+	pattern *PathPattern
+	fn      EventHandler
+	queues  []chan routedEvent
+
+	mtx sync.Mutex
+	HandlerStats
+}
+
+type routedEvent struct {
+	event  Event
+	params map[string]string
+}
+
+// NewDispatcher creates a Dispatcher without handlers.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// Handle registers fn for the events of the locations matching pattern,
+// run by the given number of workers, at least one.
+func (d *Dispatcher) Handle(pattern string, workers int, fn EventHandler) error {
+	p, err := ParsePathPattern(pattern)
+	if err != nil {
+		return err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.closed {
+		return ErrDispatcherClosed
+	}
+
+	r := &route{pattern: p, fn: fn, queues: make([]chan routedEvent, workers)}
+	for i := range r.queues {
+		queue := make(chan routedEvent, 16)
+		r.queues[i] = queue
+		d.running.Add(1)
+		go func() {
+			defer d.running.Done()
+			for e := range queue {
+				d.handle(r, e)
+			}
+		}()
+	}
+	d.routes = append(d.routes, r)
+	return nil
+}
+
+// Run dispatches the events received from notifications until it is
+// closed, and then waits for them to be handled.
+func (d *Dispatcher) Run(notifications <-chan Event) {
+	for event := range notifications {
+		d.Dispatch(event)
+	}
+	d.Close()
+}
+
+// Dispatch routes the event to the handlers of the patterns it matches,
+// waiting for room in the queues of their workers, and reports whether
+// it matched any. Events other than puts and patches are not routed.
+func (d *Dispatcher) Dispatch(event Event) bool {
+	if event.Type != EventTypePut && event.Type != EventTypePatch {
+		return false
+	}
+
+	// the queues are waited on without holding the lock,
+	// so that handlers can use the dispatcher meanwhile
+	d.mtx.RLock()
+	if d.closed {
+		d.mtx.RUnlock()
+		return false
+	}
+	routes := d.routes
+	d.dispatching.Add(1)
+	d.mtx.RUnlock()
+	defer d.dispatching.Done()
+
+	path := splitPath(event.Path)
+	var matched bool
+	for _, r := range routes {
+		n := len(r.pattern.segments)
+		switch {
+		case len(path) >= n:
+			params, ok := r.pattern.matchPrefix(path[:n])
+			if !ok {
+				continue
+			}
+			r.enqueue(path[:n], routedEvent{event: event, params: params})
+			matched = true
+		case event.Type == EventTypePatch:
+			children, _ := event.Data.(map[string]interface{})
+			for k, v := range children {
+				matched = r.split(append(path[:len(path):len(path)], splitPath(k)...), v, event.Seq) || matched
+			}
+		default:
+			matched = r.split(path, event.Data, event.Seq) || matched
+		}
+	}
+	return matched
+}
+
+// split enqueues a put event for every location at or under path, whose
+// data is v, matching the pattern of r, and reports whether there were
+// any. The locations under path are only known if v is not nil.
+func (r *route) split(path []string, v interface{}, seq uint64) bool {
+	n := len(r.pattern.segments)
+	if len(path) >= n {
+		params, ok := r.pattern.matchPrefix(path[:n])
+		if ok {
+			r.enqueue(path[:n], routedEvent{event: putEvent(path, v, seq), params: params})
+		}
+		return ok
+	}
+	if _, ok := r.pattern.matchPrefix(path); !ok {
+		return false
+	}
+
+	var matched bool
+	for k, child := range treeChildren(v) {
+		matched = r.split(append(path[:len(path):len(path)], k), child, seq) || matched
+	}
+	return matched
+}
+
+// enqueue hands e over to the worker of the location at path.
+func (r *route) enqueue(path []string, e routedEvent) {
+	h := fnv.New32a()
+	h.Write([]byte(strings.Join(path, "/")))
+	r.queues[int(h.Sum32()%uint32(len(r.queues)))] <- e
+}
+
+// Stats returns the metrics of every handler, keyed by pattern.
+func (d *Dispatcher) Stats() map[string]HandlerStats {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+
+	stats := make(map[string]HandlerStats, len(d.routes))
+	for _, r := range d.routes {
+		r.mtx.Lock()
+		stats[r.pattern.String()] = r.HandlerStats
+		r.mtx.Unlock()
+	}
+	return stats
+}
+
+// Close waits for the events dispatched to be handled and stops the
+// workers. The dispatcher can not be used afterwards.
+func (d *Dispatcher) Close() {
+	d.mtx.Lock()
+	closing := !d.closed
+	d.closed = true
+	routes := d.routes
+	d.mtx.Unlock()
+
+	if closing {
+		d.dispatching.Wait()
+		for _, r := range routes {
+			for _, queue := range r.queues {
+				close(queue)
+			}
+		}
+	}
+	d.running.Wait()
+}
+
+// handle runs the handler of r, recovering from its panics.
+func (d *Dispatcher) handle(r *route, e routedEvent) {
+	start := time.Now()
+	var err error
+	var panicked bool
+	func() {
+		defer func() {
+			if v := recover(); v != nil {
+				panicked = true
+				err = fmt.Errorf("handler panicked: %v", v)
+			}
+		}()
+		err = r.fn(e.event, e.params)
+	}()
+
+	r.mtx.Lock()
+	r.Handled++
+	r.Latency += time.Since(start)
+	switch {
+	case panicked:
+		r.Panics++
+	case err != nil:
+		r.Errors++
+	}
+	r.mtx.Unlock()
+
+	if err != nil {
+		d.handleError(r.pattern.String(), e.event.Path, err)
+	}
+}
+
+func (d *Dispatcher) handleError(pattern, path string, err error) {
+	if d.OnError != nil {
+		d.OnError(pattern, path, err)
+		return
+	}
+	log.Printf("Dispatcher: %s: %s: %s", pattern, path, err)
+}
+
+// putEvent returns a put event of v at path, numbered seq.
+func putEvent(path []string, v interface{}, seq uint64) Event {
+	p := "/" + strings.Join(path, "/")
+	raw, _ := marshal(map[string]interface{}{"path": p, "data": v})
+	return Event{Type: EventTypePut, Path: p, Data: v, Seq: seq, rawData: raw}
+}
@@ -0,0 +1,155 @@
+package firego
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type dispatched struct {
+	path   string
+	data   interface{}
+	params map[string]string
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Parallel()
+	var mtx sync.Mutex
+	var orders, emails []dispatched
+	record := func(list *[]dispatched) EventHandler {
+		return func(event Event, params map[string]string) error {
+			mtx.Lock()
+			*list = append(*list, dispatched{path: event.Path, data: event.Data, params: params})
+			mtx.Unlock()
+			return nil
+		}
+	}
+
+	d := NewDispatcher()
+	require.NoError(t, d.Handle("/orders/{id}", 4, record(&orders)))
+	require.NoError(t, d.Handle("/users/{uid}/email", 1, record(&emails)))
+	assert.Error(t, d.Handle("/{a}/{a}", 1, record(&orders)))
+
+	notifications := make(chan Event, 10)
+	notifications <- Event{Type: EventTypePut, Path: "/", Data: map[string]interface{}{
+		"orders": map[string]interface{}{"1": "new", "2": "new"},
+		"users":  map[string]interface{}{"alice": map[string]interface{}{"email": "a@b.c", "name": "Alice"}},
+	}}
+	notifications <- Event{Type: EventTypePut, Path: "/orders/1/status", Data: "shipped"}
+	notifications <- Event{Type: EventTypePatch, Path: "/orders", Data: map[string]interface{}{"2": nil}}
+	notifications <- Event{Type: EventTypePut, Path: "/users/bob/name", Data: "Bob"}
+	notifications <- Event{Type: EventTypeError, Data: errors.New("lost")}
+	close(notifications)
+	d.Run(notifications)
+
+	sort.Slice(orders, func(i, j int) bool { return orders[i].path < orders[j].path })
+	assert.Equal(t, []dispatched{
+		{path: "/orders/1", data: "new", params: map[string]string{"id": "1"}},
+		{path: "/orders/1/status", data: "shipped", params: map[string]string{"id": "1"}},
+		{path: "/orders/2", data: "new", params: map[string]string{"id": "2"}},
+		{path: "/orders/2", data: nil, params: map[string]string{"id": "2"}},
+	}, orders)
+	assert.Equal(t, []dispatched{
+		{path: "/users/alice/email", data: "a@b.c", params: map[string]string{"uid": "alice"}},
+	}, emails)
+
+	stats := d.Stats()
+	assert.Equal(t, int64(4), stats["/orders/{id}"].Handled)
+	assert.Equal(t, int64(1), stats["/users/{uid}/email"].Handled)
+	assert.False(t, d.Dispatch(Event{Type: EventTypePut, Path: "/orders/3", Data: "new"}))
+	assert.Equal(t, ErrDispatcherClosed, d.Handle("/x", 1, record(&orders)))
+}
+
+func TestDispatcherOrderAndFailures(t *testing.T) {
+	t.Parallel()
+	var mtx sync.Mutex
+	seen := map[string][]interface{}{}
+	var failures []string
+
+	d := NewDispatcher()
+	d.OnError = func(pattern, path string, err error) {
+		mtx.Lock()
+		failures = append(failures, path+": "+err.Error())
+		mtx.Unlock()
+	}
+	require.NoError(t, d.Handle("/{id}", 3, func(event Event, params map[string]string) error {
+		switch event.Data {
+		case "boom":
+			panic("boom")
+		case "fail":
+			return errors.New("failed")
+		}
+		mtx.Lock()
+		seen[params["id"]] = append(seen[params["id"]], event.Data)
+		mtx.Unlock()
+		return nil
+	}))
+
+	for i := 0; i < 20; i++ {
+		for _, id := range []string{"a", "b", "c", "d"} {
+			assert.True(t, d.Dispatch(Event{Type: EventTypePut, Path: "/" + id, Data: float64(i)}))
+		}
+	}
+	d.Dispatch(Event{Type: EventTypePut, Path: "/a", Data: "boom"})
+	d.Dispatch(Event{Type: EventTypePut, Path: "/b", Data: "fail"})
+	d.Close()
+
+	// the events of a location are handled in order
+	for _, id := range []string{"a", "b", "c", "d"} {
+		require.Len(t, seen[id], 20)
+		for i, v := range seen[id] {
+			assert.Equal(t, float64(i), v)
+		}
+	}
+	sort.Strings(failures)
+	assert.Equal(t, []string{"/a: handler panicked: boom", "/b: failed"}, failures)
+
+	stats := d.Stats()["/{id}"]
+	assert.Equal(t, int64(82), stats.Handled)
+	assert.Equal(t, int64(1), stats.Errors)
+	assert.Equal(t, int64(1), stats.Panics)
+}
+
+func TestDispatcherFullQueue(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	d := NewDispatcher()
+	require.NoError(t, d.Handle("/orders/{id}", 1, func(Event, map[string]string) error {
+		<-release
+		return nil
+	}))
+
+	// fill the queue of the worker until Dispatch waits for room
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		for i := 0; i < 20; i++ {
+			d.Dispatch(Event{Type: EventTypePut, Path: "/orders/1", Data: i})
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// the dispatcher can still be used meanwhile
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, d.Handle("/users/{uid}", 1, func(Event, map[string]string) error { return nil }))
+		assert.Len(t, d.Stats(), 2)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		close(release)
+		require.FailNow(t, "dispatcher locked while waiting for room in a queue")
+	}
+
+	close(release)
+	<-dispatched
+	d.Close()
+	assert.Equal(t, int64(20), d.Stats()["/orders/{id}"].Handled)
+}
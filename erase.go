@@ -0,0 +1,164 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErasePredicate reports whether the location at path, relative to
+// the root given to EraseMatching, holding value is to be erased.
+type ErasePredicate func(path string, value interface{}) bool
+
+// EraseOptions configures EraseMatching.
+type EraseOptions struct {
+	// Indexes are the queries finding the locations that may reference
+	// the subject, which requires the data to be indexed.
+	Indexes []EraseIndex
+	// Scan holds the patterns of locations, relative to the root, that
+	// are all read to find the ones referencing the subject, for the
+	// data that is not indexed.
+	Scan []*PathPattern
+	// Concurrency is the number of locations read at once while
+	// scanning, see WalkOptions.
+	Concurrency int
+	// DryRun reports the locations that would be erased
+	// without removing them.
+	DryRun bool
+}
+
+// EraseIndex is a query for the children of a location whose OrderBy
+// child, "$key" or "$value" equals Value, typically the ID of a user.
+type EraseIndex struct {
+	// Path of the location, relative to the root.
+	Path    string
+	OrderBy string
+	Value   interface{}
+}
+
+// EraseReport is the audit trail of an EraseMatching.
+type EraseReport struct {
+	// Candidates is the number of locations tested by the predicate.
+	Candidates int
+	// Erased holds the paths of the locations removed, relative
+	// to the root, in order. In a dry run, those that would be.
+	Erased []string
+}
+
+// EraseMatching removes every location under root that references a data
+// subject, such as a user exercising their right to erasure:
+//
+//    posts, _ := firego.ParsePathPattern("/posts/{postId}")
+//    comments, _ := firego.ParsePathPattern("/comments/{postId}/{commentId}")
+//    report, err := firego.EraseMatching(ctx, fb, firego.ContainsValue(uid), firego.EraseOptions{
+//        Indexes: []firego.EraseIndex{{Path: "posts", OrderBy: "author", Value: uid}},
+//        Scan:    []*firego.PathPattern{comments},
+//    })
+//
+// The candidates are the children returned by the Indexes queries and the
+// locations matching the Scan patterns, and those for which predicate
+// returns true are removed, one at a time. The report lists the locations
+// removed, including when an error stops the erasure half way.
+func EraseMatching(ctx context.Context, root *Firebase, predicate ErasePredicate, opts EraseOptions) (*EraseReport, error) {
+	report := &EraseReport{}
+	if len(opts.Indexes) == 0 && len(opts.Scan) == 0 {
+		return report, errors.New("erase: no indexes nor patterns to look for the subject")
+	}
+
+	ref := root.WithContext(ctx)
+	matched := map[string]bool{}
+	test := func(path string, value interface{}) {
+		report.Candidates++
+		if predicate(path, value) {
+			matched[path] = true
+		}
+	}
+
+	for _, idx := range opts.Indexes {
+		var v interface{}
+		if err := ref.at(idx.Path).OrderBy(idx.OrderBy).EqualToValue(idx.Value).Value(&v); err != nil {
+			return report, err
+		}
+		for key, child := range treeChildren(v) {
+			test(joinPath(strings.Trim(idx.Path, "/"), key), child)
+		}
+	}
+	for _, pattern := range opts.Scan {
+		err := walkPattern(ctx, root, pattern, opts.Concurrency, func(path string, raw json.RawMessage) error {
+			var v interface{}
+			if err := ref.decode(raw, &v); err != nil {
+				return err
+			}
+			test(path, v)
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	for _, path := range outermostPaths(matched) {
+		if !opts.DryRun {
+			if _, _, err := ref.at(path).doRequest("DELETE", nil); err != nil {
+				return report, err
+			}
+		}
+		report.Erased = append(report.Erased, path)
+	}
+	return report, nil
+}
+
+// outermostPaths returns the paths, in order, leaving out those
+// that are under another one.
+func outermostPaths(paths map[string]bool) []string {
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	var outermost []string
+	covered := func(p string) bool {
+		for _, o := range outermost {
+			if pathsOverlap(o, p) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, p := range sorted {
+		if !covered(p) {
+			outermost = append(outermost, p)
+		}
+	}
+	return outermost
+}
+
+// ContainsValue returns an ErasePredicate matching the locations holding
+// v anywhere in their data, such as the ID of a user.
+func ContainsValue(v interface{}) ErasePredicate {
+	// compare the values as they are decoded from JSON
+	var target interface{}
+	if data, err := json.Marshal(v); err == nil {
+		json.Unmarshal(data, &target)
+	}
+
+	var contains func(value interface{}) bool
+	contains = func(value interface{}) bool {
+		if children := treeChildren(value); children != nil {
+			for _, child := range children {
+				if contains(child) {
+					return true
+				}
+			}
+			return false
+		}
+		return reflect.DeepEqual(value, target)
+	}
+	return func(path string, value interface{}) bool {
+		return contains(value)
+	}
+}
@@ -0,0 +1,68 @@
+package firego
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func eraseServer() *firetest.Firetest {
+	server := firetest.New()
+	server.Start()
+	server.Set("", map[string]interface{}{
+		"posts": map[string]interface{}{
+			"p1": map[string]interface{}{"author": "alice", "text": "hi"},
+			"p2": map[string]interface{}{"author": "bob", "text": "hey"},
+		},
+		"comments": map[string]interface{}{
+			"p2": map[string]interface{}{
+				"c1": map[string]interface{}{"by": "alice"},
+				"c2": map[string]interface{}{"by": "carol", "mentions": []interface{}{"alice"}},
+				"c3": map[string]interface{}{"by": "bob"},
+			},
+		},
+	})
+	return server
+}
+
+func TestEraseMatching(t *testing.T) {
+	t.Parallel()
+	server := eraseServer()
+	defer server.Close()
+
+	comments, err := ParsePathPattern("/comments/{postId}/{commentId}")
+	require.NoError(t, err)
+	opts := EraseOptions{
+		Indexes: []EraseIndex{{Path: "posts", OrderBy: "author", Value: "alice"}},
+		Scan:    []*PathPattern{comments},
+		DryRun:  true,
+	}
+	expected := []string{"comments/p2/c1", "comments/p2/c2", "posts/p1"}
+
+	report, err := EraseMatching(context.Background(), New(server.URL, nil), ContainsValue("alice"), opts)
+	require.NoError(t, err)
+	assert.Equal(t, &EraseReport{Candidates: 4, Erased: expected}, report)
+	assert.NotNil(t, server.Get("posts/p1"), "dry run should not remove anything")
+
+	opts.DryRun = false
+	report, err = EraseMatching(context.Background(), New(server.URL, nil), ContainsValue("alice"), opts)
+	require.NoError(t, err)
+	assert.Equal(t, expected, report.Erased)
+	assert.Equal(t, map[string]interface{}{
+		"posts":    map[string]interface{}{"p2": map[string]interface{}{"author": "bob", "text": "hey"}},
+		"comments": map[string]interface{}{"p2": map[string]interface{}{"c3": map[string]interface{}{"by": "bob"}}},
+	}, server.Get(""))
+}
+
+func TestEraseMatchingNoCandidates(t *testing.T) {
+	_, err := EraseMatching(context.Background(), New("https://example.firebaseio.com", nil), ContainsValue("alice"), EraseOptions{})
+	assert.Error(t, err)
+}
+
+func TestOutermostPaths(t *testing.T) {
+	paths := map[string]bool{"a": true, "a-x": true, "a/b": true, "c/d": true, "c/d/e": true}
+	assert.Equal(t, []string{"a", "a-x", "c/d"}, outermostPaths(paths))
+}
@@ -0,0 +1,54 @@
+package firego
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Errors matching the responses Firebase rejects requests with,
+// to be used with errors.Is:
+//
+//    if err := fb.Value(&v); errors.Is(err, firego.ErrPermissionDenied) {
+//        // refresh the credentials
+//    }
+var (
+	// ErrPermissionDenied matches 401 and 403 responses.
+	ErrPermissionDenied = errors.New("firego: permission denied")
+	// ErrNotFound matches 404 responses.
+	ErrNotFound = errors.New("firego: not found")
+	// ErrPreconditionFailed matches 412 responses, sent when the
+	// ETag of a conditional write no longer matches the data.
+	ErrPreconditionFailed = errors.New("firego: precondition failed")
+)
+
+// StatusError is returned when Firebase responds with an unsuccessful
+// status. Use errors.As to inspect it.
+type StatusError struct {
+	// Code is the HTTP status code of the response.
+	Code int
+	// Message is the body of the response.
+	Message string
+	// RetryAfter is the delay given by the Retry-After header of
+	// a 429 or 503 response, if any, capped by SetMaxRetryAfter.
+	RetryAfter time.Duration
+}
+
+// Error returns the body of the response, which
+// holds the error reported by Firebase.
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// Is makes the error match the sentinel error for its status code.
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrPermissionDenied:
+		return e.Code == http.StatusUnauthorized || e.Code == http.StatusForbidden
+	case ErrNotFound:
+		return e.Code == http.StatusNotFound
+	case ErrPreconditionFailed:
+		return e.Code == http.StatusPreconditionFailed
+	}
+	return false
+}
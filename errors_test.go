@@ -0,0 +1,98 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestStatusErrors(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		code     int
+		sentinel error
+	}{
+		{http.StatusUnauthorized, ErrPermissionDenied},
+		{http.StatusForbidden, ErrPermissionDenied},
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusPreconditionFailed, ErrPreconditionFailed},
+		{http.StatusInternalServerError, nil},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(test.code)
+			fmt.Fprint(w, `{"error":"nope"}`)
+		}))
+
+		err := New(server.URL, nil).Set(true)
+		server.Close()
+		require.Error(t, err)
+		assert.EqualError(t, err, `{"error":"nope"}`)
+
+		var sErr *StatusError
+		require.True(t, errors.As(err, &sErr))
+		assert.Equal(t, test.code, sErr.Code)
+		for _, sentinel := range []error{ErrPermissionDenied, ErrNotFound, ErrPreconditionFailed} {
+			assert.Equal(t, sentinel == test.sentinel, errors.Is(err, sentinel), "%d %s", test.code, sentinel)
+		}
+	}
+}
+
+func TestStatusErrorsWrapped(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.RequireAuth(true)
+
+	err := New(server.URL, nil).Transaction(func(v interface{}) (interface{}, error) {
+		return v, nil
+	})
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+}
+
+func TestErrTimeoutWrapped(t *testing.T) {
+	t.Parallel()
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := New(server.URL, nil).WithContext(ctx).Set(true)
+
+	var tErr ErrTimeout
+	assert.True(t, errors.As(err, &tErr))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+}
+
+func TestRetryErrorWrapped(t *testing.T) {
+	t.Parallel()
+	server, _ := newFlakyServer(10, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	fb := New(server.URL, nil).WithContext(ctx)
+	fb.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Second})
+	err := fb.Set(true)
+
+	var rErr *RetryError
+	assert.True(t, errors.As(err, &rErr))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	var sErr *StatusError
+	require.True(t, errors.As(err, &sErr))
+	assert.Equal(t, http.StatusServiceUnavailable, sErr.Code)
+	assert.False(t, errors.Is(err, ErrNotFound))
+}
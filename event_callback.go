@@ -226,7 +226,7 @@ func (fb *Firebase) addEventFunc(fn ChildEventFunc, handleSSE handleSSEFunc) err
 	}
 
 	fb.eventFuncs[key] = stop
-	notifications, err := fb.watch(stop)
+	notifications, err := fb.watch(stop, false, "")
 	if err != nil {
 		return err
 	}
@@ -253,7 +253,7 @@ func (fb *Firebase) addEventFunc(fn ChildEventFunc, handleSSE handleSSEFunc) err
 		time.Sleep(backoff)
 
 		// try and reconnect
-		for notifications, err = fb.watch(stop); err != nil; time.Sleep(backoff) {
+		for notifications, err = fb.watch(stop, false, ""); err != nil; time.Sleep(backoff) {
 			fb.eventMtx.Lock()
 			if _, ok := fb.eventFuncs[key]; !ok {
 				fb.eventMtx.Unlock()
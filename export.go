@@ -0,0 +1,332 @@
+package firego
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// exportManifestFile is the name of the manifest in an export directory.
+const exportManifestFile = "manifest.json"
+
+// ExportOptions configures Export.
+type ExportOptions struct {
+	// ChunkSize is the number of children read, and written to
+	// a file, at a time. It defaults to 1000.
+	ChunkSize int
+	// OnChunk, if set, is called with every chunk once it is written.
+	OnChunk func(c ExportChunk)
+	// Compress writes the chunks gzip compressed, to files
+	// ending with ".json.gz".
+	Compress bool
+}
+
+// ExportDestination stores the files of an export. DirDestination writes
+// them to a local directory, other implementations can upload them to
+// object storage, such as the gcs package does.
+type ExportDestination interface {
+	// ReadFile returns the contents of the file with the given name,
+	// or an error matching os.ErrNotExist if there is none.
+	ReadFile(name string) ([]byte, error)
+	// WriteFile creates or replaces the file with the given name.
+	WriteFile(name string, data []byte) error
+}
+
+// DirDestination is an ExportDestination writing files to a directory.
+type DirDestination string
+
+// ReadFile implements ExportDestination.
+func (d DirDestination) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(string(d), name))
+}
+
+// WriteFile implements ExportDestination. Files are replaced atomically.
+func (d DirDestination) WriteFile(name string, data []byte) error {
+	return writeFileAtomic(filepath.Join(string(d), name), data)
+}
+
+// ExportManifest describes the data exported to a directory by Export.
+type ExportManifest struct {
+	// URL of the reference exported.
+	URL string `json:"url"`
+	// Chunks holds the chunks written so far, in key order.
+	Chunks []ExportChunk `json:"chunks"`
+	// Complete is set once every child was exported.
+	Complete bool `json:"complete"`
+}
+
+// ExportChunk is a file holding a range of the children of the reference
+// exported, as a JSON object keyed by child key.
+type ExportChunk struct {
+	// File is the name of the file in the export directory.
+	File string `json:"file"`
+	// First and Last are the keys of the first and last child of the range.
+	First string `json:"first"`
+	Last  string `json:"last"`
+	// Count is the number of children in the file.
+	Count int `json:"count"`
+	// Hash is the ContentHash of the JSON of the file, before compression.
+	Hash string `json:"hash"`
+}
+
+// Export writes the children of fb to files in dir, ChunkSize children at
+// a time in key order, along with a manifest of the key range of every
+// file. The manifest is updated as soon as a file is written, so that
+// calling Export again with the same directory after an interruption,
+// such as a crash or ctx being done, resumes after the last file written
+// instead of starting over. Once the manifest is complete, Export returns
+// it without reading anything.
+//
+// Children added during the export are only included if their key sorts
+// after the last file written, and changes to children already exported
+// are not, so an export is not a consistent snapshot of data being written.
+func Export(ctx context.Context, fb *Firebase, dir string, opts ExportOptions) (*ExportManifest, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return ExportTo(ctx, fb, DirDestination(dir), opts)
+}
+
+// ExportTo is Export writing the files, and reading the manifest of the
+// export to resume, through dst instead of a directory.
+func ExportTo(ctx context.Context, fb *Firebase, dst ExportDestination, opts ExportOptions) (*ExportManifest, error) {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = 1000
+	}
+
+	manifest, err := loadExportManifest(dst)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		manifest = &ExportManifest{URL: fb.url}
+	case err != nil:
+		return nil, err
+	case manifest.URL != fb.url:
+		return nil, fmt.Errorf("export: %v holds an export of %s", dst, manifest.URL)
+	}
+
+	ref := fb.WithContext(ctx).OrderBy("$key")
+	for !manifest.Complete {
+		limit := opts.ChunkSize
+		var after string
+		if n := len(manifest.Chunks); n > 0 {
+			// startAt includes the last child exported, skipped below
+			after = manifest.Chunks[n-1].Last
+			limit++
+		}
+
+		var v interface{}
+		// keys are always strings, even those StartAt would send as numbers
+		if err := ref.StartAtValue(after).LimitToFirst(int64(limit)).Value(&v); err != nil {
+			return manifest, err
+		}
+		children := treeChildren(v)
+		if after != "" {
+			delete(children, after)
+		}
+		if len(children) == 0 {
+			manifest.Complete = true
+			if err := saveExportManifest(dst, manifest); err != nil {
+				return manifest, err
+			}
+			break
+		}
+
+		chunk, err := writeExportChunk(dst, len(manifest.Chunks)+1, children, opts.Compress)
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Chunks = append(manifest.Chunks, chunk)
+		manifest.Complete = chunk.Count < opts.ChunkSize
+		if err := saveExportManifest(dst, manifest); err != nil {
+			return manifest, err
+		}
+		if opts.OnChunk != nil {
+			opts.OnChunk(chunk)
+		}
+	}
+	return manifest, nil
+}
+
+// LoadExportManifest reads the manifest of the export in dir.
+func LoadExportManifest(dir string) (*ExportManifest, error) {
+	return loadExportManifest(DirDestination(dir))
+}
+
+func loadExportManifest(dst ExportDestination) (*ExportManifest, error) {
+	data, err := dst.ReadFile(exportManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	var manifest ExportManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("export: invalid manifest in %v. %w", dst, err)
+	}
+	return &manifest, nil
+}
+
+func saveExportManifest(dst ExportDestination, manifest *ExportManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return dst.WriteFile(exportManifestFile, data)
+}
+
+// writeExportChunk writes the nth chunk of an export, holding children.
+// The hash of the chunk is that of its JSON, even if it is compressed.
+func writeExportChunk(dst ExportDestination, n int, children map[string]interface{}, compress bool) (ExportChunk, error) {
+	keys := make([]string, 0, len(children))
+	for k := range children {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return compareKeys(keys[i], keys[j]) < 0
+	})
+
+	data, err := json.Marshal(children)
+	if err != nil {
+		return ExportChunk{}, err
+	}
+	hash, err := ContentHash(data)
+	if err != nil {
+		return ExportChunk{}, err
+	}
+
+	chunk := ExportChunk{
+		File:  fmt.Sprintf("chunk-%06d.json", n),
+		First: keys[0],
+		Last:  keys[len(keys)-1],
+		Count: len(keys),
+		Hash:  hash,
+	}
+	if compress {
+		chunk.File += ".gz"
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return ExportChunk{}, err
+		}
+		if err := zw.Close(); err != nil {
+			return ExportChunk{}, err
+		}
+		data = buf.Bytes()
+	}
+	return chunk, dst.WriteFile(chunk.File, data)
+}
+
+// CSVOptions configures ExportCSV.
+type CSVOptions struct {
+	// ChunkSize is the number of children read at a time.
+	// It defaults to 1000.
+	ChunkSize int
+	// NoHeader leaves out the first row, which holds "key"
+	// followed by the fields.
+	NoHeader bool
+	// Missing is written for the fields a child does not hold.
+	// It is empty by default.
+	Missing string
+}
+
+// ExportCSV writes a row to w for every child of fb, in key order, holding
+// the key of the child followed by the given fields, paths relative to
+// the child such as "address/city":
+//
+//    w := csv.NewWriter(os.Stdout)
+//    n, err := firego.ExportCSV(ctx, fb.Child("users"), w, []string{"name", "address/city"}, firego.CSVOptions{})
+//
+// Strings are written as is, numbers as they are stored and objects and
+// arrays as JSON. The children are read ChunkSize at a time and the number
+// of rows written, the header aside, is returned.
+func ExportCSV(ctx context.Context, fb *Firebase, w *csv.Writer, fields []string, opts CSVOptions) (int, error) {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = 1000
+	}
+	paths := make([][]string, len(fields))
+	for i, field := range fields {
+		paths[i] = splitPath(field)
+	}
+
+	if !opts.NoHeader {
+		if err := w.Write(append([]string{"key"}, fields...)); err != nil {
+			return 0, err
+		}
+	}
+
+	ref := fb.WithContext(ctx).OrderBy("$key")
+	var (
+		rows  int
+		after string
+	)
+	for {
+		limit := opts.ChunkSize
+		if after != "" {
+			// startAt includes the last child written, skipped below
+			limit++
+		}
+		_, body, err := ref.StartAtValue(after).LimitToFirst(int64(limit)).doRequest("GET", nil)
+		if err != nil {
+			return rows, err
+		}
+		tree, err := decodeTree(body)
+		if err != nil {
+			return rows, err
+		}
+		children := treeChildren(tree)
+		delete(children, after)
+
+		keys := make([]string, 0, len(children))
+		for k := range children {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return compareKeys(keys[i], keys[j]) < 0
+		})
+
+		for _, key := range keys {
+			row := []string{key}
+			for _, path := range paths {
+				cell, err := csvCell(valueAt(children[key], path), opts.Missing)
+				if err != nil {
+					return rows, err
+				}
+				row = append(row, cell)
+			}
+			if err := w.Write(row); err != nil {
+				return rows, err
+			}
+			rows++
+		}
+
+		if len(keys) < opts.ChunkSize {
+			break
+		}
+		after = keys[len(keys)-1]
+	}
+	w.Flush()
+	return rows, w.Error()
+}
+
+// csvCell formats a value read from Firebase for a CSV file.
+func csvCell(v interface{}, missing string) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return missing, nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
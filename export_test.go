@@ -0,0 +1,152 @@
+package firego
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	expected := map[string]interface{}{}
+	for i := 0; i < 25; i++ {
+		expected[fmt.Sprintf("k%02d", i)] = float64(i)
+	}
+	server.Set("data", expected)
+
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// interrupt the export after the first chunk
+	fb := New(server.URL, nil).Child("data")
+	ctx, cancel := context.WithCancel(context.Background())
+	manifest, err := Export(ctx, fb, dir, ExportOptions{ChunkSize: 10, OnChunk: func(ExportChunk) { cancel() }})
+	assert.Error(t, err)
+	require.Len(t, manifest.Chunks, 1)
+	assert.False(t, manifest.Complete)
+
+	var resumed []ExportChunk
+	manifest, err = Export(context.Background(), fb, dir, ExportOptions{
+		ChunkSize: 10,
+		OnChunk:   func(c ExportChunk) { resumed = append(resumed, c) },
+	})
+	require.NoError(t, err)
+	assert.True(t, manifest.Complete)
+	assert.Len(t, resumed, 2, "export should resume after the first chunk")
+
+	loaded, err := LoadExportManifest(dir)
+	require.NoError(t, err)
+	assert.Equal(t, manifest, loaded)
+	require.Len(t, loaded.Chunks, 3)
+	assert.Equal(t, ExportChunk{File: "chunk-000002.json", First: "k10", Last: "k19", Count: 10, Hash: loaded.Chunks[1].Hash}, loaded.Chunks[1])
+
+	exported := map[string]interface{}{}
+	for _, c := range loaded.Chunks {
+		data, err := ioutil.ReadFile(filepath.Join(dir, c.File))
+		require.NoError(t, err)
+		hash, err := ContentHash(data)
+		require.NoError(t, err)
+		assert.Equal(t, c.Hash, hash)
+		require.NoError(t, json.Unmarshal(data, &exported))
+	}
+	assert.Equal(t, expected, exported)
+
+	_, err = Export(context.Background(), New(server.URL, nil).Child("other"), dir, ExportOptions{})
+	assert.Error(t, err, "directory holds the export of another reference")
+}
+
+func TestExportResumeAfterNumericKey(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	expected := map[string]interface{}{}
+	for i := 100; i < 115; i++ {
+		expected[strconv.Itoa(i)] = float64(i)
+	}
+	server.Set("data", expected)
+
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fb := New(server.URL, nil).Child("data")
+	var startAt []string
+	fb.BeforeSend(func(req *http.Request, body []byte) error {
+		startAt = append(startAt, req.URL.Query().Get(startAtParam))
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = Export(ctx, fb, dir, ExportOptions{ChunkSize: 10, OnChunk: func(ExportChunk) { cancel() }})
+	assert.Error(t, err)
+
+	manifest, err := Export(context.Background(), fb, dir, ExportOptions{ChunkSize: 10})
+	require.NoError(t, err)
+	assert.True(t, manifest.Complete)
+	// Firebase rejects bounds that are not strings when ordering by key
+	assert.Contains(t, startAt, `"109"`)
+	assert.NotContains(t, startAt, "109")
+
+	exported := map[string]interface{}{}
+	for _, c := range manifest.Chunks {
+		data, err := ioutil.ReadFile(filepath.Join(dir, c.File))
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &exported))
+	}
+	assert.Equal(t, expected, exported)
+}
+
+func TestExportCSV(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users", map[string]interface{}{
+		"alice": map[string]interface{}{
+			"name":    "Alice, Jr.",
+			"age":     float64(30),
+			"admin":   true,
+			"address": map[string]interface{}{"city": "Paris"},
+			"tags":    []interface{}{"a", "b"},
+		},
+		"bob":   map[string]interface{}{"name": "Bob", "age": float64(1500000)},
+		"carol": "not an object",
+	})
+	fb := New(server.URL, nil).Child("users")
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	n, err := ExportCSV(context.Background(), fb, w, []string{"name", "age", "admin", "address/city", "tags"}, CSVOptions{
+		ChunkSize: 2,
+		Missing:   "-",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, `key,name,age,admin,address/city,tags
+alice,"Alice, Jr.",30,true,Paris,"[""a"",""b""]"
+bob,Bob,1500000,-,-,-
+carol,-,-,-,-,-
+`, buf.String())
+
+	buf.Reset()
+	n, err = ExportCSV(context.Background(), fb, csv.NewWriter(&buf), []string{"name"}, CSVOptions{NoHeader: true})
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, "alice,\"Alice, Jr.\"\nbob,Bob\ncarol,\n", buf.String())
+}
@@ -0,0 +1,376 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	_url "net/url"
+	"sync"
+	"time"
+)
+
+// Failover sends reads to mirrors of a database when its primary instance
+// is unavailable, so that reads survive the outage of an instance or of a
+// region:
+//
+//    failover, err := firego.NewFailover(
+//        "https://my-app.firebaseio.com",
+//        "https://my-app-mirror.europe-west1.firebasedatabase.app",
+//    )
+//    if err != nil {
+//        log.Fatal(err)
+//    }
+//    failover.Start()
+//    defer failover.Stop()
+//    fb = failover.Guard(fb)
+//
+// Reads, including the streams opened by Watch, go to the first host that
+// is up, in the order given, the same path being read from every host.
+// Hosts are marked down when a read fails with a network error or a 5xx
+// response, which is then retried on the next host. Writes always go to
+// the primary.
+//
+// With Reads set to ReadMirror, reads go to the mirrors first, e.g. to a
+// read replica kept in sync with the primary by Replicate, taking the
+// reads off the primary:
+//
+//    failover, err := firego.NewFailover(primaryURL, replicaURL)
+//    ...
+//    failover.Reads = firego.ReadMirror
+//    go firego.Replicate(ctx, primary, replica, firego.ReplicateOptions{})
+//    fb = failover.Guard(primary)
+//
+// The replica lags behind the primary, use SetWithToken and ValueAfter to
+// read back the data written.
+//
+// The token of a reference is only sent to the host of its URL. Requests
+// are sent to the other hosts with the token of the TokenSource given to
+// Auth for them, if any:
+//
+//    failover.Auth(mirrorURL, firego.TokenSourceFunc(mirrorToken))
+//
+// Hosts marked down are checked every CheckInterval once Start is called,
+// and are otherwise tried again by reads once CheckInterval has passed.
+type Failover struct {
+	// Reads determines which hosts reads go to first.
+	Reads ReadRouting
+	// CheckInterval is how often the hosts marked down are checked.
+	// It defaults to 10 seconds.
+	CheckInterval time.Duration
+	// OnChange is called when a host is marked up or down.
+	// Changes are logged if it is nil.
+	OnChange func(host string, up bool)
+
+	hosts []*failoverHost
+	// base is the transport the health checks are sent with
+	base http.RoundTripper
+
+	mtx     sync.Mutex
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+// ReadRouting determines which hosts of a Failover reads go to first.
+type ReadRouting int
+
+const (
+	// ReadPrimary sends reads to the primary, the mirrors only
+	// taking over while it is down. This is the default.
+	ReadPrimary ReadRouting = iota
+	// ReadMirror sends reads to the mirrors, in order, the primary
+	// only taking over while they are all down.
+	ReadMirror
+)
+
+// failoverHost is a host of a Failover.
+type failoverHost struct {
+	scheme, host string
+	// tokens authenticates the requests sent to the host
+	// in place of the token of the request
+	tokens TokenSource
+
+	mtx       sync.Mutex
+	down      bool
+	checkedAt time.Time
+}
+
+// HostStatus tells whether a host of a Failover is up.
+type HostStatus struct {
+	// Host is the scheme and host, e.g. "https://my-app.firebaseio.com".
+	Host string
+	// Up is unset once a read failed on the host, until it
+	// responds again.
+	Up bool
+}
+
+// NewFailover creates a Failover between the hosts of the given URLs,
+// the first one being the primary.
+func NewFailover(urls ...string) (*Failover, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("failover: no hosts")
+	}
+	f := &Failover{CheckInterval: 10 * time.Second}
+	for _, u := range urls {
+		parsed, err := _url.Parse(sanitizeURL(u))
+		if err != nil {
+			return nil, fmt.Errorf("failover: invalid url %q %w", u, err)
+		}
+		f.hosts = append(f.hosts, &failoverHost{scheme: parsed.Scheme, host: parsed.Host})
+	}
+	return f, nil
+}
+
+// Auth sets the TokenSource of the tokens sent to the host of the given
+// URL, one of the URLs given to NewFailover, with the requests sent there
+// in place of the token of another host.
+func (f *Failover) Auth(url string, tokens TokenSource) error {
+	parsed, err := _url.Parse(sanitizeURL(url))
+	if err != nil {
+		return fmt.Errorf("failover: invalid url %q %w", url, err)
+	}
+	for _, h := range f.hosts {
+		if h.scheme == parsed.Scheme && h.host == parsed.Host {
+			h.mtx.Lock()
+			h.tokens = tokens
+			h.mtx.Unlock()
+			return nil
+		}
+	}
+	return fmt.Errorf("failover: unknown host %q", url)
+}
+
+// Guard returns a copy of the reference whose reads, and the reads of the
+// references derived from it, fail over to the hosts of f.
+func (f *Failover) Guard(fb *Firebase) *Firebase {
+	ref := fb.copy()
+	client := *ref.client
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	f.mtx.Lock()
+	if f.base == nil {
+		f.base = base
+	}
+	f.mtx.Unlock()
+	client.Transport = &failoverTransport{base: base, f: f}
+	ref.client = &client
+	return ref
+}
+
+// Hosts returns the status of every host, in order.
+func (f *Failover) Hosts() []HostStatus {
+	status := make([]HostStatus, len(f.hosts))
+	for i, h := range f.hosts {
+		h.mtx.Lock()
+		status[i] = HostStatus{Host: h.scheme + "://" + h.host, Up: !h.down}
+		h.mtx.Unlock()
+	}
+	return status
+}
+
+// Start checks the hosts marked down every CheckInterval
+// until Stop is called.
+func (f *Failover) Start() {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.cancel != nil {
+		// already running
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	interval := f.CheckInterval
+	f.running.Add(1)
+	go func() {
+		defer f.running.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				f.checkHosts(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops checking the hosts.
+func (f *Failover) Stop() {
+	f.mtx.Lock()
+	cancel := f.cancel
+	f.cancel = nil
+	f.mtx.Unlock()
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	f.running.Wait()
+}
+
+// checkHosts marks the hosts marked down that respond up again.
+func (f *Failover) checkHosts(ctx context.Context) {
+	f.mtx.Lock()
+	base := f.base
+	f.mtx.Unlock()
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	for _, h := range f.hosts {
+		h.mtx.Lock()
+		down := h.down
+		h.mtx.Unlock()
+		if !down {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, f.CheckInterval)
+		req, err := http.NewRequest("GET", h.scheme+"://"+h.host+"/.json?shallow=true", nil)
+		if err == nil {
+			var resp *http.Response
+			if resp, err = base.RoundTrip(req.WithContext(ctx)); err == nil {
+				resp.Body.Close()
+				if resp.StatusCode >= 500 {
+					err = fmt.Errorf("status %d", resp.StatusCode)
+				}
+			}
+		}
+		cancel()
+		f.mark(h, err == nil)
+	}
+}
+
+// mark marks the host up or down.
+func (f *Failover) mark(h *failoverHost, up bool) {
+	h.mtx.Lock()
+	changed := h.down == up
+	h.down = !up
+	h.checkedAt = time.Now()
+	h.mtx.Unlock()
+	if !changed {
+		return
+	}
+
+	host := h.scheme + "://" + h.host
+	if f.OnChange != nil {
+		f.OnChange(host, up)
+		return
+	}
+	state := "down"
+	if up {
+		state = "up"
+	}
+	log.Printf("Failover: %s is %s", host, state)
+}
+
+// candidates returns the hosts to read from in the order to try them,
+// the ones up, or due for another try, first.
+func (f *Failover) candidates() []*failoverHost {
+	hosts := f.hosts
+	if f.Reads == ReadMirror {
+		hosts = append(append([]*failoverHost{}, f.hosts[1:]...), f.hosts[0])
+	}
+
+	up := make([]*failoverHost, 0, len(hosts))
+	var down []*failoverHost
+	for _, h := range hosts {
+		h.mtx.Lock()
+		retry := !h.down || time.Since(h.checkedAt) >= f.CheckInterval
+		h.mtx.Unlock()
+		if retry {
+			up = append(up, h)
+		} else {
+			down = append(down, h)
+		}
+	}
+	return append(up, down...)
+}
+
+// failoverTransport sends reads to the hosts of a Failover.
+type failoverTransport struct {
+	base http.RoundTripper
+	f    *Failover
+}
+
+func (tr *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" {
+		primary := tr.f.hosts[0]
+		if req.URL.Scheme == primary.scheme && req.URL.Host == primary.host {
+			return tr.base.RoundTrip(req)
+		}
+		r, err := redirectTo(req, primary)
+		if err != nil {
+			return nil, err
+		}
+		return tr.base.RoundTrip(r)
+	}
+
+	hosts := tr.f.candidates()
+	for i, h := range hosts {
+		r, err := redirectTo(req, h)
+		var resp *http.Response
+		if err == nil {
+			resp, err = tr.base.RoundTrip(r)
+		}
+		if req.Context().Err() != nil {
+			// canceled rather than failed
+			return resp, err
+		}
+		if err == nil && resp.StatusCode < 500 {
+			tr.f.mark(h, true)
+			return resp, nil
+		}
+		tr.f.mark(h, false)
+		if i == len(hosts)-1 {
+			return resp, err
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+	return nil, errors.New("failover: no hosts")
+}
+
+// redirectTo returns a copy of req sent to h. The token of req, if any, is
+// only sent to its own host, and replaced by the token of h for others.
+func redirectTo(req *http.Request, h *failoverHost) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme, r.URL.Host, r.Host = h.scheme, h.host, ""
+	if req.URL.Scheme == h.scheme && req.URL.Host == h.host {
+		return r, nil
+	}
+
+	query := r.URL.Query()
+	_, accessToken := query[accessTokenParam]
+	header := r.Header.Get("Authorization") != ""
+	query.Del(authParam)
+	query.Del(accessTokenParam)
+	r.Header.Del("Authorization")
+
+	h.mtx.Lock()
+	tokens := h.tokens
+	h.mtx.Unlock()
+	if tokens != nil {
+		token, err := tokens.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failover: failed to get token of %s %w", h.host, err)
+		}
+		switch {
+		case header:
+			r.Header.Set("Authorization", "Bearer "+token)
+		case accessToken:
+			query.Set(accessTokenParam, token)
+		default:
+			query.Set(authParam, token)
+		}
+	}
+	r.URL.RawQuery = query.Encode()
+	return r, nil
+}
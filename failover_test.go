@@ -0,0 +1,153 @@
+package firego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailover(t *testing.T) {
+	t.Parallel()
+	var primaryDown, primaryWrites int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" {
+			atomic.AddInt32(&primaryWrites, 1)
+		}
+		if atomic.LoadInt32(&primaryDown) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`"primary"`))
+	}))
+	defer primary.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`"mirror"`))
+	}))
+	defer mirror.Close()
+
+	failover, err := NewFailover(primary.URL, mirror.URL)
+	require.NoError(t, err)
+	failover.CheckInterval = 50 * time.Millisecond
+	changes := make(chan bool, 10)
+	failover.OnChange = func(host string, up bool) {
+		if host == primary.URL {
+			changes <- up
+		}
+	}
+	fb := failover.Guard(New(primary.URL, nil))
+
+	var v string
+	require.NoError(t, fb.Child("a").Value(&v))
+	assert.Equal(t, "primary", v)
+
+	// reads fail over while the primary is down
+	atomic.StoreInt32(&primaryDown, 1)
+	require.NoError(t, fb.Child("a").Value(&v))
+	assert.Equal(t, "mirror", v)
+	assert.False(t, <-changes)
+	assert.Equal(t, []HostStatus{{Host: primary.URL}, {Host: mirror.URL, Up: true}}, failover.Hosts())
+
+	// writes still go to the primary
+	assert.Error(t, fb.Child("a").Set("x"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&primaryWrites))
+
+	// the primary is checked until it is back up
+	failover.Start()
+	defer failover.Stop()
+	atomic.StoreInt32(&primaryDown, 0)
+	select {
+	case up := <-changes:
+		assert.True(t, up)
+	case <-time.After(time.Second):
+		t.Fatal("primary not checked")
+	}
+	require.NoError(t, fb.Child("a").Value(&v))
+	assert.Equal(t, "primary", v)
+}
+
+func TestFailoverReadMirror(t *testing.T) {
+	t.Parallel()
+	var primaryReads, mirrorWrites int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == "GET" {
+			atomic.AddInt32(&primaryReads, 1)
+		}
+		w.Write([]byte(`"primary"`))
+	}))
+	defer primary.Close()
+	var mirrorDown int32
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" {
+			atomic.AddInt32(&mirrorWrites, 1)
+		}
+		if atomic.LoadInt32(&mirrorDown) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`"mirror"`))
+	}))
+	defer mirror.Close()
+
+	failover, err := NewFailover(primary.URL, mirror.URL)
+	require.NoError(t, err)
+	failover.Reads = ReadMirror
+	failover.OnChange = func(host string, up bool) {}
+	// references to the mirror write to the primary as well
+	fb := failover.Guard(New(mirror.URL, nil))
+
+	var v string
+	require.NoError(t, fb.Child("a").Value(&v))
+	assert.Equal(t, "mirror", v)
+	require.NoError(t, fb.Child("a").Set("x"))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&mirrorWrites))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&primaryReads))
+
+	// the primary takes over while the mirror is down
+	atomic.StoreInt32(&mirrorDown, 1)
+	require.NoError(t, fb.Child("a").Value(&v))
+	assert.Equal(t, "primary", v)
+}
+
+func TestFailoverMirrorAuth(t *testing.T) {
+	t.Parallel()
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	tokens := make(chan string, 10)
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		tokens <- req.URL.Query().Get("auth") + req.URL.Query().Get("access_token") + req.Header.Get("Authorization")
+		w.Write([]byte(`"mirror"`))
+	}))
+	defer mirror.Close()
+
+	failover, err := NewFailover(primary.URL, mirror.URL)
+	require.NoError(t, err)
+	failover.OnChange = func(string, bool) {}
+	fb := New(primary.URL, nil)
+	fb.Auth("primary-secret")
+	fb = failover.Guard(fb)
+
+	// the token of the primary is not sent to the mirror
+	var v string
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, "mirror", v)
+	assert.Equal(t, "", <-tokens)
+
+	require.NoError(t, failover.Auth(mirror.URL+"/", TokenSourceFunc(func() (string, error) {
+		return "mirror-secret", nil
+	})))
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, "mirror-secret", <-tokens)
+
+	fb.SetAuthStyle(AuthStyleHeader)
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, "Bearer mirror-secret", <-tokens)
+
+	assert.Error(t, failover.Auth("https://unknown.firebaseio.com", nil))
+}
@@ -1,17 +1,48 @@
 /*
 Package firego is a REST client for Firebase (https://firebase.com).
+
+Values are encoded using encoding/json. Struct fields may additionally
+be annotated with a firebase tag, which takes precedence over the json tag:
+
+	type User struct {
+		ID      string    `firebase:"$key"`            // key of the user, never stored
+		Name    string    `firebase:"name"`            // stored under "name"
+		Nick    string    `firebase:"nick,omitempty"`  // omitted when empty
+		Created time.Time `firebase:"created,serverTimestamp"`
+		Secret  string    `firebase:"-"`               // never stored
+	}
+
+time.Time fields with a firebase tag are stored as milliseconds since the
+Unix epoch, which is how Firebase represents timestamps, and are converted
+back when read. Fields marked with serverTimestamp are written as
+ServerTimestamp when they hold the zero value.
+
+A string field tagged "$key" is set to the key of the struct's location
+when the struct is read as a child of a map or a slice. Objects, such as
+the children created with Push, may be read into slices of types with
+firebase tags, in which case the children are ordered by key:
+
+	var users []User
+	err := fb.Child("users").Value(&users) // users[i].ID holds the push ID
+
+Likewise, a field tagged "$priority" holds the priority of the struct's
+location. It is written when not empty and read when IncludePriority is
+set.
 */
 package firego
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net"
 	"net/http"
 	_url "net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -25,14 +56,30 @@ var TimeoutDuration = 30 * time.Second
 var defaultRedirectLimit = 30
 
 // ErrTimeout is an error type is that is returned if a request
-// exceeds the TimeoutDuration configured.
+// exceeds the TimeoutDuration configured. It can be detected with
+// errors.As and wraps the error returned by the HTTP client.
 type ErrTimeout struct {
 	error
 }
 
+// Unwrap returns the error returned by the HTTP client.
+func (e ErrTimeout) Unwrap() error {
+	return e.error
+}
+
+// Timeout reports true, like net.Error does for timeouts.
+func (e ErrTimeout) Timeout() bool {
+	return true
+}
+
+// ErrReadOnly is returned by writes made through a reference
+// obtained from ReadOnly.
+var ErrReadOnly = errors.New("firego: reference is read-only")
+
 // query parameter constants
 const (
 	authParam         = "auth"
+	accessTokenParam  = "access_token"
 	shallowParam      = "shallow"
 	formatParam       = "format"
 	formatVal         = "export"
@@ -46,11 +93,83 @@ const (
 
 const defaultHeartbeat = 2 * time.Minute
 
+// ServerTimestamp is a placeholder value that Firebase replaces with the
+// number of milliseconds since the Unix epoch at the time of the write.
+//
+// Reference https://firebase.google.com/docs/reference/rest/database/#section-server-values
+var ServerTimestamp = map[string]string{".sv": "timestamp"}
+
+// ServerIncrement returns a placeholder value that Firebase replaces with
+// the number at the location plus delta, or delta if the location does
+// not hold a number. Counters written with it need no transaction:
+//
+//    fb.Update(map[string]interface{}{
+//        "likes":         firego.ServerIncrement(1),
+//        "likedBy/alice": true,
+//    })
+//
+// Reference https://firebase.google.com/docs/reference/rest/database/#section-server-values
+func ServerIncrement(delta float64) map[string]interface{} {
+	return map[string]interface{}{".sv": map[string]interface{}{"increment": delta}}
+}
+
+// AuthStyle determines how the token given to Auth is sent to Firebase.
+type AuthStyle int
+
+const (
+	// AuthStyleParam sends the token in the auth query parameter.
+	// This is the default.
+	AuthStyleParam AuthStyle = iota
+	// AuthStyleAccessToken sends the token in the access_token query
+	// parameter, as expected for Google OAuth2 access tokens.
+	AuthStyleAccessToken
+	// AuthStyleHeader sends the token in an "Authorization: Bearer" header
+	// so that it does not end up in the access logs of proxies.
+	AuthStyleHeader
+)
+
+// RequestHook is called with every request right before it is sent, along
+// with its body, which is nil for requests without one. The body must not
+// be retained once the hook returns.
+type RequestHook func(req *http.Request, body []byte) error
+
 // Firebase represents a location in the cloud.
 type Firebase struct {
 	url           string
 	client        *http.Client
-	clientTimeout time.Duration
+	enforceLimits bool
+	encodeKeys    bool
+	readOnly      bool
+	jail          string
+	jailErr       error
+	beforeSend    RequestHook
+	audit         AuditSink
+	ctx           context.Context
+	retry         RetryPolicy
+	authStyle     AuthStyle
+	tokens        TokenSource
+
+	idempotencyKey     string
+	idempotencyRecords string
+	// history is where mutations are recorded, see RecordHistory
+	history string
+	// retryCheck, if set, reports whether a failed request was applied
+	// by Firebase anyway, in which case it is not sent again
+	retryCheck func() bool
+	// reads, if set, coalesces the identical concurrent
+	// calls to Value, see DedupeReads
+	reads *readGroup
+	// misses, if set, caches the reads finding
+	// nothing, see CacheMisses
+	misses *MissCache
+	// priority is the priority of the requests, see WithPriority
+	priority Priority
+	throttle *throttle
+	requests *requestRegistry
+
+	parseServerOrder bool
+	// fields are the fields of the children read by Value, see Select
+	fields []string
 
 	paramsMtx sync.RWMutex
 	params    _url.Values
@@ -62,32 +181,29 @@ type Firebase struct {
 	watching       bool
 	watchHeartbeat time.Duration
 	stopWatching   chan struct{}
+	watchPause     *watchPause
+	watchSignal    chan struct{}
+	skipInitial    bool
+	lastEventID    string
+	maxStreamAge   time.Duration
+	coalesce       time.Duration
+	deadLetter     DeadLetterFunc
 }
 
-// New creates a new Firebase reference,
-// if client is nil, http.DefaultClient is used.
+// New creates a new Firebase reference, if client is nil, a
+// client with the default settings of NewClient is used.
 func New(url string, client *http.Client) *Firebase {
 	fb := &Firebase{
 		url:            sanitizeURL(url),
 		params:         _url.Values{},
-		clientTimeout:  TimeoutDuration,
-		stopWatching:   make(chan struct{}),
 		watchHeartbeat: defaultHeartbeat,
 		eventFuncs:     map[string]chan struct{}{},
+		throttle:       &throttle{max: defaultMaxRetryAfter},
+		requests:       &requestRegistry{},
 	}
 	if client == nil {
-		var tr *http.Transport
-		tr = &http.Transport{
-			Dial: func(network, address string) (net.Conn, error) {
-				start := time.Now()
-				c, err := net.DialTimeout(network, address, fb.clientTimeout)
-				tr.ResponseHeaderTimeout = fb.clientTimeout - time.Since(start)
-				return c, err
-			},
-		}
-
 		client = &http.Client{
-			Transport:     tr,
+			Transport:     newTransport(ClientOptions{}, TimeoutDuration),
 			CheckRedirect: redirectPreserveHeaders,
 		}
 	}
@@ -103,6 +219,27 @@ func (fb *Firebase) Auth(token string) {
 	fb.paramsMtx.Unlock()
 }
 
+// AuthTokenSource authenticates to Firebase with tokens obtained from src
+// before every request, taking precedence over the token given to Auth.
+// References derived from fb afterwards share the same TokenSource.
+func (fb *Firebase) AuthTokenSource(src TokenSource) {
+	fb.tokens = src
+}
+
+// BeforeSend sets a hook called with every request, once its URL, including
+// the auth token, and headers are final. It can add headers, such as the
+// signatures required by egress proxies, but must not read the request's
+// body. Returning an error aborts the request. Redirects are followed
+// without calling the hook again.
+func (fb *Firebase) BeforeSend(hook RequestHook) {
+	fb.beforeSend = hook
+}
+
+// SetAuthStyle sets how the token given to Auth is sent to Firebase.
+func (fb *Firebase) SetAuthStyle(style AuthStyle) {
+	fb.authStyle = style
+}
+
 // Unauth removes the current token being used to authenticate to Firebase.
 func (fb *Firebase) Unauth() {
 	fb.paramsMtx.Lock()
@@ -111,6 +248,9 @@ func (fb *Firebase) Unauth() {
 }
 
 // Ref returns a copy of an existing Firebase reference with a new path.
+//
+// On a jailed reference the path must lie within the jail,
+// otherwise ErrJailEscape is returned.
 func (fb *Firebase) Ref(path string) (*Firebase, error) {
 	newFB := fb.copy()
 	parsedURL, err := _url.Parse(fb.url)
@@ -118,12 +258,19 @@ func (fb *Firebase) Ref(path string) (*Firebase, error) {
 		return newFB, err
 	}
 	newFB.url = parsedURL.Scheme + "://" + parsedURL.Host + "/" + strings.Trim(path, "/")
+	if fb.jail != "" && !newFB.inJail() {
+		newFB.jailErr = ErrJailEscape
+		return newFB, ErrJailEscape
+	}
 	return newFB, nil
 }
 
 // SetURL changes the url for a firebase reference.
 func (fb *Firebase) SetURL(url string) {
 	fb.url = sanitizeURL(url)
+	if fb.jail != "" && !fb.inJail() {
+		fb.jailErr = ErrJailEscape
+	}
 }
 
 // URL returns firebase reference URL
@@ -133,11 +280,17 @@ func (fb *Firebase) URL() string {
 
 // Push creates a reference to an auto-generated child location.
 func (fb *Firebase) Push(v interface{}) (*Firebase, error) {
-	bytes, err := json.Marshal(v)
+	if fb.idempotencyKey != "" {
+		return fb.writeOnce(newPushID(), v)
+	}
+
+	buf, err := fb.encodeBuffer(v, false)
 	if err != nil {
 		return nil, err
 	}
-	_, bytes, err = fb.doRequest("POST", bytes)
+	body := newPooledBody(buf)
+	defer body.release()
+	_, bytes, err := fb.doRequest("POST", buf.Bytes(), body.send)
 	if err != nil {
 		return nil, err
 	}
@@ -150,6 +303,81 @@ func (fb *Firebase) Push(v interface{}) (*Firebase, error) {
 	return newRef, err
 }
 
+// PushTrimmed pushes v like Push, then removes the oldest children of the
+// reference beyond the newest maxLen, keeping a bounded list such as the
+// recent events of a user. The children are ordered by key, which for
+// pushed children is the order they were created in. The newest maxLen+1
+// are read to find the first one to remove, however long the list has
+// grown, and the ones to remove are listed with a limitToFirst query and
+// removed with a single update per trimBatch of them.
+//
+// maxLen must be at least 1. The reference to the new child is returned
+// even if trimming fails, in which case the list is trimmed by the next
+// successful call.
+func (fb *Firebase) PushTrimmed(v interface{}, maxLen int) (*Firebase, error) {
+	if maxLen < 1 {
+		return nil, fmt.Errorf("firego: invalid maxLen %d, PushTrimmed must keep at least 1 child", maxLen)
+	}
+
+	newRef, err := fb.Push(v)
+	if err != nil {
+		return nil, err
+	}
+
+	newest, err := fb.OrderBy("$key").LimitToLast(int64(maxLen) + 1).childKeys()
+	if err != nil {
+		return newRef, err
+	}
+	if len(newest) <= maxLen {
+		return newRef, nil
+	}
+
+	// the oldest of the newest maxLen+1 children
+	// is removed along with every child before it
+	surplus := fb.OrderBy("$key").EndAtValue(newest[0]).LimitToFirst(trimBatch)
+	for {
+		keys, err := surplus.childKeys()
+		if err != nil {
+			return newRef, err
+		}
+		if len(keys) == 0 {
+			return newRef, nil
+		}
+
+		oldest := make(map[string]interface{}, len(keys))
+		for _, k := range keys {
+			oldest[k] = nil
+		}
+		if err := fb.Update(oldest); err != nil {
+			return newRef, err
+		}
+		if len(keys) < trimBatch {
+			return newRef, nil
+		}
+	}
+}
+
+// trimBatch is the number of children PushTrimmed removes at once.
+const trimBatch = 100
+
+// childKeys reads the reference and returns the keys of its children in
+// the order Firebase sorts them by.
+func (fb *Firebase) childKeys() ([]string, error) {
+	_, body, err := fb.doRequest("GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	children, _ := shallowChildren(body)
+	keys := make([]string, 0, len(children))
+	for k := range children {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return compareKeys(keys[i], keys[j]) < 0
+	})
+	return keys, nil
+}
+
 // Remove the Firebase reference from the cloud.
 func (fb *Firebase) Remove() error {
 	_, _, err := fb.doRequest("DELETE", nil)
@@ -160,32 +388,236 @@ func (fb *Firebase) Remove() error {
 }
 
 // Set the value of the Firebase reference.
+//
+// Values that Firebase can not store, such as NaN or keys containing
+// forbidden characters, are rejected with a *ValidationError before
+// anything is sent.
 func (fb *Firebase) Set(v interface{}) error {
-	bytes, err := json.Marshal(v)
+	if fb.idempotencyKey != "" {
+		_, err := fb.writeOnce("", v)
+		return err
+	}
+
+	buf, err := fb.encodeBuffer(v, false)
 	if err != nil {
 		return err
 	}
-	_, _, err = fb.doRequest("PUT", bytes)
+	body := newPooledBody(buf)
+	defer body.release()
+	_, _, err = fb.doRequest("PUT", buf.Bytes(), body.send)
 	return err
 }
 
 // Update the specific child with the given value.
+//
+// Keys of v may be slash separated paths to update multiple
+// locations at once.
 func (fb *Firebase) Update(v interface{}) error {
-	bytes, err := json.Marshal(v)
+	buf, err := fb.encodeBuffer(v, true)
+	if err != nil {
+		return err
+	}
+	body := newPooledBody(buf)
+	defer body.release()
+	_, _, err = fb.doRequest("PATCH", buf.Bytes(), body.send)
+	return err
+}
+
+// SetMerge writes the leaves of v, leaving the other children of the
+// reference untouched at any depth. Where Update replaces the top level
+// children of v as a whole, SetMerge sends a single multi-location update
+// holding the path of every leaf, so that a partially filled struct only
+// changes the fields it holds:
+//
+//    // only changes /users/alice/address/city
+//    fb.Child("users/alice").SetMerge(map[string]interface{}{
+//        "address": map[string]interface{}{"city": "Paris"},
+//    })
+//
+// Arrays and server values are written as a whole, nil values remove
+// their location and empty objects are left out. Values that are not
+// objects are written like Set does.
+func (fb *Firebase) SetMerge(v interface{}) error {
+	data, err := fb.encode(v, false)
+	if err != nil {
+		return err
+	}
+	tree, err := decodeTree(data)
 	if err != nil {
 		return err
 	}
-	_, _, err = fb.doRequest("PATCH", bytes)
+	obj, ok := tree.(map[string]interface{})
+	if !ok || isLeafObject(obj) {
+		_, _, err = fb.doRequest("PUT", data)
+		return err
+	}
+
+	leaves := map[string]interface{}{}
+	mergeLeaves(leaves, "", obj)
+	if len(leaves) == 0 {
+		return nil
+	}
+	if data, err = json.Marshal(leaves); err != nil {
+		return err
+	}
+	_, _, err = fb.doRequest("PATCH", data)
 	return err
 }
 
+// mergeLeaves adds the leaves of obj, at the given path, to leaves.
+func mergeLeaves(leaves map[string]interface{}, path string, obj map[string]interface{}) {
+	for k, v := range obj {
+		child, ok := v.(map[string]interface{})
+		if ok && !isLeafObject(child) {
+			mergeLeaves(leaves, joinPath(path, k), child)
+			continue
+		}
+		leaves[joinPath(path, k)] = v
+	}
+}
+
+// isLeafObject reports whether an object is a single value, such as
+// a server value or a value along with its priority.
+func isLeafObject(obj map[string]interface{}) bool {
+	_, sv := obj[".sv"]
+	_, value := obj[".value"]
+	return sv || value
+}
+
+// Increment atomically adds delta, which may be negative, to the integer
+// at the reference, starting from 0 if it does not hold a number, and
+// returns the resulting value.
+//
+// It is never retried, as a request failing after Firebase applied it
+// would add delta twice.
+func (fb *Firebase) Increment(delta int64) (int64, error) {
+	ref := fb
+	if fb.retry.MaxAttempts > 1 {
+		ref = fb.copy()
+		ref.retry.MaxAttempts = 1
+	}
+	body := []byte(`{".sv":{"increment":` + strconv.FormatInt(delta, 10) + `}}`)
+	_, body, err := ref.doRequest("PUT", body)
+	if err != nil {
+		return 0, err
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(body, &n); err != nil {
+		return 0, fmt.Errorf("failed to decode increment response. %w", err)
+	}
+	if i, err := n.Int64(); err == nil {
+		return i, nil
+	}
+	// the location held a double
+	f, err := n.Float64()
+	return int64(f), err
+}
+
+// Do sends a request with the given method to the location at path,
+// relative to the reference, for the REST endpoints firego has no method
+// for. The request is sent like every other: with the same authentication,
+// query parameters, hooks and retries, and with the same errors for the
+// statuses Firebase responds with.
+//
+// The body, if not nil, is encoded like the values given to Set, unless it
+// is a []byte or a json.RawMessage which is sent as is. The response, if
+// out is not nil, is decoded into it like the values read by Value.
+//
+//    var rules json.RawMessage
+//    err := fb.Do(ctx, "GET", ".settings/rules", nil, &rules)
+func (fb *Firebase) Do(ctx context.Context, method, path string, body, out interface{}) error {
+	ref := fb.WithContext(ctx).at(path)
+	method = strings.ToUpper(method)
+
+	var data []byte
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		data = b
+	case json.RawMessage:
+		data = b
+	default:
+		var err error
+		if data, err = ref.encode(body, method == "PATCH"); err != nil {
+			return err
+		}
+	}
+
+	_, resp, err := ref.doRequest(method, data)
+	if err != nil || out == nil || len(bytes.TrimSpace(resp)) == 0 {
+		return err
+	}
+	return ref.decode(resp, out)
+}
+
+// UpdateResult describes the locations written by UpdateWithResult.
+type UpdateResult struct {
+	// Paths holds the outcome of every location written, ordered by path.
+	Paths []PathResult
+}
+
+// PathResult is the outcome of an update at a single location.
+type PathResult struct {
+	// Path of the location relative to the reference, e.g. "/users/alice".
+	Path string
+	// Deleted reports whether the location was removed by a nil value.
+	Deleted bool
+	// Value is the JSON value Firebase stored at the location, as echoed
+	// in its response, with server values such as ServerTimestamp
+	// resolved. It is nil if the response did not include it.
+	Value json.RawMessage
+}
+
+// UpdateWithResult behaves like Update and describes the locations that
+// were written, which lets imports keep an audit record per key. Firebase
+// applies multi-path updates atomically, so either every location listed
+// was written or an error is returned and none were.
+func (fb *Firebase) UpdateWithResult(v interface{}) (*UpdateResult, error) {
+	bytes, err := fb.encode(v, true)
+	if err != nil {
+		return nil, err
+	}
+	_, resp, err := fb.doRequest("PATCH", bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var sent map[string]json.RawMessage
+	if err := json.Unmarshal(bytes, &sent); err != nil {
+		return nil, err
+	}
+	var echoed map[string]json.RawMessage
+	if len(resp) > 0 {
+		if err := json.Unmarshal(resp, &echoed); err != nil {
+			return nil, fmt.Errorf("failed to decode update response. %w", err)
+		}
+	}
+
+	result := &UpdateResult{Paths: make([]PathResult, 0, len(sent))}
+	for k, raw := range sent {
+		result.Paths = append(result.Paths, PathResult{
+			Path:    "/" + strings.Trim(k, "/"),
+			Deleted: string(raw) == "null",
+			Value:   echoed[k],
+		})
+	}
+	sort.Slice(result.Paths, func(i, j int) bool {
+		return result.Paths[i].Path < result.Paths[j].Path
+	})
+	return result, nil
+}
+
 // Value gets the value of the Firebase reference.
 func (fb *Firebase) Value(v interface{}) error {
-	_, bytes, err := fb.doRequest("GET", nil)
+	if len(fb.fields) > 0 {
+		return fb.selectValue(v)
+	}
+	_, bytes, err := fb.getValue()
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(bytes, v)
+	return fb.decode(bytes, v)
 }
 
 // String returns the string representation of the
@@ -203,21 +635,98 @@ func (fb *Firebase) String() string {
 
 // Child creates a new Firebase reference for the requested
 // child with the same configuration as the parent.
+//
+// On a jailed reference, children that are absolute paths or
+// contain ".." segments make every request fail with ErrJailEscape.
 func (fb *Firebase) Child(child string) *Firebase {
 	c := fb.copy()
 	c.url = c.url + "/" + child
+	if fb.jail != "" && (strings.HasPrefix(child, "/") || hasDotDot(child)) {
+		c.jailErr = ErrJailEscape
+	}
+	return c
+}
+
+// EnforceLimits determines whether or not values are checked against
+// Firebase's maximum depth and key length before being written. When
+// enabled, writes that would exceed a limit fail with a *ValidationError
+// naming the offending path instead of an error from the server.
+//
+// Reference https://firebase.google.com/docs/database/usage/limits
+func (fb *Firebase) EnforceLimits(v bool) {
+	fb.enforceLimits = v
+}
+
+// WithContext returns a copy of the reference whose requests are canceled
+// when ctx is done. When ctx has a deadline, retries are only attempted
+// while the deadline can be met, see SetRetryPolicy. References derived
+// from it use the same context.
+func (fb *Firebase) WithContext(ctx context.Context) *Firebase {
+	c := fb.copy()
+	c.ctx = ctx
+	return c
+}
+
+// ReadOnly returns a copy of the reference on which every write, such as
+// Set, Update, Remove, Push or Transaction, fails with ErrReadOnly without
+// reaching Firebase. References derived from it are read-only as well.
+func (fb *Firebase) ReadOnly() *Firebase {
+	c := fb.copy()
+	c.readOnly = true
 	return c
 }
 
+// depth returns the number of path segments of the reference.
+func (fb *Firebase) depth() int {
+	parsedURL, err := _url.Parse(fb.url)
+	if err != nil {
+		return 0
+	}
+
+	path := strings.Trim(parsedURL.Path, "/")
+	if path == "" {
+		return 0
+	}
+	return strings.Count(path, "/") + 1
+}
+
+// at returns a copy of the reference pointing at the given relative path.
+func (fb *Firebase) at(path string) *Firebase {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return fb.copy()
+	}
+	return fb.Child(path)
+}
+
 func (fb *Firebase) copy() *Firebase {
 	c := &Firebase{
-		url:            fb.url,
-		params:         _url.Values{},
-		client:         fb.client,
-		clientTimeout:  fb.clientTimeout,
-		stopWatching:   make(chan struct{}),
-		watchHeartbeat: defaultHeartbeat,
-		eventFuncs:     map[string]chan struct{}{},
+		url:                fb.url,
+		params:             _url.Values{},
+		client:             fb.client,
+		enforceLimits:      fb.enforceLimits,
+		encodeKeys:         fb.encodeKeys,
+		readOnly:           fb.readOnly,
+		jail:               fb.jail,
+		jailErr:            fb.jailErr,
+		beforeSend:         fb.beforeSend,
+		audit:              fb.audit,
+		ctx:                fb.ctx,
+		retry:              fb.retry,
+		authStyle:          fb.authStyle,
+		tokens:             fb.tokens,
+		idempotencyRecords: fb.idempotencyRecords,
+		history:            fb.history,
+		parseServerOrder:   fb.parseServerOrder,
+		reads:              fb.reads,
+		misses:             fb.misses,
+		priority:           fb.priority,
+		throttle:           fb.throttle,
+		requests:           fb.requests,
+		watchHeartbeat:     defaultHeartbeat,
+		deadLetter:         fb.deadLetter,
+		maxStreamAge:       fb.maxStreamAge,
+		eventFuncs:         map[string]chan struct{}{},
 	}
 
 	// making sure to manually copy the map items into a new
@@ -242,6 +751,56 @@ func sanitizeURL(url string) string {
 	return url
 }
 
+// newRequest creates a request for the reference's location
+// carrying the token in the configured AuthStyle.
+func (fb *Firebase) newRequest(method string, body io.Reader) (*http.Request, error) {
+	if fb.jailErr != nil {
+		return nil, fb.jailErr
+	}
+
+	if fb.authStyle == AuthStyleParam && fb.tokens == nil {
+		return http.NewRequest(method, fb.String(), body)
+	}
+
+	fb.paramsMtx.RLock()
+	params := _url.Values{}
+	for k, v := range fb.params {
+		params[k] = v
+	}
+	fb.paramsMtx.RUnlock()
+
+	token := params.Get(authParam)
+	params.Del(authParam)
+	if fb.tokens != nil {
+		var err error
+		if token, err = fb.tokens.Token(); err != nil {
+			return nil, fmt.Errorf("failed to get token %w", err)
+		}
+	}
+
+	if token != "" {
+		switch fb.authStyle {
+		case AuthStyleParam:
+			params.Set(authParam, token)
+		case AuthStyleAccessToken:
+			params.Set(accessTokenParam, token)
+		}
+	}
+
+	path := fb.url + "/.json"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	req, err := http.NewRequest(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" && fb.authStyle == AuthStyleHeader {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
 // Preserve headers on redirect.
 //
 // Reference https://github.com/golang/go/issues/4800
@@ -269,14 +828,93 @@ func withHeader(key, value string) func(*http.Request) {
 }
 
 func (fb *Firebase) doRequest(method string, body []byte, options ...func(*http.Request)) (http.Header, []byte, error) {
-	req, err := http.NewRequest(method, fb.String(), bytes.NewReader(body))
+	if fb.readOnly && method != "GET" {
+		return nil, nil, ErrReadOnly
+	}
+	if fb.misses != nil && method != "GET" {
+		// whether or not it succeeds, the write may have been applied
+		defer fb.misses.forget(fb.url)
+	}
+
+	ctx := fb.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, done := fb.requests.add(ctx, fb, method, false)
+	defer done()
+	if fb.history != "" && method != "GET" {
+		if before, ok := fb.historyBefore(method, body); ok {
+			ctx = context.WithValue(ctx, historyBeforeKey{}, before)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		// wait for Firebase to stop throttling requests
+		if err := fb.throttle.wait(ctx); err != nil {
+			return nil, nil, err
+		}
+
+		// cap the attempt to what is left of the deadline
+		timeout := fb.retry.AttemptTimeout
+		if deadline, ok := ctx.Deadline(); ok {
+			if remaining := time.Until(deadline); timeout <= 0 || remaining < timeout {
+				timeout = remaining
+			}
+		}
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		headers, respBody, err := fb.sendRequest(attemptCtx, method, body, options)
+		cancel()
+
+		if err == nil || attempt >= fb.retry.MaxAttempts || !retryable(method, err) {
+			if err != nil && attempt > 1 && ctx.Err() != nil {
+				return headers, respBody, &RetryError{Attempts: attempt, Err: err, ctxErr: ctx.Err()}
+			}
+			return headers, respBody, err
+		}
+
+		// give up if the deadline would pass before the next attempt
+		delay := fb.retry.backoff(attempt)
+		var status *StatusError
+		if errors.As(err, &status) && status.RetryAfter > delay {
+			delay = status.RetryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			return headers, respBody, &RetryError{Attempts: attempt, Err: err, ctxErr: context.DeadlineExceeded}
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return headers, respBody, &RetryError{Attempts: attempt, Err: err, ctxErr: ctx.Err()}
+		}
+		if fb.retryCheck != nil && fb.retryCheck() {
+			return nil, nil, nil
+		}
+	}
+}
+
+// sendRequest makes a single attempt at a request.
+func (fb *Firebase) sendRequest(ctx context.Context, method string, body []byte, options []func(*http.Request)) (http.Header, []byte, error) {
+	req, err := fb.newRequest(method, bytes.NewReader(body))
 	if err != nil {
 		return nil, nil, err
 	}
+	if fb.priority != PriorityInteractive {
+		ctx = context.WithValue(ctx, priorityKey{}, fb.priority)
+	}
+	req = req.WithContext(ctx)
 
 	for _, opt := range options {
 		opt(req)
 	}
+	if fb.beforeSend != nil {
+		if err := fb.beforeSend(req, body); err != nil {
+			req.Body.Close()
+			return nil, nil, err
+		}
+	}
 
 	resp, err := fb.client.Do(req)
 	switch err := err.(type) {
@@ -306,12 +944,22 @@ func (fb *Firebase) doRequest(method string, body []byte, options ...func(*http.
 	}
 
 	defer resp.Body.Close()
-	respBody, err := ioutil.ReadAll(resp.Body)
+	respBody, err := readBody(resp.Body, resp.ContentLength)
 	if err != nil {
 		return nil, nil, err
 	}
 	if resp.StatusCode/200 != 1 {
-		return resp.Header, respBody, errors.New(string(respBody))
+		delay := fb.throttle.limit(retryAfter(resp))
+		if delay > 0 {
+			fb.throttle.hold(delay)
+		}
+		return resp.Header, respBody, &StatusError{Code: resp.StatusCode, Message: string(respBody), RetryAfter: delay}
+	}
+	if fb.audit != nil && method != "GET" {
+		fb.audit.Audit(auditEntry(req, body))
+	}
+	if fb.history != "" && method != "GET" {
+		fb.recordHistory(req, body, respBody)
 	}
 	return resp.Header, respBody, nil
 }
@@ -1,10 +1,15 @@
 package firego
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -79,6 +84,76 @@ func TestAuth(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestAuthStyle(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.RequireAuth(true)
+
+	for _, style := range []AuthStyle{AuthStyleParam, AuthStyleAccessToken, AuthStyleHeader} {
+		fb := New(server.URL, nil)
+		fb.SetAuthStyle(style)
+		fb.Auth(server.Secret)
+
+		var v interface{}
+		assert.NoError(t, fb.Child("foo").Value(&v), "style %d", style)
+	}
+}
+
+func TestAuthStyleRequest(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil)
+	fb.Auth("token")
+	fb.Shallow(true)
+
+	fb.SetAuthStyle(AuthStyleAccessToken)
+	req, err := fb.newRequest("GET", nil)
+	require.NoError(t, err)
+	assert.Equal(t, URL+"/.json?access_token=token&shallow=true", req.URL.String())
+	assert.Empty(t, req.Header.Get("Authorization"))
+
+	fb.SetAuthStyle(AuthStyleHeader)
+	req, err = fb.Child("foo").newRequest("GET", nil)
+	require.NoError(t, err)
+	assert.Equal(t, URL+"/foo/.json?shallow=true", req.URL.String())
+	assert.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+
+	fb.Unauth()
+	req, err = fb.newRequest("GET", nil)
+	require.NoError(t, err)
+	assert.Empty(t, req.Header.Get("Authorization"))
+}
+
+func TestBeforeSend(t *testing.T) {
+	t.Parallel()
+	server := newTestServer("")
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.Auth("token")
+	var urls, bodies []string
+	fb.BeforeSend(func(req *http.Request, body []byte) error {
+		urls = append(urls, req.URL.String())
+		bodies = append(bodies, string(body))
+		req.Header.Set("X-Signature", fmt.Sprintf("%s %d", req.Method, len(body)))
+		return nil
+	})
+
+	require.NoError(t, fb.Child("foo").Set("bar"))
+	require.Len(t, server.receivedReqs, 1)
+	assert.Equal(t, "PUT 5", server.receivedReqs[0].Header.Get("X-Signature"))
+	assert.Equal(t, []string{server.URL + "/foo/.json?auth=token"}, urls)
+	assert.Equal(t, []string{`"bar"`}, bodies)
+
+	fb.BeforeSend(func(req *http.Request, body []byte) error {
+		return errors.New("no signature")
+	})
+	assert.EqualError(t, fb.Set("bar"), "no signature")
+	assert.EqualError(t, fb.Watch(make(chan Event)), "no signature")
+	assert.Len(t, server.receivedReqs, 1)
+}
+
 func TestUnauth(t *testing.T) {
 	t.Parallel()
 	server := firetest.New()
@@ -167,6 +242,89 @@ func TestUpdate(t *testing.T) {
 	assert.Equal(t, payload, v)
 }
 
+func TestUpdateWithResult(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "PATCH", req.Method)
+		// echo the update with the server values resolved
+		fmt.Fprint(w, `{"users/alice/name":"Alice","users/bob":null,"updated":1500000000000}`)
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	result, err := fb.UpdateWithResult(map[string]interface{}{
+		"users/alice/name": "Alice",
+		"users/bob":        nil,
+		"updated":          ServerTimestamp,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []PathResult{
+		{Path: "/updated", Value: json.RawMessage(`1500000000000`)},
+		{Path: "/users/alice/name", Value: json.RawMessage(`"Alice"`)},
+		{Path: "/users/bob", Deleted: true, Value: json.RawMessage(`null`)},
+	}, result.Paths)
+}
+
+func TestUpdateWithResultSilent(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	result, err := fb.UpdateWithResult(map[string]interface{}{"foo": "bar"})
+	require.NoError(t, err)
+	assert.Equal(t, []PathResult{{Path: "/foo"}}, result.Paths)
+}
+
+func TestSetMerge(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users/alice", map[string]interface{}{
+		"name": "Alice",
+		"address": map[string]interface{}{
+			"city":   "London",
+			"street": "Baker Street",
+		},
+		"tags":   []interface{}{"a", "b"},
+		"visits": float64(1),
+		"old":    true,
+	})
+	fb := New(server.URL, nil).Child("users/alice")
+
+	type address struct {
+		City string `json:"city"`
+	}
+	require.NoError(t, fb.SetMerge(map[string]interface{}{
+		"address": address{City: "Paris"},
+		"tags":    []string{"c"},
+		"visits":  ServerIncrement(1),
+		"old":     nil,
+		"empty":   map[string]interface{}{},
+	}))
+
+	var v map[string]interface{}
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, map[string]interface{}{
+		"name": "Alice",
+		"address": map[string]interface{}{
+			"city":   "Paris",
+			"street": "Baker Street",
+		},
+		"tags":   []interface{}{"c"},
+		"visits": float64(2),
+	}, v)
+
+	// values that are not objects are set
+	require.NoError(t, fb.Child("name").SetMerge("Alicia"))
+	var name string
+	require.NoError(t, fb.Child("name").Value(&name))
+	assert.Equal(t, "Alicia", name)
+}
+
 func TestValue(t *testing.T) {
 	t.Parallel()
 	var (
@@ -207,38 +365,190 @@ func TestChild_Issue26(t *testing.T) {
 	assert.Len(t, child2.params, 0)
 }
 
+func TestReadOnly(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("foo", "bar")
+
+	fb := New(server.URL, nil)
+	ro := fb.ReadOnly().Child("foo")
+
+	var v string
+	require.NoError(t, ro.Value(&v))
+	assert.Equal(t, "bar", v)
+
+	assert.Equal(t, ErrReadOnly, ro.Set("baz"))
+	assert.Equal(t, ErrReadOnly, ro.Update(map[string]string{"a": "b"}))
+	assert.Equal(t, ErrReadOnly, ro.Remove())
+	_, err := ro.Push("baz")
+	assert.Equal(t, ErrReadOnly, err)
+	assert.Equal(t, ErrReadOnly, ro.Transaction(func(v interface{}) (interface{}, error) {
+		return v, nil
+	}))
+	assert.Equal(t, "bar", server.Get("foo"))
+
+	// the original reference can still write
+	require.NoError(t, fb.Child("foo").Set("baz"))
+	assert.Equal(t, "baz", server.Get("foo"))
+}
+
 func TestTimeoutDuration_Headers(t *testing.T) {
-	var fb *Firebase
+	timeout := time.Millisecond
 	done := make(chan struct{})
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		time.Sleep(2 * fb.clientTimeout)
+		time.Sleep(2 * timeout)
 		close(done)
 	}))
 	defer server.Close()
 
-	fb = New(server.URL, nil)
-	fb.clientTimeout = time.Millisecond
+	fb := New(server.URL, NewClient(ClientOptions{Timeout: timeout}))
 	err := fb.Value("")
 	<-done
 	assert.NotNil(t, err)
 	assert.IsType(t, ErrTimeout{}, err)
 
-	// ResponseHeaderTimeout should be TimeoutDuration less the time it took to dial, and should be positive
+	// the transport is never changed by requests
+	require.IsType(t, (*http.Transport)(nil), fb.client.Transport)
+	assert.Equal(t, timeout, fb.client.Transport.(*http.Transport).ResponseHeaderTimeout)
+
+	// by default, requests are given TimeoutDuration
+	fb = New(server.URL, nil)
 	require.IsType(t, (*http.Transport)(nil), fb.client.Transport)
-	tr := fb.client.Transport.(*http.Transport)
-	assert.True(t, tr.ResponseHeaderTimeout < TimeoutDuration)
-	assert.True(t, tr.ResponseHeaderTimeout > 0)
+	assert.Equal(t, TimeoutDuration, fb.client.Transport.(*http.Transport).ResponseHeaderTimeout)
 }
 
 func TestTimeoutDuration_Dial(t *testing.T) {
-	fb := New("http://dialtimeouterr.or/", nil)
-	fb.clientTimeout = time.Millisecond
+	fb := New("http://dialtimeouterr.or/", NewClient(ClientOptions{Timeout: time.Millisecond}))
 
 	err := fb.Value("")
 	assert.NotNil(t, err)
 	assert.IsType(t, ErrTimeout{}, err)
+}
 
-	// ResponseHeaderTimeout should be negative since the total duration was consumed when dialing
-	require.IsType(t, (*http.Transport)(nil), fb.client.Transport)
-	assert.True(t, fb.client.Transport.(*http.Transport).ResponseHeaderTimeout < 0)
+func TestIncrement(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	fb := New(server.URL, nil).Child("counter")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := fb.Increment(2)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	n, err := fb.Increment(-5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), n)
+
+	require.NoError(t, New(server.URL, nil).Update(map[string]interface{}{
+		"counter": ServerIncrement(0.5),
+	}))
+	var v float64
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, 15.5, v)
+}
+
+func TestPushTrimmed(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	fb := New(server.URL, nil).Child("events")
+
+	var keys []string
+	for i := 0; i < 5; i++ {
+		ref, err := fb.PushTrimmed(float64(i), 3)
+		require.NoError(t, err)
+		keys = append(keys, strings.TrimPrefix(ref.URL(), fb.URL()+"/"))
+	}
+
+	var v map[string]interface{}
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, map[string]interface{}{
+		keys[2]: float64(2),
+		keys[3]: float64(3),
+		keys[4]: float64(4),
+	}, v)
+
+	for _, maxLen := range []int{0, -1} {
+		ref, err := fb.PushTrimmed(float64(5), maxLen)
+		assert.Error(t, err, "maxLen %d", maxLen)
+		assert.Nil(t, ref)
+	}
+	v = nil
+	require.NoError(t, fb.Value(&v))
+	assert.Len(t, v, 3)
+}
+
+func TestPushTrimmedGrownList(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	fb := New(server.URL, nil).Child("events")
+
+	// more than trimBatch children beyond maxLen
+	for i := 0; i < 2*trimBatch+5; i++ {
+		_, err := fb.Push(float64(i))
+		require.NoError(t, err)
+	}
+
+	ref, err := fb.PushTrimmed("last", 2)
+	require.NoError(t, err)
+
+	var v map[string]interface{}
+	require.NoError(t, fb.Value(&v))
+	require.Len(t, v, 2)
+	last := strings.TrimPrefix(ref.URL(), fb.URL()+"/")
+	assert.Equal(t, "last", v[last])
+	delete(v, last)
+	for _, value := range v {
+		assert.Equal(t, float64(2*trimBatch+4), value)
+	}
+}
+
+func TestDo(t *testing.T) {
+	t.Parallel()
+	var (
+		method, path, query, body string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		method, path, query, body = req.Method, req.URL.Path, req.URL.RawQuery, string(b)
+		if req.URL.Path == "/missing/.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil).Child("app")
+	fb.Auth("token")
+
+	var out map[string]bool
+	require.NoError(t, fb.Do(context.Background(), "patch", "settings", map[string]int{"a": 1}, &out))
+	assert.Equal(t, "PATCH", method)
+	assert.Equal(t, "/app/settings/.json", path)
+	assert.Equal(t, "auth=token", query)
+	assert.JSONEq(t, `{"a":1}`, body)
+	assert.Equal(t, map[string]bool{"ok": true}, out)
+
+	require.NoError(t, fb.Do(context.Background(), "POST", "", []byte(`"raw"`), nil))
+	assert.Equal(t, "/app/.json", path)
+	assert.Equal(t, `"raw"`, body)
+
+	err := New(server.URL, nil).Do(context.Background(), "GET", "missing", nil, &out)
+	assert.True(t, errors.Is(err, ErrNotFound), "%v", err)
+
+	assert.Equal(t, ErrReadOnly, fb.ReadOnly().Do(context.Background(), "DELETE", "settings", nil, nil))
 }
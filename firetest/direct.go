@@ -1,7 +1,6 @@
 package firetest
 
 import (
-	"encoding/base64"
 	"fmt"
 	"sync/atomic"
 	"time"
@@ -24,8 +23,8 @@ func (ft *Firetest) RequireAuth(v bool) {
 //
 // Reference https://www.firebase.com/docs/rest/api/#section-post
 func (ft *Firetest) Create(path string, v interface{}) string {
-	src := []byte(fmt.Sprint(time.Now().UnixNano()))
-	name := "~" + base64.StdEncoding.EncodeToString(src)
+	// zero padded so that names sort chronologically, like push IDs
+	name := fmt.Sprintf("~%020d", time.Now().UnixNano())
 
 	path = fmt.Sprintf("%s/%s", sanitizePath(path), name)
 	// sanitize one more time in case initial path was empty
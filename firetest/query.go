@@ -0,0 +1,218 @@
+package firetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// query holds the filtering parameters of a REST request.
+//
+// Reference https://firebase.google.com/docs/database/rest/retrieve-data#section-rest-filtering
+type query struct {
+	shallow      bool
+	orderBy      string
+	startAt      *interface{}
+	endAt        *interface{}
+	equalTo      *interface{}
+	limitToFirst int
+	limitToLast  int
+}
+
+func parseQuery(v url.Values) query {
+	q := query{
+		shallow: v.Get("shallow") == "true",
+		startAt: parseParam(v, "startAt"),
+		endAt:   parseParam(v, "endAt"),
+		equalTo: parseParam(v, "equalTo"),
+	}
+	if orderBy := v.Get("orderBy"); orderBy != "" {
+		if err := json.Unmarshal([]byte(orderBy), &q.orderBy); err != nil {
+			q.orderBy = orderBy
+		}
+	}
+	q.limitToFirst, _ = strconv.Atoi(v.Get("limitToFirst"))
+	q.limitToLast, _ = strconv.Atoi(v.Get("limitToLast"))
+	return q
+}
+
+func parseParam(v url.Values, name string) *interface{} {
+	raw, ok := v[name]
+	if !ok || len(raw) == 0 {
+		return nil
+	}
+
+	var param interface{}
+	if err := json.Unmarshal([]byte(raw[0]), &param); err != nil {
+		param = raw[0]
+	}
+	return &param
+}
+
+type queryEntry struct {
+	key   string
+	value interface{}
+	sort  interface{}
+}
+
+// apply filters the given value according to the query.
+func (q query) apply(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+
+	if q.shallow {
+		shallow := make(map[string]interface{}, len(m))
+		for k, child := range m {
+			if _, ok := child.(map[string]interface{}); ok {
+				child = true
+			}
+			shallow[k] = child
+		}
+		return shallow
+	}
+
+	if q.orderBy == "" {
+		return v
+	}
+
+	entries := make([]queryEntry, 0, len(m))
+	for k, child := range m {
+		entries = append(entries, queryEntry{key: k, value: child, sort: q.sortValue(k, child)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return q.compare(entries[i], entries[j]) < 0
+	})
+
+	filtered := entries[:0]
+	for _, e := range entries {
+		if q.equalTo != nil && q.compareTo(e, *q.equalTo) != 0 {
+			continue
+		}
+		if q.startAt != nil && q.compareTo(e, *q.startAt) < 0 {
+			continue
+		}
+		if q.endAt != nil && q.compareTo(e, *q.endAt) > 0 {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+
+	if q.limitToFirst > 0 && len(filtered) > q.limitToFirst {
+		filtered = filtered[:q.limitToFirst]
+	}
+	if q.limitToLast > 0 && len(filtered) > q.limitToLast {
+		filtered = filtered[len(filtered)-q.limitToLast:]
+	}
+
+	result := make(map[string]interface{}, len(filtered))
+	for _, e := range filtered {
+		result[e.key] = e.value
+	}
+	return result
+}
+
+func (q query) sortValue(key string, v interface{}) interface{} {
+	switch q.orderBy {
+	case "$key":
+		return key
+	case "$value":
+		return v
+	}
+
+	current := v
+	for _, step := range strings.Split(q.orderBy, "/") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[step]
+	}
+	return current
+}
+
+func (q query) compare(a, b queryEntry) int {
+	if q.orderBy == "$key" {
+		return compareKeys(a.key, b.key)
+	}
+	if c := compareValues(a.sort, b.sort); c != 0 {
+		return c
+	}
+	return compareKeys(a.key, b.key)
+}
+
+func (q query) compareTo(e queryEntry, bound interface{}) int {
+	if q.orderBy == "$key" {
+		s, ok := bound.(string)
+		if !ok {
+			s = fmt.Sprint(bound)
+		}
+		return compareKeys(e.key, s)
+	}
+	return compareValues(e.sort, bound)
+}
+
+// compareKeys orders keys the same way Firebase does, keys that can be
+// parsed as 32-bit integers come first in numeric order followed by
+// the remaining keys in lexicographic order.
+func compareKeys(a, b string) int {
+	ai, aErr := strconv.ParseInt(a, 10, 32)
+	bi, bErr := strconv.ParseInt(b, 10, 32)
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareFloats(float64(ai), float64(bi))
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// compareValues orders values the same way Firebase does: null, false,
+// true, numbers, strings and finally objects.
+func compareValues(a, b interface{}) int {
+	ar, br := typeRank(a), typeRank(b)
+	if ar != br {
+		return ar - br
+	}
+
+	switch av := a.(type) {
+	case float64:
+		return compareFloats(av, b.(float64))
+	case string:
+		return strings.Compare(av, b.(string))
+	}
+	return 0
+}
+
+func typeRank(v interface{}) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if !v {
+			return 1
+		}
+		return 2
+	case float64:
+		return 3
+	case string:
+		return 4
+	}
+	return 5
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,84 @@
+package firetest
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryApply(t *testing.T) {
+	data := map[string]interface{}{
+		"a":  map[string]interface{}{"age": 30.0, "name": "alice"},
+		"b":  map[string]interface{}{"age": 20.0, "name": "bob"},
+		"c":  map[string]interface{}{"age": 40.0},
+		"10": "ten",
+		"9":  "nine",
+	}
+
+	for _, test := range []struct {
+		name     string
+		params   string
+		expected interface{}
+	}{
+		{
+			name:     "no query",
+			params:   "",
+			expected: data,
+		},
+		{
+			name:   "shallow",
+			params: "shallow=true",
+			expected: map[string]interface{}{
+				"a": true, "b": true, "c": true, "10": "ten", "9": "nine",
+			},
+		},
+		{
+			name:   "key limitToFirst",
+			params: `orderBy="$key"&limitToFirst=2`,
+			expected: map[string]interface{}{
+				"9": "nine", "10": "ten",
+			},
+		},
+		{
+			name:   "key range",
+			params: `orderBy="$key"&startAt="10"&endAt="b"`,
+			expected: map[string]interface{}{
+				"10": "ten", "a": data["a"], "b": data["b"],
+			},
+		},
+		{
+			name:   "child limitToLast",
+			params: `orderBy="age"&limitToLast=2`,
+			expected: map[string]interface{}{
+				"a": data["a"], "c": data["c"],
+			},
+		},
+		{
+			name:   "child startAt",
+			params: `orderBy="age"&startAt=25&endAt=35`,
+			expected: map[string]interface{}{
+				"a": data["a"],
+			},
+		},
+		{
+			name:   "child equalTo",
+			params: `orderBy="name"&equalTo="bob"`,
+			expected: map[string]interface{}{
+				"b": data["b"],
+			},
+		},
+	} {
+		v, err := url.ParseQuery(test.params)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.expected, parseQuery(v).apply(data), test.name)
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	ordered := []interface{}{nil, false, true, 1.0, 2.0, "a", "b", map[string]interface{}{}}
+	for i := 0; i < len(ordered)-1; i++ {
+		assert.True(t, compareValues(ordered[i], ordered[i+1]) < 0, "%v < %v", ordered[i], ordered[i+1])
+		assert.True(t, compareValues(ordered[i+1], ordered[i]) > 0, "%v > %v", ordered[i+1], ordered[i])
+	}
+}
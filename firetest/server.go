@@ -16,6 +16,7 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -36,6 +37,9 @@ type Firetest struct {
 
 	listener net.Listener
 	db       *notifyDB
+	// writeMtx makes the writes relying on the data they
+	// replace, such as increments, atomic
+	writeMtx sync.Mutex
 
 	requireAuth *int32
 }
@@ -89,7 +93,7 @@ func (ft *Firetest) serveHTTP(w http.ResponseWriter, req *http.Request) {
 
 	if atomic.LoadInt32(ft.requireAuth) == 1 {
 		var authenticated bool
-		authHeader := req.URL.Query().Get("auth")
+		authHeader := requestToken(req)
 		switch {
 		case strings.Contains(authHeader, "."):
 			authenticated = ft.validJWT(authHeader)
@@ -216,24 +220,122 @@ func (ft *Firetest) set(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	ft.writeMtx.Lock()
+	defer ft.writeMtx.Unlock()
+	if !ft.matchETag(w, req) {
+		return
+	}
+	if resolved, ok := resolveServerValues(v, sanitizePath(req.URL.Path), ft.Get); ok {
+		v = resolved
+		body, _ = json.Marshal(v)
+	}
 	ft.Set(req.URL.Path, v)
+	if req.Header.Get("X-Firebase-ETag") == "true" {
+		w.Header().Set("ETag", ft.etag(req.URL.Path))
+	}
 	w.Write(body)
 }
 
+// etag returns the ETag of the data at path.
+func (ft *Firetest) etag(path string) string {
+	v := ft.Get(path)
+	if v == nil {
+		return "null_etag"
+	}
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// matchETag reports whether the data at the request's path matches its
+// if-match header, if any, responding with the current data otherwise.
+func (ft *Firetest) matchETag(w http.ResponseWriter, req *http.Request) bool {
+	want := req.Header.Get("if-match")
+	if want == "" {
+		return true
+	}
+	etag := ft.etag(req.URL.Path)
+	if etag == want {
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusPreconditionFailed)
+	json.NewEncoder(w).Encode(ft.Get(req.URL.Path))
+	return false
+}
+
+// requestToken returns the token sent with the request, looking at the auth
+// and access_token query parameters and the Authorization header.
+func requestToken(req *http.Request) string {
+	query := req.URL.Query()
+	if token := query.Get("auth"); token != "" {
+		return token
+	}
+	if token := query.Get("access_token"); token != "" {
+		return token
+	}
+	return strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+}
+
 func (ft *Firetest) update(w http.ResponseWriter, req *http.Request) {
 	body, v, ok := unmarshal(w, req.Body)
 	if !ok {
 		return
 	}
-	ft.Update(req.URL.Path, v)
+	ft.writeMtx.Lock()
+	defer ft.writeMtx.Unlock()
+	if resolved, ok := resolveServerValues(v, sanitizePath(req.URL.Path), ft.Get); ok {
+		v = resolved
+		body, _ = json.Marshal(v)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		ft.Update(req.URL.Path, v)
+		w.Write(body)
+		return
+	}
+
+	// every key is a path whose value is replaced, null removing it
+	multiPath := isMultiPath(m)
+	rest := map[string]interface{}{}
+	for k, child := range m {
+		path := sanitizePath(req.URL.Path) + "/" + strings.Trim(k, "/")
+		switch {
+		case child == nil:
+			ft.Delete(path)
+		case multiPath:
+			ft.Set(path, child)
+		default:
+			rest[k] = child
+		}
+	}
+	if len(rest) > 0 {
+		ft.Update(req.URL.Path, rest)
+	}
 	w.Write(body)
 }
 
+// isMultiPath reports whether the keys of an update are paths.
+func isMultiPath(m map[string]interface{}) bool {
+	for k := range m {
+		if strings.Contains(strings.Trim(k, "/"), "/") {
+			return true
+		}
+	}
+	return false
+}
+
 func (ft *Firetest) create(w http.ResponseWriter, req *http.Request) {
 	_, v, ok := unmarshal(w, req.Body)
 	if !ok {
 		return
 	}
+	// the location created holds no data to increment
+	none := func(string) interface{} { return nil }
+	if resolved, ok := resolveServerValues(v, "", none); ok {
+		v = resolved
+	}
 
 	name := ft.Create(req.URL.Path, v)
 	rtn := map[string]string{"name": name}
@@ -244,13 +346,21 @@ func (ft *Firetest) create(w http.ResponseWriter, req *http.Request) {
 }
 
 func (ft *Firetest) del(w http.ResponseWriter, req *http.Request) {
+	ft.writeMtx.Lock()
+	defer ft.writeMtx.Unlock()
+	if !ft.matchETag(w, req) {
+		return
+	}
 	ft.Delete(req.URL.Path)
 }
 
 func (ft *Firetest) get(w http.ResponseWriter, req *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
+	if req.Header.Get("X-Firebase-ETag") == "true" {
+		w.Header().Set("ETag", ft.etag(req.URL.Path))
+	}
 
-	v := ft.Get(req.URL.Path)
+	v := parseQuery(req.URL.Query()).apply(ft.Get(req.URL.Path))
 	if err := json.NewEncoder(w).Encode(v); err != nil {
 		log.Printf("Error encoding json: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -318,6 +428,41 @@ func sanitizePath(p string) string {
 	return strings.TrimSuffix(s, "/")
 }
 
+// resolveServerValues replaces any Firebase server value placeholders
+// (e.g. {".sv": "timestamp"}) with their concrete values, v being written
+// at path and current returning the data held at a path. The second return
+// value reports whether any placeholder was found.
+func resolveServerValues(v interface{}, path string, current func(path string) interface{}) (interface{}, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v, false
+	}
+
+	if sv, ok := m[".sv"]; ok && len(m) == 1 {
+		switch sv := sv.(type) {
+		case string:
+			if sv == "timestamp" {
+				return float64(time.Now().UnixNano() / int64(time.Millisecond)), true
+			}
+		case map[string]interface{}:
+			if delta, ok := sv["increment"].(float64); ok && len(sv) == 1 {
+				n, _ := current(path).(float64)
+				return n + delta, true
+			}
+		}
+		return v, false
+	}
+
+	var resolved bool
+	for k, child := range m {
+		if c, ok := resolveServerValues(child, strings.Trim(path+"/"+strings.Trim(k, "/"), "/"), current); ok {
+			m[k] = c
+			resolved = true
+		}
+	}
+	return m, resolved
+}
+
 func unmarshal(w http.ResponseWriter, r io.Reader) ([]byte, interface{}, bool) {
 	body, err := ioutil.ReadAll(r)
 	if err != nil || len(body) == 0 {
@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -188,6 +189,24 @@ func TestServeHTTPAuth(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.Code)
 }
 
+func TestServeHTTPAuthHeader(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+	ft.RequireAuth(true)
+
+	// ACT
+	req, err := http.NewRequest("GET", ft.URL+"/.json", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+ft.Secret)
+
+	resp := httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
 func TestServeHTTPUnauthorized(t *testing.T) {
 	// ARRANGE
 	ft := New()
@@ -331,6 +350,30 @@ func TestServerUpdate(t *testing.T) {
 	assert.Equal(t, newVal, string(respBody))
 }
 
+func TestServerUpdateMultiPath(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+	ft.Set("a", map[string]interface{}{"b": map[string]interface{}{"c": 1, "d": 2}, "e": 3})
+
+	// ACT
+	req, err := http.NewRequest("PATCH", ft.URL+"/a/.json", strings.NewReader(`{"b/c": {"x": 4}, "e": null}`))
+	require.NoError(t, err)
+	resp := httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, map[string]interface{}{
+		"b": map[string]interface{}{"c": map[string]interface{}{"x": float64(4)}, "d": 2},
+	}, ft.Get("a"))
+
+	req, err = http.NewRequest("PATCH", ft.URL+"/a/b/.json", strings.NewReader(`{"c": null, "y": 5}`))
+	require.NoError(t, err)
+	ft.serveHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, map[string]interface{}{"d": 2, "y": float64(5)}, ft.Get("a/b"))
+}
+
 func TestServerGet(t *testing.T) {
 	// ARRANGE
 	ft := New()
@@ -411,3 +454,100 @@ func TestUnmarshal_InvalidBody(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.Equal(t, []byte(invalidJSON), w.Body.Bytes())
 }
+
+func TestServerSetServerTimestamp(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+
+	// ACT
+	body := `{"seen":{".sv":"timestamp"},"name":"bar"}`
+	req, err := http.NewRequest("PUT", ft.URL+"/foo.json", strings.NewReader(body))
+	require.NoError(t, err)
+	resp := httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var v map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&v))
+	assert.Equal(t, "bar", v["name"])
+
+	seen, ok := ft.Get("foo/seen").(float64)
+	require.True(t, ok, "timestamp was not resolved")
+	assert.True(t, int64(seen) >= before)
+	assert.Equal(t, seen, v["seen"])
+}
+
+func TestServerIncrement(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+	ft.Set("counters/likes", float64(2))
+
+	// ACT
+	for _, tc := range []struct{ method, path, body string }{
+		{"PUT", "/counters/likes.json", `{".sv":{"increment":3}}`},
+		{"PATCH", "/counters.json", `{"likes":{".sv":{"increment":-1}},"views":{".sv":{"increment":1.5}}}`},
+		{"PATCH", "/.json", `{"counters/views":{".sv":{"increment":1}}}`},
+	} {
+		req, err := http.NewRequest(tc.method, ft.URL+tc.path, strings.NewReader(tc.body))
+		require.NoError(t, err)
+		resp := httptest.NewRecorder()
+		ft.serveHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+
+	// ASSERT
+	assert.Equal(t, map[string]interface{}{
+		"likes": float64(4),
+		"views": 2.5,
+	}, ft.Get("counters"))
+}
+
+func TestServerETag(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+	ft.Set("foo", "bar")
+
+	req, err := http.NewRequest("GET", ft.URL+"/foo.json", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Firebase-ETag", "true")
+	resp := httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+	etag := resp.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// ACT
+	req, err = http.NewRequest("PUT", ft.URL+"/foo.json", strings.NewReader(`"baz"`))
+	require.NoError(t, err)
+	req.Header.Set("if-match", etag)
+	req.Header.Set("X-Firebase-ETag", "true")
+	resp = httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "baz", ft.Get("foo"))
+	assert.NotEqual(t, etag, resp.Header().Get("ETag"))
+
+	// the data no longer matches the etag
+	req, err = http.NewRequest("DELETE", ft.URL+"/foo.json", nil)
+	require.NoError(t, err)
+	req.Header.Set("if-match", etag)
+	resp = httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+	assert.Equal(t, "\"baz\"\n", resp.Body.String())
+	assert.Equal(t, "baz", ft.Get("foo"))
+
+	req, err = http.NewRequest("PUT", ft.URL+"/new.json", strings.NewReader(`1`))
+	require.NoError(t, err)
+	req.Header.Set("if-match", "null_etag")
+	resp = httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, float64(1), ft.Get("new"))
+}
@@ -0,0 +1,99 @@
+package firego
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// Flags serves feature flags stored under a node, which is watched and
+// cached in memory so that lookups never wait on the network:
+//
+//    flags := firego.NewFlags(ctx, fb.Child("flags"))
+//    if flags.Bool("checkout/newFlow", false) {
+//        ...
+//    }
+//
+// Flags are named by their path under the node. Lookups return their
+// default value when the flag is missing, has a value of another type, or
+// the node has not been received yet, e.g. while Firebase is unreachable.
+type Flags struct {
+	tree  atomic.Value
+	ready chan struct{}
+	once  sync.Once
+}
+
+// flagTree wraps the data of the node, as atomic.Value
+// can not store nil nor values of different types.
+type flagTree struct {
+	v interface{}
+}
+
+// NewFlags creates a Flags watching the node at fb until ctx is done.
+// It returns immediately, Ready telling when the flags have been received.
+func NewFlags(ctx context.Context, fb *Firebase) *Flags {
+	f := &Flags{ready: make(chan struct{})}
+	f.tree.Store(flagTree{})
+
+	events := WatchMulti(ctx, fb)
+	go func() {
+		var tree interface{}
+		for event := range events {
+			switch event.Type {
+			case EventTypePut, EventTypePatch:
+				tree = applyEvent(tree, event.Event)
+				f.tree.Store(flagTree{tree})
+				f.once.Do(func() { close(f.ready) })
+			default:
+				if err := eventError(event.Event); err != nil {
+					log.Printf("Flags: %s", err)
+				}
+			}
+		}
+	}()
+	return f
+}
+
+// Ready returns a channel closed once the flags have been received.
+func (f *Flags) Ready() <-chan struct{} {
+	return f.ready
+}
+
+// Value returns the value of the flag, and whether it is set.
+func (f *Flags) Value(name string) (interface{}, bool) {
+	v := valueAt(f.tree.Load().(flagTree).v, splitPath(name))
+	return v, v != nil
+}
+
+// Bool returns the value of a boolean flag, or def.
+func (f *Flags) Bool(name string, def bool) bool {
+	if v, ok := f.lookup(name).(bool); ok {
+		return v
+	}
+	return def
+}
+
+// String returns the value of a string flag, or def.
+func (f *Flags) String(name string, def string) string {
+	if v, ok := f.lookup(name).(string); ok {
+		return v
+	}
+	return def
+}
+
+// Int returns the value of an integer flag, or def. Numbers
+// with a fractional part are not integers and give def.
+func (f *Flags) Int(name string, def int64) int64 {
+	v, ok := f.lookup(name).(float64)
+	if ok && v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+		return int64(v)
+	}
+	return def
+}
+
+func (f *Flags) lookup(name string) interface{} {
+	v, _ := f.Value(name)
+	return v
+}
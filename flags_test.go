@@ -0,0 +1,63 @@
+package firego
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestFlags(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("flags", map[string]interface{}{
+		"checkout": map[string]interface{}{"newFlow": true},
+		"banner":   "hello",
+		"limit":    25,
+		"ratio":    0.5,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	flags := NewFlags(ctx, New(server.URL, nil).Child("flags"))
+	select {
+	case <-flags.Ready():
+	case <-time.After(2 * time.Second):
+		t.Fatal("flags were not received")
+	}
+
+	assert.True(t, flags.Bool("checkout/newFlow", false))
+	assert.True(t, flags.Bool("missing", true))
+	assert.False(t, flags.Bool("banner", false))
+	assert.Equal(t, "hello", flags.String("banner", "bye"))
+	assert.Equal(t, "bye", flags.String("limit", "bye"))
+	assert.Equal(t, int64(25), flags.Int("limit", 1))
+	assert.Equal(t, int64(1), flags.Int("ratio", 1))
+	v, ok := flags.Value("ratio")
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, v)
+	_, ok = flags.Value("missing")
+	assert.False(t, ok)
+
+	server.Set("flags/checkout/newFlow", false)
+	eventually(t, func() bool {
+		return !flags.Bool("checkout/newFlow", true)
+	}, "change was not received")
+}
+
+func TestFlagsDefaults(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	flags := NewFlags(ctx, New("http://127.0.0.1:0", nil))
+
+	assert.True(t, flags.Bool("feature", true))
+	assert.Equal(t, int64(3), flags.Int("limit", 3))
+	select {
+	case <-flags.Ready():
+		t.Fatal("flags should not be ready")
+	default:
+	}
+}
@@ -0,0 +1,84 @@
+//go:build go1.18
+// +build go1.18
+
+package firego
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func FuzzSanitizeURL(f *testing.F) {
+	for _, seed := range []string{"https://foo.firebaseio.com/", "foo.firebaseio.com", "http://localhost:9000//", "https:///", "", "/"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, url string) {
+		withScheme := url
+		if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+			withScheme = "https://" + url
+		}
+		// at most the trailing slash is removed
+		sanitized := sanitizeURL(url)
+		if sanitized != withScheme && sanitized+"/" != withScheme {
+			t.Fatalf("%q sanitized as %q", url, sanitized)
+		}
+	})
+}
+
+func FuzzEscapeString(f *testing.F) {
+	for _, seed := range []string{"foo", "2", "+02", "false", "T", `"quoted"`, "a\x1fb", "\xff", "<&>", " "} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if !json.Valid([]byte(jsonString(s))) {
+			t.Fatalf("%q escaped as invalid JSON %q", s, jsonString(s))
+		}
+		for _, escaped := range []string{escapeString(s), escapeParameter(s)} {
+			if escaped == s {
+				// ints and bools are sent as they are
+				continue
+			}
+			if unquoted, err := strconv.Unquote(escaped); err != nil || unquoted != strings.Trim(s, `"`) {
+				t.Fatalf("%q escaped as %q", s, escaped)
+			}
+		}
+	})
+}
+
+func FuzzEventReader(f *testing.F) {
+	for _, seed := range []string{
+		"event: put\ndata: {\"path\":\"/\",\"data\":{\"a\":1}}\n\n",
+		"event: patch\ndata: {\"path\":\"/a\",\"data\":{\"b\":null}}\n\nevent: keep-alive\ndata: null\n\n",
+		"event: put\ndata: {\"data\":1}\n\n",
+		"event: put\ndata: [1,2]\n\n",
+		"garbage\n\nevent: cancel\ndata: null\n\n",
+		"event: put\r\ndata: {\"path\":1}\r\n\r\n",
+		"event: put\ndata: ",
+	} {
+		f.Add(seed, true)
+		f.Add(seed, false)
+	}
+	f.Fuzz(func(t *testing.T, stream string, deadLetter bool) {
+		frames := &eventReader{r: bufio.NewReader(strings.NewReader(stream))}
+		if deadLetter {
+			frames.deadLetter = func(raw []byte, err error) {}
+		}
+		for i := 0; i < 100; i++ {
+			evt, dat, err := frames.next()
+			if err != nil {
+				return
+			}
+			if bytes.ContainsAny(evt, "\r\n") || bytes.ContainsAny(dat, "\r\n") {
+				t.Fatalf("frame holds a line break: %q %q", evt, dat)
+			}
+			event := Event{Type: EventType(evt), rawData: dat}
+			if err := parseDataEvent(&event); err == nil && !json.Valid(dat) {
+				t.Fatalf("invalid data %q decoded", dat)
+			}
+		}
+	})
+}
@@ -0,0 +1,150 @@
+/*
+Package gcs stores the files of firego exports as the objects of a Google
+Cloud Storage bucket, through the JSON API, so that backups go straight to
+a bucket:
+
+    dst := gcs.New("my-backups", gcs.DatedPrefix("firebase/", time.Now()), tr, nil)
+    manifest, err := firego.ExportTo(ctx, fb, dst, firego.ExportOptions{Compress: true})
+
+The client authenticates with the same firego.TokenSource used for the
+database, which must provide OAuth2 access tokens with the
+https://www.googleapis.com/auth/devstorage.read_write scope.
+*/
+package gcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zabawaba99/firego"
+)
+
+// DefaultEndpoint is the base URL of the Cloud Storage API.
+const DefaultEndpoint = "https://storage.googleapis.com"
+
+// Error is returned when Cloud Storage rejects a request.
+type Error struct {
+	// Code is the HTTP status code of the response.
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("gcs: %d: %s", e.Code, e.Message)
+}
+
+// Is makes 404 errors match os.ErrNotExist.
+func (e *Error) Is(target error) bool {
+	return target == os.ErrNotExist && e.Code == http.StatusNotFound
+}
+
+// DatedPrefix returns prefix followed by the date of t, in UTC, as
+// "2006/01/02/", for the objects of a daily backup.
+func DatedPrefix(prefix string, t time.Time) string {
+	return prefix + t.UTC().Format("2006/01/02") + "/"
+}
+
+// Destination is a firego.ExportDestination storing files as the objects
+// of a bucket.
+type Destination struct {
+	// Endpoint is the base URL of the Cloud Storage API,
+	// DefaultEndpoint by default.
+	Endpoint string
+
+	bucket string
+	prefix string
+	tokens firego.TokenSource
+	client *http.Client
+}
+
+var _ firego.ExportDestination = (*Destination)(nil)
+
+// New creates a Destination storing files in bucket as objects named
+// prefix followed by the name of the file, authenticated with tokens.
+// If client is nil, http.DefaultClient is used.
+func New(bucket, prefix string, tokens firego.TokenSource, client *http.Client) *Destination {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Destination{
+		Endpoint: DefaultEndpoint,
+		bucket:   bucket,
+		prefix:   prefix,
+		tokens:   tokens,
+		client:   client,
+	}
+}
+
+// String returns the URL of the objects, gs://bucket/prefix.
+func (d *Destination) String() string {
+	return "gs://" + d.bucket + "/" + d.prefix
+}
+
+// ReadFile implements firego.ExportDestination.
+func (d *Destination) ReadFile(name string) ([]byte, error) {
+	u := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media",
+		d.endpoint(), url.PathEscape(d.bucket), url.PathEscape(d.prefix+name))
+	return d.do("GET", u, "", nil)
+}
+
+// WriteFile implements firego.ExportDestination. Objects are replaced
+// at once, readers never see a partially written one.
+func (d *Destination) WriteFile(name string, data []byte) error {
+	contentType := "application/json"
+	if strings.HasSuffix(name, ".gz") {
+		contentType = "application/gzip"
+	}
+	u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+		d.endpoint(), url.PathEscape(d.bucket), url.QueryEscape(d.prefix+name))
+	_, err := d.do("POST", u, contentType, data)
+	return err
+}
+
+func (d *Destination) endpoint() string {
+	return strings.TrimSuffix(d.Endpoint, "/")
+}
+
+func (d *Destination) do(method, u, contentType string, body []byte) ([]byte, error) {
+	token, err := d.tokens.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token %w", err)
+	}
+
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Error *Error `json:"error"`
+		}
+		if err := json.Unmarshal(respBody, &e); err != nil || e.Error == nil {
+			return nil, &Error{Code: resp.StatusCode, Message: string(respBody)}
+		}
+		e.Error.Code = resp.StatusCode
+		return nil, e.Error
+	}
+	return respBody, nil
+}
@@ -0,0 +1,133 @@
+package gcs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+var tokens = firego.TokenSourceFunc(func() (string, error) {
+	return "access-token", nil
+})
+
+// fakeStorage keeps the objects uploaded to a bucket.
+type fakeStorage struct {
+	mtx          sync.Mutex
+	objects      map[string][]byte
+	contentTypes map[string]string
+}
+
+func (f *fakeStorage) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if req.Header.Get("Authorization") != "Bearer access-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":{"code":401,"message":"Invalid Credentials"}}`)
+		return
+	}
+
+	switch {
+	case req.Method == "POST" && req.URL.Path == "/upload/storage/v1/b/backups/o":
+		name := req.URL.Query().Get("name")
+		data, _ := ioutil.ReadAll(req.Body)
+		f.objects[name] = data
+		f.contentTypes[name] = req.Header.Get("Content-Type")
+		json.NewEncoder(w).Encode(map[string]string{"name": name})
+	case req.Method == "GET" && strings.HasPrefix(req.URL.EscapedPath(), "/storage/v1/b/backups/o/"):
+		name := strings.TrimPrefix(req.URL.Path, "/storage/v1/b/backups/o/")
+		data, ok := f.objects[name]
+		if !ok || req.URL.Query().Get("alt") != "media" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"code":404,"message":"No such object"}}`)
+			return
+		}
+		w.Write(data)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestDestination(t *testing.T) {
+	t.Parallel()
+	storage := &fakeStorage{objects: map[string][]byte{}, contentTypes: map[string]string{}}
+	server := httptest.NewServer(storage)
+	defer server.Close()
+
+	dst := New("backups", "nightly/", tokens, nil)
+	dst.Endpoint = server.URL
+
+	_, err := dst.ReadFile("manifest.json")
+	assert.True(t, errors.Is(err, os.ErrNotExist), "%v", err)
+
+	require.NoError(t, dst.WriteFile("manifest.json", []byte(`{}`)))
+	data, err := dst.ReadFile("manifest.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, string(data))
+	assert.Equal(t, "application/json", storage.contentTypes["nightly/manifest.json"])
+	assert.Equal(t, "gs://backups/nightly/", dst.String())
+
+	dst = New("backups", "", firego.TokenSourceFunc(func() (string, error) {
+		return "expired", nil
+	}), nil)
+	dst.Endpoint = server.URL
+	err = dst.WriteFile("manifest.json", nil)
+	assert.EqualError(t, err, "gcs: 401: Invalid Credentials")
+}
+
+func TestExportTo(t *testing.T) {
+	t.Parallel()
+	storage := &fakeStorage{objects: map[string][]byte{}, contentTypes: map[string]string{}}
+	server := httptest.NewServer(storage)
+	defer server.Close()
+
+	fs := firetest.New()
+	fs.Start()
+	defer fs.Close()
+	for i := 0; i < 5; i++ {
+		fs.Set(fmt.Sprintf("data/k%d", i), float64(i))
+	}
+	fb := firego.New(fs.URL, nil).Child("data")
+
+	prefix := DatedPrefix("firebase/", time.Date(2020, 3, 4, 23, 0, 0, 0, time.FixedZone("", -2*3600)))
+	assert.Equal(t, "firebase/2020/03/05/", prefix)
+	dst := New("backups", prefix, tokens, nil)
+	dst.Endpoint = server.URL
+
+	manifest, err := firego.ExportTo(context.Background(), fb, dst, firego.ExportOptions{ChunkSize: 3, Compress: true})
+	require.NoError(t, err)
+	assert.True(t, manifest.Complete)
+	require.Len(t, manifest.Chunks, 2)
+	assert.Equal(t, "chunk-000001.json.gz", manifest.Chunks[0].File)
+
+	object := storage.objects["firebase/2020/03/05/chunk-000001.json.gz"]
+	assert.Equal(t, "application/gzip", storage.contentTypes["firebase/2020/03/05/chunk-000001.json.gz"])
+	zr, err := gzip.NewReader(bytes.NewReader(object))
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"k0":0,"k1":1,"k2":2}`, string(data))
+	hash, err := firego.ContentHash(data)
+	require.NoError(t, err)
+	assert.Equal(t, hash, manifest.Chunks[0].Hash)
+
+	// the manifest is read back to resume
+	again, err := firego.ExportTo(context.Background(), fb, dst, firego.ExportOptions{ChunkSize: 3, Compress: true})
+	require.NoError(t, err)
+	assert.Equal(t, manifest, again)
+}
@@ -0,0 +1,169 @@
+/*
+Package geo stores locations in Firebase and queries them by distance, in
+the format of GeoFire so that the same data can be shared with the GeoFire
+libraries of the client SDKs:
+
+    g := geo.New(fb.Child("drivers"))
+    err := g.Set("alice", geo.Location{Latitude: 37.7853889, Longitude: -122.4056973})
+    ...
+    results, err := g.Query(geo.Location{Latitude: 37.79, Longitude: -122.41}, 2).Results()
+
+Every location is stored as a child holding its geohash, "g", and its
+coordinates, "l". Queries ask Firebase for the few ranges of geohashes
+covering the circle queried and then filter out the locations further than
+its radius, which means that "g" should be indexed with an ".indexOn" rule.
+*/
+package geo
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zabawaba99/firego"
+)
+
+// GeoFire stores locations as the children of a reference.
+type GeoFire struct {
+	fb *firego.Firebase
+}
+
+// New creates a GeoFire storing locations as the children of fb.
+func New(fb *firego.Firebase) *GeoFire {
+	return &GeoFire{fb: fb}
+}
+
+// Set stores the location of key.
+func (g *GeoFire) Set(key string, l Location) error {
+	if !l.Valid() {
+		return fmt.Errorf("invalid location %v", l)
+	}
+	hash := Encode(l, Precision)
+	return g.fb.Child(key).Set(map[string]interface{}{
+		".priority": hash,
+		"g":         hash,
+		"l":         []float64{l.Latitude, l.Longitude},
+	})
+}
+
+// Get returns the location of key, nil if it has none.
+func (g *GeoFire) Get(key string) (*Location, error) {
+	var v interface{}
+	if err := g.fb.Child(key).Value(&v); err != nil {
+		return nil, err
+	}
+	l, ok := parseEntry(v)
+	if !ok {
+		return nil, nil
+	}
+	return &l, nil
+}
+
+// Remove removes the location of key.
+func (g *GeoFire) Remove(key string) error {
+	return g.fb.Child(key).Remove()
+}
+
+// Query creates a query of the locations within radius, in kilometers,
+// of center.
+func (g *GeoFire) Query(center Location, radius float64) *Query {
+	return &Query{RetryDelay: time.Second, g: g, center: center, radius: radius}
+}
+
+// Result is a location found by a query.
+type Result struct {
+	Key      string
+	Location Location
+	// Distance from the center of the query, in kilometers.
+	Distance float64
+}
+
+// Query is a query of the locations within a radius of a center.
+type Query struct {
+	// OnError is called when the connection of Watch is lost.
+	// Errors are logged if it is nil.
+	OnError func(err error)
+	// RetryDelay is how long Watch waits before watching again after
+	// the connection is lost. It defaults to one second.
+	RetryDelay time.Duration
+
+	g      *GeoFire
+	center Location
+	radius float64
+
+	mtx     sync.Mutex
+	stop    chan struct{}
+	running sync.WaitGroup
+}
+
+// Results returns the locations within the radius of the query,
+// closest first.
+func (q *Query) Results() ([]Result, error) {
+	if !q.center.Valid() {
+		return nil, fmt.Errorf("invalid center %v", q.center)
+	}
+
+	locations := map[string]Location{}
+	for _, r := range queryRanges(q.center, q.radius) {
+		var v map[string]interface{}
+		if err := q.ref(r).Value(&v); err != nil {
+			return nil, err
+		}
+		for key, entry := range v {
+			if l, ok := parseEntry(entry); ok {
+				locations[key] = l
+			}
+		}
+	}
+
+	var results []Result
+	for key, l := range locations {
+		if d := Distance(q.center, l); d <= q.radius {
+			results = append(results, Result{Key: key, Location: l, Distance: d})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Distance != results[j].Distance {
+			return results[i].Distance < results[j].Distance
+		}
+		return results[i].Key < results[j].Key
+	})
+	return results, nil
+}
+
+// ref returns the query of the locations whose geohash is within r.
+func (q *Query) ref(r geohashRange) *firego.Firebase {
+	return q.g.fb.OrderBy("g").StartAtValue(r.start).EndAtValue(r.end)
+}
+
+// parseEntry returns the location held by a child stored by GeoFire.
+func parseEntry(v interface{}) (Location, bool) {
+	entry, ok := v.(map[string]interface{})
+	if !ok {
+		return Location{}, false
+	}
+
+	var coordinates [2]interface{}
+	switch l := entry["l"].(type) {
+	case []interface{}:
+		if len(l) != 2 {
+			return Location{}, false
+		}
+		coordinates[0], coordinates[1] = l[0], l[1]
+	case map[string]interface{}:
+		// arrays may be held as objects keyed by index
+		coordinates[0], coordinates[1] = l["0"], l["1"]
+	}
+
+	lat, ok := coordinates[0].(float64)
+	if !ok {
+		return Location{}, false
+	}
+	lon, ok := coordinates[1].(float64)
+	if !ok {
+		return Location{}, false
+	}
+	l := Location{Latitude: lat, Longitude: lon}
+	return l, l.Valid()
+}
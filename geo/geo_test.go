@@ -0,0 +1,106 @@
+package geo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+var (
+	center = Location{37.7853074, -122.4054274}
+	// about 500m away from center
+	near = Location{37.7898, -122.4054274}
+	// about 5km away from center
+	far = Location{37.83, -122.4054274}
+)
+
+func TestGeoFire(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	g := New(firego.New(server.URL, nil).Child("drivers"))
+
+	require.NoError(t, g.Set("alice", center))
+	require.NoError(t, g.Set("bob", near))
+	require.NoError(t, g.Set("carol", far))
+	assert.Error(t, g.Set("dave", Location{91, 0}))
+
+	assert.Equal(t, map[string]interface{}{
+		".priority": "9q8yywe56g",
+		"g":         "9q8yywe56g",
+		"l":         []interface{}{center.Latitude, center.Longitude},
+	}, server.Get("drivers/alice"))
+
+	l, err := g.Get("bob")
+	require.NoError(t, err)
+	assert.Equal(t, &near, l)
+
+	results, err := g.Query(center, 1).Results()
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "alice", results[0].Key)
+	assert.Zero(t, results[0].Distance)
+	assert.Equal(t, "bob", results[1].Key)
+	assert.InDelta(t, 0.5, results[1].Distance, 0.05)
+
+	require.NoError(t, g.Remove("alice"))
+	l, err = g.Get("alice")
+	require.NoError(t, err)
+	assert.Nil(t, l)
+	results, err = g.Query(center, 10).Results()
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "bob", results[0].Key)
+	assert.Equal(t, "carol", results[1].Key)
+}
+
+func TestQueryWatch(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	g := New(firego.New(server.URL, nil).Child("drivers"))
+	require.NoError(t, g.Set("alice", center))
+	require.NoError(t, g.Set("carol", far))
+
+	q := g.Query(center, 1)
+	notifications := make(chan Event)
+	require.NoError(t, q.Watch(notifications))
+	assert.Equal(t, errWatching, q.Watch(make(chan Event)))
+
+	next := func() Event {
+		select {
+		case event := <-notifications:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event received")
+		}
+		return Event{}
+	}
+
+	event := next()
+	assert.Equal(t, KeyEntered, event.Type)
+	assert.Equal(t, "alice", event.Key)
+
+	require.NoError(t, g.Set("bob", near))
+	event = next()
+	assert.Equal(t, Event{KeyEntered, "bob", near, Distance(center, near)}, event)
+
+	require.NoError(t, g.Set("bob", center))
+	assert.Equal(t, Event{KeyMoved, "bob", center, 0}, next())
+
+	require.NoError(t, g.Set("alice", far))
+	assert.Equal(t, Event{KeyExited, "alice", far, Distance(center, far)}, next())
+
+	require.NoError(t, g.Remove("bob"))
+	assert.Equal(t, Event{KeyExited, "bob", center, 0}, next())
+
+	q.StopWatching()
+	_, ok := <-notifications
+	assert.False(t, ok)
+}
@@ -0,0 +1,215 @@
+package geo
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	// base32 is the alphabet of geohashes.
+	base32      = "0123456789bcdefghjkmnpqrstuvwxyz"
+	bitsPerChar = 5
+	// maxPrecision is the number of characters of the longest geohash.
+	maxPrecision = 22
+
+	// Precision is the number of characters of the geohashes stored,
+	// which is what GeoFire uses.
+	Precision = 10
+
+	earthMeridionalCircumference = 40007860
+	metersPerDegreeLatitude      = 110574
+	earthEquatorialRadius        = 6378137.0
+	earthEccentricitySquared     = 0.00669447819799
+	// earthRadius is the mean radius of the Earth, in kilometers.
+	earthRadius = 6371
+	epsilon     = 1e-12
+)
+
+// Location is a point on Earth, in degrees.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Valid reports whether the location is within the range of latitudes
+// and longitudes.
+func (l Location) Valid() bool {
+	return l.Latitude >= -90 && l.Latitude <= 90 && l.Longitude >= -180 && l.Longitude <= 180
+}
+
+// Encode returns the geohash of the location with the given number of
+// characters.
+func Encode(l Location, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+
+	var (
+		hash  strings.Builder
+		value int
+		bits  int
+		even  = true
+	)
+	for hash.Len() < precision {
+		coordinate, r := l.Latitude, &latRange
+		if even {
+			coordinate, r = l.Longitude, &lonRange
+		}
+		mid := (r[0] + r[1]) / 2
+		if coordinate > mid {
+			value = value<<1 + 1
+			r[0] = mid
+		} else {
+			value <<= 1
+			r[1] = mid
+		}
+		even = !even
+
+		if bits < bitsPerChar-1 {
+			bits++
+			continue
+		}
+		hash.WriteByte(base32[value])
+		bits, value = 0, 0
+	}
+	return hash.String()
+}
+
+// Distance returns the distance between two locations, in kilometers.
+func Distance(a, b Location) float64 {
+	latDelta := radians(b.Latitude - a.Latitude)
+	lonDelta := radians(b.Longitude - a.Longitude)
+	h := math.Sin(latDelta/2)*math.Sin(latDelta/2) +
+		math.Cos(radians(a.Latitude))*math.Cos(radians(b.Latitude))*
+			math.Sin(lonDelta/2)*math.Sin(lonDelta/2)
+	return earthRadius * 2 * math.Atan2(math.Sqrt(h), math.Sqrt(1-h))
+}
+
+// geohashRange is a range of geohashes, from start to end inclusive.
+type geohashRange struct {
+	start, end string
+}
+
+// queryRanges returns the ranges of geohashes covering the circle of the
+// given radius, in kilometers, around center. They are computed like
+// GeoFire does so that the same indexes serve both.
+func queryRanges(center Location, radius float64) []geohashRange {
+	meters := radius * 1000
+	bits := boundingBoxBits(center, meters)
+	if bits < 1 {
+		bits = 1
+	}
+	precision := int(math.Ceil(float64(bits) / bitsPerChar))
+
+	var ranges []geohashRange
+	seen := map[geohashRange]bool{}
+	for _, l := range boundingBoxCoordinates(center, meters) {
+		r := geohashQuery(Encode(l, precision), bits)
+		if !seen[r] {
+			seen[r] = true
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges
+}
+
+// geohashQuery returns the range of geohashes sharing the given number
+// of leading bits with geohash.
+func geohashQuery(geohash string, bits int) geohashRange {
+	precision := int(math.Ceil(float64(bits) / bitsPerChar))
+	if len(geohash) < precision {
+		return geohashRange{geohash, geohash + "~"}
+	}
+	geohash = geohash[:precision]
+	base := geohash[:len(geohash)-1]
+	last := strings.IndexByte(base32, geohash[len(geohash)-1])
+	unused := bitsPerChar - (bits - len(base)*bitsPerChar)
+	start := (last >> uint(unused)) << uint(unused)
+	end := start + 1<<uint(unused)
+	if end > len(base32)-1 {
+		return geohashRange{base + string(base32[start]), base + "~"}
+	}
+	return geohashRange{base + string(base32[start]), base + string(base32[end])}
+}
+
+// boundingBoxBits returns the number of bits of the geohashes whose
+// cells are at least as large as the box of the given size, in meters,
+// around l.
+func boundingBoxBits(l Location, size float64) int {
+	latDelta := size / metersPerDegreeLatitude
+	north := math.Min(90, l.Latitude+latDelta)
+	south := math.Max(-90, l.Latitude-latDelta)
+	latBits := int(math.Floor(latitudeBitsForResolution(size))) * 2
+	northBits := int(math.Floor(longitudeBitsForResolution(size, north)))*2 - 1
+	southBits := int(math.Floor(longitudeBitsForResolution(size, south)))*2 - 1
+
+	bits := maxPrecision * bitsPerChar
+	for _, b := range []int{latBits, northBits, southBits} {
+		if b < bits {
+			bits = b
+		}
+	}
+	return bits
+}
+
+// boundingBoxCoordinates returns the center, corners and middles of the
+// edges of the box of the given size, in meters, around l.
+func boundingBoxCoordinates(l Location, size float64) []Location {
+	latDegrees := size / metersPerDegreeLatitude
+	north := math.Min(90, l.Latitude+latDegrees)
+	south := math.Max(-90, l.Latitude-latDegrees)
+	lonDegrees := math.Max(metersToLongitudeDegrees(size, north), metersToLongitudeDegrees(size, south))
+
+	var coordinates []Location
+	for _, lat := range []float64{l.Latitude, north, south} {
+		coordinates = append(coordinates,
+			Location{lat, l.Longitude},
+			Location{lat, wrapLongitude(l.Longitude - lonDegrees)},
+			Location{lat, wrapLongitude(l.Longitude + lonDegrees)},
+		)
+	}
+	return coordinates
+}
+
+func latitudeBitsForResolution(resolution float64) float64 {
+	return math.Min(math.Log2(earthMeridionalCircumference/2/resolution), maxPrecision*bitsPerChar)
+}
+
+func longitudeBitsForResolution(resolution, latitude float64) float64 {
+	degrees := metersToLongitudeDegrees(resolution, latitude)
+	if math.Abs(degrees) > 0.000001 {
+		return math.Max(1, math.Log2(360/degrees))
+	}
+	return 1
+}
+
+// metersToLongitudeDegrees returns the number of degrees of longitude
+// spanning distance, in meters, at the given latitude.
+func metersToLongitudeDegrees(distance, latitude float64) float64 {
+	lat := radians(latitude)
+	num := math.Cos(lat) * earthEquatorialRadius * math.Pi / 180
+	denom := 1 / math.Sqrt(1-earthEccentricitySquared*math.Sin(lat)*math.Sin(lat))
+	delta := num * denom
+	if delta < epsilon {
+		if distance > 0 {
+			return 360
+		}
+		return 0
+	}
+	return math.Min(360, distance/delta)
+}
+
+// wrapLongitude brings longitude back within -180 and 180 degrees.
+func wrapLongitude(longitude float64) float64 {
+	if longitude >= -180 && longitude <= 180 {
+		return longitude
+	}
+	adjusted := longitude + 180
+	if adjusted > 0 {
+		return math.Mod(adjusted, 360) - 180
+	}
+	return 180 - math.Mod(-adjusted, 360)
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
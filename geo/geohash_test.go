@@ -0,0 +1,92 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct {
+		location  Location
+		precision int
+		expected  string
+	}{
+		{Location{0, 0}, 10, "7zzzzzzzzz"},
+		{Location{-90, 180}, 10, "pbpbpbpbpb"},
+		{Location{90, -180}, 10, "bpbpbpbpbp"},
+		{Location{37.7853074, -122.4054274}, 10, "9q8yywe56g"},
+		{Location{38.98719, -77.250783}, 10, "dqcjf17sy6"},
+		{Location{29.3760648, 47.9818853}, 10, "tj4p5gerfz"},
+		{Location{78.216667, 15.55}, 10, "umghcygjj7"},
+		{Location{-54.933333, -67.616667}, 10, "4qpzmren1k"},
+		{Location{-54, -67}, 10, "4w2kg3s54y"},
+		{Location{-90, 180}, 5, "pbpbp"},
+	} {
+		assert.Equal(t, tt.expected, Encode(tt.location, tt.precision), "%v", tt.location)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct {
+		a, b     Location
+		expected float64
+	}{
+		{Location{90, 180}, Location{90, 180}, 0},
+		{Location{-90, -180}, Location{90, 180}, 20015},
+		{Location{-90, -180}, Location{-90, 180}, 0},
+		{Location{-90, -180}, Location{90, -180}, 20015},
+		{Location{37.7853074, -122.4054274}, Location{78.216667, 15.55}, 6818},
+		{Location{38.98719, -77.250783}, Location{29.3760648, 47.9818853}, 10531},
+	} {
+		assert.InDelta(t, tt.expected, Distance(tt.a, tt.b), 1, "%v %v", tt.a, tt.b)
+	}
+}
+
+func TestGeohashQuery(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct {
+		geohash  string
+		bits     int
+		expected geohashRange
+	}{
+		{"64m9yn96mx", 6, geohashRange{"60", "6h"}},
+		{"64m9yn96mx", 1, geohashRange{"0", "h"}},
+		{"64m9yn96mx", 10, geohashRange{"64", "65"}},
+		{"6409yn96mx", 11, geohashRange{"640", "64h"}},
+		{"64m9yn96mx", 11, geohashRange{"64h", "64~"}},
+		{"6", 10, geohashRange{"6", "6~"}},
+		{"64z178", 12, geohashRange{"64s", "64~"}},
+		{"64z178", 15, geohashRange{"64z", "64~"}},
+	} {
+		assert.Equal(t, tt.expected, geohashQuery(tt.geohash, tt.bits), "%s %d", tt.geohash, tt.bits)
+	}
+}
+
+func TestQueryRanges(t *testing.T) {
+	t.Parallel()
+	center := Location{37.7853074, -122.4054274}
+	ranges := queryRanges(center, 1)
+	assert.NotEmpty(t, ranges)
+	assert.True(t, len(ranges) <= 9)
+
+	// every location within the radius is covered
+	for _, l := range []Location{center, {37.79, -122.41}, {37.78, -122.4}} {
+		hash := Encode(l, Precision)
+		var covered bool
+		for _, r := range ranges {
+			covered = covered || (r.start <= hash && hash <= r.end)
+		}
+		assert.True(t, covered, "%v", l)
+	}
+}
+
+func TestWrapLongitude(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, 170.0, wrapLongitude(170))
+	assert.Equal(t, -170.0, wrapLongitude(190))
+	assert.Equal(t, 170.0, wrapLongitude(-190))
+	assert.Equal(t, 0.0, wrapLongitude(360))
+}
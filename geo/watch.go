@@ -0,0 +1,291 @@
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zabawaba99/firego"
+	fbsync "github.com/zabawaba99/firego/sync"
+)
+
+// EventType is the kind of change reported by Watch.
+type EventType int
+
+const (
+	// KeyEntered is sent when a location comes within the radius,
+	// including the locations within it when watching starts.
+	KeyEntered EventType = iota
+	// KeyExited is sent when a location leaves the radius or is removed.
+	KeyExited
+	// KeyMoved is sent when a location moves within the radius.
+	KeyMoved
+)
+
+func (t EventType) String() string {
+	switch t {
+	case KeyEntered:
+		return "key_entered"
+	case KeyExited:
+		return "key_exited"
+	case KeyMoved:
+		return "key_moved"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event is a change of the locations within the radius of a query.
+type Event struct {
+	Type EventType
+	Key  string
+	// Location is the new location of the key, or its last known
+	// location if it was removed.
+	Location Location
+	// Distance of the location from the center of the query,
+	// in kilometers.
+	Distance float64
+}
+
+var errWatching = errors.New("geo: query is already being watched")
+
+// rangeEvent is an event of the stream watching one of the ranges
+// of geohashes of the query.
+type rangeEvent struct {
+	index int
+	event firego.Event
+}
+
+// Watch sends an event on notifications whenever a location enters, exits
+// or moves within the radius of the query, starting with an event for every
+// location within it. Every range of geohashes covering the circle queried
+// is watched, and watched again whenever the connection is lost, until
+// StopWatching is called, which closes notifications.
+func (q *Query) Watch(notifications chan Event) error {
+	if !q.center.Valid() {
+		return fmt.Errorf("invalid center %v", q.center)
+	}
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.stop != nil {
+		return errWatching
+	}
+
+	ranges := queryRanges(q.center, q.radius)
+	stop := make(chan struct{})
+	events := make(chan rangeEvent)
+	var refs []*firego.Firebase
+	for i, r := range ranges {
+		ref := q.ref(r)
+		watched := make(chan firego.Event)
+		if err := ref.Watch(watched); err != nil {
+			for _, ref := range refs {
+				ref.StopWatching()
+			}
+			return err
+		}
+		refs = append(refs, ref)
+
+		i, r := i, r
+		q.running.Add(1)
+		go func() {
+			defer q.running.Done()
+			q.forward(i, r, ref, watched, events, stop)
+		}()
+	}
+
+	w := &queryWatch{q: q, mirrors: make([]*fbsync.Database, len(ranges)), inside: map[string]Location{}}
+	for i := range w.mirrors {
+		w.mirrors[i] = fbsync.NewDB()
+	}
+	q.running.Add(1)
+	go func() {
+		defer q.running.Done()
+		defer close(notifications)
+		w.run(events, notifications, stop)
+	}()
+
+	q.stop = stop
+	return nil
+}
+
+// StopWatching stops watching the query and waits for notifications
+// to be closed.
+func (q *Query) StopWatching() {
+	q.mtx.Lock()
+	if q.stop != nil {
+		close(q.stop)
+		q.stop = nil
+	}
+	q.mtx.Unlock()
+
+	q.running.Wait()
+}
+
+// forward sends the events of the stream of the range with the given
+// index on events, watching it again whenever the connection is lost.
+func (q *Query) forward(index int, r geohashRange, ref *firego.Firebase, watched chan firego.Event, events chan rangeEvent, stop chan struct{}) {
+	for {
+		q.session(index, ref, watched, events, stop)
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(q.RetryDelay):
+			}
+
+			ref = q.ref(r)
+			watched = make(chan firego.Event)
+			err := ref.Watch(watched)
+			if err == nil {
+				break
+			}
+			q.handleError(err)
+		}
+	}
+}
+
+func (q *Query) session(index int, ref *firego.Firebase, watched chan firego.Event, events chan rangeEvent, stop chan struct{}) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		ref.StopWatching()
+	}()
+
+	for event := range watched {
+		switch event.Type {
+		case firego.EventTypePut, firego.EventTypePatch:
+			select {
+			case events <- rangeEvent{index: index, event: event}:
+			case <-stop:
+				return
+			}
+		case firego.EventTypeError, firego.EventTypeAuthRevoked:
+			q.handleError(fmt.Errorf("watch ended by %s event", event.Type))
+		}
+	}
+}
+
+func (q *Query) handleError(err error) {
+	if q.OnError != nil {
+		q.OnError(err)
+		return
+	}
+	log.Printf("geo: %s", err)
+}
+
+// queryWatch mirrors the ranges of a watched query and
+// tells the changes of the locations within its radius.
+type queryWatch struct {
+	q       *Query
+	mirrors []*fbsync.Database
+	inside  map[string]Location
+}
+
+func (w *queryWatch) run(events chan rangeEvent, notifications chan Event, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case e := <-events:
+			w.apply(e)
+			for _, event := range w.changes() {
+				select {
+				case notifications <- event:
+				case <-stop:
+					return
+				}
+			}
+		}
+	}
+}
+
+// apply updates the mirror of a range with one of its events.
+func (w *queryWatch) apply(e rangeEvent) {
+	mirror := w.mirrors[e.index]
+	path := strings.Trim(e.event.Path, "/")
+	if e.event.Seq == 1 {
+		// the first event of a stream holds the whole of the range
+		path = ""
+	}
+	put := func(path string, v interface{}) {
+		if v == nil {
+			mirror.Del(path)
+			return
+		}
+		mirror.Add(path, fbsync.NewNode("", v))
+	}
+
+	if e.event.Type == firego.EventTypePatch {
+		children, _ := e.event.Data.(map[string]interface{})
+		for k, v := range children {
+			put(strings.Trim(path+"/"+k, "/"), v)
+		}
+		return
+	}
+	put(path, e.event.Data)
+}
+
+// changes returns the events telling how the locations within the
+// radius changed since the last call, ordered by key.
+func (w *queryWatch) changes() []Event {
+	locations := map[string]Location{}
+	for _, mirror := range w.mirrors {
+		root := mirror.Get("")
+		if root == nil {
+			continue
+		}
+		children, _ := root.Objectify().(map[string]interface{})
+		for key, entry := range children {
+			if l, ok := parseEntry(entry); ok {
+				locations[key] = l
+			}
+		}
+	}
+
+	inside := map[string]Location{}
+	for key, l := range locations {
+		if Distance(w.q.center, l) <= w.q.radius {
+			inside[key] = l
+		}
+	}
+
+	var events []Event
+	for key, l := range inside {
+		before, ok := w.inside[key]
+		switch {
+		case !ok:
+			events = append(events, w.event(KeyEntered, key, l))
+		case before != l:
+			events = append(events, w.event(KeyMoved, key, l))
+		}
+	}
+	for key, before := range w.inside {
+		if _, ok := inside[key]; ok {
+			continue
+		}
+		l, ok := locations[key]
+		if !ok {
+			l = before
+		}
+		events = append(events, w.event(KeyExited, key, l))
+	}
+	w.inside = inside
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Key < events[j].Key
+	})
+	return events
+}
+
+func (w *queryWatch) event(t EventType, key string, l Location) Event {
+	return Event{Type: t, Key: key, Location: l, Distance: Distance(w.q.center, l)}
+}
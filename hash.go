@@ -0,0 +1,75 @@
+package firego
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// ContentHash returns the SHA-256 hash, hex encoded, of data, the JSON of a
+// value read from Firebase. The hash only depends on the value, not on the
+// order of keys or the formatting of the JSON, so that the copies of a
+// subtree read at different times or from different mirrors can be compared.
+func ContentHash(data []byte) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "", err
+	}
+	// marshaling sorts the keys of objects
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ValueWithHash reads the value of the reference into v, like Value,
+// and returns the ContentHash of the data read.
+func (fb *Firebase) ValueWithHash(v interface{}) (string, error) {
+	_, bytes, err := fb.doRequest("GET", nil)
+	if err != nil {
+		return "", err
+	}
+	hash, err := ContentHash(bytes)
+	if err != nil {
+		return "", err
+	}
+	return hash, fb.decode(bytes, v)
+}
+
+// HashMismatchError is returned by VerifyValue when
+// a copy of the data differs from the first one read.
+type HashMismatchError struct {
+	// URL of the reference the copy was read from.
+	URL string
+	// Expected is the hash of the first copy, Actual of this one.
+	Expected, Actual string
+}
+
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf("firego: content of %s does not match: expected hash %s, got %s", e.URL, e.Expected, e.Actual)
+}
+
+// VerifyValue reads the value of the reference into v, like ValueWithHash,
+// then reads it from every mirror and fails with a *HashMismatchError if a
+// copy differs. Passing fb itself as a mirror reads the data again, which
+// catches reads that were silently truncated along the way.
+func (fb *Firebase) VerifyValue(v interface{}, mirrors ...*Firebase) (string, error) {
+	hash, err := fb.ValueWithHash(v)
+	if err != nil {
+		return "", err
+	}
+	for _, mirror := range mirrors {
+		var data interface{}
+		mirrorHash, err := mirror.ValueWithHash(&data)
+		if err != nil {
+			return "", err
+		}
+		if mirrorHash != hash {
+			return "", &HashMismatchError{URL: mirror.url, Expected: hash, Actual: mirrorHash}
+		}
+	}
+	return hash, nil
+}
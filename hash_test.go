@@ -0,0 +1,52 @@
+package firego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestContentHash(t *testing.T) {
+	hash, err := ContentHash([]byte(`{"a": 1, "b": {"c": [true, "x"]}}`))
+	require.NoError(t, err)
+
+	same, err := ContentHash([]byte(`{"b":{"c":[true,"x"]},"a":1.0}`))
+	require.NoError(t, err)
+	assert.Equal(t, hash, same, "formatting should not change the hash")
+
+	other, err := ContentHash([]byte(`{"a": 1, "b": {"c": [true]}}`))
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+
+	_, err = ContentHash([]byte(`{"a": 1, "b": {"c": [tr`))
+	assert.Error(t, err, "truncated data should not be hashed")
+}
+
+func TestVerifyValue(t *testing.T) {
+	t.Parallel()
+	primary, mirror := firetest.New(), firetest.New()
+	primary.Start()
+	defer primary.Close()
+	mirror.Start()
+	defer mirror.Close()
+	primary.Set("data", map[string]interface{}{"a": 1, "b": 2})
+	mirror.Set("data", map[string]interface{}{"b": 2, "a": 1})
+
+	fb := New(primary.URL, nil).Child("data")
+	var v map[string]int
+	hash, err := fb.VerifyValue(&v, fb, New(mirror.URL, nil).Child("data"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, v)
+
+	expected, err := ContentHash([]byte(`{"a":1,"b":2}`))
+	require.NoError(t, err)
+	assert.Equal(t, expected, hash)
+
+	mirror.Set("data/b", 3)
+	_, err = fb.VerifyValue(&v, New(mirror.URL, nil).Child("data"))
+	require.IsType(t, &HashMismatchError{}, err)
+	assert.Equal(t, mirror.URL+"/data", err.(*HashMismatchError).URL)
+	assert.Equal(t, hash, err.(*HashMismatchError).Expected)
+}
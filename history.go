@@ -0,0 +1,366 @@
+package firego
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	_url "net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ErrUndoConflict is returned by Undo when the location was changed
+// after the mutation to undo.
+var ErrUndoConflict = errors.New("firego: undo conflicts with later changes")
+
+// HistoryRecord is a mutation recorded by RecordHistory.
+type HistoryRecord struct {
+	// ID is the key of the record in the history, see Undo.
+	ID string
+	// Op is the kind of mutation: "set", "update", "push" or "delete".
+	Op string
+	// Path is the location mutated, e.g. "/users/alice", the new
+	// child for pushes.
+	Path string
+	// Diff is the data written: the value set or pushed, the children
+	// updated, keyed by path, and null for deletions.
+	Diff json.RawMessage
+	// Before is the data the mutation replaced: the value of the
+	// location, the previous values of the children updated, keyed
+	// by path, and null for pushes.
+	Before json.RawMessage
+	// Undoable is set if Before could be read, which Undo needs.
+	Undoable bool
+	// Actor is the uid of the token the mutation was authenticated
+	// with, if any, see AuditEntry.Identity.
+	Actor string
+	// Time is when Firebase recorded the mutation.
+	Time time.Time
+}
+
+// historyEntry is a HistoryRecord as it is stored, its data being kept
+// as JSON text so that Firebase neither resolves the server values it
+// holds nor rejects the paths of updates as keys.
+type historyEntry struct {
+	ID     string    `firebase:"$key"`
+	Op     string    `firebase:"op"`
+	Path   string    `firebase:"path"`
+	Diff   string    `firebase:"diff"`
+	Before *string   `firebase:"before,omitempty"`
+	Actor  string    `firebase:"actor,omitempty"`
+	At     time.Time `firebase:"at,serverTimestamp"`
+}
+
+func (e *historyEntry) record() HistoryRecord {
+	r := HistoryRecord{
+		ID:    e.ID,
+		Op:    e.Op,
+		Path:  e.Path,
+		Diff:  json.RawMessage(e.Diff),
+		Actor: e.Actor,
+		Time:  e.At,
+	}
+	if e.Before != nil {
+		r.Before, r.Undoable = json.RawMessage(*e.Before), true
+	}
+	return r
+}
+
+// RecordHistory appends a HistoryRecord for every successful mutation made
+// through the reference, and the references derived from it afterwards,
+// to the history of the location mutated, giving a lightweight audit trail
+// of every entity. An empty path disables it.
+//
+// The history of a location is a list of pushed children kept at path,
+// relative to the database root, under the location's path escaped with
+// EncodeKey, "%2F" for the root:
+//
+//    fb.RecordHistory("history")
+//    fb.Child("users/alice").Update(map[string]interface{}{"name": "Alice"})
+//    // appends to /history/users%2Falice:
+//    // {"op": "update", "path": "/users/alice", "diff": {"name": "Alice"}, "at": 1500000000000}
+//
+// The data replaced by a mutation is read before it is sent, only the
+// children updated for updates, for Undo to restore it. The record is
+// written once the mutation succeeded, in a request of its own, which may
+// fail or be lost if the process stops in between, and is then logged.
+// Mutations of the history itself are not recorded.
+func (fb *Firebase) RecordHistory(path string) {
+	fb.history = strings.Trim(path, "/")
+}
+
+// History returns the records of the location of the reference, oldest
+// first. It fails if RecordHistory is not enabled.
+func (fb *Firebase) History() ([]HistoryRecord, error) {
+	ref, _, err := fb.historyRef()
+	if err != nil {
+		return nil, err
+	}
+	var entries []historyEntry
+	if err := ref.Value(&entries); err != nil {
+		return nil, err
+	}
+	records := make([]HistoryRecord, len(entries))
+	for i := range entries {
+		records[i] = entries[i].record()
+	}
+	return records, nil
+}
+
+// historyRef returns a reference to the history of the location of the
+// reference, along with the path of the location.
+func (fb *Firebase) historyRef() (*Firebase, string, error) {
+	if fb.history == "" {
+		return nil, "", errors.New("firego: history is not recorded")
+	}
+	parsedURL, err := _url.Parse(fb.url)
+	if err != nil {
+		return nil, "", err
+	}
+	root := parsedURL.Scheme + "://" + parsedURL.Host
+	path := "/" + strings.Trim(strings.TrimPrefix(fb.url, root), "/")
+
+	key := strings.Trim(path, "/")
+	if key == "" {
+		key = "/"
+	}
+	// the escaped key is escaped once more for the URL
+	ref := fb.refAt(root, fb.history+"/"+_url.PathEscape(EncodeKey(key)))
+	ref.history = ""
+	return ref, path, nil
+}
+
+// historyBeforeKey is the context key of the data replaced by a mutation,
+// read by historyBefore before it is sent.
+type historyBeforeKey struct{}
+
+// historyBefore returns the data the mutation with the given method and
+// body is about to replace, as recorded in HistoryRecord.Before, or false
+// if it can not be read or the mutation is not recorded.
+func (fb *Firebase) historyBefore(method string, body []byte) (json.RawMessage, bool) {
+	if method == "POST" {
+		return json.RawMessage("null"), true
+	}
+	_, path, err := fb.historyRef()
+	if err != nil {
+		return nil, false
+	}
+	if path == "/"+fb.history || strings.HasPrefix(path, "/"+fb.history+"/") {
+		return nil, false
+	}
+
+	current := fb.copy()
+	current.history = ""
+	var data []byte
+	if method == "PATCH" {
+		// read the children updated rather than the whole location,
+		// which for a multi-location update may be the whole database
+		var patch map[string]json.RawMessage
+		err = json.Unmarshal(body, &patch)
+		before := make(map[string]json.RawMessage, len(patch))
+		for k := range patch {
+			if err != nil {
+				break
+			}
+			_, before[k], err = current.at(k).doRequest("GET", nil)
+		}
+		if err == nil {
+			data, err = json.Marshal(before)
+		}
+	} else {
+		_, data, err = current.doRequest("GET", nil)
+	}
+	if err != nil {
+		log.Printf("History: failed to read %s before %s %s", path, method, err)
+		return nil, false
+	}
+	return data, true
+}
+
+// recordHistory appends the record of the given successful
+// mutation, whose response body is respBody.
+func (fb *Firebase) recordHistory(req *http.Request, body, respBody []byte) {
+	ref, path, err := fb.historyRef()
+	if err == nil && (path == "/"+fb.history || strings.HasPrefix(path, "/"+fb.history+"/")) {
+		// a mutation of the history itself
+		return
+	}
+
+	record := historyEntry{Path: path, Diff: "null", Actor: tokenIdentity(requestToken(req))}
+	if len(body) > 0 {
+		record.Diff = string(body)
+	}
+	if before, ok := req.Context().Value(historyBeforeKey{}).(json.RawMessage); ok {
+		s := string(before)
+		record.Before = &s
+	}
+	switch req.Method {
+	case "PUT":
+		record.Op = "set"
+	case "PATCH":
+		record.Op = "update"
+	case "DELETE":
+		record.Op = "delete"
+	case "POST":
+		record.Op = "push"
+		var pushed struct {
+			Name string `json:"name"`
+		}
+		if err == nil {
+			err = json.Unmarshal(respBody, &pushed)
+		}
+		record.Path = strings.TrimSuffix(path, "/") + "/" + pushed.Name
+		if err == nil {
+			ref, _, err = fb.Child(pushed.Name).historyRef()
+		}
+	}
+
+	if err == nil {
+		var data []byte
+		if data, err = ref.encode(record, false); err == nil {
+			_, _, err = ref.doRequest("POST", data)
+		}
+	}
+	if err != nil {
+		log.Printf("History: failed to record %s of %s %s", record.Op, record.Path, err)
+	}
+}
+
+// Undo reverts the mutation of the location of the reference recorded
+// with the given ID in its history, see HistoryRecord.ID, by writing back
+// the data it replaced, e.g. the previous values of the children changed
+// by an update, the other children being left as they are.
+//
+// The undo is a conditional write, sent with the ETag of the data read to
+// check that the location still holds what the mutation wrote. It fails
+// with ErrUndoConflict if the location was changed since, in which case
+// the later mutations must be undone first. The undo of an update only
+// reads the children it changed, and writes them back with an update,
+// which is not conditional: a change made to them between the check and
+// the update is overwritten. Server values written by the
+// mutation, such as ServerTimestamp, match any value. The undo is recorded
+// in the history as well, and can be undone in turn.
+func (fb *Firebase) Undo(id string) error {
+	hist, path, err := fb.historyRef()
+	if err != nil {
+		return err
+	}
+	var entry *historyEntry
+	if err := hist.Child(id).Value(&entry); err != nil {
+		return err
+	}
+	if entry == nil {
+		return fmt.Errorf("firego: no change %s in the history of %s %w", id, path, ErrNotFound)
+	}
+	record := entry.record()
+	if !record.Undoable {
+		return fmt.Errorf("firego: change %s of %s can not be undone, its prior data is unknown", id, path)
+	}
+
+	var written, before interface{}
+	if err := json.Unmarshal(record.Diff, &written); err != nil {
+		return err
+	}
+	if len(record.Before) > 0 {
+		if err := json.Unmarshal(record.Before, &before); err != nil {
+			return err
+		}
+	}
+
+	if record.Op == "update" {
+		return fb.undoUpdate(id, path, written, before)
+	}
+
+	headers, body, err := fb.doRequest("GET", nil, withHeader("X-Firebase-ETag", "true"))
+	if err != nil {
+		return err
+	}
+	var current interface{}
+	if err := json.Unmarshal(body, &current); err != nil {
+		return err
+	}
+
+	restored := before
+	switch record.Op {
+	case "delete":
+		if current != nil {
+			return fmt.Errorf("%w: %s changed since %s", ErrUndoConflict, path, id)
+		}
+	default:
+		if !matchesWrite(current, written) {
+			return fmt.Errorf("%w: %s changed since %s", ErrUndoConflict, path, id)
+		}
+	}
+
+	method, data := "DELETE", []byte(nil)
+	if restored != nil {
+		method = "PUT"
+		if data, err = fb.encode(restored, false); err != nil {
+			return err
+		}
+	}
+	_, _, err = fb.doRequest(method, data, withHeader("if-match", headers.Get("ETag")))
+	if errors.Is(err, ErrPreconditionFailed) {
+		return fmt.Errorf("%w: %s changed while undoing %s", ErrUndoConflict, path, id)
+	}
+	return err
+}
+
+// undoUpdate reverts the update of the location at path recorded with
+// id, which wrote written, by updating the children it changed back to
+// their values before it.
+func (fb *Firebase) undoUpdate(id, path string, written, before interface{}) error {
+	restored := map[string]interface{}{}
+	for k, v := range treeChildren(written) {
+		_, body, err := fb.at(k).doRequest("GET", nil)
+		if err != nil {
+			return err
+		}
+		var current interface{}
+		if err := json.Unmarshal(body, &current); err != nil {
+			return err
+		}
+		if !matchesWrite(current, v) {
+			return fmt.Errorf("%w: %s/%s changed since %s", ErrUndoConflict, strings.TrimSuffix(path, "/"), k, id)
+		}
+		restored[k] = treeChildren(before)[k]
+	}
+
+	data, err := fb.encode(restored, true)
+	if err != nil {
+		return err
+	}
+	_, _, err = fb.doRequest("PATCH", data)
+	return err
+}
+
+// matchesWrite reports whether current, data read, is what
+// written, data written, was stored as.
+func matchesWrite(current, written interface{}) bool {
+	switch w := written.(type) {
+	case map[string]interface{}, []interface{}:
+		children := treeChildren(w)
+		if _, ok := children[".sv"]; ok {
+			// a server value
+			return true
+		}
+		currentChildren := treeChildren(current)
+		var n int
+		for k, child := range children {
+			if k == ".priority" {
+				continue
+			}
+			if !matchesWrite(currentChildren[k], child) {
+				return false
+			}
+			if child != nil {
+				n++
+			}
+		}
+		return n == len(currentChildren)
+	}
+	return reflect.DeepEqual(current, written)
+}
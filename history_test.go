@@ -0,0 +1,175 @@
+package firego
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestRecordHistory(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	_, err := fb.History()
+	assert.Error(t, err)
+
+	fb.RecordHistory("/history/")
+	alice := fb.Child("users/alice")
+	require.NoError(t, alice.Set(map[string]interface{}{"name": "alice"}))
+	require.NoError(t, alice.Update(map[string]interface{}{"name": "Alice"}))
+	require.NoError(t, alice.Remove())
+	assert.NoError(t, alice.Child("name").Value(new(interface{})))
+
+	records, err := alice.History()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	for i, op := range []string{"set", "update", "delete"} {
+		assert.Equal(t, op, records[i].Op)
+		assert.Equal(t, "/users/alice", records[i].Path)
+		assert.False(t, records[i].Time.IsZero())
+	}
+	assert.JSONEq(t, `{"name": "alice"}`, string(records[0].Diff))
+	assert.JSONEq(t, `{"name": "Alice"}`, string(records[1].Diff))
+	assert.JSONEq(t, `null`, string(records[2].Diff))
+
+	history, ok := server.Get("history").(map[string]interface{})
+	require.True(t, ok)
+	assert.Len(t, history, 1)
+	assert.Contains(t, history, "users%2Falice")
+
+	pushed, err := fb.Child("posts").Push("hello")
+	require.NoError(t, err)
+	records, err = pushed.History()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "push", records[0].Op)
+	assert.Equal(t, "/posts/"+lastKey(pushed.URL()), records[0].Path)
+	assert.JSONEq(t, `"hello"`, string(records[0].Diff))
+
+	// multi-location updates and server values
+	require.NoError(t, alice.Update(map[string]interface{}{"profile/city": "Paris", "seen": ServerTimestamp}))
+	records, err = alice.History()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.JSONEq(t, `{"profile/city": "Paris", "seen": {".sv": "timestamp"}}`, string(records[3].Diff))
+	assert.JSONEq(t, `{"profile/city": null, "seen": null}`, string(records[3].Before))
+
+	// the history itself is not recorded
+	require.NoError(t, fb.Child("history").Remove())
+	assert.Nil(t, server.Get("history"))
+}
+
+func TestUndo(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.RecordHistory("history")
+	alice := fb.Child("users/alice")
+
+	require.NoError(t, alice.Set(map[string]interface{}{"name": "alice", "age": 30}))
+	require.NoError(t, alice.Update(map[string]interface{}{"name": "Alice", "email": "alice@example.com"}))
+	require.NoError(t, alice.Child("age").Set(31))
+
+	records, err := alice.History()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.True(t, records[1].Undoable)
+	assert.JSONEq(t, `{"name": "alice", "email": null}`, string(records[1].Before))
+
+	// the age changed in between, which the update did not touch
+	require.NoError(t, alice.Undo(records[1].ID))
+	assert.Equal(t, map[string]interface{}{"name": "alice", "age": float64(31)}, server.Get("users/alice"))
+
+	// the set was overwritten by the update and its undo
+	require.NoError(t, alice.Child("age").Set(30))
+	server.Set("users/alice/name", "ALICE")
+	err = alice.Undo(records[1].ID)
+	assert.True(t, errors.Is(err, ErrUndoConflict), err)
+	server.Set("users/alice/name", "alice")
+
+	// undoing the set removes alice
+	require.NoError(t, alice.Undo(records[0].ID))
+	assert.Nil(t, server.Get("users/alice"))
+
+	// and undoing the undo brings her back
+	records, err = alice.History()
+	require.NoError(t, err)
+	last := records[len(records)-1]
+	assert.Equal(t, "delete", last.Op)
+	require.NoError(t, alice.Undo(last.ID))
+	assert.Equal(t, map[string]interface{}{"name": "alice", "age": float64(30)}, server.Get("users/alice"))
+
+	assert.True(t, errors.Is(alice.Undo("missing"), ErrNotFound))
+
+	// pushes and deletions
+	pushed, err := fb.Child("posts").Push(map[string]interface{}{"title": "hi", "at": ServerTimestamp})
+	require.NoError(t, err)
+	records, err = pushed.History()
+	require.NoError(t, err)
+	require.NoError(t, pushed.Undo(records[0].ID))
+	assert.Nil(t, server.Get("posts"))
+
+	require.NoError(t, fb.Child("posts/p1").Set("hello"))
+	require.NoError(t, fb.Child("posts/p1").Remove())
+	records, err = fb.Child("posts/p1").History()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.NoError(t, fb.Child("posts/p1").Undo(records[1].ID))
+	assert.Equal(t, "hello", server.Get("posts/p1"))
+}
+
+func TestUndoMultiLocationUpdate(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users", map[string]interface{}{
+		"alice": map[string]interface{}{"name": "alice"},
+		"bob":   map[string]interface{}{"name": "bob"},
+	})
+
+	var mtx sync.Mutex
+	var requests []string
+	fb := New(server.URL, nil)
+	fb.BeforeSend(func(req *http.Request, body []byte) error {
+		mtx.Lock()
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		mtx.Unlock()
+		return nil
+	})
+	fb.RecordHistory("history")
+
+	require.NoError(t, fb.Update(map[string]interface{}{"users/alice/name": "Alice", "users/carol/name": "carol"}))
+	// only the children updated are read, not the whole database
+	assert.NotContains(t, requests, "GET /.json")
+	assert.Contains(t, requests, "GET /users/alice/name/.json")
+
+	records, err := fb.History()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.JSONEq(t, `{"users/alice/name": "alice", "users/carol/name": null}`, string(records[0].Before))
+
+	// changed in between, which the update did not touch
+	server.Set("users/bob/name", "Bob")
+
+	requests = nil
+	require.NoError(t, fb.Undo(records[0].ID))
+	assert.NotContains(t, requests, "GET /.json")
+	assert.NotContains(t, requests, "PUT /.json")
+	assert.Contains(t, requests, "PATCH /.json")
+	assert.Equal(t, map[string]interface{}{
+		"alice": map[string]interface{}{"name": "alice"},
+		"bob":   map[string]interface{}{"name": "Bob"},
+	}, server.Get("users"))
+}
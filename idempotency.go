@@ -0,0 +1,132 @@
+package firego
+
+import (
+	"encoding/json"
+	"fmt"
+	_url "net/url"
+	"strings"
+)
+
+// defaultIdempotencyRecords is where idempotency keys are recorded unless
+// set otherwise with IdempotencyRecords, relative to the database root.
+const defaultIdempotencyRecords = "_idempotency"
+
+// idempotencyRecord is written along with every write made with an
+// idempotency key, under the key.
+type idempotencyRecord struct {
+	// Path of the location written, relative to the database root.
+	Path string `json:"path"`
+	// At is when the write was made, in milliseconds since the epoch.
+	At interface{} `json:"at"`
+}
+
+// WithIdempotencyKey returns a copy of the reference whose Set and Push
+// are made at most once for key, which makes them safe to retry after a
+// failure that leaves it unknown whether Firebase applied them, such as a
+// timeout:
+//
+//    ref, err := fb.Child("orders").WithIdempotencyKey(req.ID).Push(order)
+//
+// The key is recorded along with the write, in a single atomic update, at
+// the location set with IdempotencyRecords. Before every attempt, the key
+// is looked up and the write is only sent if it is not recorded yet, so
+// that Push with a key is retried following the RetryPolicy as well. A
+// Push whose key was already recorded returns the child created back then.
+//
+// Records are never removed by firego, they hold the time they were written
+// for them to be cleaned up. The key only applies to Set and Push on the
+// returned reference, not to the references derived from it.
+func (fb *Firebase) WithIdempotencyKey(key string) *Firebase {
+	c := fb.copy()
+	c.idempotencyKey = key
+	return c
+}
+
+// IdempotencyRecords sets the location where the keys given to
+// WithIdempotencyKey are recorded, relative to the database root. It
+// defaults to "_idempotency", which jailed references need to move
+// inside their jail.
+func (fb *Firebase) IdempotencyRecords(path string) {
+	fb.idempotencyRecords = strings.Trim(path, "/")
+}
+
+// writeOnce sets v at the given child of the reference, "" being the
+// reference itself, unless the idempotency key of the reference was
+// already recorded. It returns a reference to the location written
+// for the key.
+func (fb *Firebase) writeOnce(child string, v interface{}) (*Firebase, error) {
+	parsedURL, err := _url.Parse(fb.url)
+	if err != nil {
+		return nil, err
+	}
+	root := parsedURL.Scheme + "://" + parsedURL.Host
+	records := fb.idempotencyRecords
+	if records == "" {
+		records = defaultIdempotencyRecords
+	}
+	target := strings.Trim(joinPath(strings.TrimPrefix(fb.url, root), child), "/")
+	record := joinPath(records, EncodeKey(fb.idempotencyKey))
+
+	recordRef := fb.refAt(root, record)
+	lookup := func() (string, bool, error) {
+		_, body, err := recordRef.doRequest("GET", nil)
+		if err != nil {
+			return "", false, err
+		}
+		var r *idempotencyRecord
+		if err := json.Unmarshal(body, &r); err != nil || r == nil {
+			return "", false, err
+		}
+		return r.Path, true, nil
+	}
+	if path, ok, err := lookup(); err != nil {
+		return nil, err
+	} else if ok {
+		return fb.refAt(root, path), nil
+	}
+
+	// write both in a single update at their closest common ancestor
+	ancestor := commonAncestor(target, record)
+	if ancestor == target || ancestor == record {
+		return nil, fmt.Errorf("idempotency records at %q overlap the location written", records)
+	}
+	ref := fb.refAt(root, ancestor)
+	body, err := ref.encode(map[string]interface{}{
+		strings.Trim(target[len(ancestor):], "/"): v,
+		strings.Trim(record[len(ancestor):], "/"): idempotencyRecord{Path: target, At: ServerTimestamp},
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	ref.retryCheck = func() bool {
+		_, ok, _ := lookup()
+		return ok
+	}
+	if _, _, err := ref.doRequest("PATCH", body); err != nil {
+		return nil, err
+	}
+	return fb.refAt(root, target), nil
+}
+
+// refAt returns a copy of the reference pointing at path, relative
+// to root, failing with ErrJailEscape if it is outside of the jail.
+func (fb *Firebase) refAt(root, path string) *Firebase {
+	c := fb.copy()
+	c.url = strings.TrimSuffix(root+"/"+path, "/")
+	if c.jail != "" && !c.inJail() {
+		c.jailErr = ErrJailEscape
+	}
+	return c
+}
+
+// commonAncestor returns the deepest path that is a or b or an ancestor
+// of both, "" being the root.
+func commonAncestor(a, b string) string {
+	as, bs := splitPath(a), splitPath(b)
+	var common []string
+	for i := 0; i < len(as) && i < len(bs) && as[i] == bs[i]; i++ {
+		common = append(common, as[i])
+	}
+	return strings.Join(common, "/")
+}
@@ -0,0 +1,124 @@
+package firego
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ambiguousServer applies multi-location updates but fails the first one,
+// as if the response was lost, and serves the values written by path.
+func ambiguousServer(t *testing.T) (*httptest.Server, func() int) {
+	var mtx sync.Mutex
+	values := map[string]json.RawMessage{}
+	patches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		path := strings.Trim(strings.TrimSuffix(req.URL.EscapedPath(), ".json"), "/")
+		switch req.Method {
+		case "GET":
+			if v, ok := values[path]; ok {
+				w.Write(v)
+				return
+			}
+			w.Write([]byte("null"))
+		case "PATCH":
+			var update map[string]json.RawMessage
+			body, _ := ioutil.ReadAll(req.Body)
+			require.NoError(t, json.Unmarshal(body, &update))
+			for k, v := range update {
+				values[joinPath(path, k)] = v
+			}
+			patches++
+			if patches == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write(body)
+		default:
+			t.Errorf("unexpected %s request", req.Method)
+		}
+	}))
+	return server, func() int {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return patches
+	}
+}
+
+func TestIdempotentPush(t *testing.T) {
+	t.Parallel()
+	server, patches := ambiguousServer(t)
+	defer server.Close()
+
+	fb := New(server.URL, nil).Child("orders")
+	fb.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	ref, err := fb.WithIdempotencyKey("order-1").Push("item")
+	require.NoError(t, err)
+	assert.Equal(t, 1, patches(), "applied push should not be sent again")
+	assert.True(t, strings.HasPrefix(ref.URL(), server.URL+"/orders/"))
+
+	var v string
+	require.NoError(t, ref.Value(&v))
+	assert.Equal(t, "item", v)
+
+	// pushing again with the same key returns the same child
+	again, err := fb.WithIdempotencyKey("order-1").Push("item")
+	require.NoError(t, err)
+	assert.Equal(t, ref.URL(), again.URL())
+	assert.Equal(t, 1, patches())
+
+	other, err := fb.WithIdempotencyKey("order-2").Push("item")
+	require.NoError(t, err)
+	assert.NotEqual(t, ref.URL(), other.URL())
+	assert.Equal(t, 2, patches())
+}
+
+func TestIdempotentSet(t *testing.T) {
+	t.Parallel()
+	server, patches := ambiguousServer(t)
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	fb.IdempotencyRecords("/meta/keys/")
+
+	require.NoError(t, fb.Child("a/b").WithIdempotencyKey("k.1").Set(1))
+	assert.Equal(t, 1, patches())
+
+	var record idempotencyRecord
+	require.NoError(t, fb.Child("meta/keys/k%2E1").Value(&record))
+	assert.Equal(t, "a/b", record.Path)
+}
+
+func TestIdempotencyJail(t *testing.T) {
+	t.Parallel()
+	server, _ := ambiguousServer(t)
+	defer server.Close()
+
+	acme := New(server.URL, nil).Jail("tenants/acme")
+	acme.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	err := acme.Child("orders").WithIdempotencyKey("k").Set(1)
+	assert.Equal(t, ErrJailEscape, err)
+
+	acme.IdempotencyRecords("tenants/acme/keys")
+	require.NoError(t, acme.Child("orders").WithIdempotencyKey("k").Set(1))
+}
+
+func TestCommonAncestor(t *testing.T) {
+	assert.Equal(t, "", commonAncestor("a/b", "c"))
+	assert.Equal(t, "a", commonAncestor("a/b", "a/c/d"))
+	assert.Equal(t, "a/b", commonAncestor("a/b", "a/b/c"))
+	assert.Equal(t, "", commonAncestor("", "a"))
+}
@@ -0,0 +1,196 @@
+package firego
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// ImportOptions configures Import.
+type ImportOptions struct {
+	// Remap maps paths of the export, relative to the reference exported,
+	// to the paths they are restored to, relative to the reference
+	// imported into. Paths not remapped are restored as they are, and the
+	// longest path matching a location applies, e.g. restoring the
+	// export of the root of a database with
+	//
+	//    Remap: map[string]string{"prod/users": "staging/users"}
+	//
+	// restores /prod/users into /staging/users.
+	Remap map[string]string
+	// Skip holds paths of the export, relative to the reference exported,
+	// that are not restored, along with their children.
+	Skip []string
+	// StripPriorities restores values without their priority, as
+	// exported by references set to IncludePriority.
+	StripPriorities bool
+	// OnChunk, if set, is called with every chunk once it is restored.
+	OnChunk func(c ExportChunk)
+}
+
+// Import restores the export written to dir by Export into fb, see
+// ImportFrom.
+func Import(ctx context.Context, fb *Firebase, dir string, opts ImportOptions) error {
+	return ImportFrom(ctx, fb, DirDestination(dir), opts)
+}
+
+// ImportFrom restores the complete export read from src into fb, a chunk
+// at a time with a multi-location update holding its children, once its
+// hash is checked. The children of fb that are not part of the export are
+// left untouched, those that are replaced.
+func ImportFrom(ctx context.Context, fb *Firebase, src ExportDestination, opts ImportOptions) error {
+	manifest, err := loadExportManifest(src)
+	if err != nil {
+		return err
+	}
+	if !manifest.Complete {
+		return fmt.Errorf("export: %v holds an incomplete export of %s", src, manifest.URL)
+	}
+
+	im := &importer{opts: opts, remap: map[string]string{}, skip: map[string]bool{}}
+	for from, to := range opts.Remap {
+		im.remap[strings.Trim(from, "/")] = strings.Trim(to, "/")
+	}
+	for _, path := range opts.Skip {
+		im.skip[strings.Trim(path, "/")] = true
+	}
+
+	ref := fb.WithContext(ctx)
+	for _, chunk := range manifest.Chunks {
+		tree, err := readExportChunk(src, chunk)
+		if err != nil {
+			return err
+		}
+		update := map[string]interface{}{}
+		for key, child := range treeChildren(tree) {
+			im.place(update, key, child)
+		}
+		if len(update) > 0 {
+			if err := ref.Update(update); err != nil {
+				return err
+			}
+		}
+		if opts.OnChunk != nil {
+			opts.OnChunk(chunk)
+		}
+	}
+	return nil
+}
+
+// readExportChunk reads a chunk of an export and checks its hash.
+func readExportChunk(src ExportDestination, chunk ExportChunk) (interface{}, error) {
+	data, err := src.ReadFile(chunk.File)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(chunk.File, ".gz") {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("export: failed to decompress %s. %w", chunk.File, err)
+		}
+		if data, err = ioutil.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("export: failed to decompress %s. %w", chunk.File, err)
+		}
+	}
+
+	hash, err := ContentHash(data)
+	if err != nil {
+		return nil, err
+	}
+	if hash != chunk.Hash {
+		return nil, fmt.Errorf("export: %s does not match its hash", chunk.File)
+	}
+	return decodeTree(data)
+}
+
+// importer places the values of an export at the paths they are
+// restored to.
+type importer struct {
+	opts  ImportOptions
+	remap map[string]string
+	skip  map[string]bool
+}
+
+// place adds the value at path in the export to update,
+// at the path it is restored to.
+func (im *importer) place(update map[string]interface{}, path string, v interface{}) {
+	if im.skip[path] {
+		return
+	}
+	if im.opts.StripPriorities {
+		v = stripPriorities(v)
+		if v == nil {
+			return
+		}
+	}
+
+	// values holding remapped or skipped locations are split up
+	children := treeChildren(v)
+	if len(children) > 0 && im.hasRulesBelow(path) {
+		for key, child := range children {
+			im.place(update, path+"/"+key, child)
+		}
+		return
+	}
+	update[im.target(path)] = v
+}
+
+// hasRulesBelow reports whether locations below path are
+// remapped or skipped.
+func (im *importer) hasRulesBelow(path string) bool {
+	for from := range im.remap {
+		if strings.HasPrefix(from, path+"/") {
+			return true
+		}
+	}
+	for skipped := range im.skip {
+		if strings.HasPrefix(skipped, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// target returns the path a location of the export is restored to.
+func (im *importer) target(path string) string {
+	var match string
+	found := false
+	for from := range im.remap {
+		matches := from == "" || path == from || strings.HasPrefix(path, from+"/")
+		if matches && (!found || len(from) > len(match)) {
+			match, found = from, true
+		}
+	}
+	if !found {
+		return path
+	}
+	rest := strings.Trim(path[len(match):], "/")
+	return strings.Trim(joinPath(im.remap[match], rest), "/")
+}
+
+// stripPriorities removes the priorities of a tree in the export format.
+func stripPriorities(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	if value, ok := m[".value"]; ok {
+		return value
+	}
+	stripped := make(map[string]interface{}, len(m))
+	for k, child := range m {
+		if k == ".priority" {
+			continue
+		}
+		if child = stripPriorities(child); child != nil {
+			stripped[k] = child
+		}
+	}
+	if len(stripped) == 0 {
+		return nil
+	}
+	return stripped
+}
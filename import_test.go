@@ -0,0 +1,88 @@
+package firego
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestImport(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("prod", map[string]interface{}{
+		"users": map[string]interface{}{
+			"alice": map[string]interface{}{"name": "Alice", "secret": "s1"},
+			"bob":   map[string]interface{}{"name": "Bob", "secret": "s2"},
+		},
+		"logs":   map[string]interface{}{"1": "started"},
+		"config": map[string]interface{}{"flag": true},
+	})
+	server.Set("staging/config/other", "kept")
+
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	_, err = Export(context.Background(), New(server.URL, nil).Child("prod"), dir, ExportOptions{ChunkSize: 2, Compress: true})
+	require.NoError(t, err)
+
+	var chunks []ExportChunk
+	err = Import(context.Background(), New(server.URL, nil), dir, ImportOptions{
+		Remap: map[string]string{
+			"":      "staging",
+			"users": "staging/people",
+		},
+		Skip:    []string{"logs", "users/bob/secret"},
+		OnChunk: func(c ExportChunk) { chunks = append(chunks, c) },
+	})
+	require.NoError(t, err)
+	assert.Len(t, chunks, 2)
+
+	var v map[string]interface{}
+	require.NoError(t, New(server.URL, nil).Child("staging").Value(&v))
+	assert.Equal(t, map[string]interface{}{
+		"people": map[string]interface{}{
+			"alice": map[string]interface{}{"name": "Alice", "secret": "s1"},
+			"bob":   map[string]interface{}{"name": "Bob"},
+		},
+		"config": map[string]interface{}{"flag": true},
+	}, v)
+}
+
+func TestImportCorrupted(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("data", map[string]interface{}{"a": "1"})
+
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	manifest, err := Export(context.Background(), New(server.URL, nil).Child("data"), dir, ExportOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, manifest.Chunks[0].File), []byte(`{"a":"2"}`), 0600))
+	err = Import(context.Background(), New(server.URL, nil).Child("copy"), dir, ImportOptions{})
+	assert.EqualError(t, err, "export: chunk-000001.json does not match its hash")
+}
+
+func TestStripPriorities(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, map[string]interface{}{
+		"a": "x",
+		"b": map[string]interface{}{"c": float64(1)},
+	}, stripPriorities(map[string]interface{}{
+		".priority": float64(1),
+		"a":         map[string]interface{}{".value": "x", ".priority": "p"},
+		"b":         map[string]interface{}{"c": float64(1), ".priority": float64(2)},
+		"d":         map[string]interface{}{".priority": float64(3)},
+	}))
+}
@@ -0,0 +1,193 @@
+package firego
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	_url "net/url"
+	"strings"
+)
+
+// MissingIndexError is returned for queries ordered by a child that the
+// rules of the database do not index, which Firebase either rejects or
+// answers by sorting the whole location on every request.
+type MissingIndexError struct {
+	// Path of the location queried.
+	Path string
+	// OrderBy is the child, or "$value", the query is ordered by.
+	OrderBy string
+}
+
+func (e *MissingIndexError) Error() string {
+	return fmt.Sprintf("firego: query on /%s ordered by %q is not indexed, add it to .indexOn", e.Path, e.OrderBy)
+}
+
+// IndexChecker checks that the queries made by an application are backed
+// by the ".indexOn" rules of the database:
+//
+//    checker, err := firego.NewIndexChecker(admin)
+//    if err != nil {
+//        log.Fatal(err)
+//    }
+//    fb.BeforeSend(checker.BeforeSend)
+//
+// The rules are read once, when the checker is created.
+type IndexChecker struct {
+	// OnMissing, if set, is called by BeforeSend with the queries that
+	// are not indexed, which are then sent anyway, instead of failing.
+	OnMissing func(err *MissingIndexError)
+
+	rules interface{}
+}
+
+// NewIndexChecker reads the rules of the database fb belongs to. Reading
+// the rules requires fb to be authenticated with the database secret or
+// an admin token.
+func NewIndexChecker(fb *Firebase) (*IndexChecker, error) {
+	ref, err := fb.Ref(".settings/rules")
+	if err != nil {
+		return nil, err
+	}
+	_, body, err := ref.doRequest("GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	return ParseIndexRules(body)
+}
+
+// ParseIndexRules creates an IndexChecker from the JSON of the
+// rules of a database, which may contain comments.
+func ParseIndexRules(data []byte) (*IndexChecker, error) {
+	var v struct {
+		Rules interface{} `json:"rules"`
+	}
+	if err := json.Unmarshal(stripJSONComments(data), &v); err != nil {
+		return nil, fmt.Errorf("invalid rules. %w", err)
+	}
+	return &IndexChecker{rules: v.Rules}, nil
+}
+
+// Check returns a *MissingIndexError if ref is a query ordered
+// by a child, or by value, that is not indexed.
+func (c *IndexChecker) Check(ref *Firebase) error {
+	u, err := _url.Parse(ref.url)
+	if err != nil {
+		return err
+	}
+	ref.paramsMtx.RLock()
+	orderBy := ref.params.Get(orderByParam)
+	ref.paramsMtx.RUnlock()
+	return c.check(u.Path, orderBy)
+}
+
+// BeforeSend is a RequestHook checking the queries sent, see
+// Firebase.BeforeSend. It fails the queries that are not indexed
+// unless OnMissing is set.
+func (c *IndexChecker) BeforeSend(req *http.Request, body []byte) error {
+	if req.Method != "GET" {
+		return nil
+	}
+	err := c.check(strings.TrimSuffix(req.URL.Path, ".json"), req.URL.Query().Get(orderByParam))
+	if missing, ok := err.(*MissingIndexError); ok && c.OnMissing != nil {
+		c.OnMissing(missing)
+		return nil
+	}
+	return err
+}
+
+// check checks a query at path, ordered by the orderBy parameter.
+func (c *IndexChecker) check(path, orderBy string) error {
+	if orderBy == "" {
+		return nil
+	}
+	var child string
+	if err := json.Unmarshal([]byte(orderBy), &child); err != nil {
+		child = orderBy
+	}
+	if child == "$key" || child == "$priority" {
+		// always indexed
+		return nil
+	}
+
+	index := child
+	if child == "$value" {
+		index = ".value"
+	}
+	path = strings.Trim(path, "/")
+	for _, indexed := range indexOn(c.rules, splitPath(path)) {
+		if indexed == index {
+			return nil
+		}
+	}
+	return &MissingIndexError{Path: path, OrderBy: child}
+}
+
+// indexOn returns the children indexed at path by the rules.
+func indexOn(rules interface{}, path []string) []string {
+	for _, key := range path {
+		m, _ := rules.(map[string]interface{})
+		next, ok := m[key]
+		if !ok {
+			// fall back to the wildcard of the level
+			for k, v := range m {
+				if strings.HasPrefix(k, "$") {
+					next = v
+					break
+				}
+			}
+		}
+		rules = next
+	}
+
+	m, _ := rules.(map[string]interface{})
+	switch v := m[".indexOn"].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		children := make([]string, 0, len(v))
+		for _, child := range v {
+			if s, ok := child.(string); ok {
+				children = append(children, s)
+			}
+		}
+		return children
+	}
+	return nil
+}
+
+// stripJSONComments removes the // and /* */ comments allowed
+// in rules, leaving the strings untouched.
+func stripJSONComments(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		switch {
+		case data[i] == '"':
+			// copy the string up to its closing quote
+			j := i + 1
+			for ; j < len(data) && data[j] != '"'; j++ {
+				if data[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(data) {
+				j = len(data) - 1
+			}
+			out = append(out, data[i:j+1]...)
+			i = j
+		case data[i] == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			i--
+		case data[i] == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := strings.Index(string(data[i+2:]), "*/")
+			if end < 0 {
+				return out
+			}
+			i += end + 3
+		default:
+			out = append(out, data[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package firego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRules = `{
+  // comments are allowed in rules
+  "rules": {
+    ".read": "auth != null",
+    "users": {
+      ".indexOn": ["email", "profile/age"],
+      /* every user */
+      "$uid": {
+        "posts": {".indexOn": "created"}
+      }
+    },
+    "scores": {".indexOn": ".value", "note": "http://example.com // not a comment"}
+  }
+}`
+
+func TestIndexChecker(t *testing.T) {
+	t.Parallel()
+	var rulesPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rulesPath = req.URL.Path
+		w.Write([]byte(testRules))
+	}))
+	defer server.Close()
+
+	checker, err := NewIndexChecker(New(server.URL, nil).Child("users"))
+	require.NoError(t, err)
+	assert.Equal(t, "/.settings/rules/.json", rulesPath)
+
+	fb := New("https://example.firebaseio.com", nil)
+	for _, tt := range []struct {
+		ref     *Firebase
+		missing bool
+	}{
+		{fb.Child("users"), false},
+		{fb.Child("users").OrderBy("email"), false},
+		{fb.Child("users").OrderBy("profile/age"), false},
+		{fb.Child("users").OrderBy("name"), true},
+		{fb.Child("users").OrderBy("$key"), false},
+		{fb.Child("users/alice/posts").OrderBy("created"), false},
+		{fb.Child("users/alice/posts").OrderBy("title"), true},
+		{fb.Child("scores").OrderBy("$value"), false},
+		{fb.Child("other").OrderBy("$value"), true},
+	} {
+		err := checker.Check(tt.ref)
+		if !tt.missing {
+			assert.NoError(t, err, tt.ref.String())
+			continue
+		}
+		assert.IsType(t, &MissingIndexError{}, err, tt.ref.String())
+	}
+
+	err = checker.Check(fb.Child("users/alice/posts").OrderBy("title"))
+	assert.Equal(t, &MissingIndexError{Path: "users/alice/posts", OrderBy: "title"}, err)
+}
+
+func TestIndexCheckerBeforeSend(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("null"))
+	}))
+	defer server.Close()
+
+	checker, err := ParseIndexRules([]byte(testRules))
+	require.NoError(t, err)
+	fb := New(server.URL, nil)
+	fb.BeforeSend(checker.BeforeSend)
+
+	var v interface{}
+	assert.NoError(t, fb.Child("users").OrderBy("email").Value(&v))
+	err = fb.Child("users").OrderBy("name").Value(&v)
+	assert.IsType(t, &MissingIndexError{}, err)
+
+	var missing []*MissingIndexError
+	checker.OnMissing = func(err *MissingIndexError) {
+		missing = append(missing, err)
+	}
+	assert.NoError(t, fb.Child("users").OrderBy("name").Value(&v))
+	assert.Equal(t, []*MissingIndexError{{Path: "users", OrderBy: "name"}}, missing)
+}
@@ -0,0 +1,255 @@
+package firego
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	_url "net/url"
+	"strings"
+)
+
+// ErrIndexedValueTaken is returned by IndexWriter.Set when the value of
+// a unique index is already used by another entity.
+var ErrIndexedValueTaken = errors.New("firego: indexed value taken")
+
+// IndexWriter writes the entities of a collection along with the secondary
+// indexes mapping the values of some of their children back to their keys,
+// keeping the indexes of denormalized data consistent:
+//
+//    users := firego.NewIndexWriter(fb, "users")
+//    users.Index("email", "users_by_email", true)
+//    err := users.Set("alice", User{Email: "alice@example.com"})
+//    ...
+//    uid, err := users.Lookup("email", "alice@example.com")
+//
+// which stores the key of the entity at
+// "users_by_email/alice@example%2Ecom", the value being escaped with
+// EncodeKey, unless fb escapes keys itself.
+//
+// The entity and its index entries, including the removal of the entries
+// of its previous values, are written by a single multi-location update,
+// which either succeeds or fails as a whole. The previous values are read
+// beforehand: writes of the same entity made concurrently by other clients
+// may leave stale entries, which RebuildIndex removes.
+//
+// The entries of unique indexes are claimed before the update with a
+// conditional write, which only one of the entities written concurrently
+// with the same value succeeds in. An entry claimed by a write whose
+// update then fails is left behind, mapping the value to the entity
+// until RebuildIndex removes it.
+type IndexWriter struct {
+	fb         *Firebase
+	collection string
+	indexes    []secondaryIndex
+}
+
+// secondaryIndex maps the values of a child of the entities to their keys.
+type secondaryIndex struct {
+	child  []string
+	path   string
+	unique bool
+}
+
+// NewIndexWriter creates an IndexWriter of the entities stored under the
+// collection path of fb, which must be the reference every index path is
+// relative to, typically the root of the database.
+func NewIndexWriter(fb *Firebase, collection string) *IndexWriter {
+	return &IndexWriter{fb: fb, collection: strings.Trim(collection, "/")}
+}
+
+// Index maintains the index at path, relative to the reference of the
+// writer, of the values of the given child of the entities, which may be a
+// slash separated path. Entities whose child is missing or is not a string,
+// number or boolean are left out of the index. A unique index refuses to
+// map a value to more than one entity.
+func (w *IndexWriter) Index(child, path string, unique bool) {
+	w.indexes = append(w.indexes, secondaryIndex{
+		child:  splitPath(child),
+		path:   strings.Trim(path, "/"),
+		unique: unique,
+	})
+}
+
+// Set replaces the entity with the given key by v and updates the indexes.
+func (w *IndexWriter) Set(key string, v interface{}) error {
+	data, err := marshal(v)
+	if err != nil {
+		return err
+	}
+	entity, err := decodeTree(data)
+	if err != nil {
+		return err
+	}
+	return w.write(key, entity)
+}
+
+// Delete removes the entity with the given key and its index entries.
+func (w *IndexWriter) Delete(key string) error {
+	return w.write(key, nil)
+}
+
+// Lookup returns the key of an entity whose child indexed by Index holds
+// value, or ErrNotFound if there are none.
+func (w *IndexWriter) Lookup(child string, value interface{}) (string, error) {
+	idx, err := w.index(child)
+	if err != nil {
+		return "", err
+	}
+	entry, ok := indexValue(value)
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	var key string
+	if err := w.entry(idx, entry).Value(&key); err != nil {
+		return "", err
+	}
+	if key == "" {
+		return "", ErrNotFound
+	}
+	return key, nil
+}
+
+// RebuildIndex reads every entity and rewrites the index of the given
+// child from scratch, removing the stale entries.
+func (w *IndexWriter) RebuildIndex(child string) error {
+	idx, err := w.index(child)
+	if err != nil {
+		return err
+	}
+	entities, err := w.read(w.collection)
+	if err != nil {
+		return err
+	}
+
+	entries := map[string]interface{}{}
+	for key, entity := range treeChildren(entities) {
+		entry, ok := indexValue(valueAt(entity, idx.child))
+		if !ok {
+			continue
+		}
+		entry = w.bodyKey(entry)
+		if owner, taken := entries[entry]; taken && idx.unique {
+			return fmt.Errorf("%w: %s of %s and %s", ErrIndexedValueTaken, child, owner, key)
+		}
+		entries[entry] = key
+	}
+	return w.fb.Child(idx.path).Set(entries)
+}
+
+// write stores entity, a generic tree, as the entity with
+// the given key, along with its index entries.
+func (w *IndexWriter) write(key string, entity interface{}) error {
+	if key == "" || strings.Contains(key, "/") {
+		return fmt.Errorf("firego: invalid entity key %q", key)
+	}
+	path := w.collection + "/" + key
+
+	var old interface{}
+	if len(w.indexes) > 0 {
+		var err error
+		if old, err = w.read(path); err != nil {
+			return err
+		}
+	}
+
+	update := map[string]interface{}{path: entity}
+	for _, idx := range w.indexes {
+		before, hadBefore := indexValue(valueAt(old, idx.child))
+		after, hasAfter := indexValue(valueAt(entity, idx.child))
+		if hadBefore && hasAfter && before == after {
+			continue
+		}
+		if hadBefore {
+			update[idx.path+"/"+w.bodyKey(before)] = nil
+		}
+		if !hasAfter {
+			continue
+		}
+		if idx.unique {
+			if err := w.claim(idx, after, key); err != nil {
+				return err
+			}
+		}
+		update[idx.path+"/"+w.bodyKey(after)] = key
+	}
+	return w.fb.Update(update)
+}
+
+// claim maps value to key in the unique index idx, unless it is mapped to
+// another entity. The entry is written conditionally, with the ETag of the
+// entry read, so that only one of the entities claiming it at once does.
+func (w *IndexWriter) claim(idx secondaryIndex, value, key string) error {
+	ref := w.entry(idx, value)
+	headers, body, err := ref.doRequest("GET", nil, withHeader("X-Firebase-ETag", "true"))
+	if err != nil {
+		return err
+	}
+	var owner string
+	if err := json.Unmarshal(body, &owner); err != nil {
+		return err
+	}
+	if owner == key {
+		return nil
+	}
+
+	if owner == "" {
+		data, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		_, body, err = ref.doRequest("PUT", data, withHeader("if-match", headers.Get("ETag")))
+		if !errors.Is(err, ErrPreconditionFailed) {
+			return err
+		}
+		// claimed by another entity in the meantime
+		json.Unmarshal(body, &owner)
+	}
+	return fmt.Errorf("%w: %s is used by %s", ErrIndexedValueTaken, strings.Join(idx.child, "/"), owner)
+}
+
+// index returns the index of the given child.
+func (w *IndexWriter) index(child string) (secondaryIndex, error) {
+	path := strings.Join(splitPath(child), "/")
+	for _, idx := range w.indexes {
+		if strings.Join(idx.child, "/") == path {
+			return idx, nil
+		}
+	}
+	return secondaryIndex{}, fmt.Errorf("firego: %q is not indexed", child)
+}
+
+// entry returns a reference to the entry of the index for value.
+func (w *IndexWriter) entry(idx secondaryIndex, value string) *Firebase {
+	// the escaped key is escaped once more for the URL
+	return w.fb.Child(idx.path + "/" + _url.PathEscape(EncodeKey(value)))
+}
+
+// read returns the data at path as a generic tree.
+func (w *IndexWriter) read(path string) (interface{}, error) {
+	_, body, err := w.fb.Child(path).getValue()
+	if err != nil {
+		return nil, err
+	}
+	return decodeTree(body)
+}
+
+// bodyKey escapes key for the body of a write, unless
+// the reference of the writer escapes keys itself.
+func (w *IndexWriter) bodyKey(key string) string {
+	if w.fb.encodeKeys {
+		return key
+	}
+	return EncodeKey(key)
+}
+
+// indexValue returns the key of the index entry of value,
+// before escaping, if it can be indexed.
+func indexValue(value interface{}) (string, bool) {
+	switch value.(type) {
+	case string, json.Number, bool, int, int64, float64:
+		s := fmt.Sprint(value)
+		return s, s != ""
+	}
+	return "", false
+}
@@ -0,0 +1,104 @@
+package firego
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestIndexWriter(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	type user struct {
+		Email string `firebase:"email"`
+		Team  string `firebase:"team,omitempty"`
+	}
+
+	fb := New(server.URL, nil)
+	users := NewIndexWriter(fb, "/users/")
+	users.Index("email", "users_by_email", true)
+	users.Index("team", "/users_by_team", false)
+
+	require.NoError(t, users.Set("alice", user{Email: "alice@example.com", Team: "red"}))
+	require.NoError(t, users.Set("bob", user{Email: "bob@example.com", Team: "red"}))
+	assert.Equal(t, map[string]interface{}{
+		"alice@example%2Ecom": "alice",
+		"bob@example%2Ecom":   "bob",
+	}, server.Get("users_by_email"))
+	assert.Equal(t, map[string]interface{}{"red": "bob"}, server.Get("users_by_team"))
+
+	uid, err := users.Lookup("email", "alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", uid)
+	_, err = users.Lookup("email", "carol@example.com")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = users.Lookup("name", "Alice")
+	assert.Error(t, err)
+
+	// changing the value moves the entry
+	require.NoError(t, users.Set("alice", user{Email: "alice@example.org"}))
+	assert.Equal(t, map[string]interface{}{
+		"alice@example%2Eorg": "alice",
+		"bob@example%2Ecom":   "bob",
+	}, server.Get("users_by_email"))
+	assert.Equal(t, map[string]interface{}{"email": "alice@example.org"}, server.Get("users/alice"))
+
+	// unique values
+	err = users.Set("carol", user{Email: "bob@example.com"})
+	assert.True(t, errors.Is(err, ErrIndexedValueTaken), err)
+	assert.Nil(t, server.Get("users/carol"))
+
+	require.NoError(t, users.Delete("bob"))
+	assert.Nil(t, server.Get("users/bob"))
+	assert.Equal(t, map[string]interface{}{"alice@example%2Eorg": "alice"}, server.Get("users_by_email"))
+	assert.Error(t, users.Delete("a/b"))
+
+	// stale entries
+	server.Set("users_by_email/ghost@example%2Ecom", "ghost")
+	require.NoError(t, users.RebuildIndex("email"))
+	assert.Equal(t, map[string]interface{}{"alice@example%2Eorg": "alice"}, server.Get("users_by_email"))
+
+	server.Set("users/dave", map[string]interface{}{"email": "alice@example.org"})
+	err = users.RebuildIndex("email")
+	assert.True(t, errors.Is(err, ErrIndexedValueTaken), err)
+}
+
+func TestIndexWriterConcurrentUnique(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	users := NewIndexWriter(New(server.URL, nil), "users")
+	users.Index("email", "users_by_email", true)
+
+	for i := 0; i < 10; i++ {
+		email := fmt.Sprintf("user%d@example.com", i)
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for j, key := range []string{"alice", "bob"} {
+			wg.Add(1)
+			go func(j int, key string) {
+				defer wg.Done()
+				errs[j] = users.Set(fmt.Sprintf("%s%d", key, i), map[string]interface{}{"email": email})
+			}(j, key)
+		}
+		wg.Wait()
+
+		// the value is mapped to a single entity
+		if errs[0] == nil {
+			assert.True(t, errors.Is(errs[1], ErrIndexedValueTaken), errs[1])
+		} else {
+			assert.True(t, errors.Is(errs[0], ErrIndexedValueTaken), errs[0])
+			assert.NoError(t, errs[1])
+		}
+	}
+}
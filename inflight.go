@@ -0,0 +1,115 @@
+package firego
+
+import (
+	"context"
+	_url "net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InFlightRequest describes a request being made, see InFlight.
+type InFlightRequest struct {
+	// Method of the request, e.g. "GET".
+	Method string
+	// Path of the location, e.g. "/users/alice".
+	Path string
+	// Stream is set for the streams opened by Watch.
+	Stream bool
+	// Age is how long ago the request was started, retries included.
+	Age time.Duration
+}
+
+// requestRegistry keeps track of the requests in flight
+// of a reference and those derived from it.
+type requestRegistry struct {
+	mtx  sync.Mutex
+	next uint64
+	ops  map[uint64]*inFlightOp
+}
+
+// inFlightOp is a request in flight.
+type inFlightOp struct {
+	method  string
+	path    string
+	stream  bool
+	started time.Time
+	cancel  context.CancelFunc
+}
+
+// InFlight returns the requests in flight, oldest first, of the reference
+// and of the references created from the same call to New, which helps
+// finding stuck requests.
+func (fb *Firebase) InFlight() []InFlightRequest {
+	r := fb.requests
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	now := time.Now()
+	requests := make([]InFlightRequest, 0, len(r.ops))
+	for _, op := range r.ops {
+		requests = append(requests, InFlightRequest{
+			Method: op.method,
+			Path:   op.path,
+			Stream: op.stream,
+			Age:    now.Sub(op.started),
+		})
+	}
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].Age > requests[j].Age
+	})
+	return requests
+}
+
+// CancelAll cancels the requests listed by InFlight, which fail with
+// context.Canceled, and ends the streams opened by Watch with an error
+// event, e.g. to shut down quickly. Requests made afterwards are not
+// affected.
+func (fb *Firebase) CancelAll() {
+	r := fb.requests
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for id, op := range r.ops {
+		op.cancel()
+		delete(r.ops, id)
+	}
+}
+
+// add registers a request of fb, returning the context it is to be made
+// with, canceled by CancelAll, and the function to call once it is done.
+func (r *requestRegistry) add(ctx context.Context, fb *Firebase, method string, stream bool) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	op := &inFlightOp{
+		method:  method,
+		path:    refPath(fb.url),
+		stream:  stream,
+		started: time.Now(),
+		cancel:  cancel,
+	}
+
+	r.mtx.Lock()
+	if r.ops == nil {
+		r.ops = map[uint64]*inFlightOp{}
+	}
+	id := r.next
+	r.next++
+	r.ops[id] = op
+	r.mtx.Unlock()
+
+	return ctx, func() {
+		r.mtx.Lock()
+		delete(r.ops, id)
+		r.mtx.Unlock()
+		cancel()
+	}
+}
+
+// refPath returns the path of the location at url.
+func refPath(url string) string {
+	u, err := _url.Parse(url)
+	if err != nil {
+		return url
+	}
+	return "/" + strings.Trim(u.Path, "/")
+}
@@ -0,0 +1,53 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInFlightAndCancelAll(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Accept") == "text/event-stream" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+		<-req.Context().Done()
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, fb.Child("feed").Watch(notifications))
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- fb.Child("users/alice").Value(new(interface{}))
+	}()
+	eventually(t, func() bool { return len(fb.InFlight()) == 2 }, "requests not in flight")
+
+	requests := fb.InFlight()
+	assert.Equal(t, "/feed", requests[0].Path)
+	assert.True(t, requests[0].Stream)
+	assert.Equal(t, "/users/alice", requests[1].Path)
+	assert.Equal(t, "GET", requests[1].Method)
+	assert.False(t, requests[1].Stream)
+	assert.True(t, requests[0].Age >= requests[1].Age)
+
+	fb.CancelAll()
+	assert.True(t, errors.Is(<-errs, context.Canceled))
+	event := <-notifications
+	assert.Equal(t, EventTypeError, event.Type)
+	assert.Empty(t, fb.InFlight())
+
+	fb.StopWatching()
+	for range notifications {
+	}
+}
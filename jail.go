@@ -0,0 +1,48 @@
+package firego
+
+import (
+	"errors"
+	_url "net/url"
+	"strings"
+)
+
+// ErrJailEscape is returned by requests made through a reference
+// that points outside of the jail of the reference it came from.
+var ErrJailEscape = errors.New("firego: path escapes the jail")
+
+// Jail returns a reference to prefix that can not be used to reach data
+// outside of prefix, meant for multi-tenant services that hand out
+// references which must never touch other tenants' data:
+//
+//    acme := fb.Jail("tenants/acme")
+//    acme.Child("orders/1")      // tenants/acme/orders/1
+//    acme.Child("../globex")     // every request fails with ErrJailEscape
+//    acme.Ref("/tenants/globex") // returns ErrJailEscape
+//
+// Jailing a jailed reference narrows the jail further.
+func (fb *Firebase) Jail(prefix string) *Firebase {
+	c := fb.Child(strings.Trim(prefix, "/"))
+	if hasDotDot(prefix) {
+		c.jailErr = ErrJailEscape
+	}
+	c.jail = c.url
+	return c
+}
+
+// inJail reports whether the reference points to its jail or below.
+func (fb *Firebase) inJail() bool {
+	if hasDotDot(fb.url) {
+		return false
+	}
+	return fb.url == fb.jail || strings.HasPrefix(fb.url, fb.jail+"/")
+}
+
+// hasDotDot reports whether path has a ".." segment, escaped or not.
+func hasDotDot(path string) bool {
+	for _, s := range strings.Split(path, "/") {
+		if u, err := _url.PathUnescape(s); err != nil || u == ".." {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package firego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestJail(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("tenants/acme/name", "Acme")
+	server.Set("tenants/globex/name", "Globex")
+
+	acme := New(server.URL, nil).Jail("tenants/acme")
+
+	var v string
+	require.NoError(t, acme.Child("name").Value(&v))
+	assert.Equal(t, "Acme", v)
+	require.NoError(t, acme.Child("orders").Child("1").Set(true))
+	assert.Equal(t, true, server.Get("tenants/acme/orders/1"))
+
+	for _, child := range []string{"../globex", "orders/../../globex", "%2E%2E/globex", "/tenants/globex"} {
+		ref := acme.Child(child)
+		assert.Equal(t, ErrJailEscape, ref.Value(&v), child)
+		assert.Equal(t, ErrJailEscape, ref.Child("name").Set("pwned"), child)
+	}
+	assert.Equal(t, "Globex", server.Get("tenants/globex/name"))
+
+	ref, err := acme.Ref("/tenants/acme/orders")
+	require.NoError(t, err)
+	assert.NoError(t, ref.Value(&map[string]bool{}))
+
+	for _, path := range []string{"/tenants/globex", "/tenants/acme2", "/tenants/acme/../globex", "/"} {
+		_, err := acme.Ref(path)
+		assert.Equal(t, ErrJailEscape, err, path)
+	}
+
+	ref = acme.Child("orders")
+	ref.SetURL(server.URL + "/tenants/globex")
+	assert.Equal(t, ErrJailEscape, ref.Value(&v))
+
+	// nested jails narrow the jail
+	orders := acme.Jail("orders")
+	_, err = orders.Ref("/tenants/acme/name")
+	assert.Equal(t, ErrJailEscape, err)
+	assert.Equal(t, ErrJailEscape, acme.Jail("../globex").Value(&v))
+}
@@ -0,0 +1,118 @@
+package firego
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+var keyEncoder = strings.NewReplacer(
+	"%", "%25",
+	".", "%2E",
+	"#", "%23",
+	"$", "%24",
+	"/", "%2F",
+	"[", "%5B",
+	"]", "%5D",
+)
+
+// EncodeKey escapes the characters that Firebase does not allow in keys
+// (".", "#", "$", "/", "[" and "]") so that arbitrary strings, such as
+// email addresses, can be used as keys. The escaping is reversed by
+// DecodeKey.
+//
+//    EncodeKey("jane.doe@example.com") // -> "jane%2Edoe@example%2Ecom"
+func EncodeKey(key string) string {
+	return keyEncoder.Replace(key)
+}
+
+// DecodeKey reverses EncodeKey. Invalid escape sequences are left as is.
+func DecodeKey(key string) string {
+	if !strings.Contains(key, "%") {
+		return key
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < len(key); i++ {
+		if key[i] == '%' && i+2 < len(key) && isHex(key[i+1]) && isHex(key[i+2]) {
+			buf.WriteByte(unhex(key[i+1])<<4 | unhex(key[i+2]))
+			i += 2
+			continue
+		}
+		buf.WriteByte(key[i])
+	}
+	return buf.String()
+}
+
+// EncodeKeys determines whether or not keys are automatically escaped with
+// EncodeKey when writing and unescaped with DecodeKey when reading through
+// this reference. Top level keys given to Update are treated as paths and
+// each of their segments is escaped individually. Keys of watched events
+// are left untouched.
+func (fb *Firebase) EncodeKeys(v bool) {
+	fb.encodeKeys = v
+}
+
+// encodeTreeKeys escapes every key of a decoded JSON tree.
+func encodeTreeKeys(tree interface{}, multiPath bool) interface{} {
+	return rewriteKeys(tree, func(key string, top bool) string {
+		if !multiPath || !top {
+			return EncodeKey(key)
+		}
+
+		segments := strings.Split(strings.Trim(key, "/"), "/")
+		for i, s := range segments {
+			segments[i] = EncodeKey(s)
+		}
+		return strings.Join(segments, "/")
+	}, true)
+}
+
+// decodeTreeKeys unescapes every key of a decoded JSON tree.
+func decodeTreeKeys(tree interface{}) interface{} {
+	return rewriteKeys(tree, func(key string, _ bool) string {
+		return DecodeKey(key)
+	}, true)
+}
+
+func rewriteKeys(tree interface{}, fn func(key string, top bool) string, top bool) interface{} {
+	switch t := tree.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			if !specialKeys[k] {
+				k = fn(k, top)
+			}
+			m[k] = rewriteKeys(v, fn, false)
+		}
+		return m
+	case []interface{}:
+		for i, v := range t {
+			t[i] = rewriteKeys(v, fn, false)
+		}
+	}
+	return tree
+}
+
+// decodeTree decodes JSON into a generic tree, preserving numbers as is.
+func decodeTree(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var tree interface{}
+	err := dec.Decode(&tree)
+	return tree, err
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
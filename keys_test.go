@@ -0,0 +1,69 @@
+package firego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestEncodeKey(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		key, encoded string
+	}{
+		{"plain", "plain"},
+		{"jane.doe@example.com", "jane%2Edoe@example%2Ecom"},
+		{"a#b$c/d[e]", "a%23b%24c%2Fd%5Be%5D"},
+		{"100%", "100%25"},
+		{"%2E", "%252E"},
+	} {
+		assert.Equal(t, test.encoded, EncodeKey(test.key), test.key)
+		assert.Equal(t, test.key, DecodeKey(test.encoded), test.encoded)
+	}
+
+	assert.Equal(t, "%zz%2", DecodeKey("%zz%2"))
+}
+
+func TestEncodeTreeKeys(t *testing.T) {
+	t.Parallel()
+	tree := map[string]interface{}{
+		"/users/a.b/": map[string]interface{}{"c.d": 1, ".priority": 2},
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"users/a%2Eb": map[string]interface{}{"c%2Ed": 1, ".priority": 2},
+	}, encodeTreeKeys(tree, true))
+
+	assert.Equal(t, map[string]interface{}{
+		"%2Fusers%2Fa%2Eb%2F": map[string]interface{}{"c%2Ed": 1, ".priority": 2},
+	}, encodeTreeKeys(tree, false))
+}
+
+func TestEncodeKeys(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.EncodeKeys(true)
+
+	emails := map[string]int{"jane.doe@example.com": 1}
+	require.NoError(t, fb.Child("users").Set(emails))
+	assert.Equal(t, map[string]interface{}{"jane%2Edoe@example%2Ecom": 1.0}, server.Get("users"))
+
+	require.NoError(t, fb.Child("users").Update(map[string]int{"john.doe@example.com": 2}))
+	assert.Equal(t, 2.0, server.Get("users/john%2Edoe@example%2Ecom"))
+
+	var v map[string]int
+	require.NoError(t, fb.Child("users").Value(&v))
+	assert.Equal(t, map[string]int{"jane.doe@example.com": 1, "john.doe@example.com": 2}, v)
+
+	// keys are still validated once escaped
+	assert.IsType(t, (*ValidationError)(nil), fb.Set(map[string]int{"a\nb": 1}))
+
+	plain := New(server.URL, nil)
+	assert.IsType(t, (*ValidationError)(nil), plain.Set(emails))
+}
@@ -0,0 +1,139 @@
+package firego
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Lease is a lock on a node held by one owner at a time, for a limited
+// time unless renewed, so that it is taken over when its owner dies:
+//
+//    lease := firego.NewLease(fb.Child("locks/billing"), hostname, 10*time.Second)
+//    for range time.Tick(3 * time.Second) {
+//        held, err := lease.TryAcquire()
+//        ...
+//    }
+//
+// The node holds the owner and a term, incremented by every write, which
+// are replaced with conditional writes only. Rather than comparing clocks,
+// a lease is considered abandoned once the node has not changed for its
+// TTL as observed by the one taking it over, while its owner stops
+// considering it held a TTL after it started renewing it. Leases are
+// therefore never held by two owners at once as long as the clocks of
+// the owners run at the same rate.
+type Lease struct {
+	ref   *Firebase
+	owner string
+	ttl   time.Duration
+
+	mtx sync.Mutex
+	// seen is the last record read and seenAt when it was first read
+	seen   leaseRecord
+	seenAt time.Time
+	etag   string
+	// heldUntil is when the lease expires if it is held
+	heldUntil time.Time
+}
+
+// leaseRecord is the data of the node of a lease.
+type leaseRecord struct {
+	Owner string `json:"owner"`
+	Term  uint64 `json:"term"`
+}
+
+// NewLease creates a lease on the node at fb for owner, which must
+// identify the instance, expiring ttl after it was last renewed.
+func NewLease(fb *Firebase, owner string, ttl time.Duration) *Lease {
+	return &Lease{ref: fb.copy(), owner: owner, ttl: ttl}
+}
+
+// TryAcquire acquires the lease, or renews it if it is already held,
+// and reports whether it is held. It does not wait for the lease to be
+// available: call it again, more often than the TTL, to keep the lease or
+// to take it over once abandoned.
+func (l *Lease) TryAcquire() (bool, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	start := time.Now()
+	headers, body, err := l.ref.doRequest("GET", nil, withHeader("X-Firebase-ETag", "true"))
+	if err != nil {
+		return l.held(), err
+	}
+	var rec leaseRecord
+	if err := json.Unmarshal(body, &rec); err != nil {
+		return l.held(), err
+	}
+	if rec != l.seen || l.seenAt.IsZero() {
+		l.seen, l.seenAt = rec, time.Now()
+	}
+	l.etag = headers.Get("ETag")
+
+	abandoned := rec.Owner == "" || time.Since(l.seenAt) >= l.ttl
+	if rec.Owner != l.owner && !abandoned {
+		l.heldUntil = time.Time{}
+		return false, nil
+	}
+
+	next := leaseRecord{Owner: l.owner, Term: rec.Term + 1}
+	b, err := l.ref.encode(next, false)
+	if err != nil {
+		return l.held(), err
+	}
+	headers, _, err = l.ref.doRequest("PUT", b, withHeader("if-match", l.etag), withHeader("X-Firebase-ETag", "true"))
+	if errors.Is(err, ErrPreconditionFailed) {
+		// someone else wrote first
+		l.heldUntil = time.Time{}
+		return false, nil
+	}
+	if err != nil {
+		return l.held(), err
+	}
+	l.seen, l.seenAt, l.etag = next, time.Now(), headers.Get("ETag")
+	l.heldUntil = start.Add(l.ttl)
+	return true, nil
+}
+
+// Held reports whether the lease is held, which it stops being a TTL
+// after the start of its last renewal.
+func (l *Lease) Held() bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.held()
+}
+
+func (l *Lease) held() bool {
+	return time.Now().Before(l.heldUntil)
+}
+
+// Term returns the term of the lease, which increases every time it is
+// acquired or renewed, for use as a fencing token by the resources it
+// guards, or 0 if it is not held.
+func (l *Lease) Term() uint64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if !l.held() {
+		return 0
+	}
+	return l.seen.Term
+}
+
+// Release gives up the lease, if it is held, so that it can be
+// acquired right away rather than after its TTL.
+func (l *Lease) Release() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if !l.held() {
+		return nil
+	}
+	l.heldUntil = time.Time{}
+
+	_, _, err := l.ref.doRequest("DELETE", nil, withHeader("if-match", l.etag))
+	if errors.Is(err, ErrPreconditionFailed) {
+		// taken over in the meantime
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package firego
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestLease(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil).Child("locks/billing")
+	ttl := 200 * time.Millisecond
+	a, b := NewLease(fb, "a", ttl), NewLease(fb, "b", ttl)
+
+	held, err := a.TryAcquire()
+	require.NoError(t, err)
+	assert.True(t, held)
+	assert.True(t, a.Held())
+	assert.Equal(t, uint64(1), a.Term())
+
+	held, err = b.TryAcquire()
+	require.NoError(t, err)
+	assert.False(t, held)
+	assert.Equal(t, uint64(0), b.Term())
+
+	// renewing keeps the lease
+	held, err = a.TryAcquire()
+	require.NoError(t, err)
+	assert.True(t, held)
+	assert.Equal(t, uint64(2), a.Term())
+	held, err = b.TryAcquire()
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	// abandoned leases are taken over
+	time.Sleep(ttl)
+	assert.False(t, a.Held())
+	held, err = b.TryAcquire()
+	require.NoError(t, err)
+	assert.True(t, held)
+	assert.Equal(t, uint64(3), b.Term())
+	assert.Equal(t, map[string]interface{}{"owner": "b", "term": float64(3)}, server.Get("locks/billing"))
+
+	held, err = a.TryAcquire()
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	// released leases are acquired right away
+	require.NoError(t, b.Release())
+	assert.False(t, b.Held())
+	assert.Nil(t, server.Get("locks/billing"))
+	held, err = a.TryAcquire()
+	require.NoError(t, err)
+	assert.True(t, held)
+}
+
+func TestLeaseConflict(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil).Child("lock")
+	leases := make([]*Lease, 5)
+	results := make(chan bool, len(leases))
+	for i := range leases {
+		leases[i] = NewLease(fb, string(rune('a'+i)), time.Minute)
+		go func(l *Lease) {
+			held, err := l.TryAcquire()
+			assert.NoError(t, err)
+			results <- held
+		}(leases[i])
+	}
+
+	var holders int
+	for range leases {
+		if <-results {
+			holders++
+		}
+	}
+	assert.Equal(t, 1, holders)
+}
@@ -0,0 +1,237 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AdaptiveLimiter limits the number of requests references have in
+// flight, adjusting the limit to what Firebase can take: the limit grows
+// by one with every request succeeding while it is at least half used,
+// and shrinks by Backoff with every request getting a 429 or 5xx response
+// or taking longer than Tolerance times the usual latency. Requests over
+// the limit wait for one in flight to complete, which protects both
+// Firebase and the caller during load spikes:
+//
+//    limiter := firego.NewAdaptiveLimiter(20, 200)
+//    fb = limiter.Guard(fb)
+//
+// The usual latency is the lowest one seen, drifting up slowly when
+// latencies stay higher. Streams opened by Watch are not limited.
+//
+// Requests made with PriorityInteractive go first: requests made with
+// PriorityBatch wait while interactive ones are waiting, and only use
+// BatchShare of the limit while interactive ones are in flight.
+type AdaptiveLimiter struct {
+	// MinLimit is the lowest the limit goes. It defaults to 1.
+	MinLimit int
+	// MaxLimit is the highest the limit goes.
+	MaxLimit int
+	// Backoff is the factor the limit is multiplied by when
+	// Firebase is overloaded. It defaults to 0.9.
+	Backoff float64
+	// Tolerance is how many times the usual latency a response may
+	// take before Firebase is considered overloaded. It defaults to 2.
+	Tolerance float64
+	// BatchShare is the share of the limit batch requests may use while
+	// interactive ones are in flight, at least one request. It defaults
+	// to 0.5.
+	BatchShare float64
+
+	mtx      sync.Mutex
+	limit    float64
+	inFlight int
+	// batch is the number of batch requests in flight and
+	// waiting the number of interactive requests waiting
+	batch   int
+	waiting int
+	// latency is the usual latency
+	latency time.Duration
+	// changed is closed, and replaced, when a request completes
+	changed chan struct{}
+}
+
+// NewAdaptiveLimiter creates a limiter starting with the
+// initial limit and never going above max.
+func NewAdaptiveLimiter(initial, max int) *AdaptiveLimiter {
+	return &AdaptiveLimiter{
+		MinLimit:   1,
+		MaxLimit:   max,
+		Backoff:    0.9,
+		Tolerance:  2,
+		BatchShare: 0.5,
+		limit:      float64(initial),
+		changed:    make(chan struct{}),
+	}
+}
+
+// Guard returns a copy of the reference whose requests, and the requests
+// of the references derived from it, are subject to the limiter.
+func (l *AdaptiveLimiter) Guard(fb *Firebase) *Firebase {
+	ref := fb.copy()
+	client := *ref.client
+	client.Transport = &limiterTransport{base: client.Transport, l: l}
+	ref.client = &client
+	return ref
+}
+
+// Limit returns the current limit.
+func (l *AdaptiveLimiter) Limit() int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return int(l.limit)
+}
+
+// InFlight returns the number of requests in flight.
+func (l *AdaptiveLimiter) InFlight() int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.inFlight
+}
+
+// acquire waits for a request of the given priority to be
+// allowed under the limit and adds it to those in flight.
+func (l *AdaptiveLimiter) acquire(ctx context.Context, p Priority) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if p == PriorityInteractive {
+		l.waiting++
+		defer func() { l.waiting-- }()
+	}
+
+	for !l.allowed(p) {
+		changed := l.changed
+		l.mtx.Unlock()
+		select {
+		case <-changed:
+			l.mtx.Lock()
+		case <-ctx.Done():
+			l.mtx.Lock()
+			return ctx.Err()
+		}
+	}
+	l.inFlight++
+	if p == PriorityBatch {
+		l.batch++
+	}
+	return nil
+}
+
+// allowed reports whether a request of the given priority can be sent.
+// It must be called with the limiter's mutex held.
+func (l *AdaptiveLimiter) allowed(p Priority) bool {
+	if l.inFlight >= int(l.limit) {
+		return false
+	}
+	if p == PriorityInteractive {
+		return true
+	}
+	if l.waiting > 0 {
+		return false
+	}
+	interactive := l.inFlight - l.batch
+	share := int(l.BatchShare * l.limit)
+	return interactive == 0 || l.batch < share || l.batch == 0
+}
+
+// observe adjusts the limit to the outcome of a request
+// whose response took latency to arrive.
+func (l *AdaptiveLimiter) observe(latency time.Duration, overloaded bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	switch {
+	case l.latency == 0 || latency < l.latency:
+		l.latency = latency
+	default:
+		l.latency += (latency - l.latency) / 100
+	}
+	if float64(latency) > l.Tolerance*float64(l.latency) {
+		overloaded = true
+	}
+
+	switch {
+	case overloaded:
+		l.limit *= l.Backoff
+	case 2*l.inFlight >= int(l.limit):
+		l.limit++
+	}
+	if l.limit < float64(l.MinLimit) {
+		l.limit = float64(l.MinLimit)
+	}
+	if l.limit > float64(l.MaxLimit) {
+		l.limit = float64(l.MaxLimit)
+	}
+	l.signal()
+}
+
+// release removes a request of the given priority from the ones in flight.
+func (l *AdaptiveLimiter) release(p Priority) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.inFlight--
+	if p == PriorityBatch {
+		l.batch--
+	}
+	l.signal()
+}
+
+// signal wakes up the requests waiting. It must be
+// called with the limiter's mutex held.
+func (l *AdaptiveLimiter) signal() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// limiterTransport applies a limiter to requests.
+type limiterTransport struct {
+	base http.RoundTripper
+	l    *AdaptiveLimiter
+}
+
+func (tr *limiterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := tr.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if strings.Contains(req.Header.Get("Accept"), "text/event-stream") {
+		return base.RoundTrip(req)
+	}
+
+	p := requestPriority(req.Context())
+	if err := tr.l.acquire(req.Context(), p); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			tr.l.observe(time.Since(start), true)
+		}
+		tr.l.release(p)
+		return nil, err
+	}
+
+	overloaded := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	tr.l.observe(time.Since(start), overloaded)
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { tr.l.release(p) }}
+	return resp, nil
+}
+
+// releasingBody calls release once the response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
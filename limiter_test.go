@@ -0,0 +1,123 @@
+package firego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveLimiterLimitsRequests(t *testing.T) {
+	t.Parallel()
+	var current, highest int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		for {
+			h := atomic.LoadInt32(&highest)
+			if n <= h || atomic.CompareAndSwapInt32(&highest, h, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&current, -1)
+		w.Write([]byte("null"))
+	}))
+	defer server.Close()
+
+	limiter := NewAdaptiveLimiter(2, 2)
+	fb := limiter.Guard(New(server.URL, nil))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, fb.Child("a").Value(new(interface{})))
+		}()
+	}
+	eventually(t, func() bool { return limiter.InFlight() == 2 }, "requests not sent")
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&highest))
+	assert.Equal(t, 0, limiter.InFlight())
+}
+
+func TestAdaptiveLimiterAdjustsLimit(t *testing.T) {
+	t.Parallel()
+	var overloaded int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&overloaded) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("null"))
+	}))
+	defer server.Close()
+
+	limiter := NewAdaptiveLimiter(1, 5)
+	limiter.Tolerance = 1000
+	fb := limiter.Guard(New(server.URL, nil))
+	fb.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+
+	// the limit grows while at least half of it is used,
+	// which one request at a time grows it to 3
+	for i := 0; i < 10; i++ {
+		require.NoError(t, fb.Value(new(interface{})))
+	}
+	assert.Equal(t, 3, limiter.Limit())
+
+	// and shrinks when Firebase is overloaded
+	atomic.StoreInt32(&overloaded, 1)
+	for i := 0; i < 30; i++ {
+		assert.Error(t, fb.Value(new(interface{})))
+	}
+	assert.Equal(t, 1, limiter.Limit())
+}
+
+func TestAdaptiveLimiterPriorities(t *testing.T) {
+	t.Parallel()
+	var mtx sync.Mutex
+	var order []string
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mtx.Lock()
+		order = append(order, req.URL.Path)
+		mtx.Unlock()
+		if req.URL.Path == "/first/.json" {
+			<-release
+		}
+		w.Write([]byte("null"))
+	}))
+	defer server.Close()
+
+	limiter := NewAdaptiveLimiter(1, 1)
+	fb := limiter.Guard(New(server.URL, nil))
+	batch := fb.WithPriority(PriorityBatch)
+
+	var wg sync.WaitGroup
+	read := func(ref *Firebase) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, ref.Value(new(interface{})))
+		}()
+	}
+	read(fb.Child("first"))
+	eventually(t, func() bool { return limiter.InFlight() == 1 }, "request not sent")
+	read(batch.Child("batch"))
+	time.Sleep(20 * time.Millisecond)
+	read(fb.Child("interactive"))
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, []string{"/first/.json", "/interactive/.json", "/batch/.json"}, order)
+}
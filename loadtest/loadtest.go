@@ -0,0 +1,303 @@
+/*
+Package loadtest drives a mix of reads, writes and streams against a
+Firebase, be it the fake server of firetest, the emulator or a real
+database, and reports the throughput and latency percentiles of each kind
+of operation, to catch performance regressions of the client:
+
+    fb := firego.New("http://localhost:9000", nil)
+    report, err := loadtest.Run(ctx, fb.Child("loadtest"), loadtest.Config{
+        Mix:      loadtest.Mix{Reads: 8, Writes: 2, Streams: 1},
+        Workers:  20,
+        Duration: time.Minute,
+    })
+    if err != nil {
+        log.Fatal(err)
+    }
+    fmt.Println(report)
+
+Operations target the children of the reference given to Run, which
+should not hold data that matters since writes overwrite it.
+*/
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zabawaba99/firego"
+)
+
+// Mix holds the relative weights of the kinds of operations run. With
+// {Reads: 3, Writes: 1}, three operations out of four are reads.
+type Mix struct {
+	// Reads read a child with Value.
+	Reads int
+	// Writes set a child to Config.Value.
+	Writes int
+	// Streams watch a child until its first event is received,
+	// measuring how long it takes to establish a stream.
+	Streams int
+}
+
+func (m Mix) total() int {
+	return m.Reads + m.Writes + m.Streams
+}
+
+// Config configures a load test.
+type Config struct {
+	Mix Mix
+	// Workers is the number of operations run concurrently.
+	// It defaults to 10.
+	Workers int
+	// Duration is how long operations are run for. It defaults to
+	// 10 seconds, unless Operations is set.
+	Duration time.Duration
+	// Operations is the number of operations run, if set. The test
+	// stops at the end of Duration if it comes first.
+	Operations int
+	// Keys is the number of children operations are spread across.
+	// It defaults to 100.
+	Keys int
+	// Value is written by writes, a small object by default.
+	Value interface{}
+}
+
+// Stats are the measures of a kind of operation.
+type Stats struct {
+	// Count is the number of operations run, failed ones included.
+	Count int
+	// Errors is the number of operations that failed.
+	Errors int
+	// Throughput is the number of operations run per second.
+	Throughput float64
+	// Latency percentiles of the operations that succeeded.
+	Min, P50, P90, P99, Max time.Duration
+}
+
+// Report holds the results of a load test.
+type Report struct {
+	// Duration is how long the operations were run for.
+	Duration time.Duration
+	Reads    Stats
+	Writes   Stats
+	Streams  Stats
+}
+
+// String formats the report as a table.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-8s %8s %8s %10s %10s %10s %10s %10s %10s\n",
+		"op", "count", "errors", "ops/s", "min", "p50", "p90", "p99", "max")
+	for _, row := range []struct {
+		name  string
+		stats Stats
+	}{
+		{"read", r.Reads},
+		{"write", r.Writes},
+		{"stream", r.Streams},
+	} {
+		s := row.stats
+		if s.Count == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%-8s %8d %8d %10.1f %10s %10s %10s %10s %10s\n",
+			row.name, s.Count, s.Errors, s.Throughput,
+			round(s.Min), round(s.P50), round(s.P90), round(s.P99), round(s.Max))
+	}
+	fmt.Fprintf(&b, "duration %s\n", round(r.Duration))
+	return b.String()
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
+
+type opKind int
+
+const (
+	opRead opKind = iota
+	opWrite
+	opStream
+)
+
+// sample is the outcome of an operation.
+type sample struct {
+	kind    opKind
+	latency time.Duration
+	err     error
+}
+
+// Run runs the operations of cfg against the children of fb until
+// Duration elapses, Operations are run or ctx is done, and reports their
+// measures. Failed operations are counted, not returned.
+func Run(ctx context.Context, fb *firego.Firebase, cfg Config) (*Report, error) {
+	if cfg.Mix.Reads < 0 || cfg.Mix.Writes < 0 || cfg.Mix.Streams < 0 || cfg.Mix.total() == 0 {
+		return nil, errors.New("loadtest: mix has no operations")
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 10
+	}
+	if cfg.Duration <= 0 && cfg.Operations <= 0 {
+		cfg.Duration = 10 * time.Second
+	}
+	if cfg.Keys <= 0 {
+		cfg.Keys = 100
+	}
+	if cfg.Value == nil {
+		cfg.Value = map[string]interface{}{"name": "loadtest", "count": 1, "ok": true}
+	}
+
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	var (
+		mtx     sync.Mutex
+		samples []sample
+		left    = cfg.Operations
+		wg      sync.WaitGroup
+	)
+	// next reserves an operation, reporting false once all are run
+	next := func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if cfg.Operations <= 0 {
+			return true
+		}
+		if left == 0 {
+			return false
+		}
+		left--
+		return true
+	}
+
+	start := time.Now()
+	for i := 0; i < cfg.Workers; i++ {
+		rnd := rand.New(rand.NewSource(start.UnixNano() + int64(i)))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil && next() {
+				s := runOp(ctx, fb, cfg, rnd)
+				if ctx.Err() != nil && s.err != nil {
+					// interrupted by the end of the test
+					return
+				}
+				mtx.Lock()
+				samples = append(samples, s)
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	report := &Report{Duration: elapsed}
+	report.Reads = summarize(samples, opRead, elapsed)
+	report.Writes = summarize(samples, opWrite, elapsed)
+	report.Streams = summarize(samples, opStream, elapsed)
+	return report, nil
+}
+
+// runOp runs an operation picked according to the mix.
+func runOp(ctx context.Context, fb *firego.Firebase, cfg Config, rnd *rand.Rand) sample {
+	ref := fb.WithContext(ctx).Child(strconv.Itoa(rnd.Intn(cfg.Keys)))
+
+	n := rnd.Intn(cfg.Mix.total())
+	kind := opStream
+	switch {
+	case n < cfg.Mix.Reads:
+		kind = opRead
+	case n < cfg.Mix.Reads+cfg.Mix.Writes:
+		kind = opWrite
+	}
+
+	start := time.Now()
+	var err error
+	switch kind {
+	case opRead:
+		var v interface{}
+		err = ref.Value(&v)
+	case opWrite:
+		err = ref.Set(cfg.Value)
+	case opStream:
+		err = stream(ctx, ref)
+	}
+	return sample{kind: kind, latency: time.Since(start), err: err}
+}
+
+// stream watches ref until its first event is received.
+func stream(ctx context.Context, ref *firego.Firebase) error {
+	events := make(chan firego.Event)
+	if err := ref.Watch(events); err != nil {
+		return err
+	}
+	defer ref.StopWatching()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			return errors.New("loadtest: stream closed before its first event")
+		}
+		if event.Type != firego.EventTypePut {
+			return fmt.Errorf("loadtest: stream started with a %s event", event.Type)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// summarize computes the stats of the samples of a kind of operation.
+func summarize(samples []sample, kind opKind, elapsed time.Duration) Stats {
+	var (
+		stats     Stats
+		latencies []time.Duration
+	)
+	for _, s := range samples {
+		if s.kind != kind {
+			continue
+		}
+		stats.Count++
+		if s.err != nil {
+			stats.Errors++
+			continue
+		}
+		latencies = append(latencies, s.latency)
+	}
+	if elapsed > 0 {
+		stats.Throughput = float64(stats.Count) / elapsed.Seconds()
+	}
+	if len(latencies) == 0 {
+		return stats
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	stats.Min = latencies[0]
+	stats.P50 = percentile(latencies, 50)
+	stats.P90 = percentile(latencies, 90)
+	stats.P99 = percentile(latencies, 99)
+	stats.Max = latencies[len(latencies)-1]
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted latencies,
+// with the nearest-rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
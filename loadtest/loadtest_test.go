@@ -0,0 +1,79 @@
+package loadtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := firego.New(server.URL, nil).Child("loadtest")
+	report, err := Run(context.Background(), fb, Config{
+		Mix:        Mix{Reads: 2, Writes: 1, Streams: 1},
+		Workers:    4,
+		Operations: 200,
+		Keys:       10,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 200, report.Reads.Count+report.Writes.Count+report.Streams.Count)
+	for _, stats := range []Stats{report.Reads, report.Writes, report.Streams} {
+		assert.NotZero(t, stats.Count)
+		assert.Zero(t, stats.Errors)
+		assert.True(t, stats.Throughput > 0)
+		assert.True(t, stats.Min <= stats.P50 && stats.P50 <= stats.P90 &&
+			stats.P90 <= stats.P99 && stats.P99 <= stats.Max)
+	}
+	assert.True(t, report.Reads.Count > report.Writes.Count)
+	assert.Contains(t, report.String(), "stream")
+
+	var v map[string]interface{}
+	require.NoError(t, fb.Value(&v))
+	assert.NotEmpty(t, v)
+}
+
+func TestRunDuration(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := firego.New(server.URL, nil)
+	start := time.Now()
+	report, err := Run(context.Background(), fb, Config{
+		Mix:      Mix{Writes: 1},
+		Duration: 200 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.NotZero(t, report.Writes.Count)
+	assert.Zero(t, report.Reads.Count)
+	assert.NotContains(t, report.String(), "read")
+}
+
+func TestRunEmptyMix(t *testing.T) {
+	t.Parallel()
+	_, err := Run(context.Background(), firego.New("http://firebase.invalid", nil), Config{})
+	assert.Error(t, err)
+}
+
+func TestPercentile(t *testing.T) {
+	t.Parallel()
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i))
+	}
+	assert.Equal(t, time.Duration(50), percentile(latencies, 50))
+	assert.Equal(t, time.Duration(99), percentile(latencies, 99))
+	assert.Equal(t, time.Duration(1), percentile(latencies[:1], 99))
+}
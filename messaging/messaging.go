@@ -0,0 +1,160 @@
+/*
+Package messaging sends Firebase Cloud Messaging notifications through the
+FCM HTTP v1 API.
+
+Backends commonly write to the database and then notify devices, so the
+client authenticates with the same firego.TokenSource used for the
+database, which must provide OAuth2 access tokens with the
+https://www.googleapis.com/auth/firebase.messaging scope:
+
+    tr := firego.NewTokenRefresher(src, time.Minute)
+    if err := tr.Start(); err != nil {
+        log.Fatal(err)
+    }
+    fb.AuthTokenSource(tr)
+
+    fcm := messaging.New("my-project", tr, nil)
+    name, err := fcm.Send(&messaging.Message{
+        Topic:        "orders",
+        Notification: &messaging.Notification{Title: "New order"},
+    })
+*/
+package messaging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/zabawaba99/firego"
+)
+
+// DefaultEndpoint is the base URL of the FCM API.
+const DefaultEndpoint = "https://fcm.googleapis.com"
+
+// Message is a message to deliver to a device, a topic or
+// the devices matching a condition.
+//
+// Reference https://firebase.google.com/docs/reference/fcm/rest/v1/projects.messages
+type Message struct {
+	// Exactly one of Token, Topic or Condition must be set.
+	Token     string `json:"token,omitempty"`
+	Topic     string `json:"topic,omitempty"`
+	Condition string `json:"condition,omitempty"`
+
+	Notification *Notification     `json:"notification,omitempty"`
+	Data         map[string]string `json:"data,omitempty"`
+
+	// Platform specific options, passed through as is.
+	Android json.RawMessage `json:"android,omitempty"`
+	APNS    json.RawMessage `json:"apns,omitempty"`
+	Webpush json.RawMessage `json:"webpush,omitempty"`
+}
+
+// Notification is the basic notification shown on every platform.
+type Notification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+// Error is returned when FCM rejects a message.
+type Error struct {
+	// Code is the HTTP status code of the response.
+	Code int `json:"code"`
+	// Status is the canonical error code, e.g. "INVALID_ARGUMENT".
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("messaging: %s (%d): %s", e.Status, e.Code, e.Message)
+}
+
+// Client sends messages for a Firebase project.
+type Client struct {
+	// Endpoint is the base URL of the FCM API, DefaultEndpoint by default.
+	Endpoint string
+
+	projectID string
+	tokens    firego.TokenSource
+	client    *http.Client
+}
+
+// New creates a Client for the given project authenticated with tokens.
+// If client is nil, http.DefaultClient is used.
+func New(projectID string, tokens firego.TokenSource, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{
+		Endpoint:  DefaultEndpoint,
+		projectID: projectID,
+		tokens:    tokens,
+		client:    client,
+	}
+}
+
+// Send delivers msg and returns the name FCM assigned to it.
+func (c *Client) Send(msg *Message) (string, error) {
+	return c.send(msg, false)
+}
+
+// SendDryRun validates msg without delivering it.
+func (c *Client) SendDryRun(msg *Message) (string, error) {
+	return c.send(msg, true)
+}
+
+func (c *Client) send(msg *Message, dryRun bool) (string, error) {
+	body, err := json.Marshal(struct {
+		Message      *Message `json:"message"`
+		ValidateOnly bool     `json:"validate_only,omitempty"`
+	}{msg, dryRun})
+	if err != nil {
+		return "", err
+	}
+
+	token, err := c.tokens.Token()
+	if err != nil {
+		return "", fmt.Errorf("failed to get token %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v1/projects/%s/messages:send", c.Endpoint, c.projectID)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Error *Error `json:"error"`
+		}
+		if err := json.Unmarshal(respBody, &e); err != nil || e.Error == nil {
+			return "", &Error{Code: resp.StatusCode, Status: resp.Status, Message: string(respBody)}
+		}
+		return "", e.Error
+	}
+
+	var result struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", err
+	}
+	return result.Name, nil
+}
@@ -0,0 +1,85 @@
+package messaging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego"
+)
+
+var tokens = firego.TokenSourceFunc(func() (string, error) {
+	return "access-token", nil
+})
+
+func TestSend(t *testing.T) {
+	t.Parallel()
+	var (
+		req  *http.Request
+		body map[string]interface{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, `{"name":"projects/my-project/messages/1"}`)
+	}))
+	defer server.Close()
+
+	c := New("my-project", tokens, nil)
+	c.Endpoint = server.URL
+
+	name, err := c.Send(&Message{
+		Topic:        "orders",
+		Notification: &Notification{Title: "New order"},
+		Data:         map[string]string{"id": "42"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "projects/my-project/messages/1", name)
+
+	assert.Equal(t, "POST", req.Method)
+	assert.Equal(t, "/v1/projects/my-project/messages:send", req.URL.Path)
+	assert.Equal(t, "Bearer access-token", req.Header.Get("Authorization"))
+	assert.Equal(t, map[string]interface{}{
+		"message": map[string]interface{}{
+			"topic":        "orders",
+			"notification": map[string]interface{}{"title": "New order"},
+			"data":         map[string]interface{}{"id": "42"},
+		},
+	}, body)
+
+	_, err = c.SendDryRun(&Message{Token: "device"})
+	require.NoError(t, err)
+	assert.Equal(t, true, body["validate_only"])
+}
+
+func TestSendError(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"code":400,"status":"INVALID_ARGUMENT","message":"bad topic"}}`)
+	}))
+	defer server.Close()
+
+	c := New("my-project", tokens, nil)
+	c.Endpoint = server.URL
+
+	_, err := c.Send(&Message{Topic: "?"})
+	require.IsType(t, (*Error)(nil), err)
+	assert.Equal(t, &Error{Code: 400, Status: "INVALID_ARGUMENT", Message: "bad topic"}, err)
+	assert.EqualError(t, err, "messaging: INVALID_ARGUMENT (400): bad topic")
+}
+
+func TestSendTokenError(t *testing.T) {
+	t.Parallel()
+	c := New("my-project", firego.TokenSourceFunc(func() (string, error) {
+		return "", errors.New("no token")
+	}), nil)
+
+	_, err := c.Send(&Message{Topic: "orders"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,301 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// Model binds a struct type to the locations matching a path template,
+// sparing the building of their paths:
+//
+//    type User struct {
+//        UID  string `firebase:"$key"`
+//        Name string `firebase:"name"`
+//    }
+//
+//    users, err := firego.NewModel(fb, "/users/{uid}", User{})
+//    if err != nil {
+//        log.Fatal(err)
+//    }
+//    alice := User{UID: "alice", Name: "Alice"}
+//    if err := users.Save(&alice); err != nil {
+//        log.Fatal(err)
+//    }
+//    var u User
+//    if err := users.Load(&u, "alice"); err != nil {
+//        log.Fatal(err)
+//    }
+//
+// The keys given to its methods fill the wildcards of the template in
+// order. The last one may be left out of Save, the key being taken from
+// the field tagged "$key" of the value, or generated by Push if that field
+// is empty and stored into it. Load and Watch store the key of the
+// location into the field tagged "$key", if any.
+type Model struct {
+	// OnError is called when the data received by Watch can not be
+	// decoded into the model's type. Errors are logged if it is nil.
+	OnError func(path string, err error)
+
+	fb      *Firebase
+	pattern *PathPattern
+	typ     reflect.Type
+	// wildcards is the number of wildcards in the template
+	wildcards int
+}
+
+// ModelEvent is a change to the location of an instance of a Model.
+type ModelEvent struct {
+	// Keys holds the values of the wildcards of the
+	// template, keyed by wildcard name.
+	Keys map[string]string
+	// Value is a pointer to a new value of the model's type holding the
+	// data at the location, nil if the location holds no data.
+	Value interface{}
+}
+
+// NewModel creates a Model of the type of prototype, a struct or a
+// pointer to one, at the locations of fb matching template, whose
+// syntax is the one of PathPattern.
+func NewModel(fb *Firebase, template string, prototype interface{}) (*Model, error) {
+	p, err := ParsePathPattern(template)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.segments) == 0 {
+		return nil, fmt.Errorf("model: empty template %q", template)
+	}
+
+	t := reflect.TypeOf(prototype)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("model: %T is not a struct", prototype)
+	}
+
+	m := &Model{fb: fb, pattern: p, typ: t}
+	for _, s := range p.segments {
+		if _, wildcard := wildcardName(s); wildcard {
+			m.wildcards++
+		}
+	}
+	return m, nil
+}
+
+// Path returns the path of the location whose wildcards hold keys.
+func (m *Model) Path(keys ...string) (string, error) {
+	if len(keys) != m.wildcards {
+		return "", fmt.Errorf("model: %d keys given for %d wildcards in %q", len(keys), m.wildcards, m.pattern)
+	}
+
+	segments := make([]string, len(m.pattern.segments))
+	var i int
+	for j, s := range m.pattern.segments {
+		if _, wildcard := wildcardName(s); !wildcard {
+			segments[j] = s
+			continue
+		}
+		if keys[i] == "" || strings.Contains(keys[i], "/") {
+			return "", fmt.Errorf("model: invalid key %q for %s in %q", keys[i], s, m.pattern)
+		}
+		segments[j] = keys[i]
+		i++
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// Ref returns a reference to the location whose wildcards hold keys.
+func (m *Model) Ref(keys ...string) (*Firebase, error) {
+	path, err := m.Path(keys...)
+	if err != nil {
+		return nil, err
+	}
+	return m.fb.Child(path), nil
+}
+
+// Load reads the location whose wildcards hold keys into v,
+// a pointer to a value of the model's type.
+func (m *Model) Load(v interface{}, keys ...string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Type() != m.typ {
+		return fmt.Errorf("model: Load needs a *%s, got %T", m.typ, v)
+	}
+	path, err := m.Path(keys...)
+	if err != nil {
+		return err
+	}
+	if err := m.fb.Child(path).Value(v); err != nil {
+		return err
+	}
+	setKey(rv, lastKey(path))
+	return nil
+}
+
+// Save writes v, a value of the model's type or a pointer to one, to the
+// location whose wildcards hold keys, the last of which may be left out.
+func (m *Model) Save(v interface{}, keys ...string) error {
+	rv := reflect.ValueOf(v)
+	elem := rv
+	if elem.Kind() == reflect.Ptr && !elem.IsNil() {
+		elem = elem.Elem()
+	}
+	if elem.Type() != m.typ {
+		return fmt.Errorf("model: Save needs a %s, got %T", m.typ, v)
+	}
+
+	switch {
+	case len(keys) == m.wildcards:
+	case len(keys) == m.wildcards-1 && m.lastIsWildcard():
+		if key := keyOf(elem); key != "" {
+			keys = append(keys[:len(keys):len(keys)], key)
+			break
+		}
+		return m.push(rv, keys)
+	default:
+		return fmt.Errorf("model: %d keys given for %d wildcards in %q", len(keys), m.wildcards, m.pattern)
+	}
+
+	ref, err := m.Ref(keys...)
+	if err != nil {
+		return err
+	}
+	return ref.Set(v)
+}
+
+// push adds v under the parent of the locations whose wildcards
+// hold keys, storing the key it gets into v.
+func (m *Model) push(v reflect.Value, keys []string) error {
+	if v.Kind() != reflect.Ptr {
+		return errors.New("model: Save needs a pointer to store the generated key")
+	}
+	parent, err := m.parent(keys)
+	if err != nil {
+		return err
+	}
+	ref, err := parent.Push(v.Interface())
+	if err != nil {
+		return err
+	}
+	setKey(v, lastKey(ref.url))
+	return nil
+}
+
+// parent returns a reference to the parent of the locations
+// whose wildcards, all but the last one, hold keys.
+func (m *Model) parent(keys []string) (*Firebase, error) {
+	p := &Model{
+		fb:        m.fb,
+		pattern:   &PathPattern{raw: m.pattern.raw, segments: m.pattern.segments[:len(m.pattern.segments)-1]},
+		typ:       m.typ,
+		wildcards: m.wildcards - 1,
+	}
+	path, err := p.Path(keys...)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return m.fb.copy(), nil
+	}
+	return m.fb.Child(path), nil
+}
+
+// Delete removes the location whose wildcards hold keys.
+func (m *Model) Delete(keys ...string) error {
+	ref, err := m.Ref(keys...)
+	if err != nil {
+		return err
+	}
+	return ref.Remove()
+}
+
+// Watch sends the value of the location whose wildcards hold keys to
+// notifications, first as it is and then every time it changes, until
+// ctx is done or the stream ends, and then closes notifications.
+func (m *Model) Watch(ctx context.Context, notifications chan ModelEvent, keys ...string) error {
+	path, err := m.Path(keys...)
+	if err != nil {
+		return err
+	}
+	ref := m.fb.Child(path)
+	params := make(map[string]string, len(keys))
+	var i int
+	for _, s := range m.pattern.segments {
+		if name, wildcard := wildcardName(s); wildcard {
+			params[name] = keys[i]
+			i++
+		}
+	}
+
+	events := make(chan Event)
+	if err := ref.Watch(events); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			ref.StopWatching()
+		case <-done:
+		}
+	}()
+	go func() {
+		defer close(notifications)
+		defer close(done)
+		var tree interface{}
+		for event := range events {
+			if event.Type != EventTypePut && event.Type != EventTypePatch {
+				continue
+			}
+			tree = applyEvent(tree, event)
+
+			e := ModelEvent{Keys: params}
+			if tree != nil {
+				v := reflect.New(m.typ)
+				if err := m.decodeTree(tree, v.Interface()); err != nil {
+					m.handleError("/"+path, err)
+					continue
+				}
+				setKey(v, lastKey(path))
+				e.Value = v.Interface()
+			}
+			select {
+			case notifications <- e:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return nil
+}
+
+// decodeTree decodes tree, data received by a Watch, into v.
+func (m *Model) decodeTree(tree interface{}, v interface{}) error {
+	b, err := marshal(tree)
+	if err != nil {
+		return err
+	}
+	return m.fb.decode(b, v)
+}
+
+func (m *Model) handleError(path string, err error) {
+	if m.OnError != nil {
+		m.OnError(path, err)
+		return
+	}
+	log.Printf("Model: %s: %s", path, err)
+}
+
+// lastKey returns the last key of a slash separated path.
+func lastKey(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// lastIsWildcard reports whether the last segment of the template is a
+// wildcard, whose key can then be left out of Save.
+func (m *Model) lastIsWildcard() bool {
+	_, wildcard := wildcardName(m.pattern.segments[len(m.pattern.segments)-1])
+	return wildcard
+}
@@ -0,0 +1,112 @@
+package firego
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+type modelPost struct {
+	ID    string `firebase:"$key"`
+	Title string `firebase:"title"`
+}
+
+func TestNewModel(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil)
+
+	_, err := NewModel(fb, "/users/{uid}/posts/{id}", modelPost{})
+	assert.NoError(t, err)
+	_, err = NewModel(fb, "/users/{uid}", &modelPost{})
+	assert.NoError(t, err)
+	_, err = NewModel(fb, "/users/{uid}", "post")
+	assert.Error(t, err)
+	_, err = NewModel(fb, "/", modelPost{})
+	assert.Error(t, err)
+	_, err = NewModel(fb, "/users/{uid}/{uid}", modelPost{})
+	assert.Error(t, err)
+
+	posts, err := NewModel(fb, "/users/{uid}/posts/{id}", modelPost{})
+	require.NoError(t, err)
+	path, err := posts.Path("alice", "p1")
+	require.NoError(t, err)
+	assert.Equal(t, "users/alice/posts/p1", path)
+
+	_, err = posts.Path("alice")
+	assert.Error(t, err)
+	_, err = posts.Path("alice", "a/b")
+	assert.Error(t, err)
+	_, err = posts.Path("", "p1")
+	assert.Error(t, err)
+}
+
+func TestModel(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	posts, err := NewModel(fb, "/users/{uid}/posts/{id}", modelPost{})
+	require.NoError(t, err)
+
+	// explicit key
+	require.NoError(t, posts.Save(modelPost{Title: "first"}, "alice", "p1"))
+	assert.Equal(t, map[string]interface{}{"title": "first"}, server.Get("users/alice/posts/p1"))
+
+	// key taken from the value
+	require.NoError(t, posts.Save(&modelPost{ID: "p2", Title: "second"}, "alice"))
+	assert.Equal(t, map[string]interface{}{"title": "second"}, server.Get("users/alice/posts/p2"))
+
+	// generated key
+	p := modelPost{Title: "third"}
+	require.NoError(t, posts.Save(&p, "alice"))
+	require.NotEmpty(t, p.ID)
+	assert.Equal(t, map[string]interface{}{"title": "third"}, server.Get("users/alice/posts/"+p.ID))
+	assert.Error(t, posts.Save(modelPost{Title: "fourth"}, "alice"))
+
+	var loaded modelPost
+	require.NoError(t, posts.Load(&loaded, "alice", "p2"))
+	assert.Equal(t, modelPost{ID: "p2", Title: "second"}, loaded)
+	assert.Error(t, posts.Load(&struct{}{}, "alice", "p2"))
+	assert.Error(t, posts.Load(loaded, "alice", "p2"))
+
+	require.NoError(t, posts.Delete("alice", "p1"))
+	assert.Nil(t, server.Get("users/alice/posts/p1"))
+	assert.Error(t, posts.Save(struct{}{}, "alice", "p1"))
+}
+
+func TestModelWatch(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	posts, err := NewModel(fb, "/users/{uid}/posts/{id}", modelPost{})
+	require.NoError(t, err)
+	require.NoError(t, posts.Save(modelPost{Title: "first"}, "alice", "p1"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	notifications := make(chan ModelEvent)
+	require.NoError(t, posts.Watch(ctx, notifications, "alice", "p1"))
+
+	e := <-notifications
+	assert.Equal(t, map[string]string{"uid": "alice", "id": "p1"}, e.Keys)
+	assert.Equal(t, &modelPost{ID: "p1", Title: "first"}, e.Value)
+
+	server.Set("users/alice/posts/p1/title", "edited")
+	e = <-notifications
+	assert.Equal(t, &modelPost{ID: "p1", Title: "edited"}, e.Value)
+
+	server.Delete("users/alice/posts/p1")
+	e = <-notifications
+	assert.Nil(t, e.Value)
+
+	cancel()
+	for range notifications {
+	}
+}
@@ -0,0 +1,119 @@
+package firego
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// multiWatchRetryDelay is how long WatchMulti waits before watching
+// a reference again after its stream ended.
+var multiWatchRetryDelay = time.Second
+
+// RefEvent is an event received by WatchMulti, tagged with the
+// reference it was received for.
+type RefEvent struct {
+	Event
+	// Ref is the reference, as given to WatchMulti, the event is for.
+	Ref *Firebase
+}
+
+// WatchMulti watches every one of refs and sends their events to the
+// returned channel, which is closed once ctx is done and every watch has
+// stopped.
+//
+// Each reference is watched again, after a delay, whenever its stream ends,
+// the event ending it being delivered first and an EventTypeReconnect event
+// being delivered before watching it again, resuming after the last event
+// delivered if the server supports Last-Event-ID. A failure to watch a reference
+// is delivered as an EventTypeError event holding the error. As with Watch,
+// Seq going back to 1 for a reference tells that a new stream was started
+// and that changes may have been missed.
+//
+//    events := firego.WatchMulti(ctx, fb.Child("orders"), fb.Child("users"))
+//    for event := range events {
+//        log.Printf("%s%s changed", event.Ref, event.Path)
+//    }
+func WatchMulti(ctx context.Context, refs ...*Firebase) <-chan RefEvent {
+	events := make(chan RefEvent)
+	retryDelay := multiWatchRetryDelay
+
+	var wg sync.WaitGroup
+	for _, ref := range refs {
+		wg.Add(1)
+		go func(ref *Firebase) {
+			defer wg.Done()
+			watchRef(ctx, ref, events, retryDelay)
+		}(ref)
+	}
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+	return events
+}
+
+// watchRef sends the events of ref to events until ctx is done,
+// watching ref again retryDelay after its stream ends.
+func watchRef(ctx context.Context, ref *Firebase, events chan RefEvent, retryDelay time.Duration) {
+	// lastEventID is the ID of the last event sent, which
+	// the next stream resumes after if the server supports it
+	lastEventID := ref.lastEventID
+	send := func(event Event) bool {
+		select {
+		case events <- RefEvent{Event: event, Ref: ref}:
+			if event.ID != "" {
+				lastEventID = event.ID
+			}
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for ctx.Err() == nil {
+		watched := ref.copy()
+		watched.lastEventID = lastEventID
+		notifications := make(chan Event)
+		if err := watched.Watch(notifications); err != nil {
+			if !send(Event{Type: EventTypeError, Data: err}) {
+				return
+			}
+		} else if !forwardEvents(ctx, watched, notifications, send) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+		if !send(Event{Type: EventTypeReconnect}) {
+			return
+		}
+	}
+}
+
+// forwardEvents sends the notifications of watched until the stream ends,
+// returning false if it was stopped because ctx is done.
+func forwardEvents(ctx context.Context, watched *Firebase, notifications chan Event, send func(Event) bool) bool {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		watched.StopWatching()
+	}()
+
+	for event := range notifications {
+		if !send(event) {
+			for range notifications {
+				// drain so the watcher can shut down
+			}
+			return false
+		}
+	}
+	return ctx.Err() == nil
+}
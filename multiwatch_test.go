@@ -0,0 +1,128 @@
+package firego
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func nextRefEvent(t *testing.T, events <-chan RefEvent) RefEvent {
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "channel closed")
+		return event
+	case <-time.After(2 * time.Second):
+		require.FailNow(t, "no event received")
+	}
+	return RefEvent{}
+}
+
+func TestWatchMulti(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("orders/1", "pending")
+	server.Set("users/1", "alice")
+
+	fb := New(server.URL, nil)
+	orders, users := fb.Child("orders"), fb.Child("users")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := WatchMulti(ctx, orders, users)
+
+	initial := map[*Firebase]interface{}{}
+	for len(initial) < 2 {
+		event := nextRefEvent(t, events)
+		assert.Equal(t, uint64(1), event.Seq)
+		initial[event.Ref] = event.Data
+	}
+	assert.Equal(t, map[string]interface{}{"1": "pending"}, initial[orders])
+	assert.Equal(t, map[string]interface{}{"1": "alice"}, initial[users])
+
+	server.Set("users/2", "bob")
+	event := nextRefEvent(t, events)
+	assert.Equal(t, users, event.Ref)
+	assert.Equal(t, "/2", event.Path)
+	assert.Equal(t, "bob", event.Data)
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("channel was not closed")
+	}
+}
+
+func TestWatchMultiReconnects(t *testing.T) {
+	defer func(d time.Duration) { multiWatchRetryDelay = d }(multiWatchRetryDelay)
+	multiWatchRetryDelay = time.Millisecond
+
+	var connections int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&connections, 1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "event: put\ndata: {\"path\":\"/\",\"data\":%d}\n\n", n)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := WatchMulti(ctx, New(server.URL, nil))
+
+	for i := 1; i <= 2; i++ {
+		if i > 1 {
+			event := nextRefEvent(t, events)
+			assert.Equal(t, EventTypeReconnect, event.Type)
+		}
+		event := nextRefEvent(t, events)
+		assert.Equal(t, EventTypePut, event.Type)
+		assert.Equal(t, uint64(1), event.Seq)
+		assert.Equal(t, float64(i), event.Data)
+
+		// the stream ending is reported before watching again
+		event = nextRefEvent(t, events)
+		assert.Equal(t, EventTypeError, event.Type)
+	}
+}
+
+func TestWatchMultiLastEventID(t *testing.T) {
+	defer func(d time.Duration) { multiWatchRetryDelay = d }(multiWatchRetryDelay)
+	multiWatchRetryDelay = time.Millisecond
+
+	resumed := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		resumed <- req.Header.Get("Last-Event-ID")
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "id: 7\nevent: put\ndata: {\"path\":\"/\",\"data\":1}\n\n")
+		fmt.Fprint(w, "event: put\ndata: {\"path\":\"/a\",\"data\":2}\nid: 8\n\n")
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fb := New(server.URL, nil)
+	fb.ResumeAfter("3")
+	events := WatchMulti(ctx, fb)
+
+	event := nextRefEvent(t, events)
+	assert.Equal(t, "7", event.ID)
+	event = nextRefEvent(t, events)
+	assert.Equal(t, "8", event.ID)
+	assert.Equal(t, EventTypeError, nextRefEvent(t, events).Type)
+	assert.Equal(t, EventTypeReconnect, nextRefEvent(t, events).Type)
+	nextRefEvent(t, events)
+
+	assert.Equal(t, "3", <-resumed)
+	assert.Equal(t, "8", <-resumed)
+}
@@ -0,0 +1,227 @@
+package firego
+
+import (
+	"bytes"
+	"errors"
+	_url "net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MissCache remembers the locations found to be missing, so that they
+// are not read again for a while, see CacheMisses.
+type MissCache struct {
+	ttl time.Duration
+
+	mtx     sync.Mutex
+	entries map[string]missEntry
+	// prune is the number of entries above which
+	// the expired ones are removed
+	prune int
+	stats CacheStats
+}
+
+// missEntry is a read that found nothing.
+type missEntry struct {
+	url   string
+	path  string
+	query string
+	// err is the 404 error of the read, if it did not get null
+	err     error
+	created time.Time
+	expires time.Time
+}
+
+// CacheStats holds the counters of a MissCache.
+type CacheStats struct {
+	// Hits is the number of reads answered by the cache.
+	Hits int64
+	// Misses is the number of reads the cache could not answer.
+	Misses int64
+	// Evictions is the number of entries removed, whether they
+	// expired, were forgotten by a write or were purged.
+	Evictions int64
+	// Entries is the number of entries held, some of
+	// which may have expired without being removed yet.
+	Entries int
+}
+
+// CacheEntry describes a location cached by a MissCache.
+type CacheEntry struct {
+	// Path of the location, e.g. "/users/alice".
+	Path string
+	// Query holds the query parameters of the read, auth
+	// tokens left out, if any.
+	Query string
+	// NotFound is set if the read failed with a 404 error
+	// rather than finding null.
+	NotFound bool
+	// Age is how long ago the entry was cached.
+	Age time.Duration
+}
+
+// CacheMisses determines how long calls to Value remember that a location
+// holds no data, answering with null, or the 404 error they got, without
+// sending a request until ttl has passed, which absorbs repeated lookups
+// of missing keys. A ttl of 0 disables it.
+//
+// Enabling it starts a new cache, shared by the references derived from
+// fb afterwards. Writes made through these references forget the misses
+// at the locations they change, but data written by other clients is only
+// seen once the misses expire. Misses are cached per auth token, those
+// of the reads made with a token are never used by the reads made with
+// another, as they may not be allowed to read the same data.
+func (fb *Firebase) CacheMisses(ttl time.Duration) {
+	if ttl <= 0 {
+		fb.misses = nil
+		return
+	}
+	fb.misses = &MissCache{ttl: ttl, entries: map[string]missEntry{}, prune: 64}
+}
+
+// MissCache returns the cache enabled by CacheMisses, or nil if it is
+// not enabled, to inspect and control it at runtime.
+func (fb *Firebase) MissCache() *MissCache {
+	return fb.misses
+}
+
+// Stats returns the counters of the cache.
+func (c *MissCache) Stats() CacheStats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	return stats
+}
+
+// Entries returns the entries of the cache that have not expired,
+// sorted by path.
+func (c *MissCache) Entries() []CacheEntry {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := time.Now()
+	entries := make([]CacheEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		if now.After(e.expires) {
+			continue
+		}
+		entries = append(entries, CacheEntry{
+			Path:     e.path,
+			Query:    e.query,
+			NotFound: e.err != nil,
+			Age:      now.Sub(e.created),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Path != entries[j].Path {
+			return entries[i].Path < entries[j].Path
+		}
+		return entries[i].Query < entries[j].Query
+	})
+	return entries
+}
+
+// Purge removes the entries of the locations at or under pathPrefix,
+// the whole of the cache for "/", and returns how many were removed.
+func (c *MissCache) Purge(pathPrefix string) int {
+	prefix := strings.Trim(pathPrefix, "/")
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var n int
+	for k, e := range c.entries {
+		path := strings.Trim(e.path, "/")
+		if prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/") {
+			delete(c.entries, k)
+			n++
+		}
+	}
+	c.stats.Evictions += int64(n)
+	return n
+}
+
+// get returns the miss of the read with the given key, if any.
+func (c *MissCache) get(key string) (missEntry, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.entries[key]
+	if ok && time.Now().After(e.expires) {
+		delete(c.entries, key)
+		c.stats.Evictions++
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		return missEntry{}, false
+	}
+	c.stats.Hits++
+	return e, true
+}
+
+// record remembers the result of the read with the given
+// key, of the location at url, if it found nothing.
+func (c *MissCache) record(key, url string, body []byte, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+	case err == nil && bytes.Equal(bytes.TrimSpace(body), []byte("null")):
+	default:
+		return
+	}
+	path, query := cacheLocation(key)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= c.prune {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+				c.stats.Evictions++
+			}
+		}
+		if c.prune < 2*len(c.entries) {
+			c.prune = 2 * len(c.entries)
+		}
+	}
+	c.entries[key] = missEntry{
+		url:     url,
+		path:    path,
+		query:   query,
+		err:     err,
+		created: now,
+		expires: now.Add(c.ttl),
+	}
+}
+
+// forget removes the misses at, above or below the location at url.
+func (c *MissCache) forget(url string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for k, e := range c.entries {
+		if pathsOverlap(e.url, url) {
+			delete(c.entries, k)
+			c.stats.Evictions++
+		}
+	}
+}
+
+// cacheLocation returns the path and the query parameters,
+// auth token left out, of the URL of a read.
+func cacheLocation(key string) (string, string) {
+	u, err := _url.Parse(key)
+	if err != nil {
+		return key, ""
+	}
+	params := u.Query()
+	params.Del(authParam)
+	params.Del(accessTokenParam)
+	path := "/" + strings.Trim(strings.TrimSuffix(u.Path, ".json"), "/")
+	return path, params.Encode()
+}
@@ -0,0 +1,96 @@
+package firego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheMisses(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch req.URL.Path {
+		case "/gone/.json":
+			http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		case "/found/.json":
+			w.Write([]byte(`"here"`))
+		default:
+			w.Write([]byte("null"))
+		}
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.CacheMisses(100 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		var v interface{}
+		require.NoError(t, fb.Child("missing").Value(&v))
+		assert.Nil(t, v)
+		assert.ErrorIs(t, fb.Child("gone").Value(&v), ErrNotFound)
+		require.NoError(t, fb.Child("found").Value(&v))
+		assert.Equal(t, "here", v)
+	}
+	assert.Equal(t, int32(5), atomic.LoadInt32(&requests))
+
+	// writes forget the misses of the locations they change
+	require.NoError(t, fb.Child("missing/child").Set(1))
+	require.NoError(t, fb.Child("missing").Value(new(interface{})))
+	assert.Equal(t, int32(7), atomic.LoadInt32(&requests))
+
+	// misses expire
+	time.Sleep(150 * time.Millisecond)
+	assert.ErrorIs(t, fb.Child("gone").Value(new(interface{})), ErrNotFound)
+	assert.Equal(t, int32(8), atomic.LoadInt32(&requests))
+}
+
+func TestMissCacheInspection(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/gone/.json" {
+			http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("null"))
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	assert.Nil(t, fb.MissCache())
+	fb.Auth("secret")
+	fb.CacheMisses(time.Minute)
+	cache := fb.MissCache()
+	require.NotNil(t, cache)
+
+	var v interface{}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, fb.Child("users/alice").Value(&v))
+		require.NoError(t, fb.Child("users/bob").Value(&v))
+		fb.Child("gone").Value(&v)
+	}
+	carol := fb.Child("users/carol")
+	carol.Shallow(true)
+	require.NoError(t, carol.Value(&v))
+
+	entries := cache.Entries()
+	require.Len(t, entries, 4)
+	assert.Equal(t, "/gone", entries[0].Path)
+	assert.True(t, entries[0].NotFound)
+	assert.Equal(t, "/users/alice", entries[1].Path)
+	assert.Empty(t, entries[1].Query)
+	assert.False(t, entries[1].NotFound)
+	assert.True(t, entries[1].Age >= 0 && entries[1].Age < time.Minute)
+	assert.Equal(t, "/users/carol", entries[3].Path)
+	assert.Equal(t, "shallow=true", entries[3].Query)
+
+	assert.Equal(t, 3, cache.Purge("/users"))
+	assert.Equal(t, CacheStats{Hits: 3, Misses: 4, Evictions: 3, Entries: 1}, cache.Stats())
+	assert.Equal(t, 1, cache.Purge("/"))
+}
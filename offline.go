@@ -0,0 +1,416 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// walCompactRecords is the number of records past which the log of an
+// OfflineQueue is compacted, once most of them are acknowledged.
+const walCompactRecords = 1024
+
+// QueuedWrite is a write held by an OfflineQueue.
+type QueuedWrite struct {
+	// Method is the HTTP method of the write: PUT, PATCH or DELETE.
+	Method string
+	// Path of the location written, relative to the queue's reference.
+	Path string
+	// Body is the JSON sent, nil for DELETE.
+	Body json.RawMessage
+	// ETag is the ETag of the data at Path the write was based on, empty
+	// if unknown. It is only set when the queue has an OnConflict resolver.
+	ETag string
+
+	seq uint64
+}
+
+// ConflictResolution is how OnConflict resolves a queued write
+// whose location changed after the write was queued.
+type ConflictResolution int
+
+const (
+	// ConflictKeepLocal sends the queued write, overwriting the remote data.
+	ConflictKeepLocal ConflictResolution = iota
+	// ConflictKeepRemote drops the queued write.
+	ConflictKeepRemote
+	// ConflictMerge sets the location to the merged value
+	// returned along with the resolution instead.
+	ConflictMerge
+)
+
+// Conflict is a queued write whose location was changed by someone else
+// after the write was queued.
+type Conflict struct {
+	// Write is the queued write.
+	Write QueuedWrite
+	// Remote is the current JSON value of the location.
+	Remote json.RawMessage
+}
+
+// OfflineQueue holds writes made while Firebase can not be reached until
+// Flush sends them, in the order they were made:
+//
+//    q, err := firego.NewOfflineQueue(fb, "/var/lib/app/firego.wal")
+//    if err != nil {
+//        log.Fatal(err)
+//    }
+//    defer q.Close()
+//
+//    q.Set("readings/latest", reading)
+//    if err := q.Flush(ctx); err != nil {
+//        log.Printf("still offline, %d writes queued: %s", q.Len(), err)
+//    }
+//
+// Writes are recorded in a write-ahead log, or a Store with
+// NewOfflineQueueStore, before the queue methods return, so they survive
+// crashes and restarts, and acknowledged in the log once sent so they are
+// not sent again. A write sent right before a crash, but not yet
+// acknowledged, is sent again on the next Flush. Since every
+// queued write sets the data at its location to the same value, this only
+// matters if the data was changed by someone else in between.
+//
+// Setting OnConflict makes writes conditional instead: the ETag of the data
+// a Set, Push or Remove is based on is recorded with it, and if the data was
+// changed by someone else by the time the write is sent, OnConflict decides
+// whether to overwrite it, keep it or merge both. The ETag of a location is
+// known once the queue read it with Value or wrote it. Writes queued after
+// another write to an overlapping location, and Updates, are not checked.
+type OfflineQueue struct {
+	// OnError is called with the writes that Firebase rejected, which
+	// would be rejected again and are dropped from the queue. Errors
+	// are logged if it is nil.
+	OnError func(w QueuedWrite, err error)
+	// OnConflict, if set, resolves the queued writes whose location
+	// changed after they were queued. For ConflictMerge, it also
+	// returns the value to set, nil removing the data.
+	OnConflict func(c Conflict) (ConflictResolution, interface{})
+
+	fb *Firebase
+
+	flushMtx sync.Mutex
+
+	mtx     sync.Mutex
+	wal     queueLog
+	pending []QueuedWrite
+	seq     uint64
+	// etags holds the last known ETag of locations, by path
+	etags map[string]string
+}
+
+// queueLog persists the writes of an OfflineQueue.
+type queueLog interface {
+	// append records a queued write, or the acknowledgement of one.
+	append(r walRecord) error
+	// rewrite replaces the records with the given queued writes.
+	rewrite(records []walRecord) error
+	// size returns the number of records held.
+	size() int
+	close() error
+}
+
+// NewOfflineQueue creates an OfflineQueue for writes relative to fb, keeping
+// its write-ahead log in the file at path. The writes left in the log by a
+// previous run are queued again.
+func NewOfflineQueue(fb *Firebase, path string) (*OfflineQueue, error) {
+	w, records, err := openWAL(path)
+	if err != nil {
+		return nil, err
+	}
+	return newOfflineQueue(fb, w, records)
+}
+
+// NewOfflineQueueStore creates an OfflineQueue for writes relative to fb,
+// keeping every queued write under a key of its own in store instead of a
+// log file, e.g. to share a database with the other helpers keeping state
+// in a Store. The writes left in store by a previous run for the same
+// reference are queued again. Store.Set must be durable once it returns
+// for the writes to survive crashes, as it is with FileStore.
+func NewOfflineQueueStore(fb *Firebase, store Store) (*OfflineQueue, error) {
+	l, records, err := openStoreLog(store, "offline:"+fb.url+":")
+	if err != nil {
+		return nil, err
+	}
+	return newOfflineQueue(fb, l, records)
+}
+
+// newOfflineQueue creates an OfflineQueue persisted in l,
+// which holds the given records.
+func newOfflineQueue(fb *Firebase, l queueLog, records []walRecord) (*OfflineQueue, error) {
+	q := &OfflineQueue{fb: fb, wal: l, etags: map[string]string{}}
+	acked := map[uint64]bool{}
+	for _, r := range records {
+		if r.Seq > q.seq {
+			q.seq = r.Seq
+		}
+		if r.Ack {
+			acked[r.Seq] = true
+		}
+	}
+	queued := map[uint64]int{}
+	for _, r := range records {
+		if r.Ack || acked[r.Seq] {
+			continue
+		}
+		w := QueuedWrite{Method: r.Method, Path: r.Path, Body: r.Body, ETag: r.ETag, seq: r.Seq}
+		if i, ok := queued[r.Seq]; ok {
+			// the resolution of a conflict replacing the write
+			q.pending[i] = w
+			continue
+		}
+		queued[r.Seq] = len(q.pending)
+		q.pending = append(q.pending, w)
+	}
+
+	if err := q.compact(); err != nil {
+		l.close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// Set queues setting the value at path, see Firebase.Set.
+func (q *OfflineQueue) Set(path string, v interface{}) error {
+	body, err := q.fb.encode(v, false)
+	if err != nil {
+		return err
+	}
+	return q.enqueue("PUT", path, body)
+}
+
+// Update queues updating the children of path, see Firebase.Update.
+func (q *OfflineQueue) Update(path string, v interface{}) error {
+	body, err := q.fb.encode(v, true)
+	if err != nil {
+		return err
+	}
+	return q.enqueue("PATCH", path, body)
+}
+
+// Remove queues removing the value at path, see Firebase.Remove.
+func (q *OfflineQueue) Remove(path string) error {
+	return q.enqueue("DELETE", path, nil)
+}
+
+// Push queues adding v as a new child of path, see Firebase.Push, and
+// returns the key of the child. The key is generated locally so that
+// sending the write again can not create a second child.
+func (q *OfflineQueue) Push(path string, v interface{}) (string, error) {
+	key := newPushID()
+	return key, q.Set(joinPath(strings.Trim(path, "/"), key), v)
+}
+
+// Value reads the value at path into v, see Firebase.Value. The writes
+// queued afterwards at path are based on the data read, which matters
+// when OnConflict is set.
+func (q *OfflineQueue) Value(path string, v interface{}) error {
+	path = strings.Trim(path, "/")
+	ref := q.fb.at(path)
+	headers, body, err := ref.doRequest("GET", nil, withHeader("X-Firebase-ETag", "true"))
+	if err != nil {
+		return err
+	}
+	q.mtx.Lock()
+	q.setETag(path, headers.Get("ETag"))
+	q.mtx.Unlock()
+	return ref.decode(body, v)
+}
+
+func (q *OfflineQueue) enqueue(method, path string, body []byte) error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	w := QueuedWrite{Method: method, Path: strings.Trim(path, "/"), Body: body, seq: q.seq + 1}
+	if q.OnConflict != nil && method != "PATCH" {
+		w.ETag = q.etags[w.Path]
+	}
+	if err := q.wal.append(walRecord{Seq: w.seq, Method: w.Method, Path: w.Path, Body: w.Body, ETag: w.ETag}); err != nil {
+		return err
+	}
+	q.seq = w.seq
+	q.pending = append(q.pending, w)
+	// the data following this write is not known until it is sent
+	q.setETag(w.Path, "")
+	return nil
+}
+
+// setETag records the ETag of the location at path, forgetting those of
+// the overlapping locations which changed along with it. An empty etag
+// only forgets them. It must be called with mtx held.
+func (q *OfflineQueue) setETag(path, etag string) {
+	for p := range q.etags {
+		if pathsOverlap(p, path) {
+			delete(q.etags, p)
+		}
+	}
+	if etag != "" {
+		q.etags[path] = etag
+	}
+}
+
+// Len returns the number of queued writes.
+func (q *OfflineQueue) Len() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return len(q.pending)
+}
+
+// Flush sends the queued writes in order. It stops at the first write that
+// fails because Firebase can not be reached, or ctx is done, returning the
+// error and leaving that write and the following ones queued.
+func (q *OfflineQueue) Flush(ctx context.Context) error {
+	q.flushMtx.Lock()
+	defer q.flushMtx.Unlock()
+
+	fb := q.fb.WithContext(ctx)
+	for {
+		q.mtx.Lock()
+		if len(q.pending) == 0 {
+			q.mtx.Unlock()
+			return nil
+		}
+		w := q.pending[0]
+		q.mtx.Unlock()
+
+		resolved, err := q.send(fb, w)
+		if err != nil && !permanent(err) {
+			return err
+		}
+		if resolved != nil {
+			// send the resolution in place of w
+			if err := q.replace(*resolved); err != nil {
+				return err
+			}
+			continue
+		}
+		if ackErr := q.ack(w); ackErr != nil {
+			return ackErr
+		}
+		if err != nil {
+			q.handleError(w, err)
+		}
+	}
+}
+
+// send sends w. If the location of w changed since it was queued, it
+// returns the write resolving the conflict, nil if w is to be dropped.
+func (q *OfflineQueue) send(fb *Firebase, w QueuedWrite) (*QueuedWrite, error) {
+	options := []func(*http.Request){withHeader("X-Firebase-ETag", "true")}
+	if w.ETag != "" {
+		options = append(options, withHeader("if-match", w.ETag))
+	}
+
+	headers, body, err := fb.at(w.Path).doRequest(w.Method, w.Body, options...)
+	if w.ETag != "" && q.OnConflict != nil && errors.Is(err, ErrPreconditionFailed) {
+		return q.resolve(w, headers.Get("ETag"), body), nil
+	}
+
+	etag := headers.Get("ETag")
+	if err != nil || w.Method == "PATCH" {
+		etag = ""
+	}
+	q.mtx.Lock()
+	q.setETag(w.Path, etag)
+	q.mtx.Unlock()
+	return nil, err
+}
+
+// resolve asks OnConflict how to resolve the conflict between w and
+// remote, the current data at its location. A resolution that can not
+// be sent is reported and w is dropped.
+func (q *OfflineQueue) resolve(w QueuedWrite, etag string, remote []byte) *QueuedWrite {
+	resolution, merged := q.OnConflict(Conflict{Write: w, Remote: remote})
+	switch resolution {
+	case ConflictKeepLocal:
+	case ConflictKeepRemote:
+		return nil
+	case ConflictMerge:
+		w.Method, w.Body = "DELETE", nil
+		if merged != nil {
+			body, err := q.fb.encode(merged, false)
+			if err != nil {
+				q.handleError(w, fmt.Errorf("invalid merged value. %w", err))
+				return nil
+			}
+			w.Method, w.Body = "PUT", body
+		}
+	default:
+		q.handleError(w, fmt.Errorf("unknown conflict resolution %d", resolution))
+		return nil
+	}
+	// only overwrite the data the resolution was based on
+	w.ETag = etag
+	return &w
+}
+
+// replace records w, the resolution of a conflict, in place of the first
+// queued write, which it shares its sequence number with, so that it is
+// the one queued again after a crash.
+func (q *OfflineQueue) replace(w QueuedWrite) error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if err := q.wal.append(walRecord{Seq: w.seq, Method: w.Method, Path: w.Path, Body: w.Body, ETag: w.ETag}); err != nil {
+		return err
+	}
+	q.pending[0] = w
+	return nil
+}
+
+// ack records that w was sent and removes it from the queue.
+func (q *OfflineQueue) ack(w QueuedWrite) error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if err := q.wal.append(walRecord{Seq: w.seq, Ack: true}); err != nil {
+		return err
+	}
+	q.pending = q.pending[1:]
+	if len(q.pending) == 0 || (q.wal.size() > walCompactRecords && q.wal.size() > 2*len(q.pending)) {
+		return q.compact()
+	}
+	return nil
+}
+
+// compact rewrites the log with only the queued writes.
+func (q *OfflineQueue) compact() error {
+	records := make([]walRecord, len(q.pending))
+	for i, w := range q.pending {
+		records[i] = walRecord{Seq: w.seq, Method: w.Method, Path: w.Path, Body: w.Body, ETag: w.ETag}
+	}
+	return q.wal.rewrite(records)
+}
+
+// Close closes the write-ahead log, but not the Store given to
+// NewOfflineQueueStore. The queue can not be used afterwards.
+func (q *OfflineQueue) Close() error {
+	q.flushMtx.Lock()
+	defer q.flushMtx.Unlock()
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return q.wal.close()
+}
+
+func (q *OfflineQueue) handleError(w QueuedWrite, err error) {
+	if q.OnError != nil {
+		q.OnError(w, err)
+		return
+	}
+	log.Printf("OfflineQueue: %s %s: %s", w.Method, w.Path, err)
+}
+
+// permanent reports whether a write that failed with err would fail
+// again if sent as is.
+func permanent(err error) bool {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Code < 500 && status.Code != 429
+	}
+	var validation *ValidationError
+	return errors.As(err, &validation) || errors.Is(err, ErrReadOnly) || errors.Is(err, ErrJailEscape)
+}
@@ -0,0 +1,303 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestOfflineQueue(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue.wal")
+
+	// queue writes while Firebase can not be reached
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	q, err := NewOfflineQueue(New(down.URL, nil), path)
+	require.NoError(t, err)
+	require.NoError(t, q.Set("a", 1))
+	require.NoError(t, q.Update("b", map[string]interface{}{"c": 2}))
+	key, err := q.Push("list", "item")
+	require.NoError(t, err)
+	require.NoError(t, q.Remove("a"))
+	assert.Error(t, q.Flush(context.Background()))
+	assert.Equal(t, 4, q.Len())
+	require.NoError(t, q.Close())
+
+	// the writes survive a restart and are sent in order
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	q, err = NewOfflineQueue(New(server.URL, nil), path)
+	require.NoError(t, err)
+	defer q.Close()
+	assert.Equal(t, 4, q.Len())
+
+	require.NoError(t, q.Flush(context.Background()))
+	assert.Equal(t, 0, q.Len())
+	assert.Equal(t, map[string]interface{}{
+		"b":    map[string]interface{}{"c": float64(2)},
+		"list": map[string]interface{}{key: "item"},
+	}, server.Get(""))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size(), "log should be compacted once empty")
+}
+
+func TestOfflineQueueStore(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	store := NewMemoryStore()
+	require.NoError(t, store.Set("other", []byte("kept")))
+
+	// queue writes while Firebase can not be reached
+	down := &http.Client{Transport: &bodyKeeper{}}
+	q, err := NewOfflineQueueStore(New(server.URL, down), store)
+	require.NoError(t, err)
+	require.NoError(t, q.Set("a", 1))
+	require.NoError(t, q.Set("b", 2))
+	require.NoError(t, q.Remove("a"))
+	assert.Error(t, q.Flush(context.Background()))
+	require.NoError(t, q.Close())
+
+	// the writes survive a restart and are sent in order
+	q, err = NewOfflineQueueStore(New(server.URL, nil), store)
+	require.NoError(t, err)
+	defer q.Close()
+	assert.Equal(t, 3, q.Len())
+	require.NoError(t, q.Flush(context.Background()))
+	assert.Equal(t, map[string]interface{}{"b": float64(2)}, server.Get(""))
+
+	var keys []string
+	require.NoError(t, store.Iterate(func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"other"}, keys, "sent writes should be deleted")
+}
+
+func TestOfflineQueueRejected(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		paths = append(paths, req.URL.Path)
+		if req.URL.Path == "/denied/.json" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("null"))
+	}))
+	defer server.Close()
+
+	q, err := NewOfflineQueue(New(server.URL, nil), filepath.Join(dir, "queue.wal"))
+	require.NoError(t, err)
+	defer q.Close()
+
+	var rejected []QueuedWrite
+	q.OnError = func(w QueuedWrite, err error) {
+		assert.True(t, permanent(err))
+		rejected = append(rejected, w)
+	}
+	require.NoError(t, q.Set("denied", 1))
+	require.NoError(t, q.Set("allowed", 2))
+
+	require.NoError(t, q.Flush(context.Background()))
+	assert.Equal(t, []string{"/denied/.json", "/allowed/.json"}, paths)
+	require.Len(t, rejected, 1)
+	assert.Equal(t, "denied", rejected[0].Path)
+	assert.Equal(t, 0, q.Len())
+}
+
+// etagServer serves a single JSON value for every path,
+// honoring if-match like Firebase does.
+func etagServer(value *string) *httptest.Server {
+	var mtx sync.Mutex
+	version := 1
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		etag := strconv.Itoa(version)
+		if match := req.Header.Get("if-match"); match != "" && match != etag {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusPreconditionFailed)
+			w.Write([]byte(*value))
+			return
+		}
+		switch req.Method {
+		case "PUT":
+			body, _ := ioutil.ReadAll(req.Body)
+			*value = string(body)
+			version++
+		case "DELETE":
+			*value = "null"
+			version++
+		}
+		w.Header().Set("ETag", strconv.Itoa(version))
+		w.Write([]byte(*value))
+	}))
+}
+
+func TestOfflineQueueConflict(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct {
+		name       string
+		resolution ConflictResolution
+		merged     interface{}
+		expected   string
+	}{
+		{"keep local", ConflictKeepLocal, nil, `"local"`},
+		{"keep remote", ConflictKeepRemote, nil, `"remote"`},
+		{"merge", ConflictMerge, "merged", `"merged"`},
+		{"merge removed", ConflictMerge, nil, "null"},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir, err := ioutil.TempDir("", "firego")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			value := `"original"`
+			server := etagServer(&value)
+			defer server.Close()
+
+			q, err := NewOfflineQueue(New(server.URL, nil), filepath.Join(dir, "queue.wal"))
+			require.NoError(t, err)
+			defer q.Close()
+
+			var conflicts []Conflict
+			q.OnConflict = func(c Conflict) (ConflictResolution, interface{}) {
+				conflicts = append(conflicts, c)
+				return tt.resolution, tt.merged
+			}
+
+			var v string
+			require.NoError(t, q.Value("doc", &v))
+			require.NoError(t, q.Set("doc", "local"))
+
+			// someone else writes in between
+			_, _, err = New(server.URL, nil).at("doc").doRequest("PUT", []byte(`"remote"`))
+			require.NoError(t, err)
+
+			require.NoError(t, q.Flush(context.Background()))
+			assert.Equal(t, tt.expected, value)
+			assert.Equal(t, 0, q.Len())
+			require.Len(t, conflicts, 1)
+			assert.Equal(t, "doc", conflicts[0].Write.Path)
+			assert.JSONEq(t, `"remote"`, string(conflicts[0].Remote))
+		})
+	}
+}
+
+func TestOfflineQueueConflictPersisted(t *testing.T) {
+	t.Parallel()
+	for _, store := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "firego")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		value := `"original"`
+		server := etagServer(&value)
+		defer server.Close()
+
+		var offline bool
+		fb := New(server.URL, nil)
+		fb.BeforeSend(func(req *http.Request, body []byte) error {
+			if offline {
+				return errors.New("offline")
+			}
+			return nil
+		})
+		open := func() *OfflineQueue {
+			var q *OfflineQueue
+			var err error
+			if store {
+				s, serr := NewFileStore(dir)
+				require.NoError(t, serr)
+				q, err = NewOfflineQueueStore(fb, s)
+			} else {
+				q, err = NewOfflineQueue(fb, filepath.Join(dir, "queue.wal"))
+			}
+			require.NoError(t, err)
+			return q
+		}
+
+		q := open()
+		q.OnConflict = func(c Conflict) (ConflictResolution, interface{}) {
+			// the connection is lost before the resolution is sent
+			offline = true
+			return ConflictMerge, "merged"
+		}
+		var v string
+		require.NoError(t, q.Value("doc", &v))
+		require.NoError(t, q.Set("doc", "local"))
+		_, _, err = New(server.URL, nil).at("doc").doRequest("PUT", []byte(`"remote"`))
+		require.NoError(t, err)
+
+		assert.Error(t, q.Flush(context.Background()))
+		require.NoError(t, q.Close())
+
+		// the resolution is sent after a restart, not the conflicting write
+		offline = false
+		q = open()
+		require.Equal(t, 1, q.Len())
+		require.NoError(t, q.Flush(context.Background()))
+		assert.Equal(t, `"merged"`, value, "store %v", store)
+		require.NoError(t, q.Close())
+	}
+}
+
+func TestOfflineQueueNoConflict(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	value := `"original"`
+	server := etagServer(&value)
+	defer server.Close()
+
+	q, err := NewOfflineQueue(New(server.URL, nil), filepath.Join(dir, "queue.wal"))
+	require.NoError(t, err)
+	defer q.Close()
+	q.OnConflict = func(c Conflict) (ConflictResolution, interface{}) {
+		t.Errorf("unexpected conflict %v", c)
+		return ConflictKeepLocal, nil
+	}
+
+	var v string
+	require.NoError(t, q.Value("doc", &v))
+	require.NoError(t, q.Set("doc", "first"))
+	// based on the first write, not on the data read
+	require.NoError(t, q.Set("doc", "second"))
+	require.NoError(t, q.Flush(context.Background()))
+	assert.Equal(t, `"second"`, value)
+
+	// the ETag of the last write is known
+	require.NoError(t, q.Set("doc", "third"))
+	assert.NotEmpty(t, q.pending[0].ETag)
+	require.NoError(t, q.Flush(context.Background()))
+	assert.Equal(t, `"third"`, value)
+}
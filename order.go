@@ -0,0 +1,204 @@
+package firego
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OrderedChild is a child returned by Children.
+type OrderedChild struct {
+	Key   string
+	Value json.RawMessage
+}
+
+// QueryResult holds the children returned by a query, see Children.
+type QueryResult struct {
+	// Children holds the children in the order of the query.
+	Children []OrderedChild
+	// ServerOrder holds the keys of the children in the order of the
+	// response, only set when ParseServerOrder is enabled.
+	ServerOrder []string
+}
+
+// ServerSorted reports whether the response listed the children in the
+// order of the query. It is false unless ParseServerOrder is enabled.
+func (r *QueryResult) ServerSorted() bool {
+	if len(r.ServerOrder) != len(r.Children) {
+		return false
+	}
+	for i, c := range r.Children {
+		if r.ServerOrder[i] != c.Key {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseServerOrder determines whether Children records the order in which
+// the children appear in responses, which JSON objects do not guarantee to
+// preserve, at the cost of a slower parsing. By default, it does not.
+func (fb *Firebase) ParseServerOrder(v bool) {
+	fb.parseServerOrder = v
+}
+
+// Children runs the query of the reference and returns its children sorted
+// the way Firebase sorts them for the query's OrderBy, by key if there is
+// none. Filtering by StartAt, EndAt, EqualTo and limits is done by
+// Firebase, but JSON objects are unordered, so the children are sorted
+// again by the client:
+//
+//    result, err := fb.OrderBy("score").LimitToLast(10).Children()
+//    for _, child := range result.Children {
+//        ...
+//    }
+func (fb *Firebase) Children() (*QueryResult, error) {
+	_, body, err := fb.doRequest("GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{}
+	values := map[string]json.RawMessage{}
+	if fb.parseServerOrder {
+		result.ServerOrder, err = parseOrderedChildren(body, values)
+	} else {
+		err = parseChildren(body, values)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fb.paramsMtx.RLock()
+	orderBy := fb.params.Get(orderByParam)
+	fb.paramsMtx.RUnlock()
+	if s, err := strconv.Unquote(orderBy); err == nil {
+		orderBy = s
+	}
+
+	sortValues := map[string]interface{}{}
+	for k, raw := range values {
+		result.Children = append(result.Children, OrderedChild{Key: k, Value: raw})
+		if orderBy == "" || orderBy == "$key" {
+			continue
+		}
+		var v interface{}
+		json.Unmarshal(raw, &v)
+		if orderBy != "$value" {
+			v = valueAt(v, splitPath(orderBy))
+		}
+		sortValues[k] = v
+	}
+	sort.Slice(result.Children, func(i, j int) bool {
+		a, b := result.Children[i].Key, result.Children[j].Key
+		if c := compareValues(sortValues[a], sortValues[b]); c != 0 {
+			return c < 0
+		}
+		return compareKeys(a, b) < 0
+	})
+	return result, nil
+}
+
+// parseChildren decodes the children of the object or array in
+// data into values.
+func parseChildren(data []byte, values map[string]json.RawMessage) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '[' {
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		for k, v := range m {
+			values[k] = v
+		}
+		return nil
+	}
+
+	var array []json.RawMessage
+	if err := json.Unmarshal(data, &array); err != nil {
+		return err
+	}
+	for i, v := range array {
+		if !bytes.Equal(bytes.TrimSpace(v), []byte("null")) {
+			values[strconv.Itoa(i)] = v
+		}
+	}
+	return nil
+}
+
+// parseOrderedChildren is parseChildren, also returning the
+// keys of the children in the order they appear in data.
+func parseOrderedChildren(data []byte, values map[string]json.RawMessage) ([]string, error) {
+	if err := parseChildren(data, values); err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	array := tok == json.Delim('[')
+
+	var keys []string
+	for i := 0; dec.More(); i++ {
+		key := strconv.Itoa(i)
+		if !array {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ = tok.(string)
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		if _, ok := values[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// compareValues orders values the same way Firebase does: null, false,
+// true, numbers, strings and finally objects, which are equal.
+func compareValues(a, b interface{}) int {
+	ar, br := valueRank(a), valueRank(b)
+	if ar != br {
+		return ar - br
+	}
+
+	switch av := a.(type) {
+	case float64:
+		bv := b.(float64)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+	case string:
+		return strings.Compare(av, b.(string))
+	}
+	return 0
+}
+
+func valueRank(v interface{}) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if !v {
+			return 1
+		}
+		return 2
+	case float64:
+		return 3
+	case string:
+		return 4
+	}
+	return 5
+}
@@ -0,0 +1,57 @@
+package firego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func orderedKeys(r *QueryResult) []string {
+	keys := make([]string, len(r.Children))
+	for i, c := range r.Children {
+		keys[i] = c.Key
+	}
+	return keys
+}
+
+func TestChildren(t *testing.T) {
+	t.Parallel()
+	response := `{"c": {"score": 1}, "a": {"score": 3}, "b": {"score": 1}, "d": {"name": "x"}, "10": {"score": "high"}, "9": {"score": true}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(response))
+	}))
+	defer server.Close()
+	fb := New(server.URL, nil)
+
+	result, err := fb.Children()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"9", "10", "a", "b", "c", "d"}, orderedKeys(result))
+	assert.Nil(t, result.ServerOrder)
+	assert.False(t, result.ServerSorted())
+
+	result, err = fb.OrderBy("score").Children()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d", "9", "b", "c", "a", "10"}, orderedKeys(result))
+	assert.JSONEq(t, `{"score": 3}`, string(result.Children[4].Value))
+
+	fb.ParseServerOrder(true)
+	result, err = fb.OrderBy("score").Children()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "a", "b", "d", "10", "9"}, result.ServerOrder)
+	assert.False(t, result.ServerSorted())
+
+	response = `{"9": 1, "10": 2}`
+	result, err = fb.OrderBy("$value").Children()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"9", "10"}, result.ServerOrder)
+	assert.True(t, result.ServerSorted())
+
+	response = `[null, "b", "a"]`
+	result, err = fb.OrderBy("$value").Children()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "1"}, orderedKeys(result))
+	assert.Equal(t, []string{"1", "2"}, result.ServerOrder)
+}
@@ -0,0 +1,112 @@
+package firego
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PathPattern matches paths such as "/users/{uid}/posts/{postId}" where
+// the segments in curly braces are wildcards matching any single key.
+//
+// It can be used to route the events of a Watch:
+//
+//    posts, _ := firego.ParsePathPattern("/{uid}/posts/{postId}")
+//    for event := range notifications {
+//        if params, ok := posts.Match(event.Path); ok {
+//            log.Printf("post %s of %s changed", params["postId"], params["uid"])
+//        }
+//    }
+type PathPattern struct {
+	raw      string
+	segments []string
+}
+
+// ParsePathPattern parses a pattern made of keys and wildcards. Wildcards
+// must span a whole segment and their names must be unique.
+func ParsePathPattern(pattern string) (*PathPattern, error) {
+	p := &PathPattern{raw: pattern, segments: splitPath(pattern)}
+
+	seen := map[string]bool{}
+	for _, s := range p.segments {
+		name, wildcard := wildcardName(s)
+		switch {
+		case !wildcard && strings.ContainsAny(s, "{}"):
+			return nil, fmt.Errorf("invalid segment %q in pattern %q", s, pattern)
+		case wildcard && name == "":
+			return nil, fmt.Errorf("empty wildcard in pattern %q", pattern)
+		case wildcard && seen[name]:
+			return nil, fmt.Errorf("wildcard %q used twice in pattern %q", name, pattern)
+		}
+		seen[name] = true
+	}
+	return p, nil
+}
+
+// String returns the pattern as it was parsed.
+func (p *PathPattern) String() string {
+	return p.raw
+}
+
+// Match reports whether path matches the pattern and returns the
+// values captured by its wildcards, keyed by wildcard name. Leading
+// and trailing slashes are ignored.
+func (p *PathPattern) Match(path string) (map[string]string, bool) {
+	return p.match(splitPath(path))
+}
+
+// MatchPrefix reports whether path matches the first segments of the
+// pattern, meaning that locations under it may match the pattern.
+func (p *PathPattern) MatchPrefix(path string) (map[string]string, bool) {
+	return p.matchPrefix(splitPath(path))
+}
+
+func (p *PathPattern) match(path []string) (map[string]string, bool) {
+	if len(path) != len(p.segments) {
+		return nil, false
+	}
+	return p.matchPrefix(path)
+}
+
+func (p *PathPattern) matchPrefix(path []string) (map[string]string, bool) {
+	if len(path) > len(p.segments) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, s := range path {
+		if name, wildcard := wildcardName(p.segments[i]); wildcard {
+			params[name] = s
+			continue
+		}
+		if s != p.segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// staticPrefix returns the segments before the first wildcard.
+func (p *PathPattern) staticPrefix() []string {
+	for i, s := range p.segments {
+		if _, wildcard := wildcardName(s); wildcard {
+			return p.segments[:i]
+		}
+	}
+	return p.segments
+}
+
+func wildcardName(segment string) (string, bool) {
+	if len(segment) < 2 || segment[0] != '{' || segment[len(segment)-1] != '}' {
+		return "", false
+	}
+	return segment[1 : len(segment)-1], true
+}
+
+// splitPath splits a slash separated path into its keys.
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
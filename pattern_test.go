@@ -0,0 +1,48 @@
+package firego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePathPattern(t *testing.T) {
+	for _, pattern := range []string{"/a/{}", "/a/{b", "/a/b}", "/a/b{c}", "/{a}/{a}"} {
+		_, err := ParsePathPattern(pattern)
+		assert.Error(t, err, pattern)
+	}
+
+	p, err := ParsePathPattern("/users/{uid}/posts/{pid}")
+	require.NoError(t, err)
+	assert.Equal(t, "/users/{uid}/posts/{pid}", p.String())
+	assert.Equal(t, []string{"users"}, p.staticPrefix())
+}
+
+func TestPathPatternMatch(t *testing.T) {
+	p, err := ParsePathPattern("/users/{uid}/posts/{pid}")
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		path   string
+		ok     bool
+		params map[string]string
+	}{
+		{"/users/alice/posts/p1", true, map[string]string{"uid": "alice", "pid": "p1"}},
+		{"users/alice/posts/p1/", true, map[string]string{"uid": "alice", "pid": "p1"}},
+		{"/users/alice/posts", false, nil},
+		{"/users/alice/posts/p1/title", false, nil},
+		{"/users/alice/likes/p1", false, nil},
+	} {
+		params, ok := p.Match(test.path)
+		assert.Equal(t, test.ok, ok, test.path)
+		assert.Equal(t, test.params, params, test.path)
+	}
+
+	params, ok := p.MatchPrefix("/users/alice")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"uid": "alice"}, params)
+
+	_, ok = p.MatchPrefix("/posts")
+	assert.False(t, ok)
+}
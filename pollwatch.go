@@ -0,0 +1,153 @@
+package firego
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// PollWatch behaves like Watch but, instead of keeping a streaming
+// connection open, it polls the reference every interval and sends the
+// differences found as put events. It is meant for environments where
+// proxies break server-sent events.
+//
+// Requests are conditional on the ETag of the last response so unchanged
+// data is not transferred again. As with Watch, the first event holds the
+// whole value at the reference, only one watch can be running at a time
+// and StopWatching ends it.
+func (fb *Firebase) PollWatch(interval time.Duration, notifications chan Event) error {
+	stop, ok := fb.startWatching()
+	if !ok {
+		close(notifications)
+		return nil
+	}
+
+	etag, data, _, err := fb.poll("")
+	if err != nil {
+		fb.setWatching(false)
+		return err
+	}
+
+	go fb.pollLoop(interval, notifications, stop, etag, data)
+	return nil
+}
+
+// pollLoop sends events until stop is closed or polling
+// fails. It closes notifications on exit.
+func (fb *Firebase) pollLoop(interval time.Duration, notifications chan Event, stop chan struct{}, etag string, data interface{}) {
+	defer close(notifications)
+
+	var seq uint64
+	send := func(event Event) bool {
+		seq++
+		event.Seq = seq
+		select {
+		case notifications <- event:
+			return true
+		case <-stop:
+			return false
+		}
+	}
+
+	if !fb.skipInitial && !send(pollEvent("/", data)) {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		newETag, newData, changed, err := fb.poll(etag)
+		if err != nil {
+			send(Event{Type: EventTypeError, Data: err})
+			return
+		}
+		if !changed {
+			continue
+		}
+
+		for _, event := range pollDiff("", data, newData) {
+			if !send(event) {
+				return
+			}
+		}
+		etag, data = newETag, newData
+	}
+}
+
+// poll reads the value at the reference unless it still matches etag.
+func (fb *Firebase) poll(etag string) (string, interface{}, bool, error) {
+	options := []func(*http.Request){withHeader("X-Firebase-ETag", "true")}
+	if etag != "" {
+		options = append(options, withHeader("if-none-match", etag))
+	}
+
+	headers, body, err := fb.doRequest("GET", nil, options...)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	newETag := headers.Get("ETag")
+	if len(body) == 0 || (etag != "" && newETag == etag) {
+		// not modified
+		return etag, nil, false, nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "", nil, false, err
+	}
+	return newETag, v, true, nil
+}
+
+// pollDiff returns the put events that turn prev into next.
+func pollDiff(path string, prev, next interface{}) []Event {
+	prevMap, prevOK := prev.(map[string]interface{})
+	nextMap, nextOK := next.(map[string]interface{})
+	if !prevOK || !nextOK {
+		if reflect.DeepEqual(prev, next) {
+			return nil
+		}
+		if path == "" {
+			path = "/"
+		}
+		return []Event{pollEvent(path, next)}
+	}
+
+	keys := make([]string, 0, len(prevMap)+len(nextMap))
+	for k := range prevMap {
+		keys = append(keys, k)
+	}
+	for k := range nextMap {
+		if _, ok := prevMap[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var events []Event
+	for _, k := range keys {
+		events = append(events, pollDiff(path+"/"+k, prevMap[k], nextMap[k])...)
+	}
+	return events
+}
+
+func pollEvent(path string, data interface{}) Event {
+	raw, _ := json.Marshal(map[string]interface{}{
+		"path": path,
+		"data": data,
+	})
+	return Event{
+		Type:    EventTypePut,
+		Path:    path,
+		Data:    data,
+		rawData: raw,
+	}
+}
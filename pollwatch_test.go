@@ -0,0 +1,169 @@
+package firego
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func receiveEvent(t *testing.T, notifications chan Event) Event {
+	select {
+	case event, ok := <-notifications:
+		require.True(t, ok, "channel was closed")
+		return event
+	case <-time.After(time.Second):
+		require.FailNow(t, "did not receive a notification")
+	}
+	return Event{}
+}
+
+func TestPollWatch(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("foo", map[string]interface{}{"a": 1, "b": 2})
+
+	fb := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, fb.PollWatch(10*time.Millisecond, notifications))
+
+	event := receiveEvent(t, notifications)
+	assert.Equal(t, EventTypePut, event.Type)
+	assert.Equal(t, "/", event.Path)
+	assert.Equal(t, map[string]interface{}{
+		"foo": map[string]interface{}{"a": 1.0, "b": 2.0},
+	}, event.Data)
+
+	server.Set("foo/a", "x")
+	event = receiveEvent(t, notifications)
+	assert.Equal(t, EventTypePut, event.Type)
+	assert.Equal(t, "/foo/a", event.Path)
+	assert.Equal(t, "x", event.Data)
+	var v string
+	require.NoError(t, event.Value(&v))
+	assert.Equal(t, "x", v)
+
+	server.Delete("foo/b")
+	event = receiveEvent(t, notifications)
+	assert.Equal(t, "/foo/b", event.Path)
+	assert.Nil(t, event.Data)
+	assert.Equal(t, uint64(3), event.Seq)
+
+	// a second watch is rejected
+	second := make(chan Event)
+	require.NoError(t, fb.PollWatch(time.Millisecond, second))
+	_, ok := <-second
+	assert.False(t, ok)
+
+	fb.StopWatching()
+	for range notifications {
+	}
+}
+
+func TestPollWatchSkipInitialSnapshot(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("foo", "bar")
+
+	fb := New(server.URL, nil)
+	fb.SkipInitialSnapshot(true)
+	notifications := make(chan Event)
+	require.NoError(t, fb.PollWatch(time.Millisecond, notifications))
+
+	server.Set("foo", "baz")
+	event := receiveEvent(t, notifications)
+	assert.Equal(t, "/foo", event.Path)
+	assert.Equal(t, "baz", event.Data)
+
+	fb.StopWatching()
+	for range notifications {
+	}
+}
+
+func TestPollWatchNotModified(t *testing.T) {
+	t.Parallel()
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req)
+		w.Header().Set("ETag", "abc")
+		if req.Header.Get("if-none-match") == "abc" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, `"value"`)
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, fb.PollWatch(5*time.Millisecond, notifications))
+
+	event := receiveEvent(t, notifications)
+	assert.Equal(t, "value", event.Data)
+
+	time.Sleep(50 * time.Millisecond)
+	fb.StopWatching()
+	for event := range notifications {
+		assert.Fail(t, "unexpected event", "%v", event)
+	}
+
+	require.True(t, len(requests) > 1)
+	assert.Equal(t, "true", requests[0].Header.Get("X-Firebase-ETag"))
+	assert.Empty(t, requests[0].Header.Get("if-none-match"))
+	assert.Equal(t, "abc", requests[1].Header.Get("if-none-match"))
+}
+
+func TestPollWatchError(t *testing.T) {
+	t.Parallel()
+	var failing int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":"boom"}`)
+			return
+		}
+		fmt.Fprint(w, `null`)
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, fb.PollWatch(5*time.Millisecond, notifications))
+	receiveEvent(t, notifications)
+
+	atomic.StoreInt32(&failing, 1)
+	event := receiveEvent(t, notifications)
+	assert.Equal(t, EventTypeError, event.Type)
+	_, ok := <-notifications
+	assert.False(t, ok)
+
+	// does not block once the poller has given up
+	fb.StopWatching()
+}
+
+func TestPollDiff(t *testing.T) {
+	t.Parallel()
+	prev := map[string]interface{}{"a": 1.0, "b": map[string]interface{}{"c": true}}
+	next := map[string]interface{}{"b": map[string]interface{}{"c": false, "d": "x"}}
+
+	var paths []string
+	for _, event := range pollDiff("", prev, next) {
+		paths = append(paths, event.Path)
+	}
+	assert.Equal(t, []string{"/a", "/b/c", "/b/d"}, paths)
+	assert.Len(t, pollDiff("", prev, prev), 0)
+
+	events := pollDiff("", prev, "scalar")
+	require.Len(t, events, 1)
+	assert.Equal(t, "/", events[0].Path)
+}
@@ -0,0 +1,135 @@
+package firego
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooledBuffer is the capacity above which buffers are dropped instead
+// of being put back in the pool, so that reading a large value once does
+// not keep its memory around.
+const maxPooledBuffer = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer puts a buffer obtained from getBuffer back in the pool.
+// Its bytes must no longer be used.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// pooledBody is a request body held in a pooled buffer, which is put back
+// once the request and the bodies sent by every attempt at it are closed.
+type pooledBody struct {
+	buf  *bytes.Buffer
+	refs int32
+}
+
+// newPooledBody returns the body held in buf,
+// to be closed once the request is done.
+func newPooledBody(buf *bytes.Buffer) *pooledBody {
+	return &pooledBody{buf: buf, refs: 1}
+}
+
+func (b *pooledBody) retain() {
+	atomic.AddInt32(&b.refs, 1)
+}
+
+func (b *pooledBody) release() {
+	if atomic.AddInt32(&b.refs, -1) == 0 {
+		putBuffer(b.buf)
+	}
+}
+
+// reader returns a reader of the body which the
+// transport closes once it is done sending it.
+func (b *pooledBody) reader() io.ReadCloser {
+	b.retain()
+	return &pooledBodyReader{Reader: bytes.NewReader(b.buf.Bytes()), body: b}
+}
+
+// send is an option of doRequest sending the body.
+func (b *pooledBody) send(req *http.Request) {
+	req.Body = b.reader()
+	req.ContentLength = int64(b.buf.Len())
+	req.GetBody = func() (io.ReadCloser, error) {
+		return b.reader(), nil
+	}
+}
+
+// pooledBodyReader reads a pooledBody for a single attempt.
+type pooledBodyReader struct {
+	*bytes.Reader
+	body *pooledBody
+	once sync.Once
+}
+
+func (r *pooledBodyReader) Close() error {
+	r.once.Do(r.body.release)
+	return nil
+}
+
+// maxSizedBody is the size of the largest response body read straight into
+// a slice of the size announced by its Content-Length.
+const maxSizedBody = 8 << 20
+
+// marshalTo appends the JSON of v, like marshal returns it, to buf.
+func marshalTo(buf *bytes.Buffer, v interface{}) error {
+	if v != nil && needsCodec(reflect.TypeOf(v)) {
+		tree, err := toTree(reflect.ValueOf(v))
+		if err != nil {
+			return err
+		}
+		v = tree
+	}
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	// drop the newline written by the encoder
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+// readBody reads a response body of the given Content-Length, -1 if
+// unknown. Bodies of a known size are read straight into a slice of that
+// size, the others through a pooled buffer, of which a copy of the exact
+// size is returned, instead of growing a slice as they are read.
+func readBody(r io.Reader, size int64) ([]byte, error) {
+	if size >= 0 && size <= maxSizedBody {
+		b := make([]byte, size)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		// read up to EOF, for the connection to be reused
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
+}
@@ -0,0 +1,151 @@
+package firego
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalTo(t *testing.T) {
+	t.Parallel()
+	type user struct {
+		Name  string `firebase:"name"`
+		Email string `firebase:"email,omitempty"`
+	}
+	for _, v := range []interface{}{
+		nil,
+		"<b>&</b>",
+		map[string]interface{}{"a": 1, "b": []int{1, 2}},
+		user{Name: "alice"},
+		&user{Name: "bob", Email: "bob@example.com"},
+	} {
+		want, err := marshal(v)
+		require.NoError(t, err)
+
+		buf := getBuffer()
+		require.NoError(t, marshalTo(buf, v))
+		assert.Equal(t, string(want), buf.String())
+		putBuffer(buf)
+	}
+}
+
+func TestPutBuffer(t *testing.T) {
+	t.Parallel()
+	buf := getBuffer()
+	buf.WriteString("data")
+	putBuffer(buf)
+	assert.Equal(t, 0, buf.Len())
+
+	large := bytes.NewBuffer(make([]byte, 0, maxPooledBuffer+1))
+	large.WriteString("data")
+	putBuffer(large)
+	assert.Equal(t, "data", large.String(), "large buffers are dropped")
+}
+
+func TestPooledBody(t *testing.T) {
+	t.Parallel()
+	buf := getBuffer()
+	buf.WriteString("data")
+	body := newPooledBody(buf)
+	req := httptest.NewRequest("PUT", "/", nil)
+	body.send(req)
+	assert.Equal(t, int64(4), req.ContentLength)
+	body.release()
+	assert.Equal(t, "data", buf.String(), "the body is still being sent")
+
+	retry, err := req.GetBody()
+	require.NoError(t, err)
+	require.NoError(t, req.Body.Close())
+	require.NoError(t, req.Body.Close())
+	assert.Equal(t, "data", buf.String(), "the body is still being sent")
+
+	b, err := ioutil.ReadAll(retry)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(b))
+	require.NoError(t, retry.Close())
+	assert.Equal(t, 0, buf.Len(), "the buffer is put back")
+}
+
+func TestPooledBodyRedirect(t *testing.T) {
+	t.Parallel()
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		received = append(received, req.URL.Path+" "+string(b))
+		if req.URL.Path == "/old/.json" {
+			http.Redirect(w, req, "/new/.json", http.StatusTemporaryRedirect)
+			return
+		}
+		w.Write(b)
+	}))
+	defer server.Close()
+
+	require.NoError(t, New(server.URL+"/old", nil).Set("alice"))
+	assert.Equal(t, []string{`/old/.json "alice"`, `/new/.json "alice"`}, received)
+}
+
+func TestReadBody(t *testing.T) {
+	t.Parallel()
+	data := strings.Repeat("x", 3000)
+	for _, size := range []int64{-1, 3000, maxSizedBody + 1} {
+		b, err := readBody(strings.NewReader(data), size)
+		require.NoError(t, err)
+		assert.Equal(t, data, string(b))
+	}
+
+	_, err := readBody(strings.NewReader(data), 4000)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+// bodyKeeper is a transport failing requests without reading their
+// bodies, which are kept to be read later, as transports may.
+type bodyKeeper struct {
+	bodies []io.Reader
+}
+
+func (k *bodyKeeper) RoundTrip(req *http.Request) (*http.Response, error) {
+	k.bodies = append(k.bodies, req.Body)
+	return nil, errors.New("unavailable")
+}
+
+func TestRequestBodyOutlivesRequest(t *testing.T) {
+	t.Parallel()
+	keeper := &bodyKeeper{}
+	fb := New(URL, &http.Client{Transport: keeper})
+	assert.Error(t, fb.Set("first"))
+	assert.Error(t, fb.Update(map[string]string{"second": "2"}))
+	_, err := fb.Push("third")
+	assert.Error(t, err)
+
+	require.Len(t, keeper.bodies, 3)
+	for i, want := range []string{`"first"`, `{"second":"2"}`, `"third"`} {
+		b, err := ioutil.ReadAll(keeper.bodies[i])
+		require.NoError(t, err)
+		assert.Equal(t, want, string(b))
+	}
+}
+
+func BenchmarkSet(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"name":"alice","age":30,"tags":["a","b","c"]}`))
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	v := map[string]interface{}{"name": "alice", "age": 30, "tags": []string{"a", "b", "c"}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := fb.Set(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package firego
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Presence keeps track of which clients are connected to an application.
+//
+// Firebase's REST API has no equivalent to onDisconnect, so instead every
+// client periodically writes a server timestamp under a shared location.
+// A client is considered offline once its heartbeat has not been refreshed
+// for longer than Timeout.
+type Presence struct {
+	// Timeout is how long a heartbeat remains valid for. It defaults to three
+	// times the heartbeat interval.
+	Timeout time.Duration
+
+	fb       *Firebase
+	id       string
+	interval time.Duration
+
+	mtx    sync.Mutex
+	offset time.Duration
+	stop   chan struct{}
+
+	// beatMtx is held while a heartbeat is written, and by Stop while
+	// the entry is removed, after which stopped keeps beat from writing
+	beatMtx sync.Mutex
+	stopped bool
+
+	watchMtx  sync.Mutex
+	watchRef  *Firebase
+	watchStop chan struct{}
+}
+
+// PeerStatus describes the liveness of a single client.
+type PeerStatus struct {
+	// ID of the client
+	ID string
+	// Online is true if the client's heartbeat has not gone stale
+	Online bool
+	// LastSeen is the time of the client's last heartbeat. It is the zero
+	// time if the client has removed itself.
+	LastSeen time.Time
+}
+
+// NewPresence creates a Presence for the client identified by id. Heartbeats
+// are written to fb.Child(id) every interval.
+func NewPresence(fb *Firebase, id string, interval time.Duration) *Presence {
+	return &Presence{
+		Timeout:  3 * interval,
+		fb:       fb,
+		id:       id,
+		interval: interval,
+	}
+}
+
+// Start writes an initial heartbeat and keeps refreshing it in the
+// background until Stop is called.
+func (p *Presence) Start() error {
+	p.beatMtx.Lock()
+	p.stopped = false
+	p.beatMtx.Unlock()
+	if err := p.beat(); err != nil {
+		return err
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.stop != nil {
+		// already running
+		return nil
+	}
+
+	stop := make(chan struct{})
+	p.stop = stop
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := p.beat(); err != nil {
+					log.Printf("Presence: failed to write heartbeat for %s: %s", p.id, err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop halts the heartbeat and removes this client's entry so that
+// other peers see it go offline immediately. A heartbeat being written
+// is waited for, so that it does not write the entry back.
+func (p *Presence) Stop() error {
+	p.mtx.Lock()
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+	p.mtx.Unlock()
+
+	p.beatMtx.Lock()
+	defer p.beatMtx.Unlock()
+	p.stopped = true
+	return p.fb.Child(p.id).Remove()
+}
+
+// Peers reads the current status of every client that has
+// written a heartbeat, ordered by ID.
+func (p *Presence) Peers() ([]PeerStatus, error) {
+	var v map[string]interface{}
+	if err := p.fb.Value(&v); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]time.Time{}
+	for id, val := range v {
+		if t, ok := heartbeatTime(val); ok {
+			seen[id] = t
+		}
+	}
+
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	peers := make([]PeerStatus, len(ids))
+	for i, id := range ids {
+		peers[i] = p.status(id, seen[id])
+	}
+	return peers, nil
+}
+
+// WatchPeers listens for heartbeats and sends a PeerStatus on the given
+// channel whenever a client is first seen or goes online or offline.
+//
+// The channel is closed once StopWatchingPeers is called or the underlying
+// connection is lost, after which WatchPeers can be called again. Statuses
+// not received by then are dropped.
+func (p *Presence) WatchPeers(changes chan PeerStatus) error {
+	p.watchMtx.Lock()
+	if p.watchRef != nil {
+		p.watchMtx.Unlock()
+		close(changes)
+		return nil
+	}
+	ref := p.fb.copy()
+	stop := make(chan struct{})
+	p.watchRef, p.watchStop = ref, stop
+	p.watchMtx.Unlock()
+
+	events := make(chan Event)
+	if err := ref.Watch(events); err != nil {
+		p.watchMtx.Lock()
+		p.watchRef, p.watchStop = nil, nil
+		p.watchMtx.Unlock()
+		return err
+	}
+
+	go func() {
+		defer func() {
+			// let WatchPeers be called again once the connection is lost
+			p.watchMtx.Lock()
+			if p.watchRef == ref {
+				p.watchRef, p.watchStop = nil, nil
+			}
+			p.watchMtx.Unlock()
+			ref.StopWatching()
+			close(changes)
+		}()
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		seen := map[string]time.Time{}
+		reported := map[string]bool{}
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				applyHeartbeatEvent(seen, event)
+			case <-ticker.C:
+			}
+
+			for _, status := range p.diff(seen, reported) {
+				select {
+				case changes <- status:
+				case <-stop:
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// StopWatchingPeers stops the watch started by WatchPeers.
+func (p *Presence) StopWatchingPeers() {
+	p.watchMtx.Lock()
+	ref, stop := p.watchRef, p.watchStop
+	p.watchRef, p.watchStop = nil, nil
+	p.watchMtx.Unlock()
+
+	if ref != nil {
+		close(stop)
+		ref.StopWatching()
+	}
+}
+
+func (p *Presence) beat() error {
+	p.beatMtx.Lock()
+	defer p.beatMtx.Unlock()
+	if p.stopped {
+		return nil
+	}
+
+	sent := time.Now()
+	_, body, err := p.fb.Child(p.id).doRequest("PUT", []byte(`{".sv":"timestamp"}`))
+	if err != nil {
+		return err
+	}
+
+	// Firebase echoes back the resolved timestamp, use it to work out
+	// how far our clock is from the server's.
+	var ms float64
+	if err := json.Unmarshal(body, &ms); err == nil {
+		rtt := time.Since(sent)
+		p.mtx.Lock()
+		p.offset = millisToTime(ms).Sub(sent.Add(rtt / 2))
+		p.mtx.Unlock()
+	}
+	return nil
+}
+
+func (p *Presence) status(id string, lastSeen time.Time) PeerStatus {
+	p.mtx.Lock()
+	now := time.Now().Add(p.offset)
+	p.mtx.Unlock()
+
+	return PeerStatus{
+		ID:       id,
+		Online:   !lastSeen.IsZero() && now.Sub(lastSeen) <= p.Timeout,
+		LastSeen: lastSeen,
+	}
+}
+
+// diff returns the statuses that have changed since they were last reported
+// and records them as reported.
+func (p *Presence) diff(seen map[string]time.Time, reported map[string]bool) []PeerStatus {
+	var changed []PeerStatus
+	for id, lastSeen := range seen {
+		status := p.status(id, lastSeen)
+		if online, ok := reported[id]; ok && online == status.Online {
+			continue
+		}
+		reported[id] = status.Online
+		changed = append(changed, status)
+	}
+
+	for id, online := range reported {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		// the client removed itself
+		delete(reported, id)
+		if online {
+			changed = append(changed, PeerStatus{ID: id})
+		}
+	}
+
+	sort.Slice(changed, func(i, j int) bool { return changed[i].ID < changed[j].ID })
+	return changed
+}
+
+func applyHeartbeatEvent(seen map[string]time.Time, event Event) {
+	path := strings.Trim(event.Path, "/")
+	switch {
+	case event.Type == EventTypePut && path == "":
+		for id := range seen {
+			delete(seen, id)
+		}
+		fallthrough
+	case event.Type == EventTypePatch && path == "":
+		m, _ := event.Data.(map[string]interface{})
+		for id, v := range m {
+			setHeartbeat(seen, id, v)
+		}
+	case event.Type == EventTypePut && !strings.Contains(path, "/"):
+		setHeartbeat(seen, path, event.Data)
+	}
+}
+
+func setHeartbeat(seen map[string]time.Time, id string, v interface{}) {
+	if t, ok := heartbeatTime(v); ok {
+		seen[id] = t
+		return
+	}
+	delete(seen, id)
+}
+
+func heartbeatTime(v interface{}) (time.Time, bool) {
+	ms, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return millisToTime(ms), true
+}
@@ -0,0 +1,233 @@
+package firego
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestPresenceStart(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	p := NewPresence(New(server.URL+"/presence", nil), "alice", time.Minute)
+	require.NoError(t, p.Start())
+	defer p.Stop()
+
+	v, ok := server.Get("presence/alice").(float64)
+	require.True(t, ok, "heartbeat was not a timestamp")
+	assert.True(t, int64(v) >= before)
+}
+
+func TestPresenceStop(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	p := NewPresence(New(server.URL+"/presence", nil), "alice", time.Minute)
+	require.NoError(t, p.Start())
+	require.NoError(t, p.Stop())
+
+	assert.Nil(t, server.Get("presence/alice"))
+}
+
+func TestPresenceStopDuringHeartbeat(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	inBeat := make(chan struct{})
+	release := make(chan struct{})
+	var beats int32
+	fb := New(server.URL+"/presence", nil)
+	fb.BeforeSend(func(req *http.Request, body []byte) error {
+		// hold the first heartbeat following the initial one
+		if req.Method == "PUT" && atomic.AddInt32(&beats, 1) == 2 {
+			close(inBeat)
+			<-release
+		}
+		return nil
+	})
+
+	p := NewPresence(fb, "alice", 10*time.Millisecond)
+	require.NoError(t, p.Start())
+	<-inBeat
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- p.Stop()
+	}()
+	select {
+	case <-stopped:
+		require.FailNow(t, "Stop did not wait for the heartbeat")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	require.NoError(t, <-stopped)
+
+	// no heartbeat brings the entry back
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, server.Get("presence/alice"))
+}
+
+func TestPresencePeers(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	stale := time.Now().Add(-time.Hour).UnixNano() / int64(time.Millisecond)
+	server.Set("presence/bob", stale)
+
+	p := NewPresence(New(server.URL+"/presence", nil), "alice", time.Minute)
+	require.NoError(t, p.Start())
+	defer p.Stop()
+
+	peers, err := p.Peers()
+	require.NoError(t, err)
+	require.Len(t, peers, 2)
+
+	assert.Equal(t, "alice", peers[0].ID)
+	assert.True(t, peers[0].Online)
+	assert.Equal(t, "bob", peers[1].ID)
+	assert.False(t, peers[1].Online)
+	assert.Equal(t, stale, peers[1].LastSeen.UnixNano()/int64(time.Millisecond))
+}
+
+func TestPresenceWatchPeers(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL+"/presence", nil)
+	watcher := NewPresence(fb, "watcher", time.Minute)
+	changes := make(chan PeerStatus)
+	require.NoError(t, watcher.WatchPeers(changes))
+	defer watcher.StopWatchingPeers()
+
+	alice := NewPresence(fb, "alice", time.Minute)
+	require.NoError(t, alice.Start())
+
+	select {
+	case status := <-changes:
+		assert.Equal(t, "alice", status.ID)
+		assert.True(t, status.Online)
+	case <-time.After(time.Second):
+		require.FailNow(t, "did not receive online status")
+	}
+
+	require.NoError(t, alice.Stop())
+
+	select {
+	case status := <-changes:
+		assert.Equal(t, "alice", status.ID)
+		assert.False(t, status.Online)
+	case <-time.After(time.Second):
+		require.FailNow(t, "did not receive offline status")
+	}
+}
+
+func TestPresenceStopWatchingPeersUnread(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL+"/presence", nil)
+	watcher := NewPresence(fb, "watcher", time.Minute)
+	changes := make(chan PeerStatus)
+	require.NoError(t, watcher.WatchPeers(changes))
+
+	alice := NewPresence(fb, "alice", time.Minute)
+	require.NoError(t, alice.Start())
+	defer alice.Stop()
+
+	// leave the online status of alice unread
+	time.Sleep(100 * time.Millisecond)
+	watcher.StopWatchingPeers()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case status, ok := <-changes:
+			require.False(t, ok, "received %+v after StopWatchingPeers", status)
+			return
+		case <-timeout:
+			require.FailNow(t, "changes was not closed")
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestPresenceWatchPeersAfterConnectionLost(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL+"/presence", nil)
+	watcher := NewPresence(fb, "watcher", time.Minute)
+	changes := make(chan PeerStatus)
+	require.NoError(t, watcher.WatchPeers(changes))
+
+	watcher.watchMtx.Lock()
+	lost := watcher.watchRef
+	watcher.watchMtx.Unlock()
+	lost.StopWatching()
+
+	select {
+	case _, ok := <-changes:
+		require.False(t, ok)
+	case <-time.After(time.Second):
+		require.FailNow(t, "changes was not closed")
+	}
+
+	changes = make(chan PeerStatus)
+	require.NoError(t, watcher.WatchPeers(changes))
+	defer watcher.StopWatchingPeers()
+
+	alice := NewPresence(fb, "alice", time.Minute)
+	require.NoError(t, alice.Start())
+	defer alice.Stop()
+
+	select {
+	case status, ok := <-changes:
+		require.True(t, ok, "changes was closed")
+		assert.Equal(t, "alice", status.ID)
+		assert.True(t, status.Online)
+	case <-time.After(time.Second):
+		require.FailNow(t, "did not receive online status")
+	}
+}
+
+func TestPresenceDiffStale(t *testing.T) {
+	t.Parallel()
+	p := NewPresence(New(URL, nil), "alice", time.Second)
+	seen := map[string]time.Time{
+		"bob": time.Now(),
+	}
+	reported := map[string]bool{}
+
+	changed := p.diff(seen, reported)
+	require.Len(t, changed, 1)
+	assert.True(t, changed[0].Online)
+
+	assert.Empty(t, p.diff(seen, reported))
+
+	seen["bob"] = time.Now().Add(-time.Minute)
+	changed = p.diff(seen, reported)
+	require.Len(t, changed, 1)
+	assert.False(t, changed[0].Online)
+}
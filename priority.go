@@ -0,0 +1,41 @@
+package firego
+
+import "context"
+
+// Priority tells how urgent the requests of a reference are, for an
+// AdaptiveLimiter to schedule them under contention.
+type Priority int
+
+const (
+	// PriorityInteractive is the priority of requests someone is waiting
+	// on, such as user-facing reads. This is the default.
+	PriorityInteractive Priority = iota
+	// PriorityBatch is the priority of bulk traffic, such as imports,
+	// which gives way to interactive requests.
+	PriorityBatch
+)
+
+// priorityKey is the context key of the priority of a request.
+type priorityKey struct{}
+
+// WithPriority returns a copy of the reference whose requests have the
+// given priority, so that bulk imports do not starve the user-facing
+// reads of the same process:
+//
+//    limiter := firego.NewAdaptiveLimiter(20, 200)
+//    fb = limiter.Guard(fb)
+//    batch := fb.WithPriority(firego.PriorityBatch)
+//
+// Priorities only apply to requests subject to an AdaptiveLimiter. The
+// references derived from it have the same priority.
+func (fb *Firebase) WithPriority(p Priority) *Firebase {
+	c := fb.copy()
+	c.priority = p
+	return c
+}
+
+// requestPriority returns the priority of the request with the given context.
+func requestPriority(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
@@ -0,0 +1,224 @@
+package firego
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// profileBuckets is the number of buckets a window is split into, the
+// oldest bucket being dropped at once when it leaves the window.
+const profileBuckets = 12
+
+// PrefixBandwidth is the traffic of the locations under a path prefix.
+type PrefixBandwidth struct {
+	// Prefix is the path the locations are under, e.g. "/users".
+	Prefix string
+	// Requests is the number of requests sent.
+	Requests int64
+	// BytesRead is the size of the response bodies, including
+	// the events received while watching.
+	BytesRead int64
+	// BytesWritten is the size of the request bodies.
+	BytesWritten int64
+}
+
+// Bytes returns the number of bytes read and written.
+func (b PrefixBandwidth) Bytes() int64 {
+	return b.BytesRead + b.BytesWritten
+}
+
+// BandwidthStats is a snapshot of the traffic recorded by a
+// BandwidthProfiler over its window.
+type BandwidthStats struct {
+	// Prefixes holds the prefixes with the most traffic, the
+	// busiest first.
+	Prefixes []PrefixBandwidth
+	// Other sums up the traffic of the remaining prefixes.
+	Other PrefixBandwidth
+}
+
+// BandwidthProfiler records the size of the payloads sent and received
+// by references, grouped by path prefix, to find out which parts of the
+// database make up most of the traffic:
+//
+//    p := firego.NewBandwidthProfiler(2, time.Hour)
+//    fb = p.Profile(fb)
+//    ...
+//    for _, prefix := range p.Stats().Prefixes {
+//        log.Printf("%s: %d bytes", prefix.Prefix, prefix.Bytes())
+//    }
+//
+// Traffic is only kept for the duration of the window.
+type BandwidthProfiler struct {
+	// TopN is the number of prefixes reported by Stats. It defaults to 10.
+	TopN int
+
+	depth  int
+	window time.Duration
+	now    func() time.Time
+
+	mtx     sync.Mutex
+	buckets []*profileBucket
+}
+
+type profileBucket struct {
+	start    time.Time
+	prefixes map[string]*PrefixBandwidth
+}
+
+// NewBandwidthProfiler creates a BandwidthProfiler grouping traffic by
+// the first depth segments of paths, at least one, and keeping it for
+// window, one hour if it is not positive.
+func NewBandwidthProfiler(depth int, window time.Duration) *BandwidthProfiler {
+	if depth < 1 {
+		depth = 1
+	}
+	if window <= 0 {
+		window = time.Hour
+	}
+	return &BandwidthProfiler{TopN: 10, depth: depth, window: window, now: time.Now}
+}
+
+// Profile returns a copy of the reference whose traffic, and the traffic
+// of the references derived from it, is recorded by the profiler.
+func (p *BandwidthProfiler) Profile(fb *Firebase) *Firebase {
+	ref := fb.copy()
+	client := *ref.client
+	client.Transport = &profileTransport{base: client.Transport, p: p}
+	ref.client = &client
+	return ref
+}
+
+// Stats returns the traffic recorded over the window.
+func (p *BandwidthProfiler) Stats() BandwidthStats {
+	p.mtx.Lock()
+	totals := map[string]*PrefixBandwidth{}
+	for _, b := range p.current() {
+		for prefix, bw := range b.prefixes {
+			total, ok := totals[prefix]
+			if !ok {
+				total = &PrefixBandwidth{Prefix: prefix}
+				totals[prefix] = total
+			}
+			total.Requests += bw.Requests
+			total.BytesRead += bw.BytesRead
+			total.BytesWritten += bw.BytesWritten
+		}
+	}
+	p.mtx.Unlock()
+
+	prefixes := make([]PrefixBandwidth, 0, len(totals))
+	for _, bw := range totals {
+		prefixes = append(prefixes, *bw)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		if prefixes[i].Bytes() != prefixes[j].Bytes() {
+			return prefixes[i].Bytes() > prefixes[j].Bytes()
+		}
+		return prefixes[i].Prefix < prefixes[j].Prefix
+	})
+
+	var stats BandwidthStats
+	for i, bw := range prefixes {
+		if i < p.TopN {
+			stats.Prefixes = append(stats.Prefixes, bw)
+			continue
+		}
+		stats.Other.Requests += bw.Requests
+		stats.Other.BytesRead += bw.BytesRead
+		stats.Other.BytesWritten += bw.BytesWritten
+	}
+	return stats
+}
+
+// record adds traffic to the given prefix.
+func (p *BandwidthProfiler) record(prefix string, requests, read, written int64) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	now := p.now()
+	buckets := p.current()
+	if len(buckets) == 0 || now.Sub(buckets[len(buckets)-1].start) >= p.window/profileBuckets {
+		buckets = append(buckets, &profileBucket{start: now, prefixes: map[string]*PrefixBandwidth{}})
+	}
+	p.buckets = buckets
+
+	b := buckets[len(buckets)-1]
+	bw, ok := b.prefixes[prefix]
+	if !ok {
+		bw = &PrefixBandwidth{Prefix: prefix}
+		b.prefixes[prefix] = bw
+	}
+	bw.Requests += requests
+	bw.BytesRead += read
+	bw.BytesWritten += written
+}
+
+// current drops the buckets that left the window and returns the others.
+func (p *BandwidthProfiler) current() []*profileBucket {
+	cutoff := p.now().Add(-p.window)
+	i := 0
+	for i < len(p.buckets) && !p.buckets[i].start.After(cutoff) {
+		i++
+	}
+	p.buckets = p.buckets[i:]
+	return p.buckets
+}
+
+// prefix returns the prefix the traffic of the request is grouped by.
+func (p *BandwidthProfiler) prefix(req *http.Request) string {
+	path := strings.TrimSuffix(req.URL.EscapedPath(), ".json")
+	segments := splitPath(path)
+	if len(segments) > p.depth {
+		segments = segments[:p.depth]
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// profileTransport records the traffic of requests in a profiler.
+type profileTransport struct {
+	base http.RoundTripper
+	p    *BandwidthProfiler
+}
+
+func (tr *profileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := tr.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	prefix := tr.p.prefix(req)
+	var written int64
+	if req.ContentLength > 0 {
+		written = req.ContentLength
+	}
+	tr.p.record(prefix, 1, 0, written)
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, fn: func(n int) {
+		tr.p.record(prefix, 0, int64(n), 0)
+	}}
+	return resp, nil
+}
+
+// countingBody reports the number of bytes read from a response body
+// as they are read, which keeps counting streamed events.
+type countingBody struct {
+	io.ReadCloser
+	fn func(n int)
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.fn(n)
+	}
+	return n, err
+}
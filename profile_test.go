@@ -0,0 +1,52 @@
+package firego
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestBandwidthProfiler(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	now := time.Now()
+	p := NewBandwidthProfiler(2, time.Hour)
+	p.now = func() time.Time { return now }
+	p.TopN = 2
+	fb := p.Profile(New(server.URL, nil))
+
+	require.NoError(t, fb.Child("users/alice/profile").Set(map[string]string{"name": "alice"}))
+	require.NoError(t, fb.Child("users/alice").Set(map[string]string{"name": "alice2"}))
+	require.NoError(t, fb.Child("users/bob").Set("bob"))
+	require.NoError(t, fb.Child("logs").Set("x"))
+	var v interface{}
+	require.NoError(t, fb.Child("users/alice").Value(&v))
+
+	stats := p.Stats()
+	require.Len(t, stats.Prefixes, 2)
+	alice := stats.Prefixes[0]
+	assert.Equal(t, "/users/alice", alice.Prefix)
+	assert.Equal(t, int64(3), alice.Requests)
+	assert.Equal(t, int64(len(`{"name":"alice"}`)+len(`{"name":"alice2"}`)), alice.BytesWritten)
+	// the writes are echoed back, and what was read ends with a newline
+	assert.Equal(t, int64(len(`{"name":"alice"}`)+len(`{"name":"alice2"}`)*2+1), alice.BytesRead)
+	assert.Equal(t, "/users/bob", stats.Prefixes[1].Prefix)
+	assert.Equal(t, int64(1), stats.Other.Requests)
+	assert.Equal(t, int64(len(`"x"`)), stats.Other.BytesWritten)
+
+	// traffic leaves the window over time
+	now = now.Add(40 * time.Minute)
+	require.NoError(t, fb.Child("logs").Set("y"))
+	now = now.Add(30 * time.Minute)
+	stats = p.Stats()
+	require.Len(t, stats.Prefixes, 1)
+	assert.Equal(t, "/logs", stats.Prefixes[0].Prefix)
+	assert.Equal(t, int64(1), stats.Prefixes[0].Requests)
+	assert.Zero(t, stats.Other)
+}
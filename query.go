@@ -1,6 +1,7 @@
 package firego
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -165,6 +166,34 @@ func (fb *Firebase) EqualToValue(value interface{}) *Firebase {
 	return c
 }
 
+// prefixSentinel is the highest code point Firebase sorts strings
+// by, so that every string starting with a prefix sorts between the
+// prefix and the prefix followed by the sentinel.
+const prefixSentinel = "\uf8ff"
+
+// SearchPrefix creates a new Firebase reference querying the first limit
+// children whose child, or key if child is "$key", is a string starting
+// with prefix. Children are listed in the order of child, and all of the
+// matching children are returned if limit is not positive.
+//
+//    SearchPrefix("name", "Jo", 10) // -> orderBy="name"&startAt="Jo"&endAt="Jo\uf8ff"&limitToFirst=10
+//
+// The prefix is always queried as a string, even if it looks like a number.
+func (fb *Firebase) SearchPrefix(child, prefix string, limit int64) *Firebase {
+	c := fb.OrderBy(child).LimitToFirst(limit)
+	c.params.Set(startAtParam, jsonString(prefix))
+	c.params.Set(endAtParam, jsonString(prefix+prefixSentinel))
+	c.params.Del(equalToParam)
+	c.params.Del(limitToLastParam)
+	return c
+}
+
+// jsonString returns s as a JSON string.
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
 func escapeString(s string) string {
 	_, errNotInt := strconv.ParseInt(s, 10, 64)
 	_, errNotBool := strconv.ParseBool(s)
@@ -235,6 +264,14 @@ func (fb *Firebase) Shallow(v bool) {
 // IncludePriority determines whether or not to ask Firebase
 // for the values priority. By default, the priority is not returned.
 //
+// Values read with priorities are decoded as usual, the priority of a
+// struct's location being stored into its field tagged "$priority":
+//
+//    type Player struct {
+//        Name  string      `firebase:"name"`
+//        Score interface{} `firebase:"$priority"`
+//    }
+//
 // Reference https://www.firebase.com/docs/rest/api/#section-param-format
 func (fb *Firebase) IncludePriority(v bool) {
 	fb.paramsMtx.Lock()
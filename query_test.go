@@ -5,6 +5,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
 )
 
 func TestShallow(t *testing.T) {
@@ -282,3 +283,46 @@ func TestEscapeParameter(t *testing.T) {
 		assert.Equal(t, testCase.expected, escapeParameter(testCase.value))
 	}
 }
+
+func TestSearchPrefix(t *testing.T) {
+	t.Parallel()
+	var (
+		server = newTestServer("")
+		fb     = New(server.URL, nil)
+	)
+	defer server.Close()
+
+	fb.SearchPrefix("name", `12"a`, 10).Value("")
+	require.Len(t, server.receivedReqs, 1)
+
+	query := server.receivedReqs[0].URL.Query()
+	assert.Equal(t, `"name"`, query.Get(orderByParam))
+	assert.Equal(t, `"12\"a"`, query.Get(startAtParam))
+	assert.Equal(t, `"12\"a`+prefixSentinel+`"`, query.Get(endAtParam))
+	assert.Equal(t, "10", query.Get(limitToFirstParam))
+}
+
+func TestSearchPrefixResults(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users", map[string]interface{}{
+		"1": map[string]interface{}{"name": "Joe"},
+		"2": map[string]interface{}{"name": "John"},
+		"3": map[string]interface{}{"name": "Jo"},
+		"4": map[string]interface{}{"name": "Jp"},
+		"5": map[string]interface{}{"name": "Al"},
+	})
+
+	var v map[string]interface{}
+	require.NoError(t, New(server.URL, nil).Child("users").SearchPrefix("name", "Jo", 0).Value(&v))
+	assert.Len(t, v, 3)
+	for _, key := range []string{"1", "2", "3"} {
+		assert.Contains(t, v, key)
+	}
+
+	v = nil
+	require.NoError(t, New(server.URL, nil).Child("users").SearchPrefix("name", "Jo", 2).Value(&v))
+	assert.Len(t, v, 2)
+}
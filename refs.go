@@ -0,0 +1,385 @@
+package firego
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// refWorkers is the number of locations ResolveRefs reads at once.
+const refWorkers = 8
+
+// ResolveRefs reads the locations referenced by the fields of v, a
+// pointer to a struct or to a slice or map of structs, and decodes them
+// into these fields, following the usual denormalization of data where a
+// location stores the keys of the locations it refers to rather than
+// copies of their data:
+//
+//    type User struct {
+//        UID  string `firebase:"$key"`
+//        Name string `firebase:"name"`
+//    }
+//
+//    type Post struct {
+//        Title   string           `firebase:"title"`
+//        Author  *User            `firebase:"author,ref:/users/{uid}"`
+//        Readers map[string]*User `firebase:"readers,ref:/users/{uid}"`
+//    }
+//
+//    var posts []Post
+//    if err := fb.Child("posts").Value(&posts); err != nil {
+//        log.Fatal(err)
+//    }
+//    if err := fb.ResolveRefs(&posts); err != nil {
+//        log.Fatal(err)
+//    }
+//
+// A reference field is tagged with the "ref:" option followed by the path
+// template, relative to fb, of the locations it refers to, the single
+// wildcard of the template standing for the key stored. Reference fields
+// may be a struct or a pointer to one, stored as the key held by their
+// "$key" field, or a slice or map of these, stored as an object whose
+// keys are the ones referred to, each set to true. Decoding a reference
+// field only sets the "$key" field of the values it holds.
+//
+// The locations are read concurrently, each of them once however many
+// fields refer to it. The references of the values read are not resolved,
+// call ResolveRefs again to resolve them as well.
+func (fb *Firebase) ResolveRefs(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("firego: ResolveRefs needs a non-nil pointer, got %T", v)
+	}
+
+	r := &refResolver{targets: map[string][]refTarget{}}
+	if err := r.walk(rv.Elem()); err != nil {
+		return err
+	}
+	if err := r.fetch(fb); err != nil {
+		return err
+	}
+	for _, fixup := range r.fixups {
+		fixup()
+	}
+	return nil
+}
+
+// refResolver collects the values reference fields hold.
+type refResolver struct {
+	// targets are the values to decode the location at each path into
+	targets map[string][]refTarget
+	// fixups store back the copies of the map elements
+	// walked, which can not be modified in place
+	fixups []func()
+}
+
+// refTarget is a value of a reference field, with its key.
+type refTarget struct {
+	key string
+	v   reflect.Value
+}
+
+// walk collects the values of the reference fields of v and of the
+// values it holds. v must be addressable.
+func (r *refResolver) walk(v reflect.Value) error {
+	if !v.IsValid() || !needsCodec(v.Type()) {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return r.walk(v.Elem())
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := r.walk(v.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(k))
+			if err := r.walk(elem); err != nil {
+				return err
+			}
+			if elem.Kind() != reflect.Ptr {
+				m, k := v, k
+				r.fixups = append(r.fixups, func() { m.SetMapIndex(k, elem) })
+			}
+		}
+
+	case reflect.Struct:
+		for _, f := range fieldsOf(v.Type()) {
+			fv, ok := fieldByIndex(v, f.index, false)
+			if !ok {
+				continue
+			}
+			if f.ref == "" {
+				if err := r.walk(fv); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := r.collect(f.ref, fv); err != nil {
+				return fmt.Errorf("firego: cannot resolve %q: %w", f.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// collect adds the values held by the reference field v,
+// referring to the locations matching template.
+func (r *refResolver) collect(template string, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return r.add(template, v.Elem())
+
+	case reflect.Struct:
+		return r.add(template, v)
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := r.collect(template, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(k))
+			if err := r.collect(template, elem); err != nil {
+				return err
+			}
+			if elem.Kind() != reflect.Ptr {
+				m, k := v, k
+				r.fixups = append(r.fixups, func() { m.SetMapIndex(k, elem) })
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid reference type %s", v.Type())
+}
+
+// add adds the struct v, referring to the location
+// matching template whose key v holds.
+func (r *refResolver) add(template string, v reflect.Value) error {
+	key := keyOf(v)
+	if key == "" {
+		return nil
+	}
+	path, err := refLocation(template, key)
+	if err != nil {
+		return err
+	}
+	r.targets[path] = append(r.targets[path], refTarget{key: key, v: v})
+	return nil
+}
+
+// fetch reads the location of every target and decodes it into them.
+func (r *refResolver) fetch(fb *Firebase) error {
+	paths := make(chan string)
+	var (
+		wg       sync.WaitGroup
+		mtx      sync.Mutex
+		firstErr error
+	)
+	workers := refWorkers
+	if len(r.targets) < workers {
+		workers = len(r.targets)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				if err := r.resolve(fb, path); err != nil {
+					mtx.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mtx.Unlock()
+				}
+			}
+		}()
+	}
+
+	sorted := make([]string, 0, len(r.targets))
+	for path := range r.targets {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+	for _, path := range sorted {
+		paths <- path
+	}
+	close(paths)
+	wg.Wait()
+	return firstErr
+}
+
+// resolve reads the location at path and decodes it into its targets.
+func (r *refResolver) resolve(fb *Firebase, path string) error {
+	ref := fb.Child(path)
+	_, body, err := ref.getValue()
+	if err != nil {
+		return err
+	}
+	for _, t := range r.targets[path] {
+		if err := ref.decode(body, t.v.Addr().Interface()); err != nil {
+			return fmt.Errorf("firego: cannot decode %q: %w", path, err)
+		}
+		setKey(t.v, t.key)
+	}
+	return nil
+}
+
+// refLocation returns the path of the location matching
+// template whose wildcard stands for key.
+func refLocation(template, key string) (string, error) {
+	p, err := ParsePathPattern(template)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(key, "/") {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+
+	segments := make([]string, len(p.segments))
+	var wildcards int
+	for i, s := range p.segments {
+		segments[i] = s
+		if _, wildcard := wildcardName(s); wildcard {
+			segments[i] = key
+			wildcards++
+		}
+	}
+	if wildcards != 1 {
+		return "", fmt.Errorf("template %q must have a single wildcard", template)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// refKeys returns the keys of the values held by the reference
+// field v, as they are stored, or nil if it holds none.
+func refKeys(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Struct:
+		if key := keyOf(v); key != "" {
+			return key
+		}
+		return nil
+
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			return nil
+		}
+		keys := make(map[string]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if key := keyOf(v.Index(i)); key != "" {
+				keys[key] = true
+			}
+		}
+		return keys
+
+	case reflect.Map:
+		if v.Len() == 0 {
+			return nil
+		}
+		keys := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			keys[fmt.Sprint(k.Interface())] = true
+		}
+		return keys
+	}
+	return nil
+}
+
+// refsFromTree stores into the reference field v values holding the
+// keys of tree, as stored by refKeys.
+func refsFromTree(tree interface{}, v reflect.Value) error {
+	if tree == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Struct:
+		key, ok := tree.(string)
+		if !ok {
+			return typeError(tree, v.Type())
+		}
+		v.Set(keyedValue(v.Type(), key))
+		return nil
+
+	case reflect.Slice:
+		var keys []string
+		switch tree := tree.(type) {
+		case map[string]interface{}:
+			for k := range tree {
+				if k != ".priority" {
+					keys = append(keys, k)
+				}
+			}
+			sort.Slice(keys, func(i, j int) bool {
+				return compareKeys(keys[i], keys[j]) < 0
+			})
+		case []interface{}:
+			for _, k := range tree {
+				if k, ok := k.(string); ok {
+					keys = append(keys, k)
+				}
+			}
+		default:
+			return typeError(tree, v.Type())
+		}
+		slice := reflect.MakeSlice(v.Type(), len(keys), len(keys))
+		for i, k := range keys {
+			slice.Index(i).Set(keyedValue(v.Type().Elem(), k))
+		}
+		v.Set(slice)
+		return nil
+
+	case reflect.Map:
+		m, ok := tree.(map[string]interface{})
+		if !ok {
+			return typeError(tree, v.Type())
+		}
+		refs := reflect.MakeMapWithSize(v.Type(), len(m))
+		for k := range m {
+			if k == ".priority" {
+				continue
+			}
+			key, err := mapKey(k, v.Type().Key())
+			if err != nil {
+				return err
+			}
+			refs.SetMapIndex(key, keyedValue(v.Type().Elem(), k))
+		}
+		v.Set(refs)
+		return nil
+	}
+	return typeError(tree, v.Type())
+}
+
+// keyedValue returns a new value of type t, a struct or a pointer
+// to one, whose "$key" field holds key.
+func keyedValue(t reflect.Type, key string) reflect.Value {
+	v := reflect.New(t).Elem()
+	if t.Kind() == reflect.Ptr {
+		v.Set(reflect.New(t.Elem()))
+	}
+	setKey(v, key)
+	return v
+}
@@ -0,0 +1,119 @@
+package firego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+type refUser struct {
+	UID  string `firebase:"$key"`
+	Name string `firebase:"name"`
+}
+
+type refPost struct {
+	Title   string             `firebase:"title"`
+	Author  *refUser           `firebase:"author,ref:/users/{uid}"`
+	Editor  refUser            `firebase:"ref:/users/{uid}"`
+	Readers map[string]refUser `firebase:"readers,ref:/users/{uid},omitempty"`
+	Likes   []*refUser         `firebase:"likes,ref:/users/{uid},omitempty"`
+}
+
+func TestRefsCodec(t *testing.T) {
+	t.Parallel()
+
+	post := refPost{
+		Title:   "hello",
+		Author:  &refUser{UID: "alice", Name: "Alice"},
+		Editor:  refUser{UID: "bob"},
+		Readers: map[string]refUser{"bob": {}, "carol": {}},
+	}
+	b, err := marshal(post)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"title": "hello",
+		"author": "alice",
+		"Editor": "bob",
+		"readers": {"bob": true, "carol": true}
+	}`, string(b))
+
+	var decoded refPost
+	require.NoError(t, unmarshal([]byte(`{
+		"title": "hello",
+		"author": "alice",
+		"Editor": null,
+		"readers": {"bob": true},
+		"likes": {"carol": true, "bob": true}
+	}`), &decoded))
+	assert.Equal(t, refPost{
+		Title:   "hello",
+		Author:  &refUser{UID: "alice"},
+		Readers: map[string]refUser{"bob": {UID: "bob"}},
+		Likes:   []*refUser{{UID: "bob"}, {UID: "carol"}},
+	}, decoded)
+
+	assert.Error(t, unmarshal([]byte(`{"author": {"name": "Alice"}}`), &decoded))
+}
+
+func TestResolveRefs(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("users", map[string]interface{}{
+		"alice": map[string]interface{}{"name": "Alice"},
+		"bob":   map[string]interface{}{"name": "Bob"},
+		"carol": map[string]interface{}{"name": "Carol"},
+	})
+	server.Set("posts", map[string]interface{}{
+		"p1": map[string]interface{}{
+			"title":   "first",
+			"author":  "alice",
+			"Editor":  "bob",
+			"readers": map[string]interface{}{"bob": true, "carol": true},
+		},
+		"p2": map[string]interface{}{
+			"title":  "second",
+			"author": "bob",
+			"likes":  map[string]interface{}{"alice": true, "dave": true},
+		},
+	})
+
+	fb := New(server.URL, nil)
+	var posts map[string]refPost
+	require.NoError(t, fb.Child("posts").Value(&posts))
+	require.NoError(t, fb.ResolveRefs(&posts))
+
+	assert.Equal(t, map[string]refPost{
+		"p1": {
+			Title:  "first",
+			Author: &refUser{UID: "alice", Name: "Alice"},
+			Editor: refUser{UID: "bob", Name: "Bob"},
+			Readers: map[string]refUser{
+				"bob":   {UID: "bob", Name: "Bob"},
+				"carol": {UID: "carol", Name: "Carol"},
+			},
+		},
+		"p2": {
+			Title:  "second",
+			Author: &refUser{UID: "bob", Name: "Bob"},
+			Likes:  []*refUser{{UID: "alice", Name: "Alice"}, {UID: "dave"}},
+		},
+	}, posts)
+
+	var post refPost
+	require.NoError(t, fb.Child("posts/p2").Value(&post))
+	require.NoError(t, fb.ResolveRefs(&post))
+	assert.Equal(t, "Bob", post.Author.Name)
+
+	assert.Error(t, fb.ResolveRefs(post))
+
+	type badRef struct {
+		User *refUser `firebase:"user,ref:/users"`
+	}
+	bad := badRef{User: &refUser{UID: "alice"}}
+	assert.Error(t, fb.ResolveRefs(&bad))
+}
@@ -0,0 +1,202 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/zabawaba99/firego/sync"
+)
+
+// ConflictPolicy determines what Replicate does when the target has been
+// modified by someone other than the replicator.
+type ConflictPolicy int
+
+const (
+	// ConflictSourceWins overwrites changes made directly to the target.
+	ConflictSourceWins ConflictPolicy = iota
+	// ConflictTargetWins skips changes to locations that were modified
+	// directly on the target.
+	ConflictTargetWins
+)
+
+// ReplicateOptions configures how Replicate applies changes.
+type ReplicateOptions struct {
+	// Conflicts determines what happens when the target has
+	// been modified by someone else.
+	Conflicts ConflictPolicy
+	// OnConflict is called with the path of every change that is skipped
+	// because of a conflict.
+	OnConflict func(path string)
+	// OnError is called when a change can not be applied to the target.
+	// Returning nil skips the change, returning an error stops replication.
+	// If nil, replication stops on the first error.
+	OnError func(path string, err error) error
+	// RetryDelay is how long to wait before reconnecting to the source after
+	// the stream is lost. Defaults to one second.
+	RetryDelay time.Duration
+}
+
+// errStreamLost is returned internally when the source stream
+// needs to be re-established.
+var errStreamLost = errors.New("stream lost")
+
+// Replicate copies the data under src into dst and then keeps dst in sync by
+// applying every change made to src. It blocks until ctx is cancelled or an
+// error stops replication.
+//
+// Every time a connection to src is (re-)established the whole of src is
+// written to dst, after which individual changes are applied as they happen.
+func Replicate(ctx context.Context, src, dst *Firebase, opts ReplicateOptions) error {
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = time.Second
+	}
+
+	r := &replicator{
+		dst:    dst,
+		opts:   opts,
+		mirror: sync.NewDB(),
+	}
+	for {
+		err := r.run(ctx, src.copy())
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != errStreamLost {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(opts.RetryDelay):
+		}
+	}
+}
+
+type replicator struct {
+	dst  *Firebase
+	opts ReplicateOptions
+
+	// mirror is a local copy of the source, used to
+	// detect changes made directly to the target.
+	mirror *sync.Database
+}
+
+func (r *replicator) run(ctx context.Context, src *Firebase) error {
+	notifications := make(chan Event)
+	if err := src.Watch(notifications); err != nil {
+		return errStreamLost
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		src.StopWatching()
+	}()
+
+	first := true
+	for event := range notifications {
+		err := r.apply(event, first)
+		first = false
+		if err != nil {
+			src.StopWatching()
+			for range notifications {
+				// drain so the watcher can shut down
+			}
+			return err
+		}
+	}
+	return errStreamLost
+}
+
+func (r *replicator) apply(event Event, initial bool) error {
+	path := strings.Trim(event.Path, "/")
+	switch event.Type {
+	case EventTypePut:
+		return r.put(path, event.Data, initial)
+	case EventTypePatch:
+		m, _ := event.Data.(map[string]interface{})
+		for _, k := range sortedKeys(m) {
+			if err := r.put(joinPath(path, k), m[k], false); err != nil {
+				return err
+			}
+		}
+		return nil
+	case EventTypeError:
+		return errStreamLost
+	case EventTypeCancel, EventTypeAuthRevoked:
+		return fmt.Errorf("replication stopped by %s event", event.Type)
+	}
+	return nil
+}
+
+func (r *replicator) put(path string, v interface{}, initial bool) error {
+	if r.opts.Conflicts == ConflictTargetWins && !initial {
+		conflict, err := r.conflicts(path)
+		if err != nil {
+			return r.handleError(path, err)
+		}
+		if conflict {
+			if r.opts.OnConflict != nil {
+				r.opts.OnConflict("/" + path)
+			}
+			r.track(path, v)
+			return nil
+		}
+	}
+
+	var err error
+	if v == nil {
+		err = r.dst.at(path).Remove()
+	} else {
+		err = r.dst.at(path).Set(v)
+	}
+	if err != nil {
+		return r.handleError(path, err)
+	}
+
+	r.track(path, v)
+	return nil
+}
+
+// conflicts reports whether the target no longer holds the
+// value the source had before the change.
+func (r *replicator) conflicts(path string) (bool, error) {
+	var expected interface{}
+	if n := r.mirror.Get(path); n != nil {
+		expected = n.Objectify()
+	}
+
+	var current interface{}
+	if err := r.dst.at(path).Value(&current); err != nil {
+		return false, err
+	}
+	return !reflect.DeepEqual(expected, current), nil
+}
+
+func (r *replicator) track(path string, v interface{}) {
+	if r.opts.Conflicts != ConflictTargetWins {
+		return
+	}
+
+	if v == nil {
+		r.mirror.Del(path)
+		return
+	}
+	r.mirror.Add(path, sync.NewNode("", v))
+}
+
+func (r *replicator) handleError(path string, err error) error {
+	if r.opts.OnError == nil {
+		return err
+	}
+	return r.opts.OnError("/"+path, err)
+}
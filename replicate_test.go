@@ -0,0 +1,130 @@
+package firego
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func eventually(t *testing.T, cond func() bool, msg string) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			require.FailNow(t, msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReplicate(t *testing.T) {
+	t.Parallel()
+	src := firetest.New()
+	src.Start()
+	defer src.Close()
+	dst := firetest.New()
+	dst.Start()
+	defer dst.Close()
+
+	src.Set("users/1", "alice")
+	dst.Set("stale", true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Replicate(ctx, New(src.URL, nil), New(dst.URL, nil), ReplicateOptions{})
+	}()
+
+	eventually(t, func() bool {
+		return reflect.DeepEqual(src.Get(""), dst.Get(""))
+	}, "initial copy did not happen")
+
+	src.Set("users/2", "bob")
+	eventually(t, func() bool {
+		return dst.Get("users/2") == "bob"
+	}, "change was not replicated")
+
+	src.Delete("users/1")
+	eventually(t, func() bool {
+		return dst.Get("users/1") == nil
+	}, "delete was not replicated")
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "Replicate did not return")
+	}
+}
+
+func TestReplicateTargetWins(t *testing.T) {
+	t.Parallel()
+	src := firetest.New()
+	src.Start()
+	defer src.Close()
+	dst := firetest.New()
+	dst.Start()
+	defer dst.Close()
+
+	src.Set("users", map[string]interface{}{"1": "alice", "2": "bob"})
+
+	conflicts := make(chan string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Replicate(ctx, New(src.URL, nil), New(dst.URL, nil), ReplicateOptions{
+		Conflicts:  ConflictTargetWins,
+		OnConflict: func(path string) { conflicts <- path },
+	})
+
+	eventually(t, func() bool {
+		return reflect.DeepEqual(src.Get(""), dst.Get(""))
+	}, "initial copy did not happen")
+
+	// someone changes the target directly
+	dst.Set("users/1", "mallory")
+
+	src.Set("users/1", "alice2")
+	select {
+	case path := <-conflicts:
+		assert.Equal(t, "/users/1", path)
+	case <-time.After(time.Second):
+		require.FailNow(t, "conflict was not reported")
+	}
+	assert.Equal(t, "mallory", dst.Get("users/1"))
+
+	src.Set("users/2", "bob2")
+	eventually(t, func() bool {
+		return dst.Get("users/2") == "bob2"
+	}, "change was not replicated")
+}
+
+func TestReplicateOnError(t *testing.T) {
+	t.Parallel()
+	src := firetest.New()
+	src.Start()
+	defer src.Close()
+	dst := firetest.New()
+	dst.Start()
+	dst.RequireAuth(true)
+	defer dst.Close()
+
+	src.Set("foo", "bar")
+
+	var paths []string
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := Replicate(ctx, New(src.URL, nil), New(dst.URL, nil), ReplicateOptions{
+		OnError: func(path string, err error) error {
+			paths = append(paths, path)
+			return err
+		},
+	})
+	assert.Error(t, err)
+	assert.NotEqual(t, context.DeadlineExceeded, err)
+	assert.Equal(t, []string{"/"}, paths)
+}
@@ -0,0 +1,117 @@
+package firego
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	_url "net/url"
+	"time"
+)
+
+// RetryPolicy determines how requests that fail because of network
+// errors, timeouts or 5xx and 429 responses are retried. Push requests
+// are never retried since they could create duplicate children, unless
+// made with an idempotency key, see WithIdempotencyKey, and neither are
+// calls to Increment, which could add their delta twice.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts made, including
+	// the first one. Requests are not retried if it is below 2.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, which doubles
+	// with every further retry. It defaults to 100ms.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between retries, unlimited if zero.
+	MaxDelay time.Duration
+	// AttemptTimeout limits the duration of every attempt, in addition
+	// to the time left before the deadline of the reference's context.
+	AttemptTimeout time.Duration
+}
+
+// SetRetryPolicy sets how failed requests are retried. Retries stop as
+// soon as the context given to WithContext is done, or when its deadline
+// would pass before the next attempt, in which case the request fails
+// with a *RetryError.
+func (fb *Firebase) SetRetryPolicy(policy RetryPolicy) {
+	fb.retry = policy
+}
+
+// RetryError is returned when a request is given up on because its
+// context is done, or because its deadline can not be met by another
+// attempt, in which case it wraps context.DeadlineExceeded.
+type RetryError struct {
+	// Attempts is the number of attempts made.
+	Attempts int
+	// Err is the error of the last attempt.
+	Err error
+
+	ctxErr error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%s after %d attempts: %s", e.ctxErr, e.Attempts, e.Err)
+}
+
+// Unwrap returns the context error the request was given up for.
+func (e *RetryError) Unwrap() error {
+	return e.ctxErr
+}
+
+// Is and As look into the error of the last attempt as well, so that
+// errors.As finds the *StatusError of a request that kept failing with
+// a 503 until its deadline.
+func (e *RetryError) Is(target error) bool {
+	return errors.Is(e.Err, target)
+}
+
+// As is documented with Is.
+func (e *RetryError) As(target interface{}) bool {
+	return errors.As(e.Err, target)
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	if delay <= 0 {
+		delay = 100 * time.Millisecond
+	}
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// retryable reports whether a request that failed with err may succeed
+// if sent again: timeouts, network errors and 5xx and 429 responses.
+func retryable(method string, err error) bool {
+	if method == "POST" {
+		return false
+	}
+	if errors.Is(err, ErrBudgetExceeded) || errors.Is(err, ErrResponseTooLarge) {
+		// rejected by the client, it would be again
+		return false
+	}
+
+	switch err := err.(type) {
+	case ErrTimeout:
+		return true
+	case *StatusError:
+		return err.Code >= 500 || err.Code == http.StatusTooManyRequests
+	case *_url.Error:
+		if errors.Is(err.Err, io.EOF) || errors.Is(err.Err, io.ErrUnexpectedEOF) {
+			// the connection was closed
+			return true
+		}
+		var netErr net.Error
+		return errors.As(err.Err, &netErr)
+	case net.Error:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	_url "net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFlakyServer(failures int32, status int) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(status)
+			fmt.Fprint(w, `{"error":"try again"}`)
+			return
+		}
+		fmt.Fprint(w, `"ok"`)
+	}))
+	return server, &requests
+}
+
+func TestRetryPolicy(t *testing.T) {
+	t.Parallel()
+	server, requests := newFlakyServer(2, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	var v string
+	require.NoError(t, fb.Child("foo").Value(&v))
+	assert.Equal(t, "ok", v)
+	assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+}
+
+func TestRetryPolicyNotRetryable(t *testing.T) {
+	t.Parallel()
+	server, requests := newFlakyServer(1, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	_, err := fb.Push("foo")
+	assert.EqualError(t, err, `{"error":"try again"}`)
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+	server, requests = newFlakyServer(1, http.StatusUnauthorized)
+	defer server.Close()
+	fb.SetURL(server.URL)
+	assert.Error(t, fb.Set("foo"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+}
+
+func TestRetryPolicyIncrement(t *testing.T) {
+	t.Parallel()
+	var counter int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// the increment is applied, but the response is lost
+		if n := atomic.AddInt32(&counter, 1); n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, atomic.LoadInt32(&counter))
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	_, err := fb.Increment(1)
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&counter))
+}
+
+func TestRetryable(t *testing.T) {
+	t.Parallel()
+	netErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	for _, tc := range []struct {
+		method string
+		err    error
+		want   bool
+	}{
+		{"GET", ErrTimeout{netErr}, true},
+		{"GET", netErr, true},
+		{"PUT", &_url.Error{Op: "Put", Err: netErr}, true},
+		{"GET", &_url.Error{Op: "Get", Err: io.EOF}, true},
+		{"GET", &StatusError{Code: http.StatusServiceUnavailable}, true},
+		{"GET", &StatusError{Code: http.StatusTooManyRequests}, true},
+		{"POST", &_url.Error{Op: "Post", Err: netErr}, false},
+		{"GET", &StatusError{Code: http.StatusBadRequest}, false},
+		{"GET", &_url.Error{Op: "Get", Err: ErrBudgetExceeded}, false},
+		{"GET", &_url.Error{Op: "Get", Err: ErrResponseTooLarge}, false},
+		{"GET", ErrResponseTooLarge, false},
+		{"GET", &_url.Error{Op: "Get", Err: errors.New("x509: certificate signed by unknown authority")}, false},
+		{"GET", &_url.Error{Op: "Get", Err: context.Canceled}, false},
+	} {
+		assert.Equal(t, tc.want, retryable(tc.method, tc.err), "%s %v", tc.method, tc.err)
+	}
+}
+
+func TestRetryPolicyDeadline(t *testing.T) {
+	t.Parallel()
+	server, requests := newFlakyServer(10, http.StatusInternalServerError)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	fb := New(server.URL, nil).WithContext(ctx)
+	fb.SetRetryPolicy(RetryPolicy{MaxAttempts: 10, BaseDelay: 150 * time.Millisecond})
+
+	start := time.Now()
+	err := fb.Set("foo")
+	assert.True(t, time.Since(start) < 200*time.Millisecond, "gives up before the deadline")
+
+	// the second retry would start after the deadline
+	require.IsType(t, (*RetryError)(nil), err)
+	rErr := err.(*RetryError)
+	assert.Equal(t, 2, rErr.Attempts)
+	assert.Equal(t, context.DeadlineExceeded, rErr.Unwrap())
+	assert.EqualError(t, rErr.Err, `{"error":"try again"}`)
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+}
+
+func TestRetryPolicyAttemptTimeout(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		fmt.Fprint(w, `"ok"`)
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, AttemptTimeout: 50 * time.Millisecond})
+
+	var v string
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, "ok", v)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestWithContextCanceled(t *testing.T) {
+	t.Parallel()
+	server, _ := newFlakyServer(0, 0)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var v string
+	assert.Error(t, New(server.URL, nil).WithContext(ctx).Child("foo").Value(&v))
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	assert.Equal(t, 10*time.Millisecond, p.backoff(1))
+	assert.Equal(t, 20*time.Millisecond, p.backoff(2))
+	assert.Equal(t, 40*time.Millisecond, p.backoff(3))
+	assert.Equal(t, 50*time.Millisecond, p.backoff(4))
+	assert.Equal(t, 50*time.Millisecond, p.backoff(100))
+	assert.Equal(t, 100*time.Millisecond, RetryPolicy{}.backoff(1))
+}
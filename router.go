@@ -0,0 +1,83 @@
+package firego
+
+import (
+	"strings"
+	"sync"
+)
+
+// Router maps the paths of a data layout spread over several databases
+// to the database holding them, so that call sites use a single entry
+// point whatever the location they need:
+//
+//    archive := firego.New("https://my-app-archive.firebaseio.com", nil)
+//    archive.Auth(archiveToken)
+//
+//    router := firego.NewRouter(fb)
+//    router.Route("/archive/**", archive)
+//    router.Route("/tenants/{tid}/archive", archive)
+//
+//    err := router.Ref("/archive/2019/orders").Value(&orders)
+//
+// Routes are PathPatterns, a trailing "/**" being allowed for clarity,
+// matching the locations at or under them. A path is read from the
+// reference of the most specific route matching it, that is the one with
+// the most segments or else the first one added, the whole of the path
+// being relative to that reference, and from the default reference if no
+// route matches. Locations above a route, such as the root, are only read
+// from the default reference.
+type Router struct {
+	def *Firebase
+
+	mtx    sync.RWMutex
+	routes []routerRoute
+}
+
+type routerRoute struct {
+	pattern *PathPattern
+	ref     *Firebase
+}
+
+// NewRouter creates a Router sending the paths matching
+// no route to the default reference def.
+func NewRouter(def *Firebase) *Router {
+	return &Router{def: def}
+}
+
+// Route sends the paths at or under the locations matching
+// pattern to the database of ref.
+func (r *Router) Route(pattern string, ref *Firebase) error {
+	p, err := ParsePathPattern(strings.TrimSuffix(pattern, "/**"))
+	if err != nil {
+		return err
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.routes = append(r.routes, routerRoute{pattern: p, ref: ref})
+	return nil
+}
+
+// Ref returns a reference to the location at path, in the
+// database of the route matching it.
+func (r *Router) Ref(path string) *Firebase {
+	segments := splitPath(path)
+
+	r.mtx.RLock()
+	ref := r.def
+	best := -1
+	for _, route := range r.routes {
+		n := len(route.pattern.segments)
+		if n <= best || n > len(segments) {
+			continue
+		}
+		if _, ok := route.pattern.matchPrefix(segments[:n]); ok {
+			ref, best = route.ref, n
+		}
+	}
+	r.mtx.RUnlock()
+
+	if len(segments) == 0 {
+		return ref.copy()
+	}
+	return ref.Child(strings.Join(segments, "/"))
+}
@@ -0,0 +1,37 @@
+package firego
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	t.Parallel()
+	def := New("https://main.firebaseio.com", nil)
+	archive := New("https://archive.firebaseio.com", nil)
+	tenants := New("https://tenants.firebaseio.com", nil)
+	legacy := New("https://legacy.firebaseio.com/data", nil)
+
+	router := NewRouter(def)
+	require.NoError(t, router.Route("/archive/**", archive))
+	require.NoError(t, router.Route("/tenants/{tid}", tenants))
+	require.NoError(t, router.Route("/tenants/{tid}/archive", archive))
+	require.NoError(t, router.Route("/legacy", legacy))
+	assert.Error(t, router.Route("/{a}/{a}", archive))
+
+	for path, url := range map[string]string{
+		"/":                           "https://main.firebaseio.com",
+		"/users/alice":                "https://main.firebaseio.com/users/alice",
+		"/archive":                    "https://archive.firebaseio.com/archive",
+		"/archive/2019/orders":        "https://archive.firebaseio.com/archive/2019/orders",
+		"archives":                    "https://main.firebaseio.com/archives",
+		"/tenants":                    "https://main.firebaseio.com/tenants",
+		"/tenants/acme/users":         "https://tenants.firebaseio.com/tenants/acme/users",
+		"/tenants/acme/archive/2019/": "https://archive.firebaseio.com/tenants/acme/archive/2019",
+		"/legacy/x":                   "https://legacy.firebaseio.com/data/legacy/x",
+	} {
+		assert.Equal(t, url, router.Ref(path).url, path)
+	}
+}
@@ -0,0 +1,223 @@
+package firego
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Placeholders recognized in fixtures loaded by Seed.
+const (
+	// SeedPushID, used as a key or as a string value, is replaced by a
+	// newly generated push ID. Naming it, as in "$push:order1", makes
+	// every occurrence of the same name resolve to the same ID so that
+	// records can reference each other.
+	SeedPushID = "$push"
+	// SeedTimestamp, used as a string value, is replaced by
+	// ServerTimestamp.
+	SeedTimestamp = "$timestamp"
+)
+
+var fixtureFormats = struct {
+	sync.RWMutex
+	m map[string]func([]byte, interface{}) error
+}{m: map[string]func([]byte, interface{}) error{
+	".json": json.Unmarshal,
+}}
+
+// RegisterFixtureFormat makes Seed decode the fixture files with the given
+// extension using unmarshal. JSON is supported out of the box, YAML can
+// be added without firego depending on a YAML library:
+//
+//    firego.RegisterFixtureFormat(".yaml", yaml.Unmarshal)
+//    firego.RegisterFixtureFormat(".yml", yaml.Unmarshal)
+func RegisterFixtureFormat(ext string, unmarshal func([]byte, interface{}) error) {
+	fixtureFormats.Lock()
+	fixtureFormats.m[strings.ToLower(ext)] = unmarshal
+	fixtureFormats.Unlock()
+}
+
+// Seed replaces the data at fb with the contents of the fixture file and
+// returns the push IDs generated for named SeedPushID placeholders, keyed
+// by name. It is meant for setting up integration tests:
+//
+//    {
+//      "users": {"alice": {"name": "Alice"}},
+//      "orders": {
+//        "$push:first": {"user": "alice", "createdAt": "$timestamp"}
+//      },
+//      "latestOrder": "$push:first"
+//    }
+func Seed(ctx context.Context, fb *Firebase, fixture string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(fixture)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(fixture))
+	fixtureFormats.RLock()
+	unmarshal, ok := fixtureFormats.m[ext]
+	fixtureFormats.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported fixture format %q", ext)
+	}
+
+	var tree interface{}
+	if err := unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("failed to decode fixture %s: %w", fixture, err)
+	}
+
+	ids := map[string]string{}
+	tree, err = resolveSeed(tree, ids)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", fixture, err)
+	}
+
+	body, err := fb.encode(tree, false)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := fb.WithContext(ctx).doRequest("PUT", body); err != nil {
+		return nil, err
+	}
+
+	named := map[string]string{}
+	for name, id := range ids {
+		if name != "" {
+			named[name] = id
+		}
+	}
+	return named, nil
+}
+
+// Truncate removes all of the data at fb, typically to clean up
+// after a test that used Seed.
+func Truncate(ctx context.Context, fb *Firebase) error {
+	_, _, err := fb.WithContext(ctx).doRequest("DELETE", nil)
+	return err
+}
+
+// resolveSeed replaces the placeholders in a decoded fixture. Maps with
+// non string keys, as produced by some YAML decoders, are converted.
+func resolveSeed(tree interface{}, ids map[string]string) (interface{}, error) {
+	switch node := tree.(type) {
+	case string:
+		if node == SeedTimestamp {
+			return ServerTimestamp, nil
+		}
+		if id, ok := seedPushID(node, ids); ok {
+			return id, nil
+		}
+		return node, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(node))
+		for k, v := range node {
+			if err := resolveSeedChild(m, k, v, ids); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(node))
+		for k, v := range node {
+			if err := resolveSeedChild(m, fmt.Sprint(k), v, ids); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		s := make([]interface{}, len(node))
+		for i, v := range node {
+			var err error
+			if s[i], err = resolveSeed(v, ids); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	}
+	return tree, nil
+}
+
+func resolveSeedChild(m map[string]interface{}, key string, v interface{}, ids map[string]string) error {
+	if id, ok := seedPushID(key, ids); ok {
+		key = id
+	}
+	if _, ok := m[key]; ok {
+		return fmt.Errorf("duplicate key %q", key)
+	}
+
+	v, err := resolveSeed(v, ids)
+	if err != nil {
+		return err
+	}
+	m[key] = v
+	return nil
+}
+
+// seedPushID resolves s if it is a push ID placeholder.
+func seedPushID(s string, ids map[string]string) (string, bool) {
+	if s != SeedPushID && !strings.HasPrefix(s, SeedPushID+":") {
+		return "", false
+	}
+
+	name := strings.TrimPrefix(strings.TrimPrefix(s, SeedPushID), ":")
+	if id, ok := ids[name]; ok && name != "" {
+		return id, true
+	}
+	id := newPushID()
+	ids[name] = id
+	return id, true
+}
+
+const pushIDChars = "-0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ_abcdefghijklmnopqrstuvwxyz"
+
+var lastPushID = struct {
+	sync.Mutex
+	time   int64
+	random [12]byte
+}{}
+
+// newPushID generates a chronologically ordered ID the same way the
+// Firebase clients do: 8 characters encoding the current time in
+// milliseconds followed by 12 random characters, which are incremented
+// instead of regenerated when called twice within the same millisecond.
+func newPushID() string {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	lastPushID.Lock()
+	defer lastPushID.Unlock()
+
+	if now == lastPushID.time {
+		for i := len(lastPushID.random) - 1; i >= 0; i-- {
+			if lastPushID.random[i] < 63 {
+				lastPushID.random[i]++
+				break
+			}
+			lastPushID.random[i] = 0
+		}
+	} else {
+		lastPushID.time = now
+		if _, err := rand.Read(lastPushID.random[:]); err != nil {
+			panic(err)
+		}
+		for i := range lastPushID.random {
+			lastPushID.random[i] %= 64
+		}
+	}
+
+	id := make([]byte, 20)
+	for i := 7; i >= 0; i-- {
+		id[i] = pushIDChars[now%64]
+		now /= 64
+	}
+	for i, r := range lastPushID.random {
+		id[8+i] = pushIDChars[r]
+	}
+	return string(id)
+}
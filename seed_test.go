@@ -0,0 +1,97 @@
+package firego
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func writeFixture(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestSeed(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("fixtures/stale", true)
+
+	fixture := writeFixture(t, "fixture.json", `{
+		"orders": {
+			"$push:first": {"user": "alice", "createdAt": "$timestamp"},
+			"$push": {"user": "bob"}
+		},
+		"latestOrder": "$push:first"
+	}`)
+	defer os.RemoveAll(filepath.Dir(fixture))
+
+	fb := New(server.URL, nil).Child("fixtures")
+	ids, err := Seed(context.Background(), fb, fixture)
+	require.NoError(t, err)
+	require.Len(t, ids, 1)
+	first := ids["first"]
+	assert.Len(t, first, 20)
+
+	v := server.Get("fixtures").(map[string]interface{})
+	assert.NotContains(t, v, "stale")
+	assert.Equal(t, first, v["latestOrder"])
+
+	orders := v["orders"].(map[string]interface{})
+	require.Len(t, orders, 2)
+	order := orders[first].(map[string]interface{})
+	assert.Equal(t, "alice", order["user"])
+	assert.IsType(t, float64(0), order["createdAt"])
+
+	require.NoError(t, Truncate(context.Background(), fb))
+	assert.Nil(t, server.Get("fixtures"))
+}
+
+func TestSeedFormats(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	fb := New(server.URL, nil)
+
+	fixture := writeFixture(t, "fixture.test", "")
+	defer os.RemoveAll(filepath.Dir(fixture))
+
+	_, err := Seed(context.Background(), fb, fixture)
+	assert.EqualError(t, err, `unsupported fixture format ".test"`)
+
+	// YAML decoders may produce maps with non string keys
+	RegisterFixtureFormat(".TEST", func(data []byte, v interface{}) error {
+		*(v.(*interface{})) = map[interface{}]interface{}{
+			1: map[interface{}]interface{}{"name": "$push:a"},
+		}
+		return nil
+	})
+	ids, err := Seed(context.Background(), fb, fixture)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"1": map[string]interface{}{"name": ids["a"]},
+	}, server.Get(""))
+}
+
+func TestNewPushID(t *testing.T) {
+	ids := make([]string, 100)
+	for i := range ids {
+		ids[i] = newPushID()
+	}
+	assert.True(t, sort.StringsAreSorted(ids), "push IDs are chronological")
+	for i := 1; i < len(ids); i++ {
+		assert.NotEqual(t, ids[i-1], ids[i])
+	}
+}
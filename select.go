@@ -0,0 +1,153 @@
+package firego
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxSelectRequests is the largest number of reads a selection is
+	// fetched with, one per field of every child. Larger selections are
+	// made from a single read of the whole reference.
+	maxSelectRequests = 32
+	// selectConcurrency is the number of fields read at once.
+	selectConcurrency = 4
+)
+
+// queryParams are the parameters a shallow read can not be combined with.
+var queryParams = []string{orderByParam, limitToFirstParam, limitToLastParam, startAtParam, endAtParam, equalToParam, shallowParam}
+
+// Select returns a copy of the reference whose reads with Value only hold
+// the given fields of each of its children, such as the name and email of
+// every user without the rest of their profile:
+//
+//    var users map[string]User
+//    err := fb.Child("users").Select("name", "email").Value(&users)
+//
+// Fields are paths relative to the children, e.g. "address/city", and
+// the children holding none of them are left out.
+//
+// Firebase can not filter the children it returns, so the fields are
+// either read on their own, in parallel, after listing the children with
+// a shallow read, or picked from a single read of the whole reference.
+// The former is chosen when it takes few enough requests, which saves the
+// transfer of the other fields of wide children; queries always use the
+// latter. Unlike the other settings of a reference, the fields are not
+// inherited by references derived from it.
+func (fb *Firebase) Select(fields ...string) *Firebase {
+	c := fb.copy()
+	c.fields = fields
+	return c
+}
+
+// selectValue reads the fields selected of the children into v.
+func (fb *Firebase) selectValue(v interface{}) error {
+	var (
+		tree interface{}
+		err  error
+	)
+	if fb.isQuery() {
+		tree, err = fb.selectFiltered()
+	} else {
+		tree, err = fb.selectParallel()
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	return fb.decode(data, v)
+}
+
+// isQuery reports whether the reference queries its children.
+func (fb *Firebase) isQuery() bool {
+	fb.paramsMtx.RLock()
+	defer fb.paramsMtx.RUnlock()
+	for _, p := range queryParams {
+		if fb.params.Get(p) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// selectFiltered picks the fields selected from a read of the reference.
+func (fb *Firebase) selectFiltered() (interface{}, error) {
+	_, body, err := fb.doRequest("GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := decodeTree(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected interface{}
+	for key, child := range treeChildren(tree) {
+		for _, field := range fb.fields {
+			path := splitPath(field)
+			if value := valueAt(child, path); value != nil {
+				selected = setValueAt(selected, append([]string{key}, path...), value)
+			}
+		}
+	}
+	return selected, nil
+}
+
+// selectParallel lists the children of the reference and reads the
+// fields selected on their own, unless there are too many of them.
+func (fb *Firebase) selectParallel() (interface{}, error) {
+	list := fb.copy()
+	list.Shallow(true)
+	_, body, err := list.doRequest("GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	children, _ := shallowChildren(body)
+	if len(children)*len(fb.fields) > maxSelectRequests {
+		return fb.selectFiltered()
+	}
+
+	var (
+		mtx      sync.Mutex
+		selected interface{}
+		firstErr error
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, selectConcurrency)
+	)
+	for key := range children {
+		for _, field := range fb.fields {
+			path := append([]string{key}, splitPath(field)...)
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				_, body, err := fb.at(strings.Join(path, "/")).doRequest("GET", nil)
+				var value interface{}
+				if err == nil {
+					value, err = decodeTree(body)
+				}
+
+				mtx.Lock()
+				defer mtx.Unlock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					return
+				}
+				if value != nil {
+					selected = setValueAt(selected, path, value)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	return selected, firstErr
+}
@@ -0,0 +1,97 @@
+package firego
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func selectServer(users int) *firetest.Firetest {
+	server := firetest.New()
+	server.Start()
+	for i := 0; i < users; i++ {
+		server.Set("users/"+strconv.Itoa(i), map[string]interface{}{
+			"name":    "user" + strconv.Itoa(i),
+			"email":   strconv.Itoa(i) + "@example.com",
+			"bio":     "a long text",
+			"address": map[string]interface{}{"city": "Paris", "street": "Rue de Rivoli"},
+		})
+	}
+	server.Set("users/nameless", map[string]interface{}{"bio": "no name"})
+	return server
+}
+
+// countRequests counts the requests sent through fb.
+func countRequests(fb *Firebase) func() int {
+	var (
+		mtx sync.Mutex
+		n   int
+	)
+	fb.BeforeSend(func(req *http.Request, body []byte) error {
+		mtx.Lock()
+		n++
+		mtx.Unlock()
+		return nil
+	})
+	return func() int {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return n
+	}
+}
+
+func TestSelect(t *testing.T) {
+	t.Parallel()
+	server := selectServer(3)
+	defer server.Close()
+	fb := New(server.URL, nil).Child("users")
+	requests := countRequests(fb)
+
+	type user struct {
+		Name    string            `json:"name"`
+		Address map[string]string `json:"address"`
+		Bio     string            `json:"bio"`
+	}
+	var v map[string]user
+	require.NoError(t, fb.Select("name", "address/city").Value(&v))
+	assert.Equal(t, map[string]user{
+		"0": {Name: "user0", Address: map[string]string{"city": "Paris"}},
+		"1": {Name: "user1", Address: map[string]string{"city": "Paris"}},
+		"2": {Name: "user2", Address: map[string]string{"city": "Paris"}},
+	}, v)
+	// a shallow read and a read per field of every child
+	assert.Equal(t, 1+4*2, requests())
+
+	// the fields are not inherited
+	var bio string
+	require.NoError(t, fb.Select("name").Child("0/bio").Value(&bio))
+	assert.Equal(t, "a long text", bio)
+}
+
+func TestSelectFiltered(t *testing.T) {
+	t.Parallel()
+	server := selectServer(maxSelectRequests)
+	defer server.Close()
+	fb := New(server.URL, nil).Child("users")
+	requests := countRequests(fb)
+
+	var v map[string]map[string]string
+	require.NoError(t, fb.Select("name").Value(&v))
+	assert.Len(t, v, maxSelectRequests)
+	assert.Equal(t, map[string]string{"name": "user7"}, v["7"])
+	// too many children, the shallow read is followed by a whole one
+	assert.Equal(t, 2, requests())
+
+	v = nil
+	require.NoError(t, fb.OrderBy("$key").LimitToFirst(2).Select("email").Value(&v))
+	assert.Equal(t, map[string]map[string]string{
+		"0": {"email": "0@example.com"},
+		"1": {"email": "1@example.com"},
+	}, v)
+	assert.Equal(t, 3, requests())
+}
@@ -0,0 +1,69 @@
+package firego
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// WatchSingleton watches the locations at paths, relative to fb, like a
+// WatchManager, only while holding lease, so that a single instance of a
+// fleet processes their events:
+//
+//    lease := firego.NewLease(fb.Child("locks/orders"), hostname, 10*time.Second)
+//    err := firego.WatchSingleton(ctx, lease, fb, []string{"/orders"}, handler)
+//
+// Every instance runs it with a lease on the same node and their own
+// owner. The one acquiring the lease watches until it loses it, when
+// another one takes over once the lease is abandoned, starting with the
+// whole of the locations as events with a Seq of 1. The handler is not
+// called once the lease has expired, even if its owner has not noticed
+// yet, but events being handled then may be handled again by the next
+// owner.
+//
+// The lease is renewed every third of its TTL. WatchSingleton blocks until
+// ctx is done, releases the lease and returns ctx.Err().
+func WatchSingleton(ctx context.Context, lease *Lease, fb *Firebase, paths []string, handler WatchFunc) error {
+	guarded := func(path string, event Event) {
+		if lease.Held() {
+			handler(path, event)
+		}
+	}
+
+	var m *WatchManager
+	stop := func() {
+		if m != nil {
+			m.Close()
+			m = nil
+		}
+	}
+	defer func() {
+		stop()
+		if err := lease.Release(); err != nil {
+			log.Printf("WatchSingleton: %s", err)
+		}
+	}()
+
+	interval := lease.ttl / 3
+	for {
+		held, err := lease.TryAcquire()
+		if err != nil {
+			log.Printf("WatchSingleton: %s", err)
+		}
+		switch {
+		case held && m == nil:
+			m = NewWatchManager(fb, guarded)
+			for _, path := range paths {
+				m.Add(path)
+			}
+		case !held:
+			stop()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package firego
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestWatchSingleton(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	var mtx sync.Mutex
+	received := map[string][]interface{}{}
+	run := func(ctx context.Context, owner string) chan error {
+		done := make(chan error, 1)
+		lease := NewLease(fb.Child("locks/orders"), owner, 300*time.Millisecond)
+		go func() {
+			done <- WatchSingleton(ctx, lease, fb, []string{"/orders"}, func(path string, event Event) {
+				mtx.Lock()
+				received[owner] = append(received[owner], event.Data)
+				mtx.Unlock()
+			})
+		}()
+		return done
+	}
+	count := func(owner string) int {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(received[owner])
+	}
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	doneA := run(ctxA, "a")
+	eventually(t, func() bool { return count("a") == 1 }, "a did not start watching")
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	doneB := run(ctxB, "b")
+
+	server.Set("orders/1", "new")
+	eventually(t, func() bool { return count("a") == 2 }, "a did not receive the change")
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, count("b"))
+
+	// b takes over once a is gone
+	cancelA()
+	assert.Equal(t, context.Canceled, <-doneA)
+	eventually(t, func() bool { return count("b") == 1 }, "b did not take over")
+	server.Set("orders/2", "new")
+	eventually(t, func() bool { return count("b") == 2 }, "b did not receive the change")
+	assert.Equal(t, 2, count("a"))
+
+	cancelB()
+	assert.Equal(t, context.Canceled, <-doneB)
+}
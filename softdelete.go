@@ -0,0 +1,63 @@
+package firego
+
+import "time"
+
+// DeletedAtField is the child marking the nodes deleted by DeleteSoft,
+// holding the time they were deleted at in milliseconds.
+const DeletedAtField = "deletedAt"
+
+// DeleteSoft marks the node of the reference as deleted by setting its
+// DeletedAtField child to ServerTimestamp, rather than removing it, so that
+// it can be restored with RestoreSoft. Its other children are left as is.
+// The node is created if it does not exist.
+//
+// Readers leave out the nodes marked deleted with NotDeleted, and a
+// Sweeper created by NewPurgeSweeper removes them for good once they have
+// been deleted for long enough:
+//
+//    if err := fb.Child("posts/42").DeleteSoft(); err != nil {
+//        log.Fatal(err)
+//    }
+//    var posts map[string]Post
+//    if err := fb.Child("posts").NotDeleted().Value(&posts); err != nil {
+//        log.Fatal(err)
+//    }
+func (fb *Firebase) DeleteSoft() error {
+	return fb.Update(map[string]interface{}{DeletedAtField: ServerTimestamp})
+}
+
+// RestoreSoft restores the node of the reference deleted by DeleteSoft.
+func (fb *Firebase) RestoreSoft() error {
+	return fb.Update(map[string]interface{}{DeletedAtField: nil})
+}
+
+// NotDeleted creates a new Firebase reference querying the children that
+// are not marked deleted by DeleteSoft. The query is ordered by
+// DeletedAtField, which should be indexed, and can not be combined with
+// another OrderBy.
+//
+//    NotDeleted() // -> orderBy="deletedAt"&equalTo=null
+func (fb *Firebase) NotDeleted() *Firebase {
+	c := fb.OrderBy(DeletedAtField)
+	c.params.Del(startAtParam)
+	c.params.Del(endAtParam)
+	c.params.Set(equalToParam, "null")
+	return c
+}
+
+// Deleted creates a new Firebase reference querying the children marked
+// deleted by DeleteSoft, oldest deletions first. Like NotDeleted, it is
+// ordered by DeletedAtField.
+//
+//    Deleted() // -> orderBy="deletedAt"&startAt=0
+func (fb *Firebase) Deleted() *Firebase {
+	c := fb.OrderBy(DeletedAtField).StartAtValue(0)
+	c.params.Del(equalToParam)
+	return c
+}
+
+// NewPurgeSweeper creates a Sweeper removing the children of fb that have
+// been marked deleted by DeleteSoft for longer than retention.
+func NewPurgeSweeper(fb *Firebase, retention time.Duration) *Sweeper {
+	return NewSweeper(fb, DeletedAtField, retention)
+}
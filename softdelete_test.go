@@ -0,0 +1,60 @@
+package firego
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestSoftDeleteQueries(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil)
+
+	assert.Equal(t, URL+"/.json?equalTo=null&orderBy=%22deletedAt%22", fb.StartAt("a").NotDeleted().String())
+	assert.Equal(t, URL+"/.json?orderBy=%22deletedAt%22&startAt=0", fb.EqualTo("a").Deleted().String())
+}
+
+func TestDeleteSoft(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("posts", map[string]interface{}{
+		"p1": map[string]interface{}{"title": "first"},
+		"p2": map[string]interface{}{"title": "second"},
+	})
+	fb := New(server.URL, nil)
+	posts := fb.Child("posts")
+
+	require.NoError(t, posts.Child("p1").DeleteSoft())
+	p1, ok := server.Get("posts/p1").(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "first", p1["title"])
+	assert.IsType(t, float64(0), p1[DeletedAtField])
+
+	var v map[string]interface{}
+	require.NoError(t, posts.NotDeleted().Value(&v))
+	assert.Equal(t, map[string]interface{}{"p2": map[string]interface{}{"title": "second"}}, v)
+
+	v = nil
+	require.NoError(t, posts.Deleted().Value(&v))
+	assert.Len(t, v, 1)
+	assert.Contains(t, v, "p1")
+
+	require.NoError(t, posts.Child("p1").RestoreSoft())
+	assert.Equal(t, map[string]interface{}{"title": "first"}, server.Get("posts/p1"))
+
+	// deleted long ago
+	server.Set("posts/p2/"+DeletedAtField, float64(NewMillis(time.Now().Add(-48*time.Hour))))
+	require.NoError(t, posts.Child("p1").DeleteSoft())
+	deleted, err := NewPurgeSweeper(posts, 24*time.Hour).Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.Nil(t, server.Get("posts/p2"))
+	assert.NotNil(t, server.Get("posts/p1"))
+}
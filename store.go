@@ -0,0 +1,229 @@
+package firego
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Store persists the state of stateful helpers, such as the local copy of
+// a SyncTree or the writes of an OfflineQueue, so that it survives
+// restarts. MemoryStore and FileStore are provided, other implementations
+// can keep the state in Redis or SQLite.
+//
+// Implementations must be safe for concurrent use. The values passed to
+// Set and Iterate's fn must not be retained or modified.
+type Store interface {
+	// Get returns the value of key, and false if there is none.
+	Get(key string) ([]byte, bool, error)
+	// Set sets the value of key.
+	Set(key string, value []byte) error
+	// Delete removes key, it is not an error if there is none.
+	Delete(key string) error
+	// Iterate calls fn for every key, in ascending order, stopping at
+	// the first error, which it returns.
+	Iterate(fn func(key string, value []byte) error) error
+}
+
+// MemoryStore is a Store keeping values in memory.
+type MemoryStore struct {
+	mtx    sync.RWMutex
+	values map[string][]byte
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: map[string][]byte{}}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(key string) ([]byte, bool, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	v, ok := s.values[key]
+	return v, ok, nil
+}
+
+// Set implements Store.
+func (s *MemoryStore) Set(key string, value []byte) error {
+	s.mtx.Lock()
+	s.values[key] = append([]byte(nil), value...)
+	s.mtx.Unlock()
+	return nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(key string) error {
+	s.mtx.Lock()
+	delete(s.values, key)
+	s.mtx.Unlock()
+	return nil
+}
+
+// Iterate implements Store. fn may modify the store.
+func (s *MemoryStore) Iterate(fn func(key string, value []byte) error) error {
+	s.mtx.RLock()
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	s.mtx.RUnlock()
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v, ok, _ := s.Get(k)
+		if !ok {
+			continue
+		}
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileStore is a Store keeping every value in a file of its own in
+// a directory, named after the SHA-256 of its key, which the file holds
+// along with the value. Values are replaced atomically, so a crash leaves
+// either the previous or the new value of a key.
+type FileStore struct {
+	dir string
+}
+
+// fileStoreExt is the extension of the files holding values,
+// which keeps them apart from temporary files.
+const fileStoreExt = ".val"
+
+// NewFileStore creates a FileStore in dir, which is created if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// file returns the name of the file holding key. Keys are hashed so
+// that any key, however long, makes a valid file name.
+func (s *FileStore) file(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+fileStoreExt)
+}
+
+// Get implements Store.
+func (s *FileStore) Get(key string) ([]byte, bool, error) {
+	k, v, err := readStoreFile(s.file(key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if k != key {
+		// the SHA-256 of another key, which is as good as no value
+		return nil, false, nil
+	}
+	return v, true, nil
+}
+
+// Set implements Store.
+func (s *FileStore) Set(key string, value []byte) error {
+	data := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(key)+len(value))
+	data = data[:binary.PutUvarint(data, uint64(len(key)))]
+	data = append(data, key...)
+	data = append(data, value...)
+	return writeFileAtomic(s.file(key), data)
+}
+
+// readStoreFile reads the key and the value held by a file of a FileStore,
+// which are the length of the key as a uvarint, the key and the value.
+func readStoreFile(path string) (string, []byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	n, size := binary.Uvarint(data)
+	if size <= 0 || n > uint64(len(data)-size) {
+		return "", nil, fmt.Errorf("firego: corrupt store file %s", path)
+	}
+	data = data[size:]
+	return string(data[:n]), data[n:], nil
+}
+
+// Delete implements Store.
+func (s *FileStore) Delete(key string) error {
+	err := os.Remove(s.file(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Iterate implements Store.
+func (s *FileStore) Iterate(fn func(key string, value []byte) error) error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasSuffix(name, fileStoreExt) {
+			continue
+		}
+		key, _, err := readStoreFile(filepath.Join(s.dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v, ok, err := s.Get(k)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with one holding data, going
+// through a temporary file in the same directory so that a crash leaves
+// either the previous or the new file.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
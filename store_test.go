@@ -0,0 +1,87 @@
+package firego
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStore(t *testing.T, s Store) {
+	_, ok, err := s.Get("missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	for _, k := range []string{"b", "a/1", "c:d", ""} {
+		require.NoError(t, s.Set(k, []byte("value of "+k)))
+	}
+	require.NoError(t, s.Set("b", []byte("new")))
+
+	v, ok, err := s.Get("b")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "new", string(v))
+
+	require.NoError(t, s.Delete("c:d"))
+	require.NoError(t, s.Delete("c:d"))
+
+	var keys []string
+	require.NoError(t, s.Iterate(func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"", "a/1", "b"}, keys)
+
+	stop := errors.New("stop")
+	keys = nil
+	err = s.Iterate(func(key string, value []byte) error {
+		keys = append(keys, key)
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, []string{""}, keys)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(dir)
+	require.NoError(t, err)
+	testStore(t, s)
+
+	// values are kept across instances and
+	// left over temporary files are ignored
+	require.NoError(t, ioutil.WriteFile(dir+"/tmp123", []byte("partial"), 0600))
+	s, err = NewFileStore(dir)
+	require.NoError(t, err)
+	var keys []string
+	require.NoError(t, s.Iterate(func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"", "a/1", "b"}, keys)
+
+	// keys may be longer than file names
+	long := "offline:https://my-app.firebaseio.com/" + strings.Repeat("k", 300)
+	require.NoError(t, s.Set(long, []byte("value")))
+	v, ok, err := s.Get(long)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "value", string(v))
+	keys = nil
+	require.NoError(t, s.Iterate(func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"", "a/1", "b", long}, keys)
+}
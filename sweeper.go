@@ -0,0 +1,205 @@
+package firego
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Sweeper periodically removes the children of a reference whose timestamp
+// field is older than a time to live, such as expired sessions:
+//
+//    s := firego.NewSweeper(fb.Child("sessions"), "lastSeen", 24*time.Hour)
+//    s.Start()
+//    defer s.Stop()
+//
+// The children are found with a query ordered by the field, which should
+// be indexed, and removed in batches with a single update each. Children
+// whose field is not a timestamp are left alone.
+type Sweeper struct {
+	// Interval is the time between two runs. It defaults to one minute.
+	Interval time.Duration
+	// BatchSize is the number of children queried, and removed,
+	// at once. It defaults to 100.
+	BatchSize int
+	// MaxDeletions, if set, caps the number of children removed by a
+	// run, so that a wrong field or time to live can not wipe out the
+	// data at once. The children left are removed by the next runs.
+	MaxDeletions int
+	// OnError is called with the errors of the runs made by Start.
+	// Errors are logged if it is nil.
+	OnError func(err error)
+
+	fb    *Firebase
+	field string
+	ttl   time.Duration
+
+	mtx     sync.Mutex
+	stats   SweeperStats
+	stop    chan struct{}
+	running sync.WaitGroup
+}
+
+// SweeperStats holds the metrics collected by a Sweeper.
+type SweeperStats struct {
+	// Runs is the number of runs made.
+	Runs int64
+	// Deleted is the number of children removed.
+	Deleted int64
+	// Errors is the number of runs that failed.
+	Errors int64
+	// Capped is the number of runs stopped by MaxDeletions.
+	Capped int64
+	// LastRun is when the last run started.
+	LastRun time.Time
+}
+
+// NewSweeper creates a Sweeper removing the children of fb whose field,
+// a timestamp in milliseconds such as ServerTimestamp, is older than ttl.
+// The field may be the path of a nested child, e.g. "meta/created".
+func NewSweeper(fb *Firebase, field string, ttl time.Duration) *Sweeper {
+	return &Sweeper{
+		Interval:  time.Minute,
+		BatchSize: 100,
+		fb:        fb,
+		field:     field,
+		ttl:       ttl,
+	}
+}
+
+// Start runs the sweeper right away, and then every Interval in the
+// background until Stop is called.
+func (s *Sweeper) Start() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.stop != nil {
+		// already running
+		return
+	}
+
+	stop := make(chan struct{})
+	s.stop = stop
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			<-stop
+			cancel()
+		}()
+
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+		for {
+			if _, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+				s.handleError(err)
+			}
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the runs, interrupting the current one.
+func (s *Sweeper) Stop() {
+	s.mtx.Lock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.mtx.Unlock()
+
+	s.running.Wait()
+}
+
+// Stats returns the metrics collected so far.
+func (s *Sweeper) Stats() SweeperStats {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.stats
+}
+
+// Sweep makes a single run, removing the expired children, and returns
+// the number of children removed.
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	start := time.Now()
+	s.mtx.Lock()
+	s.stats.Runs++
+	s.stats.LastRun = start
+	s.mtx.Unlock()
+
+	deleted, capped, err := s.sweep(ctx, start.Add(-s.ttl))
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.stats.Deleted += int64(deleted)
+	if capped {
+		s.stats.Capped++
+	}
+	if err != nil {
+		s.stats.Errors++
+	}
+	return deleted, err
+}
+
+func (s *Sweeper) sweep(ctx context.Context, cutoff time.Time) (int, bool, error) {
+	ref := s.fb.WithContext(ctx)
+	// starting at 0 leaves out the children without a timestamp,
+	// which come first
+	query := ref.OrderBy(s.field).StartAtValue(0).EndAtTime(cutoff)
+	limit := NewMillis(cutoff)
+
+	deleted := 0
+	for {
+		batch := s.BatchSize
+		if s.MaxDeletions > 0 {
+			if deleted >= s.MaxDeletions {
+				return deleted, true, nil
+			}
+			if left := s.MaxDeletions - deleted; left < batch {
+				batch = left
+			}
+		}
+
+		var v interface{}
+		if err := query.LimitToFirst(int64(batch)).Value(&v); err != nil {
+			return deleted, false, err
+		}
+		children := treeChildren(v)
+
+		expired := map[string]interface{}{}
+		for key, child := range children {
+			if ts, ok := valueAt(child, splitPath(s.field)).(float64); ok && Millis(ts) <= limit {
+				expired[key] = nil
+			}
+		}
+		if len(expired) == 0 {
+			return deleted, false, nil
+		}
+
+		body, err := ref.encode(expired, true)
+		if err != nil {
+			return deleted, false, err
+		}
+		if _, _, err := ref.doRequest("PATCH", body); err != nil {
+			return deleted, false, err
+		}
+		deleted += len(expired)
+		if len(children) < batch {
+			return deleted, false, nil
+		}
+	}
+}
+
+func (s *Sweeper) handleError(err error) {
+	if s.OnError != nil {
+		s.OnError(err)
+		return
+	}
+	log.Printf("Sweeper: %s", err)
+}
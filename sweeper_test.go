@@ -0,0 +1,79 @@
+package firego
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestSweeper(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	now := time.Now()
+	// values set directly must be float64 for firetest to sort them as numbers
+	old := float64(NewMillis(now.Add(-2 * time.Hour)))
+	sessions := map[string]interface{}{
+		"fresh":   map[string]interface{}{"meta": map[string]interface{}{"seen": float64(NewMillis(now))}},
+		"pinned":  map[string]interface{}{"meta": map[string]interface{}{"seen": "never"}},
+		"missing": map[string]interface{}{"user": "alice"},
+	}
+	for i := 0; i < 5; i++ {
+		sessions[fmt.Sprintf("old%d", i)] = map[string]interface{}{"meta": map[string]interface{}{"seen": old + float64(i)}}
+	}
+	server.Set("sessions", sessions)
+
+	s := NewSweeper(New(server.URL, nil).Child("sessions"), "meta/seen", time.Hour)
+	s.BatchSize = 2
+	s.MaxDeletions = 3
+
+	deleted, err := s.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, deleted)
+	stats := s.Stats()
+	assert.Equal(t, int64(1), stats.Capped)
+	assert.Equal(t, int64(3), stats.Deleted)
+
+	deleted, err = s.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	left, ok := server.Get("sessions").(map[string]interface{})
+	require.True(t, ok)
+	assert.Len(t, left, 3)
+	for _, key := range []string{"fresh", "pinned", "missing"} {
+		assert.Contains(t, left, key)
+	}
+	assert.Equal(t, SweeperStats{Runs: 2, Deleted: 5, Capped: 1, LastRun: s.Stats().LastRun}, s.Stats())
+}
+
+func TestSweeperStart(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("sessions/old", map[string]interface{}{"seen": 1.0})
+
+	fb := New(server.URL, nil).Child("sessions")
+	empty := func() bool {
+		var v interface{}
+		return fb.Value(&v) == nil && v == nil
+	}
+
+	s := NewSweeper(fb, "seen", time.Hour)
+	s.Interval = 10 * time.Millisecond
+	s.Start()
+	eventually(t, empty, "expired child was not removed")
+
+	server.Set("sessions/older", map[string]interface{}{"seen": 0.0})
+	eventually(t, empty, "sweeper did not run again")
+	s.Stop()
+	assert.True(t, s.Stats().Runs >= 2)
+}
@@ -0,0 +1,491 @@
+package firego
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	fbsync "github.com/zabawaba99/firego/sync"
+)
+
+// SyncTree keeps a local copy of the data at a reference up to date by
+// watching it, so that reads are served without a round trip to Firebase:
+//
+//    tree := firego.NewSyncTree(fb.Child("config"))
+//    if err := tree.Start(); err != nil {
+//        log.Fatal(err)
+//    }
+//    defer tree.Stop()
+//
+//    var flags map[string]bool
+//    if err := tree.Value("flags", &flags); err != nil {
+//        log.Fatal(err)
+//    }
+//
+// Writes made through the tree are applied to the local copy right away,
+// before Firebase confirms them, so that they can be read back at once
+// from any goroutine. A write that Firebase rejects is rolled back, and a
+// write it accepts is kept on top of the data received from the stream
+// until the event confirming it arrives, so reads never go back to the
+// previous value in between.
+type SyncTree struct {
+	// OnError is called when the connection is lost.
+	// Errors are logged if it is nil.
+	OnError func(err error)
+	// RetryDelay is how long to wait before watching again after
+	// the connection is lost. It defaults to one second.
+	RetryDelay time.Duration
+	// Store, if set, is where the local copy is saved whenever it
+	// changes, for Load to restore it after a restart.
+	Store Store
+
+	fb *Firebase
+
+	mtx     sync.RWMutex
+	server  *fbsync.Database
+	pending []*treeWrite
+	stop    chan struct{}
+	running sync.WaitGroup
+}
+
+// treeWrite is a write made through a SyncTree that
+// the data received from Firebase may not reflect yet.
+type treeWrite struct {
+	sets []treeSet
+	// acked is set once Firebase accepted the write
+	acked bool
+}
+
+type treeSet struct {
+	path  string
+	value interface{}
+}
+
+// NewSyncTree creates a SyncTree for the data at fb.
+func NewSyncTree(fb *Firebase) *SyncTree {
+	return &SyncTree{
+		fb:         fb,
+		RetryDelay: time.Second,
+		server:     fbsync.NewDB(),
+	}
+}
+
+// Start watches the reference and returns once the local copy holds its
+// data. It does nothing if the tree is already started, or being started.
+// The tree can be read while Start waits for the data, see Load.
+func (t *SyncTree) Start() error {
+	t.mtx.Lock()
+	if t.stop != nil {
+		// already running
+		t.mtx.Unlock()
+		return nil
+	}
+	stop := make(chan struct{})
+	t.stop = stop
+	t.running.Add(1)
+	t.mtx.Unlock()
+
+	ref := t.fb.copy()
+	notifications := make(chan Event)
+	if err := ref.Watch(notifications); err != nil {
+		t.abortStart(stop)
+		return err
+	}
+
+	var event Event
+	ok, stopped := false, false
+	select {
+	case event, ok = <-notifications:
+	case <-stop:
+		stopped = true
+	}
+	if !ok || (event.Type != EventTypePut && event.Type != EventTypePatch) {
+		ref.StopWatching()
+		for range notifications {
+			// drain so the watcher can shut down
+		}
+		t.abortStart(stop)
+		if err, isErr := event.Data.(error); isErr {
+			return err
+		}
+		if stopped {
+			return errors.New("sync tree: stopped while starting")
+		}
+		return fmt.Errorf("sync tree: watch ended by %q event", event.Type)
+	}
+
+	t.mtx.Lock()
+	t.reset(event.Data)
+	t.mtx.Unlock()
+
+	go func() {
+		defer t.running.Done()
+		t.run(ref, notifications, stop)
+	}()
+	return nil
+}
+
+// abortStart marks the tree as stopped after Start failed.
+func (t *SyncTree) abortStart(stop chan struct{}) {
+	t.mtx.Lock()
+	if t.stop == stop {
+		t.stop = nil
+	}
+	t.mtx.Unlock()
+	t.running.Done()
+}
+
+// Stop stops watching the reference. The local copy
+// can still be read but is no longer updated.
+func (t *SyncTree) Stop() {
+	t.mtx.Lock()
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+	t.mtx.Unlock()
+
+	t.running.Wait()
+}
+
+// Load fills the local copy with the data saved in Store, which lets the
+// tree be read before Start returns, or while Firebase can not be reached.
+// Start replaces it with the current data. It returns false if no data
+// was saved for the reference.
+func (t *SyncTree) Load() (bool, error) {
+	if t.Store == nil {
+		return false, errors.New("sync tree: no store")
+	}
+
+	data, ok, err := t.Store.Get(t.storeKey())
+	if err != nil || !ok {
+		return false, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return false, err
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.server = fbsync.NewDB()
+	t.put("", v)
+	return true, nil
+}
+
+// storeKey is the key the local copy is saved under.
+func (t *SyncTree) storeKey() string {
+	return "synctree:" + t.fb.url
+}
+
+// save writes the local copy to Store.
+func (t *SyncTree) save() {
+	if t.Store == nil {
+		return
+	}
+
+	var v interface{}
+	if n := t.server.Get(""); n != nil {
+		v = n.Objectify()
+	}
+	data, err := json.Marshal(v)
+	if err == nil {
+		err = t.Store.Set(t.storeKey(), data)
+	}
+	if err != nil {
+		t.handleError(fmt.Errorf("failed to save local copy. %w", err))
+	}
+}
+
+// Get returns the value at path, relative to the reference of the tree,
+// including the writes made through the tree that are not confirmed yet.
+func (t *SyncTree) Get(path string) interface{} {
+	path = strings.Trim(path, "/")
+
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	var v interface{}
+	if n := t.server.Get(path); n != nil {
+		v = n.Objectify()
+	}
+	for _, w := range t.pending {
+		for _, s := range w.sets {
+			v = overlaySet(v, path, s)
+		}
+	}
+	return v
+}
+
+// Value decodes the value at path, as returned by Get, into v.
+func (t *SyncTree) Value(path string, v interface{}) error {
+	data, err := json.Marshal(t.Get(path))
+	if err != nil {
+		return err
+	}
+	return t.fb.decode(data, v)
+}
+
+// Set sets the value at path, like Firebase.Set does.
+func (t *SyncTree) Set(path string, v interface{}) error {
+	return t.write(path, v, "PUT")
+}
+
+// Update updates the children of path with the values of v,
+// like Firebase.Update does.
+func (t *SyncTree) Update(path string, v interface{}) error {
+	return t.write(path, v, "PATCH")
+}
+
+// Remove removes the value at path, like Firebase.Remove does.
+func (t *SyncTree) Remove(path string) error {
+	return t.write(path, nil, "DELETE")
+}
+
+func (t *SyncTree) write(path string, v interface{}, method string) error {
+	path = strings.Trim(path, "/")
+	ref := t.fb.at(path)
+
+	w := &treeWrite{sets: []treeSet{{path: path}}}
+	var body []byte
+	if method != "DELETE" {
+		var err error
+		if body, err = ref.encode(v, method == "PATCH"); err != nil {
+			return err
+		}
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			return err
+		}
+
+		w.sets[0].value = value
+		if m, ok := value.(map[string]interface{}); ok && method == "PATCH" {
+			w.sets = w.sets[:0]
+			for k, kv := range m {
+				w.sets = append(w.sets, treeSet{path: joinPath(path, strings.Trim(k, "/")), value: kv})
+			}
+		}
+	}
+
+	t.mtx.Lock()
+	t.pending = append(t.pending, w)
+	t.mtx.Unlock()
+
+	_, _, err := ref.doRequest(method, body)
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if err != nil || t.reflected(w) {
+		// roll back, or the confirming event already arrived
+		t.drop(func(p *treeWrite) bool { return p == w })
+		return err
+	}
+	w.acked = true
+	return nil
+}
+
+// reflected reports whether the data received from Firebase
+// holds the values of w.
+func (t *SyncTree) reflected(w *treeWrite) bool {
+	for _, s := range w.sets {
+		var v interface{}
+		if n := t.server.Get(s.path); n != nil {
+			v = n.Objectify()
+		}
+		if !reflect.DeepEqual(v, s.value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *SyncTree) drop(match func(*treeWrite) bool) {
+	pending := t.pending[:0]
+	for _, w := range t.pending {
+		if !match(w) {
+			pending = append(pending, w)
+		}
+	}
+	t.pending = pending
+}
+
+// run applies the events from notifications, watching
+// ref again whenever the connection is lost.
+func (t *SyncTree) run(ref *Firebase, notifications chan Event, stop chan struct{}) {
+	initial := false
+	for {
+		t.session(ref, notifications, stop, initial)
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(t.RetryDelay):
+			}
+
+			ref = ref.copy()
+			notifications = make(chan Event)
+			err := ref.Watch(notifications)
+			if err == nil {
+				break
+			}
+			t.handleError(err)
+		}
+		initial = true
+	}
+}
+
+func (t *SyncTree) session(ref *Firebase, notifications chan Event, stop chan struct{}, initial bool) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		ref.StopWatching()
+	}()
+
+	for event := range notifications {
+		switch event.Type {
+		case EventTypePut, EventTypePatch:
+			if initial {
+				t.mtx.Lock()
+				t.reset(event.Data)
+				t.mtx.Unlock()
+				initial = false
+				continue
+			}
+			t.apply(event)
+		case EventTypeError:
+			err, ok := event.Data.(error)
+			if !ok {
+				err = fmt.Errorf("Got error from event %#v", event)
+			}
+			t.handleError(err)
+		case EventTypeCancel, EventTypeAuthRevoked:
+			t.handleError(fmt.Errorf("watch ended by %s event", event.Type))
+		}
+	}
+}
+
+// reset replaces the local copy with the whole of the watched data.
+func (t *SyncTree) reset(data interface{}) {
+	t.server = fbsync.NewDB()
+	t.put("", data)
+	t.drop(func(w *treeWrite) bool { return w.acked })
+	t.save()
+}
+
+func (t *SyncTree) apply(event Event) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	path := strings.Trim(event.Path, "/")
+	if m, ok := event.Data.(map[string]interface{}); ok && event.Type == EventTypePatch {
+		for k, v := range m {
+			t.put(joinPath(path, k), v)
+		}
+	} else {
+		t.put(path, event.Data)
+	}
+	t.save()
+
+	// the accepted writes touching the location are confirmed
+	t.drop(func(w *treeWrite) bool {
+		if !w.acked {
+			return false
+		}
+		for _, s := range w.sets {
+			if pathsOverlap(s.path, path) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (t *SyncTree) put(path string, v interface{}) {
+	if v == nil {
+		t.server.Del(path)
+		return
+	}
+	t.server.Add(path, fbsync.NewNode("", v))
+}
+
+func (t *SyncTree) handleError(err error) {
+	if t.OnError != nil {
+		t.OnError(err)
+		return
+	}
+	log.Printf("SyncTree: %s", err)
+}
+
+// overlaySet returns v, the value at path, as changed by s.
+func overlaySet(v interface{}, path string, s treeSet) interface{} {
+	switch {
+	case s.path == path:
+		return s.value
+	case s.path == "" || strings.HasPrefix(path, s.path+"/"):
+		// the set replaced an ancestor of path
+		return valueAt(s.value, splitPath(path[len(s.path):]))
+	case path == "" || strings.HasPrefix(s.path, path+"/"):
+		// the set changed a descendant of path
+		return setValueAt(v, splitPath(s.path[len(path):]), s.value)
+	}
+	return v
+}
+
+func valueAt(v interface{}, path []string) interface{} {
+	for _, k := range path {
+		v = treeChildren(v)[k]
+	}
+	return v
+}
+
+// setValueAt returns a copy of v with the value at path replaced.
+func setValueAt(v interface{}, path []string, value interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+
+	children := treeChildren(v)
+	m := make(map[string]interface{}, len(children)+1)
+	for k, child := range children {
+		m[k] = child
+	}
+
+	if child := setValueAt(m[path[0]], path[1:], value); child != nil {
+		m[path[0]] = child
+	} else {
+		delete(m, path[0])
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// treeChildren returns the children of v, arrays being
+// objects keyed by index to Firebase.
+func treeChildren(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return v
+	case []interface{}:
+		m := make(map[string]interface{}, len(v))
+		for i, child := range v {
+			if child != nil {
+				m[strconv.Itoa(i)] = child
+			}
+		}
+		return m
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package firego
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestSyncTree(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("config", map[string]interface{}{"flags": map[string]interface{}{"beta": true}})
+
+	tree := NewSyncTree(New(server.URL, nil))
+	require.NoError(t, tree.Start())
+	defer tree.Stop()
+
+	var flags map[string]bool
+	require.NoError(t, tree.Value("config/flags", &flags))
+	assert.Equal(t, map[string]bool{"beta": true}, flags)
+
+	server.Set("config/flags/dark", false)
+	eventually(t, func() bool {
+		return tree.Get("config/flags/dark") == false
+	}, "change was not applied")
+
+	require.NoError(t, tree.Remove("config/flags"))
+	assert.Nil(t, tree.Get("config/flags"))
+	eventually(t, func() bool {
+		return server.Get("config/flags") == nil
+	}, "remove was not sent")
+}
+
+func TestSyncTreeStore(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("foo", "bar")
+
+	store := NewMemoryStore()
+	tree := NewSyncTree(New(server.URL, nil))
+	tree.Store = store
+	ok, err := tree.Load()
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, tree.Start())
+	server.Set("foo", "baz")
+	eventually(t, func() bool {
+		data, _, _ := store.Get(tree.storeKey())
+		return string(data) == `{"foo":"baz"}`
+	}, "local copy was not saved")
+	tree.Stop()
+
+	// a new tree can be read without connecting
+	tree = NewSyncTree(New(server.URL, nil))
+	tree.Store = store
+	ok, err = tree.Load()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "baz", tree.Get("foo"))
+}
+
+func TestSyncTreeStartWaiting(t *testing.T) {
+	t.Parallel()
+	connected := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		connected <- struct{}{}
+		<-req.Context().Done()
+	}))
+	defer server.Close()
+
+	tree := NewSyncTree(New(server.URL, nil))
+	started := make(chan error, 1)
+	go func() {
+		started <- tree.Start()
+	}()
+	select {
+	case <-connected:
+	case <-time.After(time.Second):
+		require.FailNow(t, "tree did not watch")
+	}
+
+	// the tree can be used while Start waits for the data
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.Nil(t, tree.Get("foo"))
+		assert.NoError(t, tree.Start())
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "tree blocked while starting")
+	}
+
+	tree.Stop()
+	select {
+	case err := <-started:
+		assert.EqualError(t, err, "sync tree: stopped while starting")
+	case <-time.After(time.Second):
+		require.FailNow(t, "Start did not return once stopped")
+	}
+}
+
+// pauseWrites makes the requests with the given method sent through fb
+// wait for release, closing sending when they are about to be sent.
+func pauseWrites(fb *Firebase, method string, sending, release chan struct{}, err error) {
+	fb.BeforeSend(func(req *http.Request, body []byte) error {
+		if req.Method != method {
+			return nil
+		}
+		close(sending)
+		<-release
+		return err
+	})
+}
+
+func TestSyncTreeOptimisticWrite(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("count", 1)
+
+	fb := New(server.URL, nil)
+	sending, release := make(chan struct{}), make(chan struct{})
+	pauseWrites(fb, "PUT", sending, release, nil)
+
+	tree := NewSyncTree(fb)
+	require.NoError(t, tree.Start())
+	defer tree.Stop()
+
+	done := make(chan error)
+	go func() {
+		done <- tree.Set("count", 2)
+	}()
+
+	<-sending
+	assert.Equal(t, float64(2), tree.Get("count"), "write should be visible before it is sent")
+	assert.Equal(t, map[string]interface{}{"count": float64(2)}, tree.Get(""))
+	assert.Equal(t, 1, server.Get("count"))
+
+	close(release)
+	require.NoError(t, <-done)
+	assert.Equal(t, float64(2), tree.Get("count"))
+	eventually(t, func() bool {
+		tree.mtx.RLock()
+		defer tree.mtx.RUnlock()
+		return len(tree.pending) == 0
+	}, "write was not confirmed")
+	assert.Equal(t, float64(2), tree.Get("count"))
+}
+
+func TestSyncTreeRollback(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("config", map[string]interface{}{"a": 1, "b": 1})
+
+	fb := New(server.URL, nil)
+	sending, release := make(chan struct{}), make(chan struct{})
+	denied := errors.New("denied")
+	pauseWrites(fb, "PATCH", sending, release, denied)
+
+	tree := NewSyncTree(fb)
+	require.NoError(t, tree.Start())
+	defer tree.Stop()
+
+	done := make(chan error)
+	go func() {
+		done <- tree.Update("config", map[string]interface{}{"a": nil, "b": 2, "c/d": 3})
+	}()
+
+	<-sending
+	assert.Equal(t, map[string]interface{}{
+		"b": float64(2),
+		"c": map[string]interface{}{"d": float64(3)},
+	}, tree.Get("config"))
+
+	close(release)
+	assert.Equal(t, denied, <-done)
+	assert.Equal(t, map[string]interface{}{"a": float64(1), "b": float64(1)}, tree.Get("config"))
+}
+
+func TestOverlaySet(t *testing.T) {
+	tree := map[string]interface{}{
+		"a": map[string]interface{}{"b": 1.0, "c": 2.0},
+	}
+
+	for _, tt := range []struct {
+		name     string
+		path     string
+		set      treeSet
+		expected interface{}
+	}{
+		{"same path", "a/b", treeSet{"a/b", 3.0}, 3.0},
+		{"ancestor", "a/b", treeSet{"a", map[string]interface{}{"b": 4.0}}, 4.0},
+		{"ancestor removed", "a/b", treeSet{"a", nil}, nil},
+		{
+			name:     "descendant",
+			path:     "",
+			set:      treeSet{"a/d", 5.0},
+			expected: map[string]interface{}{"a": map[string]interface{}{"b": 1.0, "c": 2.0, "d": 5.0}},
+		},
+		{
+			name:     "descendant removed",
+			path:     "a",
+			set:      treeSet{"a/b", nil},
+			expected: map[string]interface{}{"c": 2.0},
+		},
+		{"unrelated", "a/b", treeSet{"a/bb", 6.0}, 1.0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			v := valueAt(tree, splitPath(tt.path))
+			assert.Equal(t, tt.expected, overlaySet(v, tt.path, tt.set))
+		})
+	}
+
+	// the tree read from the server is left untouched
+	assert.Equal(t, map[string]interface{}{"b": 1.0, "c": 2.0}, tree["a"])
+}
@@ -0,0 +1,214 @@
+package firego
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quota limits the rate of requests of a tenant.
+type Quota struct {
+	// Rate is the sustained number of requests per second,
+	// zero means unlimited.
+	Rate float64
+	// Burst is the number of requests that can be made at once
+	// on top of Rate. It is at least one.
+	Burst int
+}
+
+// TenantStats holds the metrics collected for a tenant.
+type TenantStats struct {
+	// Requests is the number of requests sent.
+	Requests int64
+	// Errors is the number of requests that failed
+	// or received a response with a 4xx or 5xx status.
+	Errors int64
+	// Throttled is the number of requests that
+	// were delayed because of the tenant's quota.
+	Throttled int64
+	// Latency is the total time spent waiting for responses.
+	Latency time.Duration
+}
+
+// TenantManager hands out references for the tenants of a service sharing
+// a single Firebase project. The data of every tenant lives under its own
+// child of the manager's reference, which the tenant's references are
+// jailed to, and the requests of each tenant are subject to a Quota and
+// counted separately:
+//
+//    tm := firego.NewTenantManager(fb.Child("tenants"), firego.Quota{Rate: 50, Burst: 10})
+//    acme, err := tm.Tenant("acme")
+//    if err != nil {
+//        log.Fatal(err)
+//    }
+//    acme.Child("orders").Push(order)
+//    log.Printf("%+v", tm.Stats("acme"))
+//
+// Requests exceeding a quota wait for their turn, or until their
+// context is done.
+type TenantManager struct {
+	fb    *Firebase
+	quota Quota
+
+	mtx     sync.Mutex
+	tenants map[string]*tenant
+}
+
+// NewTenantManager creates a TenantManager for the tenants stored
+// under fb, applying quota to tenants without a quota of their own.
+func NewTenantManager(fb *Firebase, quota Quota) *TenantManager {
+	return &TenantManager{
+		fb:      fb,
+		quota:   quota,
+		tenants: map[string]*tenant{},
+	}
+}
+
+// Tenant returns a reference to the data of the tenant with the given ID,
+// jailed so that it can not reach the data of other tenants.
+func (m *TenantManager) Tenant(id string) (*Firebase, error) {
+	if id == "" || id == "." || strings.ContainsAny(id, "/#$[]") || hasDotDot(id) {
+		return nil, fmt.Errorf("invalid tenant id %q", id)
+	}
+
+	t := m.tenant(id)
+	ref := m.fb.Jail(id)
+	client := *ref.client
+	client.Transport = &tenantTransport{base: client.Transport, t: t}
+	ref.client = &client
+	return ref, nil
+}
+
+// SetQuota overrides the quota of a tenant.
+func (m *TenantManager) SetQuota(id string, quota Quota) {
+	m.tenant(id).limiter.setQuota(quota)
+}
+
+// Stats returns the metrics collected for a tenant.
+func (m *TenantManager) Stats(id string) TenantStats {
+	return m.tenant(id).stats()
+}
+
+// AllStats returns the metrics of every tenant, keyed by ID.
+func (m *TenantManager) AllStats() map[string]TenantStats {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	stats := make(map[string]TenantStats, len(m.tenants))
+	for id, t := range m.tenants {
+		stats[id] = t.stats()
+	}
+	return stats
+}
+
+func (m *TenantManager) tenant(id string) *tenant {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	t, ok := m.tenants[id]
+	if !ok {
+		t = &tenant{limiter: &tokenBucket{}}
+		t.limiter.setQuota(m.quota)
+		m.tenants[id] = t
+	}
+	return t
+}
+
+type tenant struct {
+	limiter *tokenBucket
+
+	mtx sync.Mutex
+	TenantStats
+}
+
+func (t *tenant) stats() TenantStats {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.TenantStats
+}
+
+// tenantTransport applies the quota of a tenant and records its metrics.
+type tenantTransport struct {
+	base http.RoundTripper
+	t    *tenant
+}
+
+func (tr *tenantTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if wait := tr.t.limiter.reserve(); wait > 0 {
+		tr.t.mtx.Lock()
+		tr.t.Throttled++
+		tr.t.mtx.Unlock()
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	base := tr.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	latency := time.Since(start)
+
+	tr.t.mtx.Lock()
+	tr.t.Requests++
+	tr.t.Latency += latency
+	if err != nil || resp.StatusCode >= 400 {
+		tr.t.Errors++
+	}
+	tr.t.mtx.Unlock()
+	return resp, err
+}
+
+// tokenBucket is a token bucket rate limiter.
+type tokenBucket struct {
+	mtx    sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) setQuota(q Quota) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.rate = q.Rate
+	b.burst = float64(q.Burst)
+	if b.burst < 1 {
+		b.burst = 1
+	}
+	b.tokens = b.burst
+	b.last = time.Now()
+}
+
+// reserve takes a token and returns how long to wait before it is
+// available. Tokens are taken in advance so that waiting requests
+// are served in order.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.rate <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
@@ -0,0 +1,69 @@
+package firego
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestTenantManager(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("tenants/globex/name", "Globex")
+
+	tm := NewTenantManager(New(server.URL, nil).Child("tenants"), Quota{})
+	acme, err := tm.Tenant("acme")
+	require.NoError(t, err)
+
+	require.NoError(t, acme.Child("name").Set("Acme"))
+	assert.Equal(t, "Acme", server.Get("tenants/acme/name"))
+	assert.Equal(t, ErrJailEscape, acme.Child("../globex/name").Set("pwned"))
+	assert.Equal(t, "Globex", server.Get("tenants/globex/name"))
+
+	server.RequireAuth(true)
+	assert.Error(t, acme.Child("name").Set("Acme"))
+
+	stats := tm.Stats("acme")
+	assert.Equal(t, int64(2), stats.Requests)
+	assert.Equal(t, int64(1), stats.Errors)
+	assert.Equal(t, int64(0), stats.Throttled)
+	assert.True(t, stats.Latency > 0)
+	assert.Equal(t, map[string]TenantStats{"acme": stats}, tm.AllStats())
+
+	for _, id := range []string{"", ".", "..", "a/b", "$a"} {
+		_, err := tm.Tenant(id)
+		assert.Error(t, err, id)
+	}
+}
+
+func TestTenantManagerQuota(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	tm := NewTenantManager(New(server.URL, nil), Quota{Rate: 20, Burst: 2})
+	tm.SetQuota("unlimited", Quota{})
+	acme, err := tm.Tenant("acme")
+	require.NoError(t, err)
+	unlimited, err := tm.Tenant("unlimited")
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, unlimited.Set(i))
+	}
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, acme.Set(i))
+	}
+	// the first two requests use the burst, the next two wait 50ms each
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+	assert.Equal(t, int64(2), tm.Stats("acme").Throttled)
+	assert.Equal(t, int64(0), tm.Stats("unlimited").Throttled)
+}
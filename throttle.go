@@ -0,0 +1,144 @@
+package firego
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ThrottleState tells whether Firebase is throttling the requests of a
+// reference, and how often it did.
+type ThrottleState struct {
+	// Until is when requests stop being held back, in the
+	// past or zero if they are not being held back.
+	Until time.Time
+	// Responses is the number of responses received with a Retry-After.
+	Responses int64
+	// Delayed is the number of requests that were held back.
+	Delayed int64
+}
+
+// Throttled reports whether requests are being held back.
+func (s ThrottleState) Throttled() bool {
+	return time.Now().Before(s.Until)
+}
+
+// defaultMaxRetryAfter is the default longest delay
+// taken from a Retry-After header.
+const defaultMaxRetryAfter = time.Minute
+
+// throttle is the throttling shared by a reference and
+// those derived from it.
+type throttle struct {
+	mtx   sync.Mutex
+	state ThrottleState
+	fn    func(until time.Time)
+	// max caps the delays of Retry-After headers, unlimited if
+	// not positive
+	max time.Duration
+}
+
+// Throttle returns the throttling state of the reference. When a 429 or
+// 503 response comes with a Retry-After header, every request of the
+// reference, and of the references created from the same call to New, is
+// held back until the time it gives has passed rather than only the
+// retries of the request that got it.
+func (fb *Firebase) Throttle() ThrottleState {
+	fb.throttle.mtx.Lock()
+	defer fb.throttle.mtx.Unlock()
+	return fb.throttle.state
+}
+
+// OnThrottle sets a function called with the time until which requests
+// are held back whenever a response with a Retry-After header pushes it
+// further, see Throttle.
+func (fb *Firebase) OnThrottle(fn func(until time.Time)) {
+	fb.throttle.mtx.Lock()
+	fb.throttle.fn = fn
+	fb.throttle.mtx.Unlock()
+}
+
+// SetMaxRetryAfter caps the delay requests are held back, and retried
+// after, by a Retry-After header, one minute by default, so that a wrong
+// or hostile header can not stall them for hours. A duration that is not
+// positive removes the cap. Like Throttle, it applies to the references
+// created from the same call to New.
+func (fb *Firebase) SetMaxRetryAfter(d time.Duration) {
+	fb.throttle.mtx.Lock()
+	fb.throttle.max = d
+	fb.throttle.mtx.Unlock()
+}
+
+// limit caps the delay of a Retry-After header.
+func (t *throttle) limit(d time.Duration) time.Duration {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.max > 0 && d > t.max {
+		return t.max
+	}
+	return d
+}
+
+// hold holds requests back for the given duration.
+func (t *throttle) hold(d time.Duration) {
+	until := time.Now().Add(d)
+
+	t.mtx.Lock()
+	t.state.Responses++
+	later := until.After(t.state.Until)
+	if later {
+		t.state.Until = until
+	}
+	fn := t.fn
+	t.mtx.Unlock()
+
+	if later && fn != nil {
+		fn(until)
+	}
+}
+
+// wait waits for requests to stop being held back, or for ctx to be done.
+func (t *throttle) wait(ctx context.Context) error {
+	t.mtx.Lock()
+	d := time.Until(t.state.Until)
+	if d > 0 {
+		t.state.Delayed++
+	}
+	t.mtx.Unlock()
+	if d <= 0 {
+		return nil
+	}
+
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryAfter returns the delay given by the Retry-After header of a 429
+// or 503 response, either in seconds or as a date, or 0 if there is none.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,95 @@
+package firego
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottle(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, `{"error":"slow down"}`, http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("null"))
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	var notified time.Time
+	fb.OnThrottle(func(until time.Time) { notified = until })
+
+	start := time.Now()
+	err := fb.Child("a").Value(new(interface{}))
+	var status *StatusError
+	require.True(t, errors.As(err, &status))
+	assert.Equal(t, time.Second, status.RetryAfter)
+
+	state := fb.Throttle()
+	assert.True(t, state.Throttled())
+	assert.Equal(t, state.Until, notified)
+	assert.Equal(t, int64(1), state.Responses)
+
+	// every reference of the client is held back
+	require.NoError(t, fb.Child("b").Value(new(interface{})))
+	assert.True(t, time.Since(start) >= time.Second)
+	state = fb.Throttle()
+	assert.False(t, state.Throttled())
+	assert.Equal(t, int64(1), state.Delayed)
+}
+
+func TestMaxRetryAfter(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Retry-After", "86400")
+		http.Error(w, `{"error":"slow down"}`, http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	err := fb.Value(new(interface{}))
+	var status *StatusError
+	require.True(t, errors.As(err, &status))
+	assert.Equal(t, time.Minute, status.RetryAfter)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), fb.Throttle().Until, time.Second)
+
+	fb = New(server.URL, nil)
+	fb.SetMaxRetryAfter(10 * time.Millisecond)
+	fb.SetRetryPolicy(RetryPolicy{MaxAttempts: 3})
+	start := time.Now()
+	err = fb.Value(new(interface{}))
+	require.True(t, errors.As(err, &status))
+	assert.Equal(t, 10*time.Millisecond, status.RetryAfter)
+	assert.True(t, time.Since(start) < time.Second, "requests held back for %s", time.Since(start))
+
+	fb = New(server.URL, nil)
+	fb.SetMaxRetryAfter(0)
+	err = fb.Value(new(interface{}))
+	require.True(t, errors.As(err, &status))
+	assert.Equal(t, 24*time.Hour, status.RetryAfter)
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+	resp := func(code int, v string) *http.Response {
+		return &http.Response{StatusCode: code, Header: http.Header{"Retry-After": {v}}}
+	}
+	assert.Equal(t, 2*time.Second, retryAfter(resp(http.StatusTooManyRequests, "2")))
+	assert.Equal(t, time.Duration(0), retryAfter(resp(http.StatusTooManyRequests, "-1")))
+	assert.Equal(t, time.Duration(0), retryAfter(resp(http.StatusInternalServerError, "2")))
+	assert.Equal(t, time.Duration(0), retryAfter(resp(http.StatusServiceUnavailable, "soon")))
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	d := retryAfter(resp(http.StatusServiceUnavailable, date))
+	assert.True(t, d > 58*time.Second && d <= time.Minute, d.String())
+}
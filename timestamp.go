@@ -0,0 +1,80 @@
+package firego
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// Millis is a point in time expressed as milliseconds since the Unix epoch,
+// the format Firebase uses for timestamps. Since it is stored as a number
+// it sorts chronologically when used with OrderBy.
+type Millis int64
+
+// NewMillis converts t into Millis. The zero time.Time is converted into
+// the zero Millis, rather than the distant past it stands for, so that
+// it converts back into the zero time.Time.
+func NewMillis(t time.Time) Millis {
+	if t.IsZero() {
+		return 0
+	}
+	return Millis(t.UnixNano() / int64(time.Millisecond))
+}
+
+// Time converts m into a time.Time, the zero one for the zero Millis.
+func (m Millis) Time() time.Time {
+	if m == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(m)*int64(time.Millisecond))
+}
+
+// Time wraps time.Time so that it is stored in Firebase as milliseconds since
+// the Unix epoch rather than an RFC 3339 string. The zero Time is stored
+// as null.
+type Time struct {
+	time.Time
+}
+
+// MarshalJSON encodes t as milliseconds since the Unix epoch.
+func (t Time) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(NewMillis(t.Time))
+}
+
+// UnmarshalJSON decodes milliseconds since the Unix epoch into t.
+func (t *Time) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		t.Time = time.Time{}
+		return nil
+	}
+
+	var ms float64
+	if err := json.Unmarshal(b, &ms); err != nil {
+		return err
+	}
+	t.Time = millisToTime(ms)
+	return nil
+}
+
+// StartAtTime creates a new Firebase reference that starts
+// at the given time, for children ordered by a timestamp.
+//
+//    OrderBy("created").StartAtTime(t) // -> startAt=<t in milliseconds>
+func (fb *Firebase) StartAtTime(t time.Time) *Firebase {
+	return fb.StartAtValue(int64(NewMillis(t)))
+}
+
+// EndAtTime creates a new Firebase reference that ends
+// at the given time, for children ordered by a timestamp.
+//
+//    OrderBy("created").EndAtTime(t) // -> endAt=<t in milliseconds>
+func (fb *Firebase) EndAtTime(t time.Time) *Firebase {
+	return fb.EndAtValue(int64(NewMillis(t)))
+}
+
+func millisToTime(ms float64) time.Time {
+	return Millis(ms).Time()
+}
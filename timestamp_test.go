@@ -0,0 +1,63 @@
+package firego
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMillis(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(1500000000, 123000000)
+
+	m := NewMillis(now)
+	assert.Equal(t, Millis(1500000000123), m)
+	assert.True(t, now.Equal(m.Time()))
+
+	assert.Equal(t, Millis(0), NewMillis(time.Time{}))
+	assert.True(t, NewMillis(time.Time{}).Time().IsZero())
+}
+
+func TestTimeJSON(t *testing.T) {
+	t.Parallel()
+	type event struct {
+		At   Time  `json:"at"`
+		Zero Time  `json:"zero"`
+		Ptr  *Time `json:"ptr"`
+	}
+
+	at := time.Unix(1500000000, 123000000)
+	b, err := json.Marshal(event{At: Time{at}, Ptr: &Time{at}})
+	require.NoError(t, err)
+	assert.Equal(t, `{"at":1500000000123,"zero":null,"ptr":1500000000123}`, string(b))
+
+	var e event
+	require.NoError(t, json.Unmarshal(b, &e))
+	assert.True(t, at.Equal(e.At.Time))
+	assert.True(t, e.Zero.IsZero())
+	require.NotNil(t, e.Ptr)
+	assert.True(t, at.Equal(e.Ptr.Time))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"at":"yesterday"}`), &e))
+}
+
+func TestStartAtEndAtTime(t *testing.T) {
+	t.Parallel()
+	var (
+		server = newTestServer("")
+		fb     = New(server.URL, nil)
+		start  = time.Unix(1500000000, 0)
+		end    = start.Add(time.Hour)
+	)
+	defer server.Close()
+
+	fb.OrderBy("created").StartAtTime(start).EndAtTime(end).Value("")
+	require.Len(t, server.receivedReqs, 1)
+
+	req := server.receivedReqs[0]
+	assert.Equal(t, "1500000000000", req.URL.Query().Get(startAtParam))
+	assert.Equal(t, "1500003600000", req.URL.Query().Get(endAtParam))
+}
@@ -0,0 +1,204 @@
+package firego
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenSource provides the tokens used to authenticate to Firebase.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// TokenSourceFunc is an adapter to allow the use of ordinary
+// functions as a TokenSource.
+type TokenSourceFunc func() (string, error)
+
+// Token calls f().
+func (f TokenSourceFunc) Token() (string, error) {
+	return f()
+}
+
+// ErrNoExpiry is returned by TokenExpiry when a token
+// does not carry an exp claim.
+var ErrNoExpiry = errors.New("token has no expiry")
+
+// TokenExpiry parses the exp claim of a JWT. The signature of
+// the token is not verified.
+func TokenExpiry(token string) (time.Time, error) {
+	var v struct {
+		Exp *float64 `json:"exp"`
+	}
+	if err := decodeClaims(token, &v); err != nil {
+		return time.Time{}, err
+	}
+	if v.Exp == nil {
+		return time.Time{}, ErrNoExpiry
+	}
+	return time.Unix(int64(*v.Exp), 0), nil
+}
+
+// decodeClaims unmarshals the claims of a JWT into v without
+// verifying its signature.
+func decodeClaims(token string, v interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("token is not a JWT")
+	}
+
+	claims, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return fmt.Errorf("failed to decode token claims %w", err)
+	}
+	if err := json.Unmarshal(claims, v); err != nil {
+		return fmt.Errorf("failed to unmarshal token claims %w", err)
+	}
+	return nil
+}
+
+// TokenRefresher is a TokenSource that caches the token of another
+// TokenSource and, once started, refreshes it on a background goroutine
+// shortly before the expiry found in its exp claim instead of waiting for
+// Firebase to reject it. Tokens without an exp claim are never refreshed.
+//
+//    tr := firego.NewTokenRefresher(src, time.Minute)
+//    if err := tr.Start(); err != nil {
+//        log.Fatal(err)
+//    }
+//    defer tr.Stop()
+//    fb.AuthTokenSource(tr)
+type TokenRefresher struct {
+	// RetryDelay is how long to wait before trying again when the
+	// underlying TokenSource fails. It defaults to 10 seconds.
+	RetryDelay time.Duration
+	// OnError, if set, is called whenever refreshing fails.
+	OnError func(error)
+
+	src    TokenSource
+	margin time.Duration
+
+	mtx    sync.Mutex
+	token  string
+	expiry time.Time
+	stop   chan struct{}
+}
+
+// NewTokenRefresher creates a TokenRefresher that refreshes
+// tokens from src margin before they expire.
+func NewTokenRefresher(src TokenSource, margin time.Duration) *TokenRefresher {
+	return &TokenRefresher{
+		RetryDelay: 10 * time.Second,
+		src:        src,
+		margin:     margin,
+	}
+}
+
+// Start fetches the initial token and keeps refreshing
+// it in the background until Stop is called.
+func (tr *TokenRefresher) Start() error {
+	if err := tr.refresh(); err != nil {
+		return err
+	}
+
+	tr.mtx.Lock()
+	defer tr.mtx.Unlock()
+	if tr.stop != nil {
+		// already running
+		return nil
+	}
+
+	stop := make(chan struct{})
+	tr.stop = stop
+	go tr.run(stop)
+	return nil
+}
+
+// Stop stops refreshing the token. The current
+// token keeps being used until it expires.
+func (tr *TokenRefresher) Stop() {
+	tr.mtx.Lock()
+	if tr.stop != nil {
+		close(tr.stop)
+		tr.stop = nil
+	}
+	tr.mtx.Unlock()
+}
+
+// Token returns the cached token, fetching one if there is none yet or if
+// it expired, as it does when refreshing keeps failing or the refresher is
+// stopped, in which case the error of the underlying TokenSource is
+// returned rather than the expired token.
+func (tr *TokenRefresher) Token() (string, error) {
+	tr.mtx.Lock()
+	token, expiry := tr.token, tr.expiry
+	tr.mtx.Unlock()
+	if token != "" && (expiry.IsZero() || time.Now().Before(expiry)) {
+		return token, nil
+	}
+
+	if err := tr.refresh(); err != nil {
+		return "", err
+	}
+	tr.mtx.Lock()
+	defer tr.mtx.Unlock()
+	return tr.token, nil
+}
+
+func (tr *TokenRefresher) run(stop chan struct{}) {
+	tr.mtx.Lock()
+	expiry := tr.expiry
+	tr.mtx.Unlock()
+
+	for !expiry.IsZero() {
+		wait := time.Until(expiry.Add(-tr.margin))
+		if wait <= 0 {
+			// the token is already due, as short-lived or cached
+			// tokens may be, don't fetch it again right away
+			wait = tr.RetryDelay
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := tr.refresh(); err != nil {
+			if tr.OnError != nil {
+				tr.OnError(err)
+			} else {
+				log.Printf("TokenRefresher: failed to refresh token: %s", err)
+			}
+			// try again later
+			expiry = time.Now().Add(tr.margin + tr.RetryDelay)
+			continue
+		}
+
+		tr.mtx.Lock()
+		expiry = tr.expiry
+		tr.mtx.Unlock()
+	}
+}
+
+func (tr *TokenRefresher) refresh() error {
+	token, err := tr.src.Token()
+	if err != nil {
+		return err
+	}
+
+	// tokens that can not be parsed are assumed to never expire
+	expiry, _ := TokenExpiry(token)
+
+	tr.mtx.Lock()
+	tr.token = token
+	tr.expiry = expiry
+	tr.mtx.Unlock()
+	return nil
+}
@@ -0,0 +1,164 @@
+package firego
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func testJWT(claims string) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	return enc([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc([]byte(claims)) + ".c2ln"
+}
+
+func TestTokenExpiry(t *testing.T) {
+	t.Parallel()
+	exp, err := TokenExpiry(testJWT(`{"exp":1500000000,"d":{"uid":"1"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1500000000, 0), exp)
+
+	_, err = TokenExpiry(testJWT(`{"d":{"uid":"1"}}`))
+	assert.Equal(t, ErrNoExpiry, err)
+
+	_, err = TokenExpiry("legacy-secret")
+	assert.Error(t, err)
+
+	_, err = TokenExpiry("a.!!!.c")
+	assert.Error(t, err)
+}
+
+func TestTokenRefresher(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	src := TokenSourceFunc(func() (string, error) {
+		n := atomic.AddInt32(&calls, 1)
+		exp := time.Now().Add(time.Hour).Unix()
+		return testJWT(fmt.Sprintf(`{"exp":%d,"n":%d}`, exp, n)), nil
+	})
+
+	// refresh a few milliseconds after the token is issued
+	tr := NewTokenRefresher(src, time.Hour-1500*time.Millisecond)
+	require.NoError(t, tr.Start())
+	defer tr.Stop()
+
+	first, err := tr.Token()
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+
+	eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) > 1
+	}, "token was not refreshed")
+
+	second, err := tr.Token()
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
+
+func TestTokenRefresherError(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	src := TokenSourceFunc(func() (string, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			exp := time.Now().Add(time.Hour).Unix()
+			return testJWT(fmt.Sprintf(`{"exp":%d}`, exp)), nil
+		}
+		return "", errors.New("boom")
+	})
+
+	errs := make(chan error, 10)
+	tr := NewTokenRefresher(src, time.Hour-1500*time.Millisecond)
+	tr.RetryDelay = time.Millisecond
+	tr.OnError = func(err error) { errs <- err }
+	require.NoError(t, tr.Start())
+	defer tr.Stop()
+
+	select {
+	case err := <-errs:
+		assert.EqualError(t, err, "boom")
+	case <-time.After(3 * time.Second):
+		require.FailNow(t, "error was not reported")
+	}
+
+	// the previous token is still served
+	token, err := tr.Token()
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+}
+
+func TestTokenRefresherDueToken(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	src := TokenSourceFunc(func() (string, error) {
+		atomic.AddInt32(&calls, 1)
+		exp := time.Now().Add(time.Minute).Unix()
+		return testJWT(fmt.Sprintf(`{"exp":%d}`, exp)), nil
+	})
+
+	// every token is due as soon as it is fetched
+	tr := NewTokenRefresher(src, time.Hour)
+	tr.RetryDelay = 50 * time.Millisecond
+	require.NoError(t, tr.Start())
+	time.Sleep(120 * time.Millisecond)
+	tr.Stop()
+
+	n := atomic.LoadInt32(&calls)
+	assert.True(t, n >= 2 && n <= 4, "%d tokens fetched", n)
+}
+
+func TestTokenRefresherExpiredToken(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	src := TokenSourceFunc(func() (string, error) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			exp := time.Now().Add(-time.Minute).Unix()
+			return testJWT(fmt.Sprintf(`{"exp":%d}`, exp)), nil
+		case 2:
+			return "", errors.New("boom")
+		}
+		exp := time.Now().Add(time.Hour).Unix()
+		return testJWT(fmt.Sprintf(`{"exp":%d}`, exp)), nil
+	})
+
+	tr := NewTokenRefresher(src, time.Minute)
+	expired, err := tr.Token()
+	require.NoError(t, err)
+
+	// the expired token is not served
+	_, err = tr.Token()
+	assert.EqualError(t, err, "boom")
+
+	token, err := tr.Token()
+	require.NoError(t, err)
+	assert.NotEqual(t, expired, token)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+}
+
+func TestAuthTokenSource(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.RequireAuth(true)
+
+	fb := New(server.URL, nil)
+	fb.AuthTokenSource(TokenSourceFunc(func() (string, error) {
+		return server.Secret, nil
+	}))
+	fb.SetAuthStyle(AuthStyleHeader)
+
+	var v interface{}
+	assert.NoError(t, fb.Child("foo").Value(&v))
+
+	fb.AuthTokenSource(TokenSourceFunc(func() (string, error) {
+		return "", errors.New("no token")
+	}))
+	assert.Error(t, fb.Value(&v))
+}
@@ -1,7 +1,6 @@
 package firego
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -11,14 +10,14 @@ import (
 // See Firebase.Transaction for more information.
 type TransactionFn func(currentSnapshot interface{}) (result interface{}, err error)
 
-func getTransactionParams(headers http.Header, body []byte) (etag string, snapshot interface{}, err error) {
+func (fb *Firebase) getTransactionParams(headers http.Header, body []byte) (etag string, snapshot interface{}, err error) {
 	etag = headers.Get("ETag")
 	if len(etag) == 0 {
 		return etag, snapshot, errors.New("no etag returned by Firebase")
 	}
 
-	if err := json.Unmarshal(body, &snapshot); err != nil {
-		return etag, snapshot, fmt.Errorf("failed to unmarshal Firebase response. %s", err)
+	if err := fb.decode(body, &snapshot); err != nil {
+		return etag, snapshot, fmt.Errorf("failed to unmarshal Firebase response. %w", err)
 	}
 
 	return etag, snapshot, nil
@@ -34,13 +33,17 @@ func getTransactionParams(headers http.Header, body []byte) (etag string, snapsh
 //
 // Best practices for this method are to rely only on the data that is passed in.
 func (fb *Firebase) Transaction(fn TransactionFn) error {
+	if fb.readOnly {
+		return ErrReadOnly
+	}
+
 	// fetch etag and current value
 	headers, body, err := fb.doRequest("GET", nil, withHeader("X-Firebase-ETag", "true"))
 	if err != nil {
 		return err
 	}
 
-	etag, snapshot, err := getTransactionParams(headers, body)
+	etag, snapshot, err := fb.getTransactionParams(headers, body)
 	if err != nil {
 		return err
 	}
@@ -55,9 +58,9 @@ func (fb *Firebase) Transaction(fn TransactionFn) error {
 			return nil
 		}
 
-		newBody, err := json.Marshal(result)
+		newBody, err := fb.encode(result, false)
 		if err != nil {
-			return fmt.Errorf("failed to marshal transaction result. %s", err)
+			return fmt.Errorf("failed to marshal transaction result. %w", err)
 		}
 
 		// attempt to update it
@@ -68,7 +71,7 @@ func (fb *Firebase) Transaction(fn TransactionFn) error {
 		}
 
 		// we failed to update, so grab the new snapshot/etag
-		e, s, tErr := getTransactionParams(headers, body)
+		e, s, tErr := fb.getTransactionParams(headers, body)
 		if tErr != nil {
 			return tErr
 		}
@@ -76,7 +79,7 @@ func (fb *Firebase) Transaction(fn TransactionFn) error {
 	}
 
 	if tErr != nil {
-		return fmt.Errorf("failed to run transaction. %s", tErr)
+		return fmt.Errorf("failed to run transaction. %w", tErr)
 	}
 	return nil
 }
@@ -0,0 +1,158 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+// TransformFunc is called by Transform with the path of a matching
+// location, relative to the reference transformed, and its value. It
+// returns the new value of the location, nil removing it.
+type TransformFunc func(path string, value interface{}) (interface{}, error)
+
+// TransformOptions configures Transform.
+type TransformOptions struct {
+	// DryRun calls the TransformFunc and reports the changes without
+	// writing them.
+	DryRun bool
+	// BatchSize is the number of changed locations written by a
+	// single update, 100 by default.
+	BatchSize int
+	// Concurrency is the number of locations read at once, see WalkOptions.
+	Concurrency int
+	// OnProgress, if set, is called with the progress of the
+	// transform after every batch.
+	OnProgress func(stats TransformStats)
+}
+
+// TransformStats reports the progress of a Transform.
+type TransformStats struct {
+	// Matched is the number of locations matching the pattern.
+	Matched int
+	// Changed is the number of locations changed by the TransformFunc.
+	Changed int
+	// Written is the number of changed locations written to Firebase,
+	// which stays zero in a dry run.
+	Written int
+}
+
+// Transform migrates the data at fb by calling fn with the value of every
+// location matching pattern, relative to fb, and writing back the values
+// fn changed:
+//
+//    users, _ := firego.ParsePathPattern("/{uid}/profile")
+//    stats, err := firego.Transform(ctx, fb.Child("users"), users, firego.TransformOptions{}, func(path string, v interface{}) (interface{}, error) {
+//        profile, _ := v.(map[string]interface{})
+//        if name, ok := profile["name"].(string); ok {
+//            profile["displayName"] = name
+//            delete(profile, "name")
+//        }
+//        return profile, nil
+//    })
+//
+// The data is read with Walk, skipping the locations that can not match,
+// and the changes are written in batches of multi-location updates. Since
+// the changes of a batch are only written once it is full, the data is
+// partly migrated if fn, or a write, fails, and running the transform
+// again must leave the locations already migrated unchanged.
+func Transform(ctx context.Context, fb *Firebase, pattern *PathPattern, opts TransformOptions, fn TransformFunc) (TransformStats, error) {
+	if len(pattern.segments) == 0 {
+		return TransformStats{}, errors.New("transform: the pattern must match locations below the reference")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	t := &transformer{ref: fb.WithContext(ctx), opts: opts, batch: map[string]interface{}{}}
+	err := walkPattern(ctx, fb, pattern, opts.Concurrency, func(path string, raw json.RawMessage) error {
+		return t.transform(path, raw, fn)
+	})
+	if err == nil {
+		err = t.flush()
+	}
+	return t.stats, err
+}
+
+type transformer struct {
+	ref   *Firebase
+	opts  TransformOptions
+	stats TransformStats
+	// batch holds the changes not written yet, by path
+	batch map[string]interface{}
+}
+
+func (t *transformer) transform(path string, raw json.RawMessage, fn TransformFunc) error {
+	t.stats.Matched++
+	// fn may modify the value it is given
+	var before, value interface{}
+	if err := t.ref.decode(raw, &before); err != nil {
+		return err
+	}
+	if err := t.ref.decode(raw, &value); err != nil {
+		return err
+	}
+	after, err := fn(path, value)
+	if err != nil {
+		return err
+	}
+
+	// compare the values as Firebase would store them
+	data, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+	var stored interface{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	if reflect.DeepEqual(before, stored) {
+		return nil
+	}
+
+	t.stats.Changed++
+	t.batch[path] = after
+	if len(t.batch) >= t.opts.BatchSize {
+		return t.flush()
+	}
+	return nil
+}
+
+// flush writes the batch.
+func (t *transformer) flush() error {
+	if len(t.batch) > 0 && !t.opts.DryRun {
+		body, err := t.ref.encode(t.batch, true)
+		if err != nil {
+			return err
+		}
+		if _, _, err := t.ref.doRequest("PATCH", body); err != nil {
+			return err
+		}
+		t.stats.Written += len(t.batch)
+	}
+	if len(t.batch) > 0 && t.opts.OnProgress != nil {
+		t.opts.OnProgress(t.stats)
+	}
+	t.batch = map[string]interface{}{}
+	return nil
+}
+
+// walkPattern calls fn with the value of every location under fb matching
+// pattern, only reading the locations that may match.
+func walkPattern(ctx context.Context, fb *Firebase, pattern *PathPattern, concurrency int, fn WalkFunc) error {
+	opts := WalkOptions{
+		Concurrency: concurrency,
+		MaxDepth:    len(pattern.segments),
+		Skip: func(path string) bool {
+			_, ok := pattern.MatchPrefix(path)
+			return !ok
+		},
+	}
+	return Walk(ctx, fb, opts, func(path string, raw json.RawMessage) error {
+		if _, ok := pattern.Match(path); !ok {
+			return nil
+		}
+		return fn(path, raw)
+	})
+}
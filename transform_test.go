@@ -0,0 +1,91 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func transformServer() *firetest.Firetest {
+	server := firetest.New()
+	server.Start()
+	server.Set("users", map[string]interface{}{
+		"alice": map[string]interface{}{"profile": map[string]interface{}{"name": "Alice"}, "posts": 3},
+		"bob":   map[string]interface{}{"profile": map[string]interface{}{"displayName": "Bob"}},
+		"carol": map[string]interface{}{"profile": map[string]interface{}{"name": "Carol"}},
+	})
+	return server
+}
+
+func renameProfile(path string, v interface{}) (interface{}, error) {
+	profile, _ := v.(map[string]interface{})
+	if name, ok := profile["name"]; ok {
+		profile["displayName"] = name
+		delete(profile, "name")
+	}
+	return profile, nil
+}
+
+func TestTransform(t *testing.T) {
+	t.Parallel()
+	server := transformServer()
+	defer server.Close()
+
+	pattern, err := ParsePathPattern("/{uid}/profile")
+	require.NoError(t, err)
+
+	var progress []TransformStats
+	opts := TransformOptions{BatchSize: 1, OnProgress: func(s TransformStats) { progress = append(progress, s) }}
+	stats, err := Transform(context.Background(), New(server.URL, nil).Child("users"), pattern, opts, renameProfile)
+	require.NoError(t, err)
+	assert.Equal(t, TransformStats{Matched: 3, Changed: 2, Written: 2}, stats)
+	assert.Len(t, progress, 2)
+	assert.Equal(t, map[string]interface{}{
+		"alice": map[string]interface{}{"profile": map[string]interface{}{"displayName": "Alice"}, "posts": 3},
+		"bob":   map[string]interface{}{"profile": map[string]interface{}{"displayName": "Bob"}},
+		"carol": map[string]interface{}{"profile": map[string]interface{}{"displayName": "Carol"}},
+	}, server.Get("users"))
+
+	// running it again changes nothing
+	stats, err = Transform(context.Background(), New(server.URL, nil).Child("users"), pattern, TransformOptions{}, renameProfile)
+	require.NoError(t, err)
+	assert.Equal(t, TransformStats{Matched: 3}, stats)
+}
+
+func TestTransformDryRun(t *testing.T) {
+	t.Parallel()
+	server := transformServer()
+	defer server.Close()
+
+	pattern, err := ParsePathPattern("/{uid}/profile")
+	require.NoError(t, err)
+	before := server.Get("users")
+
+	stats, err := Transform(context.Background(), New(server.URL, nil).Child("users"), pattern, TransformOptions{DryRun: true}, renameProfile)
+	require.NoError(t, err)
+	assert.Equal(t, TransformStats{Matched: 3, Changed: 2}, stats)
+	assert.Equal(t, before, server.Get("users"))
+}
+
+func TestTransformError(t *testing.T) {
+	t.Parallel()
+	server := transformServer()
+	defer server.Close()
+
+	pattern, err := ParsePathPattern("/{uid}/posts")
+	require.NoError(t, err)
+
+	failed := errors.New("failed")
+	_, err = Transform(context.Background(), New(server.URL, nil).Child("users"), pattern, TransformOptions{}, func(path string, v interface{}) (interface{}, error) {
+		assert.Equal(t, "alice/posts", path)
+		return nil, failed
+	})
+	assert.Equal(t, failed, err)
+
+	_, err = Transform(context.Background(), New(server.URL, nil), &PathPattern{}, TransformOptions{}, renameProfile)
+	assert.Error(t, err)
+}
@@ -0,0 +1,376 @@
+package firego
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	fbsync "github.com/zabawaba99/firego/sync"
+)
+
+// Change describes a write to a location matched by a trigger.
+type Change struct {
+	// Path of the location that changed, e.g. "/orders/42".
+	Path string
+	// Params holds the values captured by the wildcards of the
+	// trigger's pattern, e.g. {"id": "42"} for "/orders/{id}".
+	Params map[string]string
+	// Before is the data at the location before the write.
+	// Its Value is nil if the location did not exist.
+	Before DataSnapshot
+	// After is the data at the location after the write.
+	// Its Value is nil if the location was deleted.
+	After DataSnapshot
+}
+
+// TriggerFunc handles a change to a location matched by a trigger.
+type TriggerFunc func(change Change) error
+
+type triggerKind int
+
+const (
+	triggerWrite triggerKind = iota
+	triggerCreate
+	triggerUpdate
+	triggerDelete
+)
+
+type trigger struct {
+	pattern *PathPattern
+	kind    triggerKind
+	fn      TriggerFunc
+}
+
+// Triggers runs handlers when the data at locations matching path patterns
+// changes, in the style of the database triggers of Cloud Functions:
+//
+//    t := firego.NewTriggers(fb)
+//    t.OnCreate("/orders/{id}", func(c firego.Change) error {
+//        log.Printf("new order %s: %v", c.Params["id"], c.After.Value)
+//        return nil
+//    })
+//    if err := t.Start(); err != nil {
+//        log.Fatal(err)
+//    }
+//    defer t.Stop()
+//
+// Patterns follow the syntax of PathPattern. The part of every pattern
+// before its first wildcard is watched and handlers are called one at a time, in the order
+// the changes happen. Data existing when watching starts, or changed while
+// the connection is being re-established, does not trigger handlers.
+type Triggers struct {
+	// OnError is called when a handler fails or the connection is lost.
+	// Errors are logged if it is nil.
+	OnError func(path string, err error)
+	// RetryDelay is how long to wait before watching again after
+	// the connection is lost. It defaults to one second.
+	RetryDelay time.Duration
+
+	fb       *Firebase
+	triggers []*trigger
+
+	mtx     sync.Mutex
+	stop    chan struct{}
+	running sync.WaitGroup
+}
+
+// NewTriggers creates a Triggers for patterns relative to fb.
+func NewTriggers(fb *Firebase) *Triggers {
+	return &Triggers{fb: fb, RetryDelay: time.Second}
+}
+
+// OnWrite calls fn whenever a location matching
+// pattern is created, updated or deleted.
+func (t *Triggers) OnWrite(pattern string, fn TriggerFunc) error {
+	return t.add(pattern, triggerWrite, fn)
+}
+
+// OnCreate calls fn whenever a location matching pattern is created.
+func (t *Triggers) OnCreate(pattern string, fn TriggerFunc) error {
+	return t.add(pattern, triggerCreate, fn)
+}
+
+// OnUpdate calls fn whenever an existing location matching pattern changes.
+func (t *Triggers) OnUpdate(pattern string, fn TriggerFunc) error {
+	return t.add(pattern, triggerUpdate, fn)
+}
+
+// OnDelete calls fn whenever a location matching pattern is deleted.
+func (t *Triggers) OnDelete(pattern string, fn TriggerFunc) error {
+	return t.add(pattern, triggerDelete, fn)
+}
+
+func (t *Triggers) add(pattern string, kind triggerKind, fn TriggerFunc) error {
+	p, err := ParsePathPattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.stop != nil {
+		return fmt.Errorf("triggers can not be added once started")
+	}
+	t.triggers = append(t.triggers, &trigger{pattern: p, kind: kind, fn: fn})
+	return nil
+}
+
+// Start watches the locations needed by the registered triggers. It returns
+// once every watch has been established.
+func (t *Triggers) Start() error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.stop != nil {
+		// already running
+		return nil
+	}
+
+	// group the triggers by the location they need to watch
+	var roots []string
+	groups := map[string][]*trigger{}
+	for _, tr := range t.triggers {
+		root := strings.Join(tr.pattern.staticPrefix(), "/")
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], tr)
+	}
+
+	stop := make(chan struct{})
+	var refs []*Firebase
+	for _, root := range roots {
+		ref := t.fb.at(root)
+		notifications := make(chan Event)
+		if err := ref.Watch(notifications); err != nil {
+			for _, ref := range refs {
+				ref.StopWatching()
+			}
+			return err
+		}
+		refs = append(refs, ref)
+
+		w := &triggerWatch{t: t, root: splitPath(root), triggers: groups[root]}
+		t.running.Add(1)
+		go func() {
+			defer t.running.Done()
+			w.run(ref, notifications, stop)
+		}()
+	}
+
+	t.stop = stop
+	return nil
+}
+
+// Stop stops watching and waits for running handlers to return.
+func (t *Triggers) Stop() {
+	t.mtx.Lock()
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+	t.mtx.Unlock()
+
+	t.running.Wait()
+}
+
+func (t *Triggers) handleError(path string, err error) {
+	if t.OnError != nil {
+		t.OnError(path, err)
+		return
+	}
+	log.Printf("Triggers: %s: %s", path, err)
+}
+
+// triggerWatch feeds the triggers sharing the same static prefix.
+type triggerWatch struct {
+	t        *Triggers
+	root     []string
+	triggers []*trigger
+
+	mirror *fbsync.Database
+}
+
+// run feeds the triggers from notifications, watching
+// ref again whenever the connection is lost.
+func (w *triggerWatch) run(ref *Firebase, notifications chan Event, stop chan struct{}) {
+	for {
+		w.session(ref, notifications, stop)
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(w.t.RetryDelay):
+			}
+
+			ref = ref.copy()
+			notifications = make(chan Event)
+			err := ref.Watch(notifications)
+			if err == nil {
+				break
+			}
+			w.t.handleError(w.path(), err)
+		}
+	}
+}
+
+func (w *triggerWatch) session(ref *Firebase, notifications chan Event, stop chan struct{}) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		ref.StopWatching()
+	}()
+
+	w.mirror = fbsync.NewDB()
+	first := true
+	for event := range notifications {
+		switch event.Type {
+		case EventTypePut, EventTypePatch:
+			w.apply(event, first)
+			first = false
+		case EventTypeError, EventTypeCancel, EventTypeAuthRevoked:
+			w.t.handleError(w.path(), fmt.Errorf("watch ended by %s event", event.Type))
+		}
+	}
+}
+
+func (w *triggerWatch) path() string {
+	return "/" + strings.Join(w.root, "/")
+}
+
+// apply updates the mirror with the event and calls the handlers of the
+// triggers whose locations changed.
+func (w *triggerWatch) apply(event Event, initial bool) {
+	if initial {
+		// the first event holds the whole of the watched location
+		w.put("", event.Data)
+		return
+	}
+	path := splitPath(event.Path)
+
+	// the locations whose before and after values need comparing
+	// are the event's path cut to the length of each pattern
+	type location struct {
+		t      *trigger
+		path   []string
+		before interface{}
+	}
+	locations := make([]location, 0, len(w.triggers))
+	for _, tr := range w.triggers {
+		n := len(tr.pattern.segments) - len(w.root)
+		if n > len(path) {
+			n = len(path)
+		}
+		locations = append(locations, location{t: tr, path: path[:n], before: w.value(path[:n])})
+	}
+
+	p := strings.Join(path, "/")
+	switch {
+	case event.Type == EventTypePatch:
+		m, _ := event.Data.(map[string]interface{})
+		for k, v := range m {
+			w.put(joinPath(p, k), v)
+		}
+	default:
+		w.put(p, event.Data)
+	}
+
+	for _, l := range locations {
+		full := append(append([]string{}, w.root...), l.path...)
+		params, ok := l.t.pattern.matchPrefix(full)
+		if !ok {
+			continue
+		}
+		rest := l.t.pattern.segments[len(full):]
+		w.fire(l.t, full, rest, params, l.before, w.value(l.path))
+	}
+}
+
+// fire calls the handler of t for every location under path matching
+// the rest of the pattern that differs between before and after.
+func (w *triggerWatch) fire(t *trigger, path, rest []string, params map[string]string, before, after interface{}) {
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+
+	if len(rest) > 0 {
+		keys := []string{rest[0]}
+		name, wildcard := wildcardName(rest[0])
+		if wildcard {
+			keys = unionKeys(before, after)
+		}
+		for _, k := range keys {
+			childParams := params
+			if wildcard {
+				childParams = make(map[string]string, len(params)+1)
+				for pk, pv := range params {
+					childParams[pk] = pv
+				}
+				childParams[name] = k
+			}
+			childPath := append(append([]string{}, path...), k)
+			w.fire(t, childPath, rest[1:], childParams, childValue(before, k), childValue(after, k))
+		}
+		return
+	}
+
+	switch {
+	case t.kind == triggerCreate && (before != nil || after == nil),
+		t.kind == triggerUpdate && (before == nil || after == nil),
+		t.kind == triggerDelete && (before == nil || after != nil):
+		return
+	}
+
+	var key string
+	if len(path) > 0 {
+		key = path[len(path)-1]
+	}
+	change := Change{
+		Path:   "/" + strings.Join(path, "/"),
+		Params: params,
+		Before: DataSnapshot{Key: key, Value: before},
+		After:  DataSnapshot{Key: key, Value: after},
+	}
+	if err := t.fn(change); err != nil {
+		w.t.handleError(change.Path, err)
+	}
+}
+
+func (w *triggerWatch) put(path string, v interface{}) {
+	if v == nil {
+		w.mirror.Del(path)
+		return
+	}
+	w.mirror.Add(path, fbsync.NewNode("", v))
+}
+
+func (w *triggerWatch) value(path []string) interface{} {
+	n := w.mirror.Get(strings.Join(path, "/"))
+	if n == nil {
+		return nil
+	}
+	return n.Objectify()
+}
+
+func childValue(v interface{}, key string) interface{} {
+	m, _ := v.(map[string]interface{})
+	return m[key]
+}
+
+func unionKeys(a, b interface{}) []string {
+	keys := map[string]interface{}{}
+	for _, v := range []interface{}{a, b} {
+		m, _ := v.(map[string]interface{})
+		for k := range m {
+			keys[k] = nil
+		}
+	}
+	return sortedKeysByFirebase(keys)
+}
@@ -0,0 +1,137 @@
+package firego
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func receiveChange(t *testing.T, changes chan Change) Change {
+	select {
+	case c := <-changes:
+		return c
+	case <-time.After(2 * time.Second):
+		require.FailNow(t, "timed out waiting for change")
+	}
+	return Change{}
+}
+
+func TestTriggers(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("orders/1", map[string]interface{}{"status": "new"})
+
+	fb := New(server.URL, nil)
+	tr := NewTriggers(fb)
+	created, updated, deleted := make(chan Change, 10), make(chan Change, 10), make(chan Change, 10)
+	require.NoError(t, tr.OnCreate("/orders/{id}", func(c Change) error {
+		created <- c
+		return nil
+	}))
+	require.NoError(t, tr.OnUpdate("/orders/{id}/status", func(c Change) error {
+		updated <- c
+		return nil
+	}))
+	require.NoError(t, tr.OnDelete("/orders/{id}", func(c Change) error {
+		deleted <- c
+		return nil
+	}))
+	require.NoError(t, tr.Start())
+	defer tr.Stop()
+
+	require.NoError(t, fb.Child("orders/2").Set(map[string]interface{}{"status": "new"}))
+	c := receiveChange(t, created)
+	assert.Equal(t, "/orders/2", c.Path)
+	assert.Equal(t, map[string]string{"id": "2"}, c.Params)
+	assert.Nil(t, c.Before.Value)
+	assert.Equal(t, DataSnapshot{Key: "2", Value: map[string]interface{}{"status": "new"}}, c.After)
+
+	require.NoError(t, fb.Child("orders/1/status").Set("shipped"))
+	c = receiveChange(t, updated)
+	assert.Equal(t, "/orders/1/status", c.Path)
+	assert.Equal(t, map[string]string{"id": "1"}, c.Params)
+	assert.Equal(t, "new", c.Before.Value)
+	assert.Equal(t, "shipped", c.After.Value)
+
+	require.NoError(t, fb.Child("orders").Remove())
+	var ids []string
+	for i := 0; i < 2; i++ {
+		c = receiveChange(t, deleted)
+		assert.Nil(t, c.After.Value)
+		ids = append(ids, c.Params["id"])
+	}
+	assert.Equal(t, []string{"1", "2"}, ids)
+
+	assert.Len(t, created, 0)
+	assert.Len(t, updated, 0)
+}
+
+func TestTriggersOnWrite(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	tr := NewTriggers(fb)
+	changes := make(chan Change, 10)
+	require.NoError(t, tr.OnWrite("/users/{uid}/posts/{pid}", func(c Change) error {
+		changes <- c
+		return nil
+	}))
+	require.NoError(t, tr.Start())
+	defer tr.Stop()
+
+	require.NoError(t, fb.Child("users/alice").Set(map[string]interface{}{
+		"name":  "Alice",
+		"posts": map[string]interface{}{"p1": "hello"},
+	}))
+	c := receiveChange(t, changes)
+	assert.Equal(t, "/users/alice/posts/p1", c.Path)
+	assert.Equal(t, map[string]string{"uid": "alice", "pid": "p1"}, c.Params)
+	assert.Equal(t, "hello", c.After.Value)
+
+	// changes outside of the pattern do not trigger
+	require.NoError(t, fb.Child("users/alice/name").Set("Alicia"))
+	require.NoError(t, fb.Child("users/alice/posts/p1").Set("hi"))
+	c = receiveChange(t, changes)
+	assert.Equal(t, "hello", c.Before.Value)
+	assert.Equal(t, "hi", c.After.Value)
+	assert.Len(t, changes, 0)
+}
+
+func TestTriggersError(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	tr := NewTriggers(fb)
+	errs := make(chan error, 1)
+	tr.OnError = func(path string, err error) {
+		assert.Equal(t, "/orders/1", path)
+		errs <- err
+	}
+	require.NoError(t, tr.OnWrite("/orders/{id}", func(c Change) error {
+		return errors.New("boom")
+	}))
+	require.NoError(t, tr.Start())
+	defer tr.Stop()
+
+	require.NoError(t, fb.Child("orders/1").Set(true))
+	select {
+	case err := <-errs:
+		assert.EqualError(t, err, "boom")
+	case <-time.After(2 * time.Second):
+		require.FailNow(t, "timed out waiting for error")
+	}
+
+	assert.Error(t, tr.OnWrite("/orders", func(Change) error { return nil }))
+}
@@ -0,0 +1,188 @@
+package firego
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ValidationError is returned when a value is rejected before being sent to
+// Firebase because Firebase would not be able to store it.
+type ValidationError struct {
+	// Path of the offending value, relative to the reference being written.
+	Path string
+	// Reason the value was rejected.
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("firego: invalid value at %s: %s", e.Path, e.Reason)
+}
+
+// forbiddenKeyChars can not appear anywhere in a key.
+//
+// Reference https://firebase.google.com/docs/database/web/structure-data#how_data_is_structured_its_a_json_tree
+const forbiddenKeyChars = ".$#[]/"
+
+// specialKeys are the only keys allowed to contain forbidden characters.
+var specialKeys = map[string]bool{
+	".sv":       true,
+	".value":    true,
+	".priority": true,
+}
+
+// Limits enforced by Firebase on the structure of the data.
+//
+// Reference https://firebase.google.com/docs/database/usage/limits
+const (
+	maxDepth     = 32
+	maxKeyLength = 768
+)
+
+// validator walks values looking for data that Firebase would reject,
+// which encode does before every write.
+type validator struct {
+	// multiPath allows top level keys to contain slashes
+	// as used by multi-location updates.
+	multiPath bool
+	// limits enables the depth and key length checks.
+	limits bool
+	// depth of the reference being written to.
+	depth int
+	// escapeKeys checks keys as they will be once escaped by EncodeKey.
+	escapeKeys bool
+}
+
+func (vd *validator) value(v reflect.Value, path string) error {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if vd.limits && vd.depth+strings.Count(path, "/") > maxDepth {
+		return invalid(path, fmt.Sprintf("exceeds the maximum depth of %d", maxDepth))
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+	}
+	if v.Type().Implements(marshalerT) {
+		// the type knows how to encode itself
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return vd.value(v.Elem(), path)
+
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch {
+		case math.IsNaN(f):
+			return invalid(path, "NaN is not supported")
+		case math.IsInf(f, 0):
+			return invalid(path, "infinity is not supported")
+		}
+
+	case reflect.Complex64, reflect.Complex128, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return invalid(path, fmt.Sprintf("unsupported type %s", v.Type()))
+
+	case reflect.Map:
+		multiPath := vd.multiPath && path == ""
+		for _, k := range v.MapKeys() {
+			if k.Kind() == reflect.Interface && k.IsNil() {
+				return invalid(path, "nil map key")
+			}
+
+			key := fmt.Sprint(k.Interface())
+			if multiPath {
+				key = strings.Trim(key, "/")
+			}
+			childPath := path + "/" + key
+			if err := vd.key(key, multiPath); err != nil {
+				return invalid(childPath, err.Error())
+			}
+			if err := vd.value(v.MapIndex(k), childPath); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// encoded as a base64 string
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := vd.value(v.Index(i), path+"/"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return nil
+		}
+		for _, f := range fieldsOf(v.Type()) {
+			if f.key || f.priority {
+				continue
+			}
+			fv, ok := fieldByIndex(v, f.index, false)
+			if !ok {
+				continue
+			}
+			childPath := path + "/" + f.name
+			if err := vd.key(f.name, false); err != nil {
+				return invalid(childPath, err.Error())
+			}
+			if err := vd.value(fv, childPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (vd *validator) key(key string, multiPath bool) error {
+	if specialKeys[key] {
+		return nil
+	}
+
+	if multiPath {
+		for _, segment := range strings.Split(key, "/") {
+			if err := vd.key(segment, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if key == "" {
+		return fmt.Errorf("empty keys are not supported")
+	}
+	if vd.escapeKeys {
+		key = EncodeKey(key)
+	}
+	if vd.limits && len(key) > maxKeyLength {
+		return fmt.Errorf("key is longer than %d bytes", maxKeyLength)
+	}
+	for _, r := range key {
+		if strings.ContainsRune(forbiddenKeyChars, r) {
+			return fmt.Errorf("key %q contains forbidden character %q", key, r)
+		}
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("key %q contains control character %U", key, r)
+		}
+	}
+	return nil
+}
+
+func invalid(path, reason string) *ValidationError {
+	if path == "" {
+		path = "/"
+	}
+	return &ValidationError{Path: path, Reason: reason}
+}
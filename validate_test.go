@@ -0,0 +1,126 @@
+package firego
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	type nested struct {
+		Score float64 `json:"score"`
+	}
+	type withTag struct {
+		Bad string `json:"bad.key"`
+	}
+
+	for _, test := range []struct {
+		name      string
+		v         interface{}
+		multiPath bool
+		path      string
+	}{
+		{name: "nil", v: nil},
+		{name: "string", v: "foo"},
+		{name: "server value", v: ServerTimestamp},
+		{name: "time", v: time.Now()},
+		{name: "bytes", v: []byte("foo")},
+		{name: "struct", v: nested{Score: 1}},
+		{name: "multi path update", v: map[string]interface{}{"a/b": 1, "/c/d/": 2}, multiPath: true},
+		{name: "NaN", v: math.NaN(), path: "/"},
+		{name: "infinity", v: map[string]interface{}{"a": []interface{}{1, math.Inf(-1)}}, path: "/a/1"},
+		{name: "struct NaN", v: map[string]nested{"x": {Score: math.NaN()}}, path: "/x/score"},
+		{name: "channel", v: map[string]interface{}{"c": make(chan int)}, path: "/c"},
+		{name: "func", v: []interface{}{func() {}}, path: "/0"},
+		{name: "complex", v: complex(1, 2), path: "/"},
+		{name: "nil map key", v: map[interface{}]int{nil: 1}, path: "/"},
+		{name: "forbidden key", v: map[string]int{"a.b": 1}, path: "/a.b"},
+		{name: "nested forbidden key", v: map[string]interface{}{"a": map[string]int{"$b": 1}}, path: "/a/$b"},
+		{name: "empty key", v: map[string]int{"": 1}, path: "/"},
+		{name: "control character", v: map[string]int{"a\nb": 1}, path: "/a\nb"},
+		{name: "slash in set", v: map[string]int{"a/b": 1}, path: "/a/b"},
+		{name: "slash not at top", v: map[string]interface{}{"a": map[string]int{"b/c": 1}}, multiPath: true, path: "/a/b/c"},
+		{name: "multi path forbidden", v: map[string]int{"a/b#": 1}, multiPath: true, path: "/a/b#"},
+		{name: "struct tag", v: withTag{}, path: "/bad.key"},
+	} {
+		_, err := New(URL, nil).encode(test.v, test.multiPath)
+		if test.path == "" {
+			assert.NoError(t, err, test.name)
+			continue
+		}
+
+		require.IsType(t, (*ValidationError)(nil), err, test.name)
+		assert.Equal(t, test.path, err.(*ValidationError).Path, test.name)
+	}
+}
+
+func TestSetValidates(t *testing.T) {
+	t.Parallel()
+	var (
+		server = newTestServer("")
+		fb     = New(server.URL, nil)
+	)
+	defer server.Close()
+
+	err := fb.Set(map[string]interface{}{"score": math.NaN()})
+	require.IsType(t, (*ValidationError)(nil), err)
+	assert.Equal(t, "firego: invalid value at /score: NaN is not supported", err.Error())
+
+	_, err = fb.Push(map[string]int{"a.b": 1})
+	assert.IsType(t, (*ValidationError)(nil), err)
+
+	assert.IsType(t, (*ValidationError)(nil), fb.Update(map[string]int{"a/b#": 1}))
+	assert.Empty(t, server.receivedReqs, "invalid values should not be sent")
+
+	assert.NoError(t, fb.Update(map[string]int{"a/b": 1}))
+	assert.Len(t, server.receivedReqs, 1)
+}
+
+func TestValidateLimits(t *testing.T) {
+	t.Parallel()
+	deep := map[string]interface{}{"leaf": true}
+	for i := 0; i < maxDepth; i++ {
+		deep = map[string]interface{}{"n": deep}
+	}
+	longKey := map[string]bool{strings.Repeat("k", maxKeyLength+1): true}
+
+	var (
+		server = newTestServer("")
+		fb     = New(server.URL+"/a/b", nil)
+	)
+	defer server.Close()
+
+	// limits are off by default
+	require.NoError(t, fb.Set(deep))
+	require.NoError(t, fb.Set(longKey))
+
+	fb.EnforceLimits(true)
+	child := fb.Child("c")
+
+	err := child.Set(deep)
+	require.IsType(t, (*ValidationError)(nil), err)
+	// the reference is already 3 levels deep, so the 30th level is too deep
+	assert.Equal(t, "/"+strings.TrimSuffix(strings.Repeat("n/", maxDepth-2), "/"), err.(*ValidationError).Path)
+
+	err = child.Set(longKey)
+	require.IsType(t, (*ValidationError)(nil), err)
+	assert.Contains(t, err.Error(), "longer than 768 bytes")
+
+	err = child.Update(map[string]bool{strings.Repeat("x/", maxDepth) + "y": true})
+	require.IsType(t, (*ValidationError)(nil), err)
+
+	assert.NoError(t, child.Update(map[string]bool{"x/y/z": true}))
+}
+
+func TestDepth(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil)
+	assert.Equal(t, 0, fb.depth())
+	assert.Equal(t, 1, fb.Child("a").depth())
+	assert.Equal(t, 3, fb.Child("a/b/c").depth())
+}
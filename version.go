@@ -0,0 +1,122 @@
+package firego
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// VersionField is the child holding the version of the
+// nodes written by SetVersioned.
+const VersionField = "version"
+
+// ErrVersionConflict is matched by the *VersionConflictError returned
+// when the version of a node changed since it was read.
+var ErrVersionConflict = errors.New("firego: version conflict")
+
+// VersionConflictError is returned by SetVersioned and DeleteVersioned
+// when the node is no longer at the version the write was based on.
+type VersionConflictError struct {
+	// Expected is the version the write was based on,
+	// Actual the version the node is at.
+	Expected, Actual int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("firego: version conflict: expected version %d, got %d", e.Expected, e.Actual)
+}
+
+// Is makes the error match ErrVersionConflict.
+func (e *VersionConflictError) Is(target error) bool {
+	return target == ErrVersionConflict
+}
+
+// ValueVersioned reads the node of the reference into v, like Value, and
+// returns its version, the number held by its VersionField child, 0 for
+// nodes without one.
+//
+// The version is kept by the caller, e.g. in a hidden field of an edit
+// form, and given back to SetVersioned, which only writes the node if no
+// one else wrote it in between, where ETags can not be kept around:
+//
+//    version, err := fb.ValueVersioned(&doc)
+//    ...
+//    version, err = fb.SetVersioned(edited, version)
+//    if errors.Is(err, firego.ErrVersionConflict) {
+//        // reload the document and merge the changes
+//    }
+func (fb *Firebase) ValueVersioned(v interface{}) (int64, error) {
+	_, body, err := fb.getValue()
+	if err != nil {
+		return 0, err
+	}
+	tree, err := decodeTree(body)
+	if err != nil {
+		return 0, err
+	}
+	if err := fb.decode(body, v); err != nil {
+		return 0, err
+	}
+	return versionOf(tree), nil
+}
+
+// SetVersioned replaces the node of the reference by v, which must encode
+// to an object, if the node is still at the given version, 0 standing for
+// a node without version or data. The node is written by a Transaction
+// with the next version in its VersionField child, which is returned. It
+// fails with a *VersionConflictError if the node is at another version.
+func (fb *Firebase) SetVersioned(v interface{}, version int64) (int64, error) {
+	data, err := marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	tree, err := decodeTree(data)
+	if err != nil {
+		return 0, err
+	}
+	node, ok := tree.(map[string]interface{})
+	if !ok {
+		return 0, fmt.Errorf("firego: versioned value %T is not an object", v)
+	}
+	node[VersionField] = version + 1
+
+	if err := fb.writeVersioned(node, version); err != nil {
+		return 0, err
+	}
+	return version + 1, nil
+}
+
+// DeleteVersioned removes the node of the reference if it is still at
+// the given version, or fails with a *VersionConflictError.
+func (fb *Firebase) DeleteVersioned(version int64) error {
+	return fb.writeVersioned(nil, version)
+}
+
+// writeVersioned replaces the node by v if it is at the given version.
+func (fb *Firebase) writeVersioned(v interface{}, version int64) error {
+	var conflict error
+	err := fb.Transaction(func(current interface{}) (interface{}, error) {
+		if actual := versionOf(current); actual != version {
+			conflict = &VersionConflictError{Expected: version, Actual: actual}
+			return nil, conflict
+		}
+		conflict = nil
+		return v, nil
+	})
+	if err != nil {
+		return err
+	}
+	return conflict
+}
+
+// versionOf returns the version held by the node tree.
+func versionOf(tree interface{}) int64 {
+	switch version := treeChildren(tree)[VersionField].(type) {
+	case float64:
+		return int64(version)
+	case json.Number:
+		n, _ := version.Int64()
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package firego
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestVersioned(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	type doc struct {
+		Title   string `firebase:"title"`
+		Version int64  `firebase:"version"`
+	}
+	fb := New(server.URL, nil).Child("docs/d1")
+
+	version, err := fb.SetVersioned(doc{Title: "draft"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+	assert.Equal(t, map[string]interface{}{"title": "draft", "version": float64(1)}, server.Get("docs/d1"))
+
+	var d doc
+	version, err = fb.ValueVersioned(&d)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+	assert.Equal(t, doc{Title: "draft", Version: 1}, d)
+
+	version, err = fb.SetVersioned(doc{Title: "final"}, version)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+
+	// stale version
+	_, err = fb.SetVersioned(doc{Title: "lost"}, 1)
+	require.True(t, errors.Is(err, ErrVersionConflict), err)
+	var conflict *VersionConflictError
+	require.True(t, errors.As(err, &conflict))
+	assert.Equal(t, VersionConflictError{Expected: 1, Actual: 2}, *conflict)
+	assert.Equal(t, "final", server.Get("docs/d1/title"))
+
+	_, err = fb.SetVersioned("text", 2)
+	assert.Error(t, err)
+
+	assert.True(t, errors.Is(fb.DeleteVersioned(1), ErrVersionConflict))
+	require.NoError(t, fb.DeleteVersioned(2))
+	assert.Nil(t, server.Get("docs/d1"))
+
+	version, err = fb.ValueVersioned(&d)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), version)
+}
@@ -0,0 +1,236 @@
+package firego
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// walRecord is an entry of the write-ahead log of an OfflineQueue, either
+// a queued write or the acknowledgement that the write with Seq was sent.
+// A write recorded with the Seq of an earlier one replaces it.
+type walRecord struct {
+	Seq    uint64          `json:"seq"`
+	Ack    bool            `json:"ack,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Path   string          `json:"path,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	ETag   string          `json:"etag,omitempty"`
+}
+
+// walHeaderSize is the size of the header preceding every record: the
+// length of the record followed by its CRC-32 checksum.
+const walHeaderSize = 8
+
+// wal is an append-only log of records. Every append is synced to disk
+// before returning so that a record, once appended, survives a crash.
+type wal struct {
+	path string
+	f    *os.File
+	// records is the number of records in the file
+	records int
+}
+
+// openWAL opens the log at path, creating it if needed, and returns the
+// records it holds. A record that was partially written, or that does not
+// match its checksum, is considered the end of the log and is truncated
+// along with everything following it.
+func openWAL(path string) (*wal, []walRecord, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	var records []walRecord
+	var end int
+	for end+walHeaderSize <= len(data) {
+		size := int(binary.BigEndian.Uint32(data[end:]))
+		sum := binary.BigEndian.Uint32(data[end+4:])
+		start := end + walHeaderSize
+		if size > len(data)-start || crc32.ChecksumIEEE(data[start:start+size]) != sum {
+			break
+		}
+
+		var r walRecord
+		if err := json.Unmarshal(data[start:start+size], &r); err != nil {
+			break
+		}
+		records = append(records, r)
+		end = start + size
+	}
+
+	if err := f.Truncate(int64(end)); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(int64(end), io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return &wal{path: path, f: f, records: len(records)}, records, nil
+}
+
+func encodeWALRecord(r walRecord) ([]byte, error) {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, walHeaderSize, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(b, uint32(len(payload)))
+	binary.BigEndian.PutUint32(b[4:], crc32.ChecksumIEEE(payload))
+	return append(b, payload...), nil
+}
+
+// append writes r at the end of the log.
+func (w *wal) append(r walRecord) error {
+	b, err := encodeWALRecord(r)
+	if err != nil {
+		return err
+	}
+	if _, err := w.f.Write(b); err != nil {
+		return err
+	}
+	if err := w.f.Sync(); err != nil {
+		return err
+	}
+	w.records++
+	return nil
+}
+
+// rewrite compacts the log by atomically replacing it with one
+// holding only the given records.
+func (w *wal) rewrite(records []walRecord) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(w.path), filepath.Base(w.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	for _, r := range records {
+		b, err := encodeWALRecord(r)
+		if err == nil {
+			_, err = tmp.Write(b)
+		}
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), w.path); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	w.f.Close()
+	w.f = tmp
+	w.records = len(records)
+	return nil
+}
+
+func (w *wal) size() int {
+	return w.records
+}
+
+func (w *wal) close() error {
+	return w.f.Close()
+}
+
+// storeLog keeps the queued writes of an OfflineQueue in a Store, each
+// under the key prefix followed by its zero padded sequence number so that
+// Store.Iterate lists them in order. Acknowledged writes are deleted.
+type storeLog struct {
+	store  Store
+	prefix string
+	// seqs holds the sequence numbers of the writes in the store
+	seqs map[uint64]bool
+}
+
+// openStoreLog returns the log of the writes under prefix
+// in store, along with the writes.
+func openStoreLog(store Store, prefix string) (*storeLog, []walRecord, error) {
+	l := &storeLog{store: store, prefix: prefix, seqs: map[uint64]bool{}}
+	var records []walRecord
+	err := store.Iterate(func(key string, value []byte) error {
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		var r walRecord
+		if err := json.Unmarshal(value, &r); err != nil {
+			return fmt.Errorf("offline queue: invalid write %s. %w", key, err)
+		}
+		l.seqs[r.Seq] = true
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return l, records, nil
+}
+
+func (l *storeLog) key(seq uint64) string {
+	return fmt.Sprintf("%s%020d", l.prefix, seq)
+}
+
+func (l *storeLog) append(r walRecord) error {
+	if r.Ack {
+		if err := l.store.Delete(l.key(r.Seq)); err != nil {
+			return err
+		}
+		delete(l.seqs, r.Seq)
+		return nil
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := l.store.Set(l.key(r.Seq), b); err != nil {
+		return err
+	}
+	l.seqs[r.Seq] = true
+	return nil
+}
+
+func (l *storeLog) rewrite(records []walRecord) error {
+	keep := make(map[uint64]bool, len(records))
+	for _, r := range records {
+		keep[r.Seq] = true
+		if !l.seqs[r.Seq] {
+			if err := l.append(r); err != nil {
+				return err
+			}
+		}
+	}
+	for seq := range l.seqs {
+		if !keep[seq] {
+			if err := l.append(walRecord{Seq: seq, Ack: true}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *storeLog) size() int {
+	return len(l.seqs)
+}
+
+func (l *storeLog) close() error {
+	return nil
+}
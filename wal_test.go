@@ -0,0 +1,88 @@
+package firego
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWAL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue.wal")
+
+	w, records, err := openWAL(path)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	expected := []walRecord{
+		{Seq: 1, Method: "PUT", Path: "a", Body: []byte(`{"b":1}`)},
+		{Seq: 1, Ack: true},
+		{Seq: 2, Method: "DELETE", Path: "c"},
+	}
+	for _, r := range expected {
+		require.NoError(t, w.append(r))
+	}
+	require.NoError(t, w.close())
+
+	w, records, err = openWAL(path)
+	require.NoError(t, err)
+	assert.Equal(t, expected, records)
+	assert.Equal(t, 3, w.records)
+
+	require.NoError(t, w.rewrite(expected[2:]))
+	require.NoError(t, w.append(walRecord{Seq: 3, Method: "PUT", Path: "d", Body: []byte(`null`)}))
+	require.NoError(t, w.close())
+
+	w, records, err = openWAL(path)
+	require.NoError(t, err)
+	assert.Equal(t, []walRecord{expected[2], {Seq: 3, Method: "PUT", Path: "d", Body: []byte(`null`)}}, records)
+	require.NoError(t, w.close())
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "temporary files should be removed")
+}
+
+func TestWALTornWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "firego")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue.wal")
+
+	w, _, err := openWAL(path)
+	require.NoError(t, err)
+	require.NoError(t, w.append(walRecord{Seq: 1, Method: "DELETE", Path: "a"}))
+	require.NoError(t, w.append(walRecord{Seq: 2, Method: "DELETE", Path: "b"}))
+	require.NoError(t, w.close())
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	good := walHeaderSize + len(`{"seq":1,"method":"DELETE","path":"a"}`)
+
+	for name, corrupt := range map[string][]byte{
+		"partial record": data[:len(data)-3],
+		"bad checksum":   append(append([]byte{}, data[:len(data)-2]...), 'x', '}'),
+		"partial header": append(append([]byte{}, data[:good]...), 0, 0, 0),
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, ioutil.WriteFile(path, corrupt, 0600))
+
+			w, records, err := openWAL(path)
+			require.NoError(t, err)
+			assert.Equal(t, []walRecord{{Seq: 1, Method: "DELETE", Path: "a"}}, records)
+
+			// the log goes on after the last good record
+			require.NoError(t, w.append(walRecord{Seq: 3, Method: "DELETE", Path: "c"}))
+			require.NoError(t, w.close())
+			_, records, err = openWAL(path)
+			require.NoError(t, err)
+			assert.Len(t, records, 2)
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package firego
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// WalkFunc is called by Walk with the path of a value, relative to the
+// reference walked, and its JSON. Returning an error stops the walk.
+type WalkFunc func(path string, value json.RawMessage) error
+
+// WalkOptions configures Walk.
+type WalkOptions struct {
+	// Concurrency is the number of requests made at once, 4 by default.
+	Concurrency int
+	// MaxDepth, if set, is the depth below the reference at which
+	// locations are read whole and passed to the WalkFunc instead of
+	// being walked further.
+	MaxDepth int
+	// Skip, if set, is called with the path of every location before it
+	// is visited. The locations for which it returns true are neither
+	// read nor passed to the WalkFunc, and neither are their children.
+	Skip func(path string) bool
+}
+
+// Walk traverses the data at fb breadth-first, calling fn for every
+// primitive value, so that large subtrees can be scanned or transformed
+// without reading them at once:
+//
+//    err := firego.Walk(ctx, fb.Child("users"), firego.WalkOptions{}, func(path string, value json.RawMessage) error {
+//        if strings.HasSuffix(path, "/email") {
+//            log.Printf("found an email at %s", path)
+//        }
+//        return nil
+//    })
+//
+// Every location is listed with a shallow read, which only returns the keys
+// of the children holding objects, and the locations of a level are listed
+// concurrently. Since a shallow read does not tell an object from the
+// boolean true, children holding true are read on their own.
+//
+// fn is never called concurrently. Values are visited level by level,
+// in key order for the children of a location, but the order of the
+// locations of a level is not defined.
+func Walk(ctx context.Context, fb *Firebase, opts WalkOptions, fn WalkFunc) error {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := &walker{ref: fb.WithContext(ctx), opts: opts, fn: fn, cancel: cancel}
+	var level []string
+	if opts.Skip == nil || !opts.Skip("") {
+		level = append(level, "")
+	}
+	for depth := 0; len(level) > 0; depth++ {
+		sem := make(chan struct{}, opts.Concurrency)
+		var wg sync.WaitGroup
+		for _, path := range level {
+			if ctx.Err() != nil {
+				break
+			}
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(path string) {
+				defer wg.Done()
+				w.visit(path, depth)
+				<-sem
+			}(path)
+		}
+		wg.Wait()
+
+		if w.err != nil {
+			return w.err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		level, w.next = w.next, nil
+	}
+	return nil
+}
+
+type walker struct {
+	ref    *Firebase
+	opts   WalkOptions
+	fn     WalkFunc
+	cancel context.CancelFunc
+
+	mtx sync.Mutex
+	// err is the first error of the walk
+	err error
+	// next holds the locations of the next level
+	next []string
+}
+
+// visit reads the location at path, calling fn for its primitive
+// children and queuing the others for the next level.
+func (w *walker) visit(path string, depth int) {
+	ref := w.ref.at(path)
+	whole := w.opts.MaxDepth > 0 && depth >= w.opts.MaxDepth
+	if !whole {
+		ref.Shallow(true)
+	}
+	_, body, err := ref.doRequest("GET", nil)
+	if err != nil {
+		w.fail(err)
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	children, ok := shallowChildren(body)
+	if whole || !ok {
+		if !bytes.Equal(body, []byte("null")) {
+			w.call(path, body)
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(children))
+	for k := range children {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return compareKeys(keys[i], keys[j]) < 0
+	})
+	for _, k := range keys {
+		child := joinPath(path, k)
+		if w.opts.Skip != nil && w.opts.Skip(child) {
+			continue
+		}
+		if bytes.Equal(bytes.TrimSpace(children[k]), []byte("true")) {
+			w.next = append(w.next, child)
+			continue
+		}
+		w.call(child, children[k])
+	}
+}
+
+// call calls fn, it must be called with mtx held.
+func (w *walker) call(path string, value json.RawMessage) {
+	if w.err != nil {
+		return
+	}
+	if err := w.fn(path, value); err != nil {
+		w.err = err
+		w.cancel()
+	}
+}
+
+func (w *walker) fail(err error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.err == nil {
+		w.err = err
+		w.cancel()
+	}
+}
+
+// shallowChildren returns the children of the object or array in data,
+// and false if it holds a primitive value.
+func shallowChildren(data []byte) (map[string]json.RawMessage, bool) {
+	var children map[string]json.RawMessage
+	if err := json.Unmarshal(data, &children); err == nil && children != nil {
+		return children, true
+	}
+
+	var array []json.RawMessage
+	if err := json.Unmarshal(data, &array); err != nil || array == nil {
+		return nil, false
+	}
+	children = make(map[string]json.RawMessage, len(array))
+	for i, child := range array {
+		if !bytes.Equal(bytes.TrimSpace(child), []byte("null")) {
+			children[strconv.Itoa(i)] = child
+		}
+	}
+	return children, true
+}
@@ -0,0 +1,103 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func walkServer(t *testing.T) *firetest.Firetest {
+	server := firetest.New()
+	server.Start()
+	server.Set("users", map[string]interface{}{
+		"alice": map[string]interface{}{
+			"email":   "alice@example.com",
+			"admin":   true,
+			"address": map[string]interface{}{"city": "Paris"},
+		},
+		"bob": map[string]interface{}{"email": "bob@example.com", "admin": false},
+	})
+	return server
+}
+
+func TestWalk(t *testing.T) {
+	t.Parallel()
+	server := walkServer(t)
+	defer server.Close()
+
+	visited := map[string]string{}
+	var order []string
+	err := Walk(context.Background(), New(server.URL, nil).Child("users"), WalkOptions{Concurrency: 2}, func(path string, value json.RawMessage) error {
+		visited[path] = string(value)
+		order = append(order, path)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"alice/email":        `"alice@example.com"`,
+		"alice/admin":        "true",
+		"alice/address/city": `"Paris"`,
+		"bob/email":          `"bob@example.com"`,
+		"bob/admin":          "false",
+	}, visited)
+	// alice/address/city is found with alice/admin, read on its own since
+	// it holds true, at the level after the other values
+	require.Len(t, order, 5)
+	assert.ElementsMatch(t, []string{"alice/email", "bob/admin", "bob/email"}, order[:3], "deeper levels should be visited last")
+}
+
+func TestWalkMaxDepth(t *testing.T) {
+	t.Parallel()
+	server := walkServer(t)
+	defer server.Close()
+
+	visited := map[string]json.RawMessage{}
+	err := Walk(context.Background(), New(server.URL, nil).Child("users"), WalkOptions{MaxDepth: 1}, func(path string, value json.RawMessage) error {
+		visited[path] = value
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, visited, 2)
+	assert.JSONEq(t, `{"email":"bob@example.com","admin":false}`, string(visited["bob"]))
+}
+
+func TestWalkError(t *testing.T) {
+	t.Parallel()
+	server := walkServer(t)
+	defer server.Close()
+
+	stop := errors.New("stop")
+	calls := 0
+	err := Walk(context.Background(), New(server.URL, nil).Child("users"), WalkOptions{}, func(path string, value json.RawMessage) error {
+		calls++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, calls)
+
+	err = Walk(context.Background(), New(server.URL, nil).Child("missing"), WalkOptions{}, func(path string, value json.RawMessage) error {
+		t.Errorf("unexpected value at %s", path)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestWalkSkip(t *testing.T) {
+	t.Parallel()
+	server := walkServer(t)
+	defer server.Close()
+
+	var visited []string
+	opts := WalkOptions{Skip: func(path string) bool { return path == "alice" || path == "bob/admin" }}
+	err := Walk(context.Background(), New(server.URL, nil).Child("users"), opts, func(path string, value json.RawMessage) error {
+		visited = append(visited, path)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob/email"}, visited)
+}
@@ -3,54 +3,134 @@ package firego
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
-	"net/http"
+	"sync"
 	"time"
 )
 
+// EventType is the kind of an Event.
+type EventType string
+
 const (
 	// EventTypePut is the event type sent when new data is inserted to the
 	// Firebase instance.
-	EventTypePut = "put"
+	EventTypePut EventType = "put"
 	// EventTypePatch is the event type sent when data at the Firebase instance is
 	// updated.
-	EventTypePatch = "patch"
-	// EventTypeError is the event type sent when an unknown error is encountered.
-	EventTypeError = "event_error"
+	EventTypePatch EventType = "patch"
+	// EventTypeKeepAlive is the event type Firebase sends periodically to keep
+	// the stream open. Such events are not delivered by Watch.
+	EventTypeKeepAlive EventType = "keep-alive"
+	// EventTypeCancel is the event type sent when the security rules no longer
+	// allow reading the watched location. It ends the stream.
+	EventTypeCancel EventType = "cancel"
 	// EventTypeAuthRevoked is the event type sent when the supplied auth parameter
-	// is no longer valid.
-	EventTypeAuthRevoked = "auth_revoked"
+	// is no longer valid. It ends the stream.
+	EventTypeAuthRevoked EventType = "auth_revoked"
+	// EventTypeReconnect is the event type sent by WatchMulti before it watches
+	// a reference again after its stream ended.
+	EventTypeReconnect EventType = "reconnect"
+	// EventTypeError is the event type sent when an unknown error is encountered.
+	EventTypeError EventType = "event_error"
+
+	eventTypeRulesDebug EventType = "rules_debug"
+)
 
-	eventTypeKeepAlive  = "keep-alive"
-	eventTypeCancel     = "cancel"
-	eventTypeRulesDebug = "rules_debug"
+// CancelCode tells why Firebase ended a stream.
+type CancelCode int
+
+const (
+	// CancelPermissionDenied is the code of EventTypeCancel events.
+	CancelPermissionDenied CancelCode = iota + 1
+	// CancelAuthRevoked is the code of EventTypeAuthRevoked events.
+	CancelAuthRevoked
 )
 
+// CancelReason tells why Firebase ended a stream with a cancel
+// or auth_revoked event.
+type CancelReason struct {
+	Code CancelCode
+	// Message is the explanation sent by Firebase, if any.
+	Message string
+}
+
+func (r CancelReason) Error() string {
+	msg := "permission denied"
+	if r.Code == CancelAuthRevoked {
+		msg = "auth revoked"
+	}
+	if r.Message != "" {
+		msg += ": " + r.Message
+	}
+	return msg
+}
+
 // Event represents a notification received when watching a
 // firebase reference.
 type Event struct {
 	// Type of event that was received
-	Type string
+	Type EventType
 	// Path to the data that changed
 	Path string
 	// Data that changed
 	Data interface{}
+	// Seq numbers the events of a stream, starting at 1 with the event
+	// holding the initial data unless SkipInitialSnapshot is set. Events
+	// are delivered in the order they were received, without gaps, so
+	// consumers can tell that a new stream was started, and that changes
+	// may have been missed, when Seq goes back to 1.
+	Seq uint64
+	// ID is the ID given to the event by the server with an id field, as
+	// servers supporting Last-Event-ID do, or else the last one given to
+	// a preceding event of the stream, if any.
+	ID string
 
 	rawData []byte
 }
 
+// CancelReason returns why the stream was ended, if
+// the event is a cancel or auth_revoked event.
+func (e Event) CancelReason() (CancelReason, bool) {
+	var reason CancelReason
+	switch e.Type {
+	case EventTypeCancel:
+		reason.Code = CancelPermissionDenied
+	case EventTypeAuthRevoked:
+		reason.Code = CancelAuthRevoked
+	default:
+		return reason, false
+	}
+	// the data is null or a JSON string
+	if s, ok := e.Data.(string); ok {
+		json.Unmarshal([]byte(s), &reason.Message)
+	}
+	return reason, true
+}
+
 // Value converts the raw payload of the event into the given interface.
 func (e Event) Value(v interface{}) error {
 	var tmp struct {
-		Data interface{} `json:"data"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(e.rawData, &tmp); err != nil {
+		return err
+	}
+	if len(tmp.Data) == 0 {
+		return nil
 	}
-	tmp.Data = &v
-	return json.Unmarshal(e.rawData, &tmp)
+	return unmarshal(tmp.Data, v)
 }
 
 // StopWatching stops tears down all connections that are watching.
+//
+// It can be called any number of times, from any goroutine, including
+// while events are being delivered. Once it returns no more events are
+// sent and the channel given to Watch is closed shortly after, whether
+// or not it is being read from.
 func (fb *Firebase) StopWatching() {
 	fb.watchMtx.Lock()
 	defer fb.watchMtx.Unlock()
@@ -58,9 +138,25 @@ func (fb *Firebase) StopWatching() {
 	if fb.watching {
 		// flip the bit back to not watching
 		fb.watching = false
-		// signal connection to terminal
-		fb.stopWatching <- struct{}{}
+		// signal connection to terminate
+		close(fb.stopWatching)
+	}
+}
+
+// startWatching marks the reference as watching and returns the channel
+// closed by StopWatching, or false if the reference is already watching.
+func (fb *Firebase) startWatching() (chan struct{}, bool) {
+	fb.watchMtx.Lock()
+	defer fb.watchMtx.Unlock()
+
+	if fb.watching {
+		return nil, false
 	}
+	fb.watching = true
+	fb.stopWatching = make(chan struct{})
+	fb.watchPause = nil
+	fb.watchSignal = make(chan struct{}, 1)
+	return fb.stopWatching, true
 }
 
 func (fb *Firebase) setWatching(v bool) {
@@ -75,45 +171,260 @@ func (fb *Firebase) setWatching(v bool) {
 // Only one connection can be established at a time. The
 // second call to this function without a call to fb.StopWatching
 // will close the channel given and return nil immediately.
+//
+// The channel is closed when the connection ends, after an error,
+// cancel or auth_revoked event, or when StopWatching is called.
 func (fb *Firebase) Watch(notifications chan Event) error {
-	fb.watchMtx.Lock()
-	if fb.watching {
-		fb.watchMtx.Unlock()
+	stop, ok := fb.startWatching()
+	if !ok {
 		close(notifications)
 		return nil
 	}
-	fb.watching = true
-	fb.watchMtx.Unlock()
 
-	stop := make(chan struct{})
-	events, err := fb.watch(stop)
+	open := func(skipInitial bool, lastEventID string) (chan Event, func(), error) {
+		streamStop := make(chan struct{})
+		var once sync.Once
+		closeStream := func() {
+			once.Do(func() { close(streamStop) })
+		}
+		go func() {
+			select {
+			case <-stop:
+				closeStream()
+			case <-streamStop:
+			}
+		}()
+
+		events, err := fb.watch(streamStop, skipInitial, lastEventID)
+		if err != nil {
+			closeStream()
+			return nil, nil, err
+		}
+		if fb.coalesce > 0 {
+			events = coalesceEvents(events, fb.coalesce, streamStop)
+		}
+		return events, closeStream, nil
+	}
+
+	events, closeStream, err := open(fb.skipInitial, fb.lastEventID)
 	if err != nil {
 		return err
 	}
-
-	var closedManually bool
+	signal := fb.watchSignal
 
 	go func() {
-		<-fb.stopWatching
-		closedManually = true
-		stop <- struct{}{}
-	}()
+		// recycle fires once the stream reaches its maximum age
+		var recycle <-chan time.Time
+		var recycleTimer *time.Timer
+		opened := func() {
+			if recycleTimer != nil {
+				recycleTimer.Stop()
+			}
+			if fb.maxStreamAge > 0 {
+				recycleTimer = time.NewTimer(fb.maxStreamAge)
+				recycle = recycleTimer.C
+			}
+		}
+		opened()
 
-	go func() {
 		defer close(notifications)
+		defer func() {
+			if closeStream != nil {
+				closeStream()
+			}
+			if recycleTimer != nil {
+				recycleTimer.Stop()
+			}
+		}()
 
-		for event := range events {
-			if closedManually {
-				return
+		// events are numbered here, by the only goroutine
+		// delivering them, which keeps the numbers in order
+		var seq uint64
+		// lastEventID is the ID of the last event delivered,
+		// the one a new stream resumes after
+		lastEventID := fb.lastEventID
+		send := func(event Event) bool {
+			select {
+			case <-stop:
+				return false
+			default:
+			}
+
+			seq++
+			event.Seq = seq
+			select {
+			case notifications <- event:
+				if event.ID != "" {
+					lastEventID = event.ID
+				}
+				return true
+			case <-stop:
+				return false
+			}
+		}
+
+		// pending holds the events received while paused
+		var pending []Event
+		for {
+			pause := fb.pauseState()
+			switch {
+			case pause == nil && events == nil:
+				// resuming after the stream was closed, its
+				// initial data catches up with what was missed
+				var err error
+				if events, closeStream, err = open(false, lastEventID); err != nil {
+					send(Event{Type: EventTypeError, Data: err})
+					return
+				}
+				opened()
+			case pause == nil && len(pending) > 0:
+				for _, event := range pending {
+					if !send(event) {
+						return
+					}
+				}
+				pending = nil
+			case pause != nil && pause.stopReading && events != nil:
+				closeStream()
+				events, closeStream, pending = nil, nil, nil
+				recycle = nil
 			}
 
-			notifications <- event
+			select {
+			case event, ok := <-events:
+				if !ok {
+					for _, event := range pending {
+						if !send(event) {
+							return
+						}
+					}
+					return
+				}
+				if fb.pauseState() != nil && (event.Type == EventTypePut || event.Type == EventTypePatch) {
+					pending = mergeEvent(pending, event)
+					continue
+				}
+				pending = append(pending, event)
+				for _, event := range pending {
+					if !send(event) {
+						return
+					}
+				}
+				pending = nil
+			case <-recycle:
+				// the stream is replaced by a new one,
+				// once resumed if paused
+				closeStream()
+				events, closeStream, recycle = nil, nil, nil
+			case <-signal:
+			case <-stop:
+				return
+			}
 		}
 	}()
 
 	return nil
 }
 
+// watchPause is how a watch is paused.
+type watchPause struct {
+	stopReading bool
+}
+
+// PauseWatching stops delivering the events of Watch until ResumeWatching
+// is called, without closing the channel given to Watch, e.g. while the
+// consumer is under maintenance. The events received in the meantime are
+// merged as CoalesceEvents does and delivered on resume, the events ending
+// the stream, such as errors, being delivered right away with those
+// preceding them.
+//
+// If stopReading is set the stream is closed as well, so that nothing is
+// received while paused, and a new one is opened on resume, its initial
+// data being delivered as a put event catching up with the changes made
+// in between. Event numbers carry on in either case.
+func (fb *Firebase) PauseWatching(stopReading bool) {
+	fb.watchMtx.Lock()
+	defer fb.watchMtx.Unlock()
+	if !fb.watching {
+		return
+	}
+	fb.watchPause = &watchPause{stopReading: stopReading}
+	fb.signalWatch()
+}
+
+// ResumeWatching delivers the events received since PauseWatching
+// was called and resumes delivering events as they are received.
+func (fb *Firebase) ResumeWatching() {
+	fb.watchMtx.Lock()
+	defer fb.watchMtx.Unlock()
+	if !fb.watching || fb.watchPause == nil {
+		return
+	}
+	fb.watchPause = nil
+	fb.signalWatch()
+}
+
+func (fb *Firebase) pauseState() *watchPause {
+	fb.watchMtx.Lock()
+	defer fb.watchMtx.Unlock()
+	return fb.watchPause
+}
+
+// signalWatch wakes the goroutine delivering events up. It must be
+// called with watchMtx held.
+func (fb *Firebase) signalWatch() {
+	select {
+	case fb.watchSignal <- struct{}{}:
+	default:
+	}
+}
+
+// ResumeAfter makes Watch send id as the Last-Event-ID header, so that a
+// server supporting it resumes the stream after the event with that ID,
+// typically the ID of the last event received before the connection was
+// lost. Servers not supporting it, as the Firebase REST API, ignore it and
+// start with the initial data. Reopening a stream, as ResumeWatching and
+// WatchMulti do, sends the ID of the last event delivered in the same
+// way. Unlike the other settings of a reference, it is not inherited by
+// references derived from fb.
+func (fb *Firebase) ResumeAfter(id string) {
+	fb.lastEventID = id
+}
+
+// MaxStreamAge makes Watch replace its stream with a new one once it has
+// been open for d, for networks where idle connections are silently
+// dropped, e.g. by NATs, and the heartbeat would only notice it later. The
+// initial data of the new stream is delivered as a put event catching up
+// with the changes made in between, as ResumeWatching does, and event
+// numbers carry on. Zero, the default, keeps streams open. References
+// derived from fb afterwards use the same age.
+func (fb *Firebase) MaxStreamAge(d time.Duration) {
+	fb.maxStreamAge = d
+}
+
+// DeadLetterFunc is called with the raw bytes of an event that could not
+// be parsed, and the reason why.
+type DeadLetterFunc func(raw []byte, err error)
+
+// DeadLetter sets a function called by Watch with the events that can not
+// be parsed, instead of ending the stream with an error event. The raw
+// bytes are the line breaking the event-stream format, or the payload of
+// a put or patch event that is not valid JSON or has no path. Such events
+// are skipped once fn returns and watching goes on.
+func (fb *Firebase) DeadLetter(fn DeadLetterFunc) {
+	fb.deadLetter = fn
+}
+
+// frameError reports a line breaking the event-stream format.
+type frameError struct {
+	line []byte
+	msg  string
+}
+
+func (e *frameError) Error() string {
+	return e.msg
+}
+
 func readLine(rdr *bufio.Reader, prefix string) ([]byte, error) {
 	// read event: line
 	line, err := rdr.ReadBytes('\n')
@@ -123,16 +434,15 @@ func readLine(rdr *bufio.Reader, prefix string) ([]byte, error) {
 
 	// empty line check for empty prefix
 	if len(prefix) == 0 {
-		line = bytes.TrimSpace(line)
-		if len(line) != 0 {
-			return nil, errors.New("expected empty line")
+		if len(bytes.TrimSpace(line)) != 0 {
+			return nil, &frameError{line: line, msg: "expected empty line"}
 		}
-		return line, nil
+		return nil, nil
 	}
 
 	// check line has event prefix
 	if !bytes.HasPrefix(line, []byte(prefix)) {
-		return nil, errors.New("missing prefix")
+		return nil, &frameError{line: line, msg: "missing prefix"}
 	}
 
 	// trim space
@@ -140,37 +450,143 @@ func readLine(rdr *bufio.Reader, prefix string) ([]byte, error) {
 	return bytes.TrimSpace(line), nil
 }
 
-func (fb *Firebase) watch(stop chan struct{}) (chan Event, error) {
+// eventReader reads the frames of an event stream.
+type eventReader struct {
+	r *bufio.Reader
+	// deadLetter, if set, receives the malformed lines, which are
+	// skipped along with the rest of their event
+	deadLetter DeadLetterFunc
+	// lastID is the value of the last id field read
+	lastID string
+}
+
+// next returns the type and data of the next event.
+func (er *eventReader) next() (evt, dat []byte, err error) {
+	for {
+		if evt, err = er.readLine("event: "); err == nil {
+			if dat, err = er.readLine("data: "); err == nil {
+				_, err = er.readLine("")
+			}
+		}
+		if err == nil {
+			return evt, dat, nil
+		}
+
+		var frame *frameError
+		if er.deadLetter == nil || !errors.As(err, &frame) {
+			return nil, nil, err
+		}
+		er.deadLetter(frame.line, err)
+
+		// resume at the line following the next empty one
+		for len(bytes.TrimSpace(frame.line)) != 0 {
+			if frame.line, err = er.r.ReadBytes('\n'); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+}
+
+// readLine reads the line with the given prefix, recording
+// the value of the id fields found before it.
+func (er *eventReader) readLine(prefix string) ([]byte, error) {
+	for {
+		line, err := readLine(er.r, prefix)
+		var frame *frameError
+		if !errors.As(err, &frame) || !bytes.HasPrefix(frame.line, []byte("id:")) {
+			return line, err
+		}
+		er.lastID = string(bytes.TrimSpace(frame.line[len("id:"):]))
+	}
+}
+
+// parseDataEvent decodes the path and data of a put or patch event
+// from its raw data.
+func parseDataEvent(event *Event) error {
+	var data map[string]interface{}
+	if err := json.Unmarshal(event.rawData, &data); err != nil {
+		return err
+	}
+	path, ok := data["path"].(string)
+	if !ok {
+		return fmt.Errorf("%s event without a path", event.Type)
+	}
+	event.Path = path
+	event.Data = data["data"]
+	return nil
+}
+
+// SkipInitialSnapshot makes Watch and PollWatch leave out the event
+// holding the initial data at the reference and only deliver the changes
+// that follow, which avoids decoding the whole of a large node when only
+// its changes are needed. Unlike the other settings of a reference, it
+// is not inherited by references derived from fb.
+func (fb *Firebase) SkipInitialSnapshot(v bool) {
+	fb.skipInitial = v
+}
+
+// watch streams the events of the reference, leaving out the
+// initial one without decoding it if skipInitial is set, and
+// resuming after lastEventID if the server supports it.
+func (fb *Firebase) watch(stop chan struct{}, skipInitial bool, lastEventID string) (chan Event, error) {
 	// build SSE request
-	req, err := http.NewRequest("GET", fb.String(), nil)
+	req, err := fb.newRequest("GET", nil)
 	if err != nil {
 		fb.setWatching(false)
 		return nil, err
 	}
 	req.Header.Add("Accept", "text/event-stream")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	// the stream is aborted by canceling its context, closing the
+	// body while it is being read can hang the transport
+	ctx := fb.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := fb.requests.add(ctx, fb, "GET", true)
+	req = req.WithContext(ctx)
+	if fb.beforeSend != nil {
+		if err := fb.beforeSend(req, nil); err != nil {
+			cancel()
+			fb.setWatching(false)
+			return nil, err
+		}
+	}
 
 	// do request
 	resp, err := fb.client.Do(req)
 	if err != nil {
+		cancel()
 		fb.setWatching(false)
 		return nil, err
 	}
 
 	notifications := make(chan Event)
+	done := make(chan struct{})
 
 	go func() {
-		<-stop
-		resp.Body.Close()
+		select {
+		case <-stop:
+		case <-done:
+		}
+		cancel()
 	}()
 
 	heartbeat := make(chan struct{})
+	expired := make(chan struct{})
 	go func() {
 		for {
 			select {
 			case <-heartbeat:
 				// do nothing
+			case <-done:
+				return
 			case <-time.After(fb.watchHeartbeat):
-				resp.Body.Close()
+				close(expired)
+				cancel()
 				return
 			}
 		}
@@ -180,38 +596,36 @@ func (fb *Firebase) watch(stop chan struct{}) (chan Event, error) {
 	go func() {
 		defer func() {
 			resp.Body.Close()
+			close(done)
 			close(notifications)
 		}()
 
-		// build scanner for response body
-		scanner := bufio.NewReader(resp.Body)
+		frames := &eventReader{r: bufio.NewReader(resp.Body), deadLetter: fb.deadLetter}
+		send := func(event Event) bool {
+			select {
+			case notifications <- event:
+				return true
+			case <-stop:
+				return false
+			}
+		}
 		sendError := func(err error) {
-			notifications <- Event{
+			select {
+			case <-expired:
+				err = ErrTimeout{err}
+			default:
+			}
+			send(Event{
 				Type: EventTypeError,
 				Data: err,
-			}
+			})
 		}
 		for {
 			select {
 			case heartbeat <- struct{}{}:
 			default:
 			}
-			// scan for 'event:'
-			evt, err := readLine(scanner, "event: ")
-			if err != nil {
-				sendError(err)
-				return
-			}
-
-			// scan for 'data:'
-			dat, err := readLine(scanner, "data: ")
-			if err != nil {
-				sendError(err)
-				return
-			}
-
-			// read the empty line
-			_, err = readLine(scanner, "")
+			evt, dat, err := frames.next()
 			if err != nil {
 				sendError(err)
 				return
@@ -219,41 +633,49 @@ func (fb *Firebase) watch(stop chan struct{}) (chan Event, error) {
 
 			// create a base event
 			event := Event{
-				Type:    string(evt),
+				Type:    EventType(evt),
 				Data:    string(dat),
+				ID:      frames.lastID,
 				rawData: dat,
 			}
 
 			// should be reacting differently based off the type of event
 			switch event.Type {
 			case EventTypePut, EventTypePatch:
+				if skipInitial {
+					// the first event holds the initial data
+					skipInitial = false
+					continue
+				}
+
 				// we've got extra data we've got to parse
-				var data map[string]interface{}
-				if err := json.Unmarshal(event.rawData, &data); err != nil {
+				if err := parseDataEvent(&event); err != nil {
+					if fb.deadLetter != nil {
+						fb.deadLetter(dat, err)
+						continue
+					}
 					sendError(err)
 					return
 				}
 
-				// set the extra fields
-				event.Path = data["path"].(string)
-				event.Data = data["data"]
-
 				// ship it
-				notifications <- event
-			case eventTypeKeepAlive:
+				if !send(event) {
+					return
+				}
+			case EventTypeKeepAlive:
 				// received ping - nothing to do here
-			case eventTypeCancel:
+			case EventTypeCancel:
 				// The data for this event is null
 				// This event will be sent if the Security and Firebase Rules
 				// cause a read at the requested location to no longer be allowed
 
 				// send the cancel event
-				notifications <- event
+				send(event)
 				return
 			case EventTypeAuthRevoked:
 				// The data for this event is a string indicating that a the credential has expired
 				// This event will be sent when the supplied auth parameter is no longer valid
-				notifications <- event
+				send(event)
 				return
 			case eventTypeRulesDebug:
 				log.Printf("Rules-Debug: %s\n%s\n", evt, dat)
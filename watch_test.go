@@ -1,10 +1,14 @@
 package firego
 
 import (
+	"bufio"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -34,7 +38,7 @@ func TestWatch(t *testing.T) {
 	select {
 	case event, ok := <-notifications:
 		assert.True(t, ok)
-		assert.Equal(t, "put", event.Type)
+		assert.Equal(t, EventTypePut, event.Type)
 		assert.Equal(t, "/", event.Path)
 		assert.Nil(t, event.Data)
 	case <-time.After(250 * time.Millisecond):
@@ -108,6 +112,7 @@ func TestWatchHeartbeatTimeout(t *testing.T) {
 	assert.Empty(t, event.Path, "event path is not empty")
 	assert.NotNil(t, event.Data, "event data is nil")
 	assert.Implements(t, new(error), event.Data)
+	assert.IsType(t, ErrTimeout{}, event.Data)
 	t.Logf("%#v\n", event)
 
 	_, ok = <-notifications
@@ -175,6 +180,22 @@ func TestWatchAuthRevoked(t *testing.T) {
 	assert.Equal(t, EventTypeAuthRevoked, event.Type, "event type doesn't match")
 	assert.Empty(t, event.Path, "event path is not empty")
 	assert.Equal(t, event.Data, `"token expired"`, "event data does not match")
+
+	reason, ok := event.CancelReason()
+	require.True(t, ok)
+	assert.Equal(t, CancelReason{Code: CancelAuthRevoked, Message: "token expired"}, reason)
+	assert.EqualError(t, reason, "auth revoked: token expired")
+}
+
+func TestEventCancelReason(t *testing.T) {
+	t.Parallel()
+	reason, ok := Event{Type: EventTypeCancel, Data: "null"}.CancelReason()
+	require.True(t, ok)
+	assert.Equal(t, CancelReason{Code: CancelPermissionDenied}, reason)
+	assert.EqualError(t, reason, "permission denied")
+
+	_, ok = Event{Type: EventTypePut, Data: "null"}.CancelReason()
+	assert.False(t, ok)
 }
 
 func TestWatch_Issue66(t *testing.T) {
@@ -230,3 +251,360 @@ func TestStopWatch(t *testing.T) {
 	_, ok := <-notifications
 	assert.False(t, ok, "notifications should be closed")
 }
+
+// requireNoLeaks fails if the number of goroutines does not drop back to
+// what it was when requireNoLeaks was called. Tests using it must not
+// run in parallel with others.
+func requireNoLeaks(t *testing.T) func() {
+	before := runtime.NumGoroutine()
+	return func() {
+		eventually(t, func() bool {
+			return runtime.NumGoroutine() <= before
+		}, fmt.Sprintf("goroutines leaked, %d before, %d after", before, runtime.NumGoroutine()))
+	}
+}
+
+func TestStopWatchingIdempotent(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	fb := New(server.URL, nil)
+	checkLeaks := requireNoLeaks(t)
+
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	<-notifications
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fb.StopWatching()
+		}()
+	}
+	wg.Wait()
+	fb.StopWatching()
+
+	_, ok := <-notifications
+	assert.False(t, ok, "notifications should be closed")
+	checkLeaks()
+
+	// the reference can watch again
+	notifications = make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	<-notifications
+	fb.StopWatching()
+	for range notifications {
+	}
+	checkLeaks()
+}
+
+func TestStopWatchingNotReading(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	fb := New(server.URL, nil)
+	checkLeaks := requireNoLeaks(t)
+
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	// the initial event is never read
+	time.Sleep(10 * time.Millisecond)
+	fb.StopWatching()
+	checkLeaks()
+
+	// the channel was closed without being read from
+	_, ok := <-notifications
+	assert.False(t, ok, "notifications should be closed")
+}
+
+func TestStopWatchingDuringDelivery(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	fb := New(server.URL, nil)
+	checkLeaks := requireNoLeaks(t)
+
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			server.Set(fmt.Sprintf("foo/%d", i), i)
+		}
+	}()
+
+	var received int
+	for range notifications {
+		if received++; received == 20 {
+			go fb.StopWatching()
+		}
+	}
+	<-done
+	fb.StopWatching()
+	checkLeaks()
+}
+
+func TestWatchStreamEndedNoLeaks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// keep the idle connection from counting as a leak
+		w.Header().Set("Connection", "close")
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: put\ndata: {\"path\":\"/\",\"data\":null}\n\n")
+	}))
+	defer server.Close()
+	fb := New(server.URL, nil)
+	checkLeaks := requireNoLeaks(t)
+
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	var events []EventType
+	for event := range notifications {
+		events = append(events, event.Type)
+	}
+	assert.Equal(t, []EventType{EventTypePut, EventTypeError}, events)
+	checkLeaks()
+
+	fb.StopWatching()
+	fb.StopWatching()
+}
+
+func TestWatchSeq(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	fb := New(server.URL, nil)
+
+	for stream := 0; stream < 2; stream++ {
+		notifications := make(chan Event)
+		require.NoError(t, fb.Watch(notifications))
+		for i := 1; i <= 5; i++ {
+			if i > 1 {
+				server.Set("foo", i)
+			}
+			event := <-notifications
+			assert.Equal(t, uint64(i), event.Seq)
+		}
+		fb.StopWatching()
+		for range notifications {
+		}
+	}
+}
+
+func TestWatchDeadLetter(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Connection", "close")
+		fmt.Fprint(w, "event: put\ngarbage\nmore garbage\n\n")
+		fmt.Fprint(w, "event: put\ndata: {nope\n\n")
+		fmt.Fprint(w, "event: patch\ndata: {\"data\":1}\n\n")
+		fmt.Fprint(w, "event: put\ndata: {\"path\":\"/foo\",\"data\":\"bar\"}\n\n")
+	}))
+	defer server.Close()
+
+	type letter struct {
+		raw string
+		err error
+	}
+	var mtx sync.Mutex
+	var letters []letter
+
+	fb := New(server.URL, nil)
+	fb.DeadLetter(func(raw []byte, err error) {
+		mtx.Lock()
+		letters = append(letters, letter{string(raw), err})
+		mtx.Unlock()
+	})
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+
+	event := receiveEvent(t, notifications)
+	assert.Equal(t, "/foo", event.Path)
+	assert.Equal(t, "bar", event.Data)
+	assert.Equal(t, uint64(1), event.Seq)
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	require.Len(t, letters, 3)
+	assert.Equal(t, "garbage\n", letters[0].raw)
+	assert.EqualError(t, letters[0].err, "missing prefix")
+	assert.Equal(t, "{nope", letters[1].raw)
+	assert.Error(t, letters[1].err)
+	assert.Equal(t, `{"data":1}`, letters[2].raw)
+	assert.EqualError(t, letters[2].err, "patch event without a path")
+}
+
+func TestWatchUndecodableEvent(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Connection", "close")
+		fmt.Fprint(w, "event: put\ndata: {\"data\":1}\n\n")
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+
+	event := receiveEvent(t, notifications)
+	assert.Equal(t, EventTypeError, event.Type)
+	assert.EqualError(t, event.Data.(error), "put event without a path")
+
+	_, ok := <-notifications
+	assert.False(t, ok, "notifications should be closed")
+}
+
+func TestWatchSkipInitialSnapshot(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("foo", "bar")
+
+	fb := New(server.URL, nil)
+	fb.SkipInitialSnapshot(true)
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+
+	server.Set("foo", "baz")
+	event := <-notifications
+	assert.Equal(t, EventTypePut, event.Type)
+	assert.Equal(t, "/foo", event.Path)
+	assert.Equal(t, "baz", event.Data)
+	assert.Equal(t, uint64(1), event.Seq)
+
+	fb.StopWatching()
+	for range notifications {
+	}
+}
+
+func TestPauseWatching(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	defer fb.StopWatching()
+	receiveEvent(t, notifications)
+
+	fb.PauseWatching(false)
+	server.Set("foo", "1")
+	time.Sleep(20 * time.Millisecond)
+	server.Set("foo", "2")
+	server.Set("bar", "x")
+	select {
+	case event := <-notifications:
+		t.Fatalf("unexpected event while paused: %v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the changes made while paused are merged
+	fb.ResumeWatching()
+	got := map[string]interface{}{}
+	for seq := uint64(2); seq <= 3; seq++ {
+		event := receiveEvent(t, notifications)
+		assert.Equal(t, seq, event.Seq)
+		got[event.Path] = event.Data
+	}
+	assert.Equal(t, map[string]interface{}{"/foo": "2", "/bar": "x"}, got)
+
+	server.Set("foo", "3")
+	event := receiveEvent(t, notifications)
+	assert.Equal(t, "3", event.Data)
+	assert.Equal(t, uint64(4), event.Seq)
+}
+
+func TestPauseWatchingStopReading(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("foo", "1")
+
+	var streams int32
+	fb := New(server.URL, nil)
+	fb.BeforeSend(func(req *http.Request, body []byte) error {
+		if req.Header.Get("Accept") == "text/event-stream" {
+			atomic.AddInt32(&streams, 1)
+		}
+		return nil
+	})
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	defer fb.StopWatching()
+	receiveEvent(t, notifications)
+
+	fb.PauseWatching(true)
+	time.Sleep(50 * time.Millisecond)
+	server.Set("foo", "2")
+	server.Set("bar", "x")
+
+	// the initial data of a new stream catches up
+	fb.ResumeWatching()
+	event := receiveEvent(t, notifications)
+	assert.Equal(t, EventTypePut, event.Type)
+	assert.Equal(t, map[string]interface{}{"foo": "2", "bar": "x"}, event.Data)
+	assert.Equal(t, uint64(2), event.Seq)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&streams))
+
+	server.Set("foo", "3")
+	event = receiveEvent(t, notifications)
+	assert.Equal(t, "/foo", event.Path)
+	assert.Equal(t, uint64(3), event.Seq)
+}
+
+func TestEventReaderIDs(t *testing.T) {
+	t.Parallel()
+	stream := "id: 1\nevent: put\ndata: {}\n\n" +
+		"event: put\ndata: {}\n\n" +
+		"event: put\ndata: {}\nid: 2\n\n"
+	frames := &eventReader{r: bufio.NewReader(strings.NewReader(stream))}
+
+	for _, id := range []string{"1", "1", "2"} {
+		evt, _, err := frames.next()
+		require.NoError(t, err)
+		assert.Equal(t, "put", string(evt))
+		assert.Equal(t, id, frames.lastID)
+	}
+}
+
+func TestMaxStreamAge(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("foo", "1")
+
+	var streams int32
+	fb := New(server.URL, nil)
+	fb.MaxStreamAge(100 * time.Millisecond)
+	fb.BeforeSend(func(req *http.Request, body []byte) error {
+		if req.Header.Get("Accept") == "text/event-stream" {
+			atomic.AddInt32(&streams, 1)
+		}
+		return nil
+	})
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	defer fb.StopWatching()
+	assert.Equal(t, uint64(1), receiveEvent(t, notifications).Seq)
+
+	// the stream is replaced, its initial data catching up
+	server.Set("foo", "2")
+	var event Event
+	for event.Path != "/" {
+		event = receiveEvent(t, notifications)
+	}
+	assert.Equal(t, map[string]interface{}{"foo": "2"}, event.Data)
+	assert.True(t, event.Seq > 1)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&streams))
+}
@@ -0,0 +1,448 @@
+package firego
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	fbsync "github.com/zabawaba99/firego/sync"
+)
+
+// ErrManagerClosed is returned when subscribing to a closed WatchManager.
+var ErrManagerClosed = errors.New("firego: watch manager closed")
+
+// WatchFunc handles an event of the location subscribed to at path.
+type WatchFunc func(path string, event Event)
+
+// WatchManager watches a set of locations that can change at runtime,
+// as long-lived daemons whose watched paths come from their
+// configuration need:
+//
+//    m := firego.NewWatchManager(fb, func(path string, event firego.Event) {
+//        log.Printf("%s%s changed", path, event.Path)
+//    })
+//    defer m.Close()
+//    m.Add("/config/flags")
+//    m.Add("/queues/emails")
+//
+// Locations under another subscribed location share its stream rather than
+// opening their own, their events being relative to their own path as if
+// they were watched on their own. Events are numbered per subscription,
+// Seq going back to 1 with an event holding the whole of the location
+// whenever it starts being served by a new stream, e.g. after the
+// connection was lost or an ancestor was added or removed, in which case
+// changes may have been missed.
+//
+// Streams are watched again after RetryDelay when they end. The handler is
+// called one event at a time for each subscription, and may add or remove
+// subscriptions.
+type WatchManager struct {
+	// OnError is called when a stream can not be established or ends
+	// with an error. Errors are logged if it is nil.
+	OnError func(path string, err error)
+	// RetryDelay is how long to wait before watching again after
+	// the connection is lost. It defaults to one second.
+	RetryDelay time.Duration
+
+	fb      *Firebase
+	handler WatchFunc
+
+	mtx     sync.Mutex
+	closed  bool
+	subs    map[string]*subscription
+	streams map[string]*managedStream
+	running sync.WaitGroup
+}
+
+// NewWatchManager creates a WatchManager calling handler with the
+// events of the locations, relative to fb, subscribed to.
+func NewWatchManager(fb *Firebase, handler WatchFunc) *WatchManager {
+	return &WatchManager{
+		RetryDelay: time.Second,
+		fb:         fb,
+		handler:    handler,
+		subs:       map[string]*subscription{},
+		streams:    map[string]*managedStream{},
+	}
+}
+
+// subscription is a location subscribed to.
+type subscription struct {
+	path string
+
+	// stream is the stream serving the subscription, guarded by the
+	// manager's mutex, and mtx serializes the calls to the handler
+	stream *managedStream
+	mtx    sync.Mutex
+}
+
+// managedStream watches a subscribed location having
+// no subscribed ancestor, for it and its descendants.
+type managedStream struct {
+	path string
+	stop chan struct{}
+	wake chan struct{}
+
+	mtx     sync.Mutex
+	pending []*subscription
+
+	// owned by the goroutine running the stream
+	attached map[*subscription]*attachment
+	mirror   *fbsync.Database
+	ready    bool
+}
+
+// attachment is a subscription served by a stream.
+type attachment struct {
+	// rel is the path of the subscription relative to the stream
+	rel []string
+	seq uint64
+}
+
+// Add subscribes to the location at path. Adding a location
+// already subscribed to does nothing.
+func (m *WatchManager) Add(path string) error {
+	path = cleanWatchPath(path)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.closed {
+		return ErrManagerClosed
+	}
+	if _, ok := m.subs[path]; ok {
+		return nil
+	}
+	m.subs[path] = &subscription{path: path}
+	m.reconcile()
+	return nil
+}
+
+// Remove unsubscribes from the location at path. The handler may still
+// be called for it by events being delivered when Remove is called.
+func (m *WatchManager) Remove(path string) {
+	path = cleanWatchPath(path)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	sub, ok := m.subs[path]
+	if !ok {
+		return
+	}
+	delete(m.subs, path)
+	sub.stream = nil
+	m.reconcile()
+}
+
+// Paths returns the locations subscribed to, sorted.
+func (m *WatchManager) Paths() []string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	paths := make([]string, 0, len(m.subs))
+	for path := range m.subs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Streams returns the locations actually watched, sorted, which are the
+// locations subscribed to having no subscribed ancestor.
+func (m *WatchManager) Streams() []string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	paths := make([]string, 0, len(m.streams))
+	for path := range m.streams {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Close stops watching and waits for the handler to return. The manager
+// can not be used afterwards.
+func (m *WatchManager) Close() {
+	m.mtx.Lock()
+	m.closed = true
+	for path, s := range m.streams {
+		close(s.stop)
+		delete(m.streams, path)
+	}
+	for _, sub := range m.subs {
+		sub.stream = nil
+	}
+	m.mtx.Unlock()
+
+	m.running.Wait()
+}
+
+// reconcile starts a stream for every subscribed location having no
+// subscribed ancestor, stops the others and attaches every subscription
+// to the stream of its closest ancestor. It must be called with the
+// manager's mutex held.
+func (m *WatchManager) reconcile() {
+	roots := map[string]bool{}
+	for path := range m.subs {
+		if m.streamPath(path) == path {
+			roots[path] = true
+		}
+	}
+
+	for path, s := range m.streams {
+		if !roots[path] {
+			close(s.stop)
+			delete(m.streams, path)
+		}
+	}
+	for path := range roots {
+		if _, ok := m.streams[path]; ok {
+			continue
+		}
+		s := &managedStream{
+			path:     path,
+			stop:     make(chan struct{}),
+			wake:     make(chan struct{}, 1),
+			attached: map[*subscription]*attachment{},
+		}
+		m.streams[path] = s
+		m.running.Add(1)
+		go func() {
+			defer m.running.Done()
+			m.run(s)
+		}()
+	}
+
+	for path, sub := range m.subs {
+		s := m.streams[m.streamPath(path)]
+		if sub.stream == s {
+			continue
+		}
+		sub.stream = s
+		s.mtx.Lock()
+		s.pending = append(s.pending, sub)
+		s.mtx.Unlock()
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// streamPath returns the highest subscribed location at or above path.
+func (m *WatchManager) streamPath(path string) string {
+	root := path
+	for p := path; p != "/"; {
+		p = p[:strings.LastIndex(p, "/")]
+		if p == "" {
+			p = "/"
+		}
+		if _, ok := m.subs[p]; ok {
+			root = p
+		}
+	}
+	return root
+}
+
+// run watches the location of s, watching it again whenever
+// the connection is lost, until s is stopped.
+func (m *WatchManager) run(s *managedStream) {
+	for {
+		ref := m.fb.at(s.path)
+		notifications := make(chan Event)
+		if err := ref.Watch(notifications); err != nil {
+			m.handleError(s.path, err)
+		} else {
+			m.session(s, ref, notifications)
+		}
+		s.ready = false
+
+		retry := time.After(m.RetryDelay)
+	wait:
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-s.wake:
+				m.attachPending(s)
+			case <-retry:
+				break wait
+			}
+		}
+	}
+}
+
+func (m *WatchManager) session(s *managedStream, ref *Firebase, notifications chan Event) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.stop:
+		case <-done:
+		}
+		ref.StopWatching()
+	}()
+
+	for {
+		select {
+		case <-s.wake:
+			m.attachPending(s)
+		case event, ok := <-notifications:
+			if !ok {
+				return
+			}
+			switch event.Type {
+			case EventTypePut, EventTypePatch:
+				m.apply(s, event)
+			case EventTypeError, EventTypeCancel, EventTypeAuthRevoked:
+				m.handleError(s.path, fmt.Errorf("watch ended by %s event", event.Type))
+			}
+		}
+	}
+}
+
+// attachPending attaches the subscriptions added to s, sending them the
+// data at their location if the stream has already received it.
+func (m *WatchManager) attachPending(s *managedStream) {
+	s.mtx.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.mtx.Unlock()
+
+	for _, sub := range pending {
+		a := &attachment{rel: splitPath(strings.TrimPrefix(sub.path, s.path))}
+		s.attached[sub] = a
+		if s.ready {
+			m.deliver(s, sub, a, Event{Type: EventTypePut, Path: "/", Data: s.value(a.rel)})
+		}
+	}
+}
+
+// apply updates the mirror of s with the event and delivers it to the
+// subscriptions whose location it changed.
+func (m *WatchManager) apply(s *managedStream, event Event) {
+	if event.Seq == 1 {
+		// a new stream, whose first event holds the whole location
+		s.mirror = fbsync.NewDB()
+		s.put("", event.Data)
+		s.ready = true
+		for sub, a := range s.attached {
+			a.seq = 0
+			m.deliver(s, sub, a, Event{Type: EventTypePut, Path: "/", Data: s.value(a.rel), rawData: event.rawData})
+		}
+		return
+	}
+	path := splitPath(event.Path)
+
+	// subscriptions below the event's path are sent their whole
+	// location when it changed, the others the event itself
+	before := map[*attachment]interface{}{}
+	for _, a := range s.attached {
+		if len(a.rel) > len(path) && hasPathPrefix(a.rel, path) {
+			before[a] = s.value(a.rel)
+		}
+	}
+
+	p := strings.Join(path, "/")
+	if event.Type == EventTypePatch {
+		children, _ := event.Data.(map[string]interface{})
+		for k, v := range children {
+			s.put(joinPath(p, k), v)
+		}
+	} else {
+		s.put(p, event.Data)
+	}
+
+	for sub, a := range s.attached {
+		switch {
+		case hasPathPrefix(path, a.rel):
+			e := event
+			e.Path = "/" + strings.Join(path[len(a.rel):], "/")
+			m.deliver(s, sub, a, e)
+		case hasPathPrefix(a.rel, path):
+			after := s.value(a.rel)
+			if !reflect.DeepEqual(before[a], after) {
+				m.deliver(s, sub, a, Event{Type: EventTypePut, Path: "/", Data: after})
+			}
+		}
+	}
+}
+
+// deliver calls the handler with the event, numbered for the
+// subscription, unless it is no longer served by s.
+func (m *WatchManager) deliver(s *managedStream, sub *subscription, a *attachment, event Event) {
+	sub.mtx.Lock()
+	defer sub.mtx.Unlock()
+
+	m.mtx.Lock()
+	current := sub.stream == s
+	m.mtx.Unlock()
+	if !current {
+		delete(s.attached, sub)
+		return
+	}
+
+	a.seq++
+	event.Seq = a.seq
+	if event.Path == "/" && event.Type == EventTypePut {
+		// the raw payload only matches the event when it was
+		// received for the subscription's location
+		if len(a.rel) > 0 || event.rawData == nil {
+			event.rawData = watchPayload(event.Data)
+		}
+	}
+	m.handler(sub.path, event)
+}
+
+func (m *WatchManager) handleError(path string, err error) {
+	if m.OnError != nil {
+		m.OnError(path, err)
+		return
+	}
+	log.Printf("WatchManager: %s: %s", path, err)
+}
+
+func (s *managedStream) put(path string, v interface{}) {
+	if v == nil {
+		s.mirror.Del(path)
+		return
+	}
+	s.mirror.Add(path, fbsync.NewNode("", v))
+}
+
+func (s *managedStream) value(path []string) interface{} {
+	n := s.mirror.Get(strings.Join(path, "/"))
+	if n == nil {
+		return nil
+	}
+	return n.Objectify()
+}
+
+// watchPayload returns the payload of a put event at
+// the root holding v, for use by Event.Value.
+func watchPayload(v interface{}) []byte {
+	b, _ := marshal(map[string]interface{}{"path": "/", "data": v})
+	return b
+}
+
+// hasPathPrefix reports whether path is at or below prefix.
+func hasPathPrefix(path, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i, k := range prefix {
+		if path[i] != k {
+			return false
+		}
+	}
+	return true
+}
+
+// cleanWatchPath returns path with a leading slash
+// and without empty segments.
+func cleanWatchPath(path string) string {
+	return "/" + strings.Join(splitPath(path), "/")
+}
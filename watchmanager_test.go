@@ -0,0 +1,142 @@
+package firego
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+type managedEvent struct {
+	path  string
+	event Event
+}
+
+func nextManagedEvent(t *testing.T, events chan managedEvent) managedEvent {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(2 * time.Second):
+		require.FailNow(t, "no event received")
+	}
+	return managedEvent{}
+}
+
+func TestWatchManager(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("a/b/c", "1")
+	server.Set("a/d", "2")
+
+	events := make(chan managedEvent, 10)
+	m := NewWatchManager(New(server.URL, nil), func(path string, event Event) {
+		events <- managedEvent{path: path, event: event}
+	})
+	defer m.Close()
+
+	require.NoError(t, m.Add("a"))
+	e := nextManagedEvent(t, events)
+	assert.Equal(t, "/a", e.path)
+	assert.Equal(t, uint64(1), e.event.Seq)
+	assert.Equal(t, map[string]interface{}{
+		"b": map[string]interface{}{"c": "1"},
+		"d": "2",
+	}, e.event.Data)
+
+	// served by the stream of its ancestor
+	require.NoError(t, m.Add("/a/b/"))
+	assert.Equal(t, []string{"/a", "/a/b"}, m.Paths())
+	assert.Equal(t, []string{"/a"}, m.Streams())
+	e = nextManagedEvent(t, events)
+	assert.Equal(t, "/a/b", e.path)
+	assert.Equal(t, uint64(1), e.event.Seq)
+	assert.Equal(t, map[string]interface{}{"c": "1"}, e.event.Data)
+	var v map[string]string
+	require.NoError(t, e.event.Value(&v))
+	assert.Equal(t, map[string]string{"c": "1"}, v)
+
+	server.Set("a/b/c", "3")
+	got := map[string]Event{}
+	for len(got) < 2 {
+		e = nextManagedEvent(t, events)
+		got[e.path] = e.event
+	}
+	assert.Equal(t, "/b/c", got["/a"].Path)
+	assert.Equal(t, "/c", got["/a/b"].Path)
+	assert.Equal(t, "3", got["/a/b"].Data)
+	assert.Equal(t, uint64(2), got["/a/b"].Seq)
+
+	// changes outside of a location are not delivered for it
+	server.Set("a/d", "4")
+	e = nextManagedEvent(t, events)
+	assert.Equal(t, "/a", e.path)
+	assert.Equal(t, "/d", e.event.Path)
+
+	// removing the ancestor gives the location its own stream
+	m.Remove("/a")
+	assert.Equal(t, []string{"/a/b"}, m.Paths())
+	assert.Equal(t, []string{"/a/b"}, m.Streams())
+	e = nextManagedEvent(t, events)
+	assert.Equal(t, "/a/b", e.path)
+	assert.Equal(t, uint64(1), e.event.Seq)
+	assert.Equal(t, map[string]interface{}{"c": "3"}, e.event.Data)
+
+	m.Close()
+	assert.Equal(t, ErrManagerClosed, m.Add("x"))
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event %v", e)
+	default:
+	}
+}
+
+func TestWatchManagerAncestorPut(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("a/b", "1")
+
+	events := make(chan managedEvent, 10)
+	m := NewWatchManager(New(server.URL, nil), func(path string, event Event) {
+		events <- managedEvent{path: path, event: event}
+	})
+	defer m.Close()
+
+	require.NoError(t, m.Add("/a"))
+	nextManagedEvent(t, events)
+	require.NoError(t, m.Add("/a/b"))
+	nextManagedEvent(t, events)
+	m.Remove("/a")
+	require.NoError(t, m.Add("/a"))
+	nextManagedEvent(t, events)
+	e := nextManagedEvent(t, events)
+	assert.Equal(t, uint64(1), e.event.Seq)
+	assert.Equal(t, []string{"/a"}, m.Streams())
+	for len(events) > 0 {
+		<-events
+	}
+
+	// a write above a location is delivered as a put of its new value,
+	// if it changed
+	server.Set("a", map[string]interface{}{"b": "1", "c": "2"})
+	e = nextManagedEvent(t, events)
+	assert.Equal(t, "/a", e.path)
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event %v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	server.Set("a", map[string]interface{}{"b": "5"})
+	got := map[string]Event{}
+	for len(got) < 2 {
+		e = nextManagedEvent(t, events)
+		got[e.path] = e.event
+	}
+	assert.Equal(t, EventTypePut, got["/a/b"].Type)
+	assert.Equal(t, "/", got["/a/b"].Path)
+	assert.Equal(t, "5", got["/a/b"].Data)
+}
@@ -0,0 +1,214 @@
+package firego
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WebhookSignatureHeader is the header that carries the HMAC-SHA256
+// signature of a webhook payload.
+const WebhookSignatureHeader = "X-Firego-Signature"
+
+// Webhook watches a Firebase reference and POSTs every event it receives
+// to an HTTP endpoint, letting services without a streaming client receive
+// changes. Each request body is a single EventRecord encoded as JSON.
+type Webhook struct {
+	// URL that events are delivered to.
+	URL string
+	// Secret is used to sign every payload with HMAC-SHA256. The hex encoded
+	// signature is sent as "sha256=<signature>" in the WebhookSignatureHeader
+	// header. Payloads are not signed if Secret is empty.
+	Secret []byte
+	// MaxRetries is the number of times a failed delivery is retried.
+	MaxRetries int
+	// Backoff is the delay before the first retry. It is doubled
+	// after every failed attempt.
+	Backoff time.Duration
+	// Client is used to deliver events. If nil, http.DefaultClient is used.
+	Client *http.Client
+	// OnError is called when an event could not be delivered after all
+	// retries. If nil, the failure is logged.
+	OnError func(Event, error)
+
+	fb *Firebase
+
+	mtx  sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewWebhook creates a Webhook that forwards events from fb to url.
+func NewWebhook(fb *Firebase, url string) *Webhook {
+	return &Webhook{
+		URL:        url,
+		MaxRetries: 3,
+		Backoff:    time.Second,
+		fb:         fb.copy(),
+	}
+}
+
+// Start begins watching the reference and delivering events in the
+// background. The reference is watched again, Backoff after the stream
+// ended, until Stop is called.
+func (wh *Webhook) Start() error {
+	wh.mtx.Lock()
+	defer wh.mtx.Unlock()
+	if wh.done != nil {
+		return nil
+	}
+
+	notifications := make(chan Event)
+	if err := wh.fb.Watch(notifications); err != nil {
+		return err
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	wh.stop, wh.done = stop, done
+	go func() {
+		defer close(done)
+		for notifications != nil {
+			for event := range notifications {
+				if err := wh.deliver(event, stop); err != nil {
+					if wh.OnError != nil {
+						wh.OnError(event, err)
+					} else {
+						log.Printf("Webhook: failed to deliver event to %s: %s", wh.URL, err)
+					}
+				}
+			}
+			notifications = wh.rewatch(stop)
+		}
+	}()
+	return nil
+}
+
+// Stop stops watching the reference and waits for any in flight
+// delivery to finish, the retries left being given up.
+func (wh *Webhook) Stop() {
+	wh.mtx.Lock()
+	stop, done := wh.stop, wh.done
+	wh.stop, wh.done = nil, nil
+	wh.mtx.Unlock()
+
+	if done == nil {
+		return
+	}
+	close(stop)
+	wh.fb.StopWatching()
+	<-done
+}
+
+// rewatch watches the reference again once its stream ended, waiting
+// Backoff before every attempt. It returns nil once stop is closed.
+func (wh *Webhook) rewatch(stop chan struct{}) chan Event {
+	for {
+		if !sleep(wh.Backoff, stop) {
+			return nil
+		}
+
+		// the reference is still marked as watching
+		wh.fb.StopWatching()
+		notifications := make(chan Event)
+		err := wh.fb.Watch(notifications)
+		if err == nil {
+			select {
+			case <-stop:
+				// stopped before the new stream could be
+				wh.fb.StopWatching()
+				return nil
+			default:
+				return notifications
+			}
+		}
+		log.Printf("Webhook: failed to watch %s again: %s", wh.fb.url, err)
+	}
+}
+
+// sleep waits for d, returning false if stop is closed first.
+func sleep(d time.Duration, stop chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// deliver posts event, retrying failed attempts until stop is closed.
+func (wh *Webhook) deliver(event Event, stop chan struct{}) error {
+	var body bytes.Buffer
+	if err := NewEventWriter(&body).Write(event); err != nil {
+		return err
+	}
+	payload := body.Bytes()
+
+	var signature string
+	if len(wh.Secret) > 0 {
+		mac := hmac.New(sha256.New, wh.Secret)
+		mac.Write(payload)
+		signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	backoff := wh.Backoff
+	var err error
+	for attempt := 0; attempt <= wh.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if !sleep(backoff, stop) {
+				return err
+			}
+			backoff *= 2
+		}
+
+		var retry bool
+		retry, err = wh.post(payload, signature)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// post sends a single delivery attempt and reports whether
+// a failure is worth retrying.
+func (wh *Webhook) post(payload []byte, signature string) (bool, error) {
+	req, err := http.NewRequest("POST", wh.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if signature != "" {
+		req.Header.Set(WebhookSignatureHeader, signature)
+	}
+
+	client := wh.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode/100 == 2:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode/100 == 5:
+		return true, fmt.Errorf("webhook responded with %s", resp.Status)
+	default:
+		return false, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+}
@@ -0,0 +1,180 @@
+package firego
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestWebhook(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	var (
+		secret   = []byte("shh")
+		attempts = new(int32)
+		records  = make(chan EventRecord, 10)
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(attempts, 1) == 1 {
+			// fail the first delivery so that it is retried
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(body)
+		assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), req.Header.Get(WebhookSignatureHeader))
+
+		var record EventRecord
+		require.NoError(t, json.Unmarshal(body, &record))
+		records <- record
+	}))
+	defer receiver.Close()
+
+	wh := NewWebhook(New(server.URL, nil), receiver.URL)
+	wh.Secret = secret
+	wh.Backoff = time.Millisecond
+	require.NoError(t, wh.Start())
+	defer wh.Stop()
+
+	select {
+	case record := <-records:
+		assert.Equal(t, EventTypePut, record.Type)
+		assert.Equal(t, "/", record.Path)
+	case <-time.After(time.Second):
+		require.FailNow(t, "initial event was not delivered")
+	}
+
+	server.Set("foo", true)
+	select {
+	case record := <-records:
+		assert.Equal(t, "/foo", record.Path)
+		assert.Equal(t, "true", string(record.Data))
+	case <-time.After(time.Second):
+		require.FailNow(t, "event was not delivered")
+	}
+}
+
+func TestWebhookDeliverGivesUp(t *testing.T) {
+	t.Parallel()
+	attempts := new(int32)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(attempts, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer receiver.Close()
+
+	wh := NewWebhook(New(URL, nil), receiver.URL)
+	wh.MaxRetries = 2
+	wh.Backoff = time.Millisecond
+
+	err := wh.deliver(Event{Type: EventTypePut, Path: "/"}, nil)
+	assert.Error(t, err)
+	assert.EqualValues(t, 3, atomic.LoadInt32(attempts))
+}
+
+func TestWebhookDeliverDoesNotRetryClientErrors(t *testing.T) {
+	t.Parallel()
+	attempts := new(int32)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(attempts, 1)
+		assert.Empty(t, req.Header.Get(WebhookSignatureHeader))
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer receiver.Close()
+
+	wh := NewWebhook(New(URL, nil), receiver.URL)
+	wh.Backoff = time.Millisecond
+
+	err := wh.deliver(Event{Type: EventTypePut, Path: "/"}, nil)
+	assert.Error(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(attempts))
+}
+
+func TestWebhookStopDuringBackoff(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	attempted := make(chan struct{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case attempted <- struct{}{}:
+		default:
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	wh := NewWebhook(New(server.URL, nil), receiver.URL)
+	wh.Backoff = time.Hour
+	require.NoError(t, wh.Start())
+	<-attempted
+
+	stopped := make(chan struct{})
+	go func() {
+		wh.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		require.FailNow(t, "Stop waited for the backoff")
+	}
+}
+
+func TestWebhookRewatch(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	records := make(chan EventRecord, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var record EventRecord
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&record))
+		records <- record
+	}))
+	defer receiver.Close()
+
+	wh := NewWebhook(New(server.URL, nil), receiver.URL)
+	wh.Backoff = 10 * time.Millisecond
+	require.NoError(t, wh.Start())
+	defer wh.Stop()
+
+	receive := func() EventRecord {
+		select {
+		case record := <-records:
+			return record
+		case <-time.After(time.Second):
+			require.FailNow(t, "event was not delivered")
+		}
+		return EventRecord{}
+	}
+	assert.Equal(t, "/", receive().Path)
+
+	// the stream ends, as when Firebase closes it
+	wh.fb.StopWatching()
+	assert.Equal(t, "/", receive().Path, "the initial data of the new stream")
+
+	server.Set("foo", true)
+	assert.Equal(t, "/foo", receive().Path)
+}
@@ -0,0 +1,615 @@
+/*
+Package wire is an experimental client for the realtime protocol that the
+official Firebase SDKs speak over WebSockets. Compared to the REST API used
+by firego it keeps a single connection open for both reads and writes,
+which lowers the latency of listens and writes. When a websocket can not be
+established, the client falls back to the long-polling protocol, made of
+plain HTTP requests, that the SDKs use behind restrictive proxies.
+
+The protocol is not publicly documented and only the subset needed for
+reading, writing and listening is implemented:
+
+    c, err := wire.Dial("https://my-app.firebaseio.com", firego.TokenSourceFunc(func() (string, error) {
+        return token, nil
+    }))
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer c.Close()
+
+    events := make(chan wire.Event)
+    if err := c.Watch("users", events); err != nil {
+        log.Fatal(err)
+    }
+*/
+package wire
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zabawaba99/firego"
+)
+
+const protocolVersion = "5"
+
+// actions used in the protocol messages
+const (
+	actionAuth     = "auth"
+	actionGet      = "g"
+	actionPut      = "p"
+	actionMerge    = "m"
+	actionListen   = "q"
+	actionUnlisten = "n"
+
+	// sent by the server
+	actionData          = "d"
+	actionListenRevoked = "c"
+	actionAuthRevoked   = "ac"
+)
+
+// ErrClosed is returned when using a Client that has been closed.
+var ErrClosed = errors.New("wire: connection closed")
+
+// keepAliveInterval is how often an empty
+// message is sent to keep the connection open.
+var keepAliveInterval = 45 * time.Second
+
+// Event is a change received while watching a location.
+type Event struct {
+	// Type is either firego.EventTypePut, firego.EventTypePatch
+	// or firego.EventTypeAuthRevoked.
+	Type firego.EventType
+	// Path of the data that changed, relative to the watched location.
+	Path string
+	// Data that changed
+	Data interface{}
+
+	raw json.RawMessage
+}
+
+// Value converts the data of the event into the given interface.
+func (e Event) Value(v interface{}) error {
+	if len(e.raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(e.raw, v)
+}
+
+// message is the envelope of every message in the protocol.
+type message struct {
+	// Type is "d" for data and "c" for control messages
+	Type string          `json:"t"`
+	Data json.RawMessage `json:"d"`
+}
+
+type dataMessage struct {
+	Request int             `json:"r,omitempty"`
+	Action  string          `json:"a,omitempty"`
+	Body    json.RawMessage `json:"b"`
+}
+
+type response struct {
+	Status string          `json:"s"`
+	Data   json.RawMessage `json:"d"`
+}
+
+type push struct {
+	Path string          `json:"p"`
+	Data json.RawMessage `json:"d"`
+}
+
+// watcher delivers the events of a watched location. Events are queued
+// and sent on the channel by a goroutine of their own, so that a slow
+// reader of the channel does not hold up the connection.
+type watcher struct {
+	notifications chan Event
+	stop          chan struct{}
+	stopOnce      sync.Once
+	// exited is closed once run closed the channel
+	exited chan struct{}
+	// ready is signaled when events are queued
+	ready chan struct{}
+
+	mtx   sync.Mutex
+	queue []Event
+	// abandoned keeps the channel open once run returns
+	abandoned bool
+}
+
+func newWatcher(notifications chan Event) *watcher {
+	w := &watcher{
+		notifications: notifications,
+		stop:          make(chan struct{}),
+		exited:        make(chan struct{}),
+		ready:         make(chan struct{}, 1),
+	}
+	go w.run()
+	return w
+}
+
+// send queues the event, it does not block.
+func (w *watcher) send(event Event) {
+	select {
+	case <-w.stop:
+		return
+	default:
+	}
+
+	w.mtx.Lock()
+	w.queue = append(w.queue, event)
+	w.mtx.Unlock()
+	select {
+	case w.ready <- struct{}{}:
+	default:
+	}
+}
+
+// run sends the queued events on the channel, in order,
+// until the watcher is closed.
+func (w *watcher) run() {
+	defer close(w.exited)
+	defer func() {
+		w.mtx.Lock()
+		defer w.mtx.Unlock()
+		if !w.abandoned {
+			close(w.notifications)
+		}
+	}()
+	for {
+		select {
+		case <-w.ready:
+		case <-w.stop:
+			return
+		}
+
+		w.mtx.Lock()
+		queue := w.queue
+		w.queue = nil
+		w.mtx.Unlock()
+		for _, event := range queue {
+			select {
+			case w.notifications <- event:
+			case <-w.stop:
+				return
+			}
+		}
+	}
+}
+
+// close drops the events not yet delivered and
+// returns once the channel of the watcher is closed.
+func (w *watcher) close() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.exited
+}
+
+// abandon stops the watcher, leaving its channel open.
+func (w *watcher) abandon() {
+	w.mtx.Lock()
+	w.abandoned = true
+	w.mtx.Unlock()
+	w.close()
+}
+
+// transport carries the messages of the protocol.
+type transport interface {
+	WriteText(msg []byte) error
+	ReadText() ([]byte, error)
+	Close() error
+}
+
+// Transport selects how a Client talks to Firebase.
+type Transport int
+
+const (
+	// TransportAuto uses websockets, falling back to long-polling
+	// when a websocket connection can not be established.
+	TransportAuto Transport = iota
+	// TransportWebSocket only uses websockets.
+	TransportWebSocket
+	// TransportLongPoll only uses long-polling, which works behind
+	// proxies that break both websockets and server-sent events.
+	TransportLongPoll
+)
+
+// Client is a connection to a Firebase database.
+type Client struct {
+	conn transport
+
+	mtx      sync.Mutex
+	nextReq  int
+	pending  map[int]chan response
+	watchers map[string]*watcher
+	err      error
+
+	done chan struct{}
+}
+
+// Dial connects to the Firebase database at url. If tokens is
+// not nil the connection is authenticated with its token.
+func Dial(url string, tokens firego.TokenSource) (*Client, error) {
+	return DialTransport(url, tokens, TransportAuto)
+}
+
+// DialTransport is like Dial but lets the caller choose the transport.
+func DialTransport(url string, tokens firego.TokenSource, t Transport) (*Client, error) {
+	conn, err := dialTransport(url, t)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		conn:     conn,
+		pending:  map[int]chan response{},
+		watchers: map[string]*watcher{},
+		done:     make(chan struct{}),
+	}
+	go c.read()
+	if _, ok := conn.(*wsConn); ok {
+		go c.keepAlive()
+	}
+
+	if tokens != nil {
+		token, err := tokens.Token()
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		if _, err := c.request(actionAuth, map[string]interface{}{"cred": token}); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Close closes the connection. Channels given to Watch are closed.
+func (c *Client) Close() error {
+	c.mtx.Lock()
+	if c.err != nil {
+		c.mtx.Unlock()
+		return nil
+	}
+	c.err = ErrClosed
+	close(c.done)
+	c.mtx.Unlock()
+	return c.conn.Close()
+}
+
+// Transport returns the transport in use.
+func (c *Client) Transport() Transport {
+	if _, ok := c.conn.(*longPollConn); ok {
+		return TransportLongPoll
+	}
+	return TransportWebSocket
+}
+
+func dialTransport(url string, t Transport) (transport, error) {
+	if !strings.Contains(url, "://") {
+		url = "https://" + url
+	}
+
+	var wsErr error
+	if t != TransportLongPoll {
+		wsURL, err := websocketURL(url)
+		if err != nil {
+			return nil, err
+		}
+		ws, err := dialWebsocket(wsURL, &net.Dialer{Timeout: firego.TimeoutDuration})
+		switch {
+		case err == nil:
+			return ws, nil
+		case t == TransportWebSocket:
+			return nil, err
+		}
+		wsErr = err
+	}
+
+	lp, err := dialLongPoll(url, &http.Client{})
+	if err != nil && wsErr != nil {
+		return nil, fmt.Errorf("websocket: %s, long-polling: %s", wsErr, err)
+	}
+	return lp, err
+}
+
+// Value reads the data at path into v.
+func (c *Client) Value(path string, v interface{}) error {
+	data, err := c.request(actionGet, map[string]interface{}{
+		"p": cleanPath(path),
+		"q": map[string]interface{}{},
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Set writes v at path, replacing any existing data.
+func (c *Client) Set(path string, v interface{}) error {
+	_, err := c.request(actionPut, map[string]interface{}{"p": cleanPath(path), "d": v})
+	return err
+}
+
+// Update merges the children of v into the data at path.
+func (c *Client) Update(path string, v interface{}) error {
+	_, err := c.request(actionMerge, map[string]interface{}{"p": cleanPath(path), "d": v})
+	return err
+}
+
+// Remove deletes the data at path.
+func (c *Client) Remove(path string) error {
+	return c.Set(path, nil)
+}
+
+// Watch listens for changes at path and sends them on the given channel,
+// starting with a put event holding the current value. Only one watch per
+// path can be running at a time; the channel is closed once StopWatching
+// is called or the connection is lost.
+func (c *Client) Watch(path string, notifications chan Event) error {
+	path = cleanPath(path)
+
+	c.mtx.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mtx.Unlock()
+		return err
+	}
+	if _, ok := c.watchers[path]; ok {
+		c.mtx.Unlock()
+		return fmt.Errorf("wire: already watching %q", path)
+	}
+	w := newWatcher(notifications)
+	c.watchers[path] = w
+	c.mtx.Unlock()
+
+	_, err := c.request(actionListen, map[string]interface{}{"p": path, "h": ""})
+	if err != nil {
+		c.mtx.Lock()
+		owned := c.watchers[path] == w
+		if owned {
+			delete(c.watchers, path)
+		}
+		c.mtx.Unlock()
+		if owned {
+			w.abandon()
+		}
+	}
+	return err
+}
+
+// StopWatching stops the watch at path and closes its channel.
+func (c *Client) StopWatching(path string) error {
+	path = cleanPath(path)
+
+	c.mtx.Lock()
+	w, ok := c.watchers[path]
+	delete(c.watchers, path)
+	c.mtx.Unlock()
+	if !ok {
+		return nil
+	}
+	w.close()
+
+	_, err := c.request(actionUnlisten, map[string]interface{}{"p": path})
+	return err
+}
+
+func (c *Client) request(action string, body interface{}) (json.RawMessage, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mtx.Unlock()
+		return nil, err
+	}
+	c.nextReq++
+	id := c.nextReq
+	respCh := make(chan response, 1)
+	c.pending[id] = respCh
+	c.mtx.Unlock()
+
+	msg, err := json.Marshal(map[string]interface{}{
+		"t": "d",
+		"d": dataMessage{Request: id, Action: action, Body: b},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.conn.WriteText(msg); err != nil {
+		c.fail(err)
+	}
+
+	resp, ok := <-respCh
+	if !ok {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		return nil, c.err
+	}
+	if resp.Status != "ok" {
+		var reason string
+		if err := json.Unmarshal(resp.Data, &reason); err != nil || reason == "" {
+			reason = string(resp.Data)
+		}
+		return nil, fmt.Errorf("wire: %s: %s", resp.Status, reason)
+	}
+	return resp.Data, nil
+}
+
+func (c *Client) read() {
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		var m message
+		if err := json.Unmarshal(msg, &m); err != nil || m.Type != "d" {
+			// control messages (handshake, server resets) are ignored
+			continue
+		}
+
+		var d dataMessage
+		if err := json.Unmarshal(m.Data, &d); err != nil {
+			continue
+		}
+
+		if d.Request != 0 {
+			var resp response
+			json.Unmarshal(d.Body, &resp)
+			c.mtx.Lock()
+			respCh, ok := c.pending[d.Request]
+			delete(c.pending, d.Request)
+			c.mtx.Unlock()
+			if ok {
+				respCh <- resp
+			}
+			continue
+		}
+
+		var p push
+		json.Unmarshal(d.Body, &p)
+		c.dispatch(d.Action, p)
+	}
+}
+
+// readMessage reads a protocol message, which the server may split
+// across several websocket messages preceded by their count.
+func (c *Client) readMessage() ([]byte, error) {
+	msg, err := c.conn.ReadText()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(msg) > 6 {
+		return msg, nil
+	}
+	frames, err := strconv.Atoi(string(msg))
+	if err != nil {
+		return msg, nil
+	}
+
+	var buf []byte
+	for i := 0; i < frames; i++ {
+		part, err := c.conn.ReadText()
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, part...)
+	}
+	return buf, nil
+}
+
+func (c *Client) dispatch(action string, p push) {
+	var typ firego.EventType
+	switch action {
+	case actionData:
+		typ = firego.EventTypePut
+	case actionMerge:
+		typ = firego.EventTypePatch
+	case actionAuthRevoked:
+		typ = firego.EventTypeAuthRevoked
+	case actionListenRevoked:
+		c.mtx.Lock()
+		w, ok := c.watchers[cleanPath(p.Path)]
+		delete(c.watchers, cleanPath(p.Path))
+		c.mtx.Unlock()
+		if ok {
+			w.close()
+		}
+		return
+	default:
+		return
+	}
+
+	path := cleanPath(p.Path)
+
+	c.mtx.Lock()
+	var targets []*watcher
+	var relative []string
+	for watched, w := range c.watchers {
+		if typ == firego.EventTypeAuthRevoked {
+			targets = append(targets, w)
+			relative = append(relative, "/")
+			continue
+		}
+		if rel, ok := relativePath(watched, path); ok {
+			targets = append(targets, w)
+			relative = append(relative, rel)
+		}
+	}
+	c.mtx.Unlock()
+
+	var data interface{}
+	json.Unmarshal(p.Data, &data)
+	for i, w := range targets {
+		w.send(Event{Type: typ, Path: relative[i], Data: data, raw: p.Data})
+	}
+}
+
+func (c *Client) keepAlive() {
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.conn.WriteText([]byte("0")); err != nil {
+				c.fail(err)
+				return
+			}
+		}
+	}
+}
+
+// fail records the error that broke the connection, failing
+// pending requests and closing the channels of watchers.
+func (c *Client) fail(err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.err == nil {
+		c.err = err
+		close(c.done)
+		go c.conn.Close()
+	}
+	for id, respCh := range c.pending {
+		close(respCh)
+		delete(c.pending, id)
+	}
+	for path, w := range c.watchers {
+		w.close()
+		delete(c.watchers, path)
+	}
+}
+
+// relativePath returns the path of changed relative to watched, if
+// changed is watched or one of its descendants.
+func relativePath(watched, changed string) (string, bool) {
+	switch {
+	case watched == "":
+		return "/" + changed, true
+	case changed == watched:
+		return "/", true
+	case strings.HasPrefix(changed, watched+"/"):
+		return changed[len(watched):], true
+	}
+	return "", false
+}
+
+func cleanPath(path string) string {
+	return strings.Trim(path, "/")
+}
@@ -0,0 +1,416 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego"
+	"github.com/zabawaba99/firego/sync"
+)
+
+// fakeServer speaks enough of the protocol to exercise the client.
+type fakeServer struct {
+	*httptest.Server
+	secret      string
+	noWebsocket bool
+
+	mtx     gosync.Mutex
+	db      *sync.Database
+	listens map[string]bool
+
+	// long-polling session
+	lpQueue    chan []byte
+	lpSegments []string
+}
+
+func newFakeServer() *fakeServer {
+	fs := &fakeServer{
+		secret:  "secret",
+		db:      sync.NewDB(),
+		listens: map[string]bool{},
+		lpQueue: make(chan []byte, 100),
+	}
+	fs.Server = httptest.NewServer(http.HandlerFunc(fs.serveHTTP))
+	return fs
+}
+
+func (fs *fakeServer) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Query().Get("ns") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case req.URL.Path == "/.ws" && !fs.noWebsocket:
+		fs.serveWebsocket(w, req)
+	case req.URL.Path == "/.lp":
+		fs.serveLongPoll(w, req)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (fs *fakeServer) serveWebsocket(w http.ResponseWriter, req *http.Request) {
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + acceptKey(req.Header.Get("Sec-Websocket-Key")) + "\r\n\r\n")
+	rw.Flush()
+
+	ws := &wsConn{conn: conn, br: rw.Reader}
+	send := func(msg []byte) {
+		if len(msg) < 64 {
+			ws.WriteText(msg)
+			return
+		}
+		// exercise messages split across several frames
+		half := len(msg) / 2
+		ws.WriteText([]byte("2"))
+		ws.WriteText(msg[:half])
+		ws.WriteText(msg[half:])
+	}
+	send([]byte(handshakeMessage))
+
+	for {
+		msg, err := ws.ReadText()
+		if err != nil {
+			return
+		}
+		fs.handle(msg, send)
+	}
+}
+
+func (fs *fakeServer) serveLongPoll(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	if q.Get(lpStartParam) == "t" {
+		fs.lpQueue <- []byte(handshakeMessage)
+		fmt.Fprint(w, `pLPCommand("start","session","password");`)
+		return
+	}
+	if q.Get(lpIDParam) != "session" || q.Get(lpPasswordParam) != "password" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case q.Get(lpDisconnectParam) == "t":
+		return
+	case q.Get(lpSegmentParam+"0") != "":
+		total, _ := strconv.Atoi(q.Get(lpTotalParam + "0"))
+		fs.mtx.Lock()
+		fs.lpSegments = append(fs.lpSegments, q.Get(lpDataParam+"0"))
+		var data string
+		if len(fs.lpSegments) == total {
+			data = strings.Join(fs.lpSegments, "")
+			fs.lpSegments = nil
+		}
+		fs.mtx.Unlock()
+
+		if data != "" {
+			msg, _ := base64.StdEncoding.DecodeString(data)
+			fs.handle(msg, func(msg []byte) { fs.lpQueue <- msg })
+		}
+		return
+	}
+
+	// poll
+	var msgs [][]byte
+	select {
+	case msg := <-fs.lpQueue:
+		msgs = append(msgs, msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+drain:
+	for len(msgs) < 10 {
+		select {
+		case msg := <-fs.lpQueue:
+			msgs = append(msgs, msg)
+		default:
+			break drain
+		}
+	}
+	fmt.Fprintf(w, "pRTLPCB(%s,[%s]);", q.Get(lpSerialParam), bytes.Join(msgs, []byte(",")))
+}
+
+const handshakeMessage = `{"t":"c","d":{"t":"h","d":{"ts":1,"v":"5","h":"localhost","s":"session"}}}`
+
+func (fs *fakeServer) handle(msg []byte, send func([]byte)) {
+	if string(msg) == "0" {
+		return
+	}
+
+	var m struct {
+		D struct {
+			R int    `json:"r"`
+			A string `json:"a"`
+			B struct {
+				P    string      `json:"p"`
+				D    interface{} `json:"d"`
+				Cred string      `json:"cred"`
+			} `json:"b"`
+		} `json:"d"`
+	}
+	json.Unmarshal(msg, &m)
+	path, data := m.D.B.P, m.D.B.D
+
+	status, result := "ok", interface{}(nil)
+	fs.mtx.Lock()
+	switch m.D.A {
+	case actionAuth:
+		if m.D.B.Cred != fs.secret {
+			status, result = "invalid_token", "Could not parse auth token."
+		}
+	case actionGet:
+		result = fs.get(path)
+	case actionPut:
+		fs.db.Add(path, sync.NewNode("", data))
+		fs.notify(send, actionData, path, data)
+	case actionMerge:
+		fs.db.Update(path, sync.NewNode("", data))
+		fs.notify(send, actionMerge, path, data)
+	case actionListen:
+		fs.listens[path] = true
+		fs.push(send, actionData, path, fs.get(path))
+	case actionUnlisten:
+		delete(fs.listens, path)
+	}
+	fs.mtx.Unlock()
+
+	resp, _ := json.Marshal(map[string]interface{}{
+		"t": "d",
+		"d": map[string]interface{}{
+			"r": m.D.R,
+			"b": map[string]interface{}{"s": status, "d": result},
+		},
+	})
+	send(resp)
+}
+
+func (fs *fakeServer) get(path string) interface{} {
+	if n := fs.db.Get(path); n != nil {
+		return n.Objectify()
+	}
+	return nil
+}
+
+func (fs *fakeServer) notify(send func([]byte), action, path string, data interface{}) {
+	for listen := range fs.listens {
+		if listen == "" || path == listen || strings.HasPrefix(path, listen+"/") {
+			fs.push(send, action, path, data)
+			return
+		}
+	}
+}
+
+func (fs *fakeServer) push(send func([]byte), action, path string, data interface{}) {
+	msg, _ := json.Marshal(map[string]interface{}{
+		"t": "d",
+		"d": map[string]interface{}{
+			"a": action,
+			"b": map[string]interface{}{"p": path, "d": data},
+		},
+	})
+	send(msg)
+}
+
+func receive(t *testing.T, events chan Event) Event {
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "channel was closed")
+		return event
+	case <-time.After(time.Second):
+		require.FailNow(t, "did not receive an event")
+	}
+	return Event{}
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+	server := newFakeServer()
+	defer server.Close()
+
+	c, err := Dial(server.URL, firego.TokenSourceFunc(func() (string, error) {
+		return "secret", nil
+	}))
+	require.NoError(t, err)
+	defer c.Close()
+	assert.Equal(t, TransportWebSocket, c.Transport())
+
+	require.NoError(t, c.Set("users/1", map[string]string{"name": "alice"}))
+	require.NoError(t, c.Update("users/1", map[string]string{"nick": "al"}))
+
+	var v map[string]string
+	require.NoError(t, c.Value("/users/1/", &v))
+	assert.Equal(t, map[string]string{"name": "alice", "nick": "al"}, v)
+
+	events := make(chan Event, 10)
+	require.NoError(t, c.Watch("users", events))
+	assert.Error(t, c.Watch("users", events))
+
+	event := receive(t, events)
+	assert.Equal(t, firego.EventTypePut, event.Type)
+	assert.Equal(t, "/", event.Path)
+
+	require.NoError(t, c.Set("users/2/name", "bob"))
+	event = receive(t, events)
+	assert.Equal(t, firego.EventTypePut, event.Type)
+	assert.Equal(t, "/2/name", event.Path)
+	var name string
+	require.NoError(t, event.Value(&name))
+	assert.Equal(t, "bob", name)
+
+	require.NoError(t, c.Update("users/2", map[string]string{"nick": "b"}))
+	event = receive(t, events)
+	assert.Equal(t, firego.EventTypePatch, event.Type)
+	assert.Equal(t, "/2", event.Path)
+
+	require.NoError(t, c.StopWatching("users"))
+	_, ok := <-events
+	assert.False(t, ok)
+}
+
+func TestClientSlowWatcher(t *testing.T) {
+	t.Parallel()
+	server := newFakeServer()
+	defer server.Close()
+
+	c, err := Dial(server.URL, nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	// a channel that is never read
+	require.NoError(t, c.Watch("users", make(chan Event)))
+
+	events := make(chan Event, 10)
+	require.NoError(t, c.Watch("orders", events))
+	receive(t, events)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, c.Set(fmt.Sprintf("users/%d", i), "alice"))
+		}
+		var v map[string]string
+		assert.NoError(t, c.Value("users", &v))
+		assert.NoError(t, c.Set("orders/1", "book"))
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "requests blocked by a watcher that is not read")
+	}
+	event := receive(t, events)
+	assert.Equal(t, "/1", event.Path)
+
+	require.NoError(t, c.StopWatching("users"))
+}
+
+func TestDialInvalidToken(t *testing.T) {
+	t.Parallel()
+	server := newFakeServer()
+	defer server.Close()
+
+	_, err := Dial(server.URL, firego.TokenSourceFunc(func() (string, error) {
+		return "nope", nil
+	}))
+	assert.EqualError(t, err, "wire: invalid_token: Could not parse auth token.")
+}
+
+func TestClientClose(t *testing.T) {
+	t.Parallel()
+	server := newFakeServer()
+	defer server.Close()
+
+	c, err := Dial(server.URL, nil)
+	require.NoError(t, err)
+
+	events := make(chan Event, 10)
+	require.NoError(t, c.Watch("", events))
+	receive(t, events)
+
+	require.NoError(t, c.Close())
+	for range events {
+	}
+	assert.Equal(t, ErrClosed, c.Set("foo", "bar"))
+}
+
+func TestWebsocketURL(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		url, expected string
+	}{
+		{"https://my-app.firebaseio.com", "wss://my-app.firebaseio.com/.ws?ns=my-app&v=5"},
+		{"my-app.firebaseio.com/", "wss://my-app.firebaseio.com/.ws?ns=my-app&v=5"},
+		{"http://localhost:9000?ns=other", "ws://localhost:9000/.ws?ns=other&v=5"},
+	} {
+		url, err := websocketURL(test.url)
+		require.NoError(t, err, test.url)
+		assert.Equal(t, test.expected, url, test.url)
+	}
+
+	_, err := websocketURL("ftp://example.com")
+	assert.Error(t, err)
+}
+
+func TestRelativePath(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		watched, changed, expected string
+		ok                         bool
+	}{
+		{"", "a/b", "/a/b", true},
+		{"a", "a", "/", true},
+		{"a", "a/b", "/b", true},
+		{"a", "ab", "", false},
+		{"a/b", "a", "", false},
+	} {
+		rel, ok := relativePath(test.watched, test.changed)
+		assert.Equal(t, test.ok, ok, "%v", test)
+		assert.Equal(t, test.expected, rel, "%v", test)
+	}
+}
+
+func TestReadTextFragmented(t *testing.T) {
+	t.Parallel()
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	pong := make(chan []byte, 1)
+	go func() {
+		// "he" without FIN, a ping, then "llo" as the final continuation
+		remote.Write([]byte{0x01, 0x02, 'h', 'e', 0x89, 0x00, 0x80, 0x03, 'l', 'l', 'o'})
+		frame := make([]byte, 6)
+		io.ReadFull(remote, frame)
+		pong <- frame
+	}()
+
+	ws := &wsConn{conn: local, br: bufio.NewReader(local), client: true}
+	msg, err := ws.ReadText()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(msg))
+
+	frame := <-pong
+	assert.Equal(t, byte(0x80|opPong), frame[0])
+	assert.Equal(t, byte(0x80), frame[1], "client frames must be masked")
+}
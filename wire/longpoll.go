@@ -0,0 +1,273 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	_url "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// long-polling request parameters
+//
+// The protocol is the one used by the JavaScript SDK when neither
+// websockets nor server-sent events make it through: a session is opened
+// with a start request, messages are sent base64 encoded in the query string
+// of GET requests and the server answers outstanding poll requests with the
+// messages it has queued.
+const (
+	lpStartParam      = "start"
+	lpIDParam         = "id"
+	lpPasswordParam   = "pw"
+	lpSerialParam     = "ser"
+	lpCallbackParam   = "cb"
+	lpDisconnectParam = "disconn"
+	lpSegmentParam    = "seg"
+	lpTotalParam      = "ts"
+	lpDataParam       = "d"
+)
+
+// maxSegmentSize is the maximum amount of encoded data sent per request
+// so that URLs stay within the limits of proxies.
+const maxSegmentSize = 1800
+
+// lpCommandRE matches the commands sent by the server, such as the
+// one carrying the id and password of a new session.
+var lpCommandRE = regexp.MustCompile(`pLPCommand\((.*?)\);`)
+
+// lpCallback precedes each batch of messages in a poll response.
+var lpCallback = []byte("pRTLPCB(")
+
+// longPollConn is a transport made of plain HTTP requests.
+type longPollConn struct {
+	client *http.Client
+	url    string
+	ns     string
+	id, pw string
+
+	mtx    sync.Mutex
+	serial int
+	err    error
+
+	// segments are numbered across the whole session so
+	// that the server can reassemble them in order
+	writeMtx sync.Mutex
+	segment  int
+
+	msgs chan []byte
+	done chan struct{}
+}
+
+// dialLongPoll opens a long-polling session with the
+// database at url, which uses the http or https scheme.
+func dialLongPoll(url string, client *http.Client) (*longPollConn, error) {
+	u, err := _url.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	ns := u.Query().Get("ns")
+	if ns == "" {
+		ns = strings.Split(u.Hostname(), ".")[0]
+	}
+
+	lp := &longPollConn{
+		client: client,
+		url:    u.Scheme + "://" + u.Host + "/.lp",
+		ns:     ns,
+		msgs:   make(chan []byte, 16),
+		done:   make(chan struct{}),
+	}
+
+	body, err := lp.get(_url.Values{
+		lpStartParam:    {"t"},
+		lpCallbackParam: {"1"},
+		"v":             {protocolVersion},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	match := lpCommandRE.FindSubmatch(body)
+	if match == nil {
+		return nil, errors.New("long-polling session was not started")
+	}
+	var args []string
+	if err := json.Unmarshal([]byte("["+string(match[1])+"]"), &args); err != nil || len(args) != 3 || args[0] != "start" {
+		return nil, fmt.Errorf("unexpected long-polling command %s", match[1])
+	}
+	lp.id, lp.pw = args[1], args[2]
+
+	go lp.poll()
+	return lp, nil
+}
+
+// WriteText sends a message, split across as many requests as needed.
+func (lp *longPollConn) WriteText(msg []byte) error {
+	data := base64.StdEncoding.EncodeToString(msg)
+
+	var segments []string
+	for len(data) > maxSegmentSize {
+		segments = append(segments, data[:maxSegmentSize])
+		data = data[maxSegmentSize:]
+	}
+	segments = append(segments, data)
+
+	lp.writeMtx.Lock()
+	defer lp.writeMtx.Unlock()
+	for _, segment := range segments {
+		num := lp.segment
+		lp.segment++
+		_, err := lp.get(lp.session(_url.Values{
+			lpSegmentParam + "0": {strconv.Itoa(num)},
+			lpTotalParam + "0":   {strconv.Itoa(len(segments))},
+			lpDataParam + "0":    {segment},
+		}))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadText returns the next message received by the poller.
+func (lp *longPollConn) ReadText() ([]byte, error) {
+	msg, ok := <-lp.msgs
+	if !ok {
+		lp.mtx.Lock()
+		defer lp.mtx.Unlock()
+		return nil, lp.err
+	}
+	return msg, nil
+}
+
+// Close ends the session.
+func (lp *longPollConn) Close() error {
+	lp.mtx.Lock()
+	select {
+	case <-lp.done:
+		lp.mtx.Unlock()
+		return nil
+	default:
+		close(lp.done)
+	}
+	lp.mtx.Unlock()
+
+	_, err := lp.get(lp.session(_url.Values{lpDisconnectParam: {"t"}}))
+	return err
+}
+
+func (lp *longPollConn) poll() {
+	defer close(lp.msgs)
+	for {
+		body, err := lp.get(lp.session(_url.Values{}))
+		if err != nil {
+			lp.fail(err)
+			return
+		}
+
+		msgs, err := parsePollResponse(body)
+		if err != nil {
+			lp.fail(err)
+			return
+		}
+		for _, msg := range msgs {
+			select {
+			case lp.msgs <- msg:
+			case <-lp.done:
+				lp.fail(io.EOF)
+				return
+			}
+		}
+
+		select {
+		case <-lp.done:
+			lp.fail(io.EOF)
+			return
+		default:
+		}
+	}
+}
+
+func (lp *longPollConn) fail(err error) {
+	lp.mtx.Lock()
+	defer lp.mtx.Unlock()
+	select {
+	case <-lp.done:
+		// closed on purpose
+		err = io.EOF
+	default:
+	}
+	if lp.err == nil {
+		lp.err = err
+	}
+}
+
+// parsePollResponse extracts the messages from the
+// pRTLPCB(serial, [messages...]); calls of a poll response.
+func parsePollResponse(body []byte) ([]json.RawMessage, error) {
+	var msgs []json.RawMessage
+	for {
+		i := bytes.Index(body, lpCallback)
+		if i < 0 {
+			return msgs, nil
+		}
+		body = body[i+len(lpCallback):]
+
+		// skip the serial number
+		i = bytes.IndexByte(body, ',')
+		if i < 0 {
+			return nil, errors.New("invalid long-polling response")
+		}
+		body = bytes.TrimLeft(body[i+1:], " \t\r\n")
+
+		var batch json.RawMessage
+		if err := json.NewDecoder(bytes.NewReader(body)).Decode(&batch); err != nil {
+			return nil, fmt.Errorf("invalid long-polling response %s", err)
+		}
+		body = body[len(batch):]
+
+		var parsed []json.RawMessage
+		if err := json.Unmarshal(batch, &parsed); err != nil {
+			return nil, fmt.Errorf("invalid long-polling response %s", err)
+		}
+		msgs = append(msgs, parsed...)
+	}
+}
+
+// session adds the parameters identifying the session to params.
+func (lp *longPollConn) session(params _url.Values) _url.Values {
+	params.Set(lpIDParam, lp.id)
+	params.Set(lpPasswordParam, lp.pw)
+	return params
+}
+
+func (lp *longPollConn) get(params _url.Values) ([]byte, error) {
+	lp.mtx.Lock()
+	lp.serial++
+	params.Set(lpSerialParam, strconv.Itoa(lp.serial))
+	lp.mtx.Unlock()
+	params.Set("ns", lp.ns)
+
+	resp, err := lp.client.Get(lp.url + "?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("long-polling request failed with status %s", resp.Status)
+	}
+	return body, nil
+}
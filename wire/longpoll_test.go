@@ -0,0 +1,74 @@
+package wire
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego"
+)
+
+func TestClientLongPollFallback(t *testing.T) {
+	t.Parallel()
+	server := newFakeServer()
+	server.noWebsocket = true
+	defer server.Close()
+
+	c, err := Dial(server.URL, firego.TokenSourceFunc(func() (string, error) {
+		return "secret", nil
+	}))
+	require.NoError(t, err)
+	defer c.Close()
+	assert.Equal(t, TransportLongPoll, c.Transport())
+
+	events := make(chan Event, 10)
+	require.NoError(t, c.Watch("docs", events))
+	event := receive(t, events)
+	assert.Equal(t, "/", event.Path)
+	assert.Nil(t, event.Data)
+
+	// large enough to be sent in several segments
+	large := strings.Repeat("firego ", 1000)
+	require.NoError(t, c.Set("docs/1", large))
+
+	event = receive(t, events)
+	assert.Equal(t, "/1", event.Path)
+	assert.Equal(t, large, event.Data)
+
+	var v string
+	require.NoError(t, c.Value("docs/1", &v))
+	assert.Equal(t, large, v)
+}
+
+func TestDialTransportWebSocketOnly(t *testing.T) {
+	t.Parallel()
+	server := newFakeServer()
+	server.noWebsocket = true
+	defer server.Close()
+
+	_, err := DialTransport(server.URL, nil, TransportWebSocket)
+	assert.Error(t, err)
+
+	c, err := DialTransport(server.URL, nil, TransportAuto)
+	require.NoError(t, err)
+	defer c.Close()
+	assert.Equal(t, TransportLongPoll, c.Transport())
+}
+
+func TestParsePollResponse(t *testing.T) {
+	t.Parallel()
+	msgs, err := parsePollResponse([]byte(`pRTLPCB(1,[{"a":"x);"},{"b":1}]); pRTLPCB(2,[]);pRTLPCB(3, ["y"]);`))
+	require.NoError(t, err)
+	require.Len(t, msgs, 3)
+	assert.Equal(t, `{"a":"x);"}`, string(msgs[0]))
+	assert.Equal(t, `{"b":1}`, string(msgs[1]))
+	assert.Equal(t, `"y"`, string(msgs[2]))
+
+	msgs, err = parsePollResponse([]byte(`nothing here`))
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+
+	_, err = parsePollResponse([]byte(`pRTLPCB(1,[{]);`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,296 @@
+package wire
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	_url "net/url"
+	"strings"
+	"sync"
+)
+
+// websocket opcodes
+//
+// Reference https://tools.ietf.org/html/rfc6455#section-5.2
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxMessageSize bounds the size of a single websocket message.
+const maxMessageSize = 16 << 20
+
+// wsConn is a minimal websocket connection supporting
+// the subset of RFC 6455 needed by the Firebase protocol.
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	// client connections mask the frames they send
+	client bool
+
+	writeMtx sync.Mutex
+}
+
+// dialWebsocket opens a websocket connection to a ws:// or wss:// URL.
+func dialWebsocket(url string, dialer *net.Dialer) (*wsConn, error) {
+	u, err := _url.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "wss" {
+			host += ":443"
+		} else {
+			host += ":80"
+		}
+	}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = dialer.Dial("tcp", host)
+	case "wss":
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ws, err := handshake(conn, u)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+func handshake(conn net.Conn, u *_url.URL) (*wsConn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method:     "GET",
+		URL:        u,
+		Host:       u.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-Websocket-Key":     {key},
+			"Sec-Websocket-Version": {"13"},
+		},
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("websocket handshake failed with status %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-Websocket-Accept") != acceptKey(key) {
+		return nil, errors.New("websocket handshake returned an invalid accept key")
+	}
+	return &wsConn{conn: conn, br: br, client: true}, nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+websocketGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// WriteText sends a text message in a single frame.
+func (ws *wsConn) WriteText(msg []byte) error {
+	return ws.writeFrame(opText, msg)
+}
+
+// ReadText returns the next text message, answering pings along the way.
+// It returns io.EOF once the peer closes the connection.
+func (ws *wsConn) ReadText() ([]byte, error) {
+	var msg []byte
+	for {
+		fin, op, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case opPing:
+			if err := ws.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			ws.writeFrame(opClose, payload)
+			return nil, io.EOF
+		case opText, opBinary, opContinuation:
+			msg = append(msg, payload...)
+			if len(msg) > maxMessageSize {
+				return nil, errors.New("websocket message too large")
+			}
+		default:
+			return nil, fmt.Errorf("unknown websocket opcode %d", op)
+		}
+
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+// Close sends a close frame and closes the underlying connection.
+func (ws *wsConn) Close() error {
+	ws.writeFrame(opClose, nil)
+	return ws.conn.Close()
+}
+
+func (ws *wsConn) writeFrame(op byte, payload []byte) error {
+	header := make([]byte, 2, 14)
+	header[0] = 0x80 | op // FIN
+
+	var maskBit byte
+	if ws.client {
+		maskBit = 0x80
+	}
+
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = maskBit | byte(n)
+	case n <= 0xffff:
+		header[1] = maskBit | 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header[1] = maskBit | 127
+		header = append(header, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	if ws.client {
+		mask := make([]byte, 4)
+		if _, err := rand.Read(mask); err != nil {
+			return err
+		}
+		header = append(header, mask...)
+		masked := make([]byte, len(payload))
+		for i, b := range payload {
+			masked[i] = b ^ mask[i%4]
+		}
+		payload = masked
+	}
+
+	ws.writeMtx.Lock()
+	defer ws.writeMtx.Unlock()
+	_, err := ws.conn.Write(append(header, payload...))
+	return err
+}
+
+func (ws *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(ws.br, header[:]); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	op = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+
+	n := uint64(header[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(ws.br, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(ws.br, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxMessageSize {
+		err = errors.New("websocket frame too large")
+		return
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(ws.br, mask[:]); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(ws.br, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// websocketURL converts the URL of a Firebase database
+// into the URL of its websocket endpoint.
+func websocketURL(url string) (string, error) {
+	if !strings.Contains(url, "://") {
+		url = "https://" + url
+	}
+	u, err := _url.Parse(url)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "https", "wss":
+		u.Scheme = "wss"
+	case "http", "ws":
+		u.Scheme = "ws"
+	default:
+		return "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	q := u.Query()
+	q.Set("v", protocolVersion)
+	if q.Get("ns") == "" {
+		q.Set("ns", strings.Split(u.Hostname(), ".")[0])
+	}
+	u.Path = "/.ws"
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}